@@ -0,0 +1,121 @@
+package chape
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// APEv2 tags are read as a fallback for MP3 files without ID3v2 tags, as some rippers
+// write them instead. They're never written.
+// cf. https://wiki.hydrogenaud.io/index.php?title=APEv2_specification
+
+const (
+	apePreamble   = "APETAGEX"
+	apeFooterSize = 32
+	// apeItemTypeMask masks the item flags to the type, of which 0 is UTF-8 text
+	apeItemTypeMask = 0x6
+)
+
+// apeKeys maps the upper-cased APEv2 item keys to the Metadata fields of textFrameMappings.
+// Year and Comment are handled separately.
+var apeKeys = map[string]string{
+	"TITLE":        "Title",
+	"SUBTITLE":     "Subtitle",
+	"ARTIST":       "Artist",
+	"ALBUM":        "Album",
+	"ALBUM ARTIST": "AlbumArtist",
+	"ARTISTSORT":   "ArtistSort",
+	"ALBUMSORT":    "AlbumSort",
+	"TITLESORT":    "TitleSort",
+	"COMPOSER":     "Composer",
+	"GENRE":        "Genre",
+	"TRACK":        "Track",
+	"DISC":         "Disc",
+	"PUBLISHER":    "Publisher",
+	"COPYRIGHT":    "Copyright",
+	"ISRC":         "ISRC",
+	"MEDIA":        "MediaType",
+	"LANGUAGE":     "Language",
+}
+
+// readAPEItems reads the text items of the APEv2 tag at the end of r, preceding an ID3v1
+// tag if any. Keys are upper-cased, as they're case-insensitive. It returns nil for no
+// or malformed tags.
+func readAPEItems(r io.ReadSeeker) (map[string]string, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	end := size
+	if size >= 128 {
+		id3v1 := make([]byte, 3)
+		if err := readAt(r, id3v1, size-128); err != nil {
+			return nil, err
+		}
+		if string(id3v1) == "TAG" {
+			end -= 128
+		}
+	}
+	if end < apeFooterSize {
+		return nil, nil
+	}
+	footer := make([]byte, apeFooterSize)
+	if err := readAt(r, footer, end-apeFooterSize); err != nil {
+		return nil, err
+	}
+	if string(footer[:8]) != apePreamble {
+		return nil, nil
+	}
+	// The tag size includes the footer and the items, but not the header
+	tagSize := int64(binary.LittleEndian.Uint32(footer[12:16]))
+	count := int(binary.LittleEndian.Uint32(footer[16:20]))
+	if tagSize < apeFooterSize || tagSize > end {
+		return nil, nil
+	}
+	body := make([]byte, tagSize-apeFooterSize)
+	if err := readAt(r, body, end-tagSize); err != nil {
+		return nil, err
+	}
+
+	items := map[string]string{}
+	for range count {
+		// Value size, flags, NUL-terminated key and value
+		if len(body) < 9 {
+			break
+		}
+		valueSize := int(binary.LittleEndian.Uint32(body))
+		flags := binary.LittleEndian.Uint32(body[4:])
+		key, rest, ok := bytes.Cut(body[8:], []byte{0})
+		if !ok || valueSize > len(rest) {
+			break
+		}
+		if flags&apeItemTypeMask == 0 {
+			items[strings.ToUpper(string(key))] = string(rest[:valueSize])
+		}
+		body = rest[valueSize:]
+	}
+	return items, nil
+}
+
+// apeMetadata builds Metadata from the APEv2 items
+func apeMetadata(items map[string]string) *Metadata {
+	metadata := &Metadata{}
+	for _, mapping := range textFrameMappings {
+		for key, fieldName := range apeKeys {
+			// Multiple values are separated by NUL as in ID3v2.4
+			if fieldName == mapping.fieldName && items[key] != "" {
+				mapping.setValue(metadata, items[key])
+			}
+		}
+	}
+	if year := items["YEAR"]; year != "" {
+		var ts Timestamp
+		if err := ts.UnmarshalYAML([]byte(year)); err == nil {
+			metadata.Date = &ts
+		}
+	}
+	metadata.Comment = items["COMMENT"]
+	return metadata
+}
@@ -0,0 +1,104 @@
+package chape
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildAPETag builds an APEv2 tag of text items without the header
+func buildAPETag(items [][2]string) []byte {
+	var body bytes.Buffer
+	for _, item := range items {
+		binary.Write(&body, binary.LittleEndian, uint32(len(item[1])))
+		binary.Write(&body, binary.LittleEndian, uint32(0))
+		body.WriteString(item[0] + "\x00" + item[1])
+	}
+	footer := make([]byte, apeFooterSize)
+	copy(footer, apePreamble)
+	binary.LittleEndian.PutUint32(footer[8:], 2000)
+	binary.LittleEndian.PutUint32(footer[12:], uint32(body.Len()+apeFooterSize))
+	binary.LittleEndian.PutUint32(footer[16:], uint32(len(items)))
+	return append(body.Bytes(), footer...)
+}
+
+func TestReadAPETag(t *testing.T) {
+	tag := buildAPETag([][2]string{
+		{"Title", "Episode"},
+		{"Artist", "Alice\x00Bob"},
+		{"Album", "Album"},
+		{"Track", "3/10"},
+		{"Genre", "Podcast"},
+		{"Year", "2024"},
+		{"Comment", "Ripped"},
+	})
+	id3v1 := append([]byte("TAG"), make([]byte, 125)...)
+
+	tests := []struct {
+		name    string
+		trailer []byte
+	}{
+		{"APEv2", tag},
+		{"APEv2 followed by ID3v1", append(bytes.Clone(tag), id3v1...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mp3Path := createDummyMP3(t, time.Second)
+			f, err := os.OpenFile(mp3Path, os.O_APPEND|os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Write(tt.trailer)
+			f.Close()
+
+			metadata, err := New(mp3Path).Metadata()
+			if err != nil {
+				t.Fatalf("Metadata failed: %v", err)
+			}
+			if metadata.Title != "Episode" || metadata.Album != "Album" || metadata.Comment != "Ripped" {
+				t.Errorf("unexpected metadata: %+v", metadata)
+			}
+			if want := (Values{"Alice", "Bob"}); !reflect.DeepEqual(metadata.Artist, want) {
+				t.Errorf("artist = %v, want %v", metadata.Artist, want)
+			}
+			if metadata.Track == nil || *metadata.Track != (NumberInSet{Current: 3, Total: 10}) {
+				t.Errorf("track = %v, want 3/10", metadata.Track)
+			}
+			if got := metadata.Date.String(); got != "2024" {
+				t.Errorf("date = %q, want 2024", got)
+			}
+			if len(metadata.Genre) != 1 || metadata.Genre[0] != "Podcast" {
+				t.Errorf("genre = %v", metadata.Genre)
+			}
+
+			// ID3v2 written on apply takes precedence
+			if err := New(mp3Path).Apply(strings.NewReader("title: New\n"), true); err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+			metadata, err = New(mp3Path).Metadata()
+			if err != nil {
+				t.Fatalf("Metadata failed: %v", err)
+			}
+			if metadata.Title != "New" || metadata.Album != "" {
+				t.Errorf("unexpected metadata after apply: %+v", metadata)
+			}
+		})
+	}
+}
+
+func TestReadAPETagMalformed(t *testing.T) {
+	tag := buildAPETag([][2]string{{"Title", "Episode"}})
+	// The tag size exceeds the file
+	binary.LittleEndian.PutUint32(tag[len(tag)-apeFooterSize+12:], 1<<20)
+	items, err := readAPEItems(bytes.NewReader(tag))
+	if err != nil {
+		t.Fatalf("readAPEItems failed: %v", err)
+	}
+	if items != nil {
+		t.Errorf("items = %v, want nil", items)
+	}
+}
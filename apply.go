@@ -1,309 +1,646 @@
 package chape
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"math"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Songmu/prompter"
-	"github.com/bogem/id3v2/v2"
 	"github.com/goccy/go-yaml"
 	"github.com/sergi/go-diff/diffmatchpatch"
-	"github.com/tcolgate/mp3"
+	"golang.org/x/term"
 )
 
-func (c *Chape) Apply(input io.Reader, yes bool) error {
-	var newMetadata Metadata
-	if err := yaml.NewDecoder(input).Decode(&newMetadata); err != nil {
-		return fmt.Errorf("failed to decode YAML: %w", err)
-	}
+// Apply reads metadata from input and writes it to the audio file.
+// The format of input defaults to YAML when not specified.
+func (c *Chape) Apply(input io.Reader, yes bool, format ...Format) error {
+	return c.ApplyContext(context.Background(), input, yes, format...)
+}
 
-	// Get current metadata from MP3 file
-	currentMetadata, err := c.getMetadata()
+// ApplyContext is like Apply, but ctx cancels downloading artwork.
+func (c *Chape) ApplyContext(ctx context.Context, input io.Reader, yes bool, format ...Format) error {
+	newMetadata, err := c.readInput(input, format...)
 	if err != nil {
-		return fmt.Errorf("failed to read current metadata: %w", err)
+		return err
 	}
 
-	// Normalize both metadata by marshaling them to YAML
-	currentYAMLData, err := yaml.Marshal(currentMetadata)
+	// Check if input is os.Stdin (when called from pipe/redirect)
+	// Type assertion to check if input is *os.File and if it's stdin
+	file, ok := input.(*os.File)
+	return c.write(ctx, newMetadata, yes, ok && file == os.Stdin)
+}
+
+// readInput reads metadata to apply from input in the format, YAML by default
+func (c *Chape) readInput(input io.Reader, format ...Format) (*Metadata, error) {
+	f := FormatYAML
+	if len(format) > 0 && format[0] != "" {
+		f = format[0]
+	}
+	newMetadata, nulls, err := c.decodeMetadata(input, f)
 	if err != nil {
-		return fmt.Errorf("failed to marshal current metadata: %w", err)
+		return nil, err
+	}
+	if f == FormatFFMetadata {
+		// ffmetadata can't hold artwork, so keep the current one
+		currentMetadata, err := c.Metadata()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read current metadata: %w", err)
+		}
+		newMetadata.Artwork = currentMetadata.Artwork
 	}
+	return c.mergeInput(newMetadata, nulls...)
+}
 
-	normalizedNewYAMLData, err := yaml.Marshal(&newMetadata)
-	if err != nil {
-		return fmt.Errorf("failed to marshal new metadata: %w", err)
+// decodeMetadata decodes metadata from input in the format, and sets the synchronised
+// lyrics from LyricsFrom, the chapters from ChaptersFrom and the empty chapter titles from
+// ChapterTemplate if specified. With Merge, it also returns the fields given as null in
+// the YAML input, which are cleared on merging.
+func (c *Chape) decodeMetadata(input io.Reader, f Format) (*Metadata, []string, error) {
+	var (
+		newMetadata *Metadata
+		nulls       []string
+	)
+	switch f {
+	case FormatYAML:
+		if c.Merge {
+			b, err := io.ReadAll(input)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read input: %w", err)
+			}
+			if nulls, err = yamlNullFields(b); err != nil {
+				return nil, nil, fmt.Errorf("failed to decode YAML: %w", err)
+			}
+			input = bytes.NewReader(b)
+		}
+		newMetadata = &Metadata{}
+		if err := yaml.NewDecoder(input).Decode(newMetadata); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode YAML: %w", err)
+		}
+	case FormatTOML:
+		m, err := decodeTOML(input)
+		if err != nil {
+			return nil, nil, err
+		}
+		newMetadata = m
+	case FormatFFMetadata:
+		m, err := parseFFMetadata(input)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse ffmetadata: %w", err)
+		}
+		newMetadata = m
+	default:
+		return nil, nil, fmt.Errorf("unsupported format %q", f)
+	}
+	if c.LyricsFrom != "" {
+		lines, err := readLRCFile(c.LyricsFrom)
+		if err != nil {
+			return nil, nil, err
+		}
+		newMetadata.SyncedLyrics = lines
+	}
+	if c.ChaptersFrom != "" {
+		chapters, err := readChaptersFile(c.ChaptersFrom)
+		if err != nil {
+			return nil, nil, err
+		}
+		newMetadata.Chapters = chapters
+	}
+	if c.ChapterTemplate != "" {
+		if err := fillChapterTitles(newMetadata.Chapters, c.ChapterTemplate); err != nil {
+			return nil, nil, err
+		}
 	}
+	return newMetadata, nulls, nil
+}
 
-	currentYAML := string(currentYAMLData)
-	newYAML := string(normalizedNewYAMLData)
+// Write writes the metadata to the audio file. Unless yes is true, it shows the diff
+// from the current metadata and asks for confirmation before writing.
+func (c *Chape) Write(newMetadata *Metadata, yes bool) error {
+	return c.WriteContext(context.Background(), newMetadata, yes)
+}
+
+// WriteContext is like Write, but ctx cancels downloading artwork.
+func (c *Chape) WriteContext(ctx context.Context, newMetadata *Metadata, yes bool) error {
+	return c.write(ctx, newMetadata, yes, false)
+}
+
+func (c *Chape) write(ctx context.Context, newMetadata *Metadata, yes, fromStdin bool) error {
+	if c.reader != nil && !c.DryRun {
+		return ErrReadOnly
+	}
+	newMetadata, err := c.prepareMetadata(newMetadata)
+	if err != nil {
+		return err
+	}
+	currentMetadata, newMetadata, currentYAML, newYAML, err := c.compareMetadata(newMetadata)
+	if err != nil {
+		return err
+	}
 
-	if currentYAML == newYAML {
-		log.Println("No changes to apply.")
+	// Empty frames don't appear in metadata, so they're reported apart from the diff
+	pruned, err := c.emptyFrameIDs()
+	if err != nil {
+		return err
+	}
+	// Nor does the ID3v1 tag
+	id3v1Pending, err := c.id3v1Pending(newMetadata)
+	if err != nil {
+		return err
+	}
+	// Nor does the tag version
+	fromVersion, err := c.versionPending()
+	if err != nil {
+		return err
+	}
+	// Stripping removes frames that don't appear in metadata, so it always writes
+	if metadataEqual(currentMetadata, newMetadata) && !c.strip && len(pruned) == 0 && !id3v1Pending &&
+		fromVersion == 0 {
+		c.logf("No changes to apply.")
 		return nil
 	}
-	if !yes {
+	if len(pruned) > 0 {
+		c.logf("Empty frames to prune: %s", strings.Join(pruned, ", "))
+	}
+	if id3v1Pending {
+		c.logf("ID3v1 tag to %s", c.ID3v1)
+	}
+	if fromVersion != 0 {
+		c.logf("ID3v2.%d tag to convert to ID3v2.%d", fromVersion, c.ID3Version)
+	}
+	if !yes && !c.DryRun && assumeYes() {
+		yes = true
+	}
+	// A chapter past the end is likely a typo, so it's only written when confirmed upfront.
+	// Without the duration, the chapters are written as the taggers do.
+	if len(newMetadata.Chapters) > 0 {
+		if audioDuration, err := c.getAudioDuration(); err == nil {
+			if err := checkChapterStarts(newMetadata.Chapters, audioDuration); err != nil {
+				if !yes {
+					return err
+				}
+				log.Printf("Warning: %v", err)
+			}
+		}
+	}
+	if !yes || c.DryRun {
 		// Compare and show diff if different
-		diff := generateDiff(currentYAML, newYAML)
+		diff := generateDiff(currentYAML, newYAML, colorEnabled(log.Writer()))
 		log.Printf("The following changes will be applied:\n%s\n", diff)
-		// Check if input is os.Stdin (when called from pipe/redirect)
-		// Type assertion to check if input is *os.File and if it's stdin
-		if file, ok := input.(*os.File); ok && file == os.Stdin {
-			// Input is from stdin (e.g., chape apply < file.yaml)
-			// Need to reopen terminal for user interaction
-
-			// Use /dev/tty on Unix-like systems, CON on Windows
-			consoleDevice := "/dev/tty"
-			if runtime.GOOS == "windows" {
-				consoleDevice = "CON"
-			}
-
-			tty, err := os.OpenFile(consoleDevice, os.O_RDWR, 0)
-			if err != nil {
-				return fmt.Errorf("failed to open %s: %w", consoleDevice, err)
-			}
-			defer tty.Close()
-
-			// Temporarily replace stdin with tty
-			oldStdin := os.Stdin
-			os.Stdin = tty
-			defer func() { os.Stdin = oldStdin }()
+		if c.DryRun {
+			c.logf("Dry run: changes not applied.")
+			return nil
+		}
+		ok, err := c.confirm(fromStdin)
+		if err != nil {
+			return err
 		}
-		if !prompter.YN("Apply these changes?", true) {
-			log.Println("Changes not applied.")
+		if !ok {
+			c.logf("Changes not applied.")
 			return nil
 		}
 	}
-	// Apply changes to MP3 file
-	err = c.writeMetadata(&newMetadata)
-	if err != nil {
+	// Apply changes to audio file. The artwork already embedded isn't subject to
+	// MaxArtworkSize, so that editing the other fields doesn't fail.
+	wc := c
+	if newMetadata.Artwork.Src != "" && newMetadata.Artwork.Src == currentMetadata.Artwork.Src {
+		unlimited := *c
+		unlimited.MaxArtworkSize = -1
+		wc = &unlimited
+	}
+	// The embedded picture is kept rather than fetched again when the source is unchanged
+	if c.KeepArtwork && newMetadata.Artwork.Src != "" && newMetadata.Artwork.Src == currentMetadata.Artwork.Src &&
+		artworkSource(newMetadata.Artwork.Src) != "" {
+		t, err := c.tagger()
+		if err != nil {
+			return err
+		}
+		embedded, err := t.embeddedArtwork()
+		if err != nil {
+			return fmt.Errorf("failed to get embedded artwork: %w", err)
+		}
+		if embedded != "" {
+			m := *newMetadata
+			m.Artwork.Src = embedded
+			newMetadata = &m
+		}
+	}
+	if err := c.withBackup(func() error { return wc.writeMetadata(ctx, newMetadata) }); err != nil {
 		return fmt.Errorf("failed to write metadata: %w", err)
 	}
 
-	log.Println("Metadata updated successfully.")
+	c.logf("Metadata updated successfully.")
 	return nil
 }
 
-// generateDiff creates a human-readable diff between old and new YAML
-func generateDiff(oldYAML, newYAML string) string {
-	dmp := diffmatchpatch.New()
-	diffs := dmp.DiffMain(oldYAML, newYAML, false)
-	return dmp.DiffPrettyText(diffs)
+// logf logs the informational message unless Quiet is set. Warnings, errors and the messages
+// asked for, e.g. the diff of DryRun, are logged with log directly.
+func (c *Chape) logf(format string, args ...any) {
+	if !c.Quiet {
+		log.Printf(format, args...)
+	}
 }
 
-// writeMetadata writes metadata to the MP3 file
-func (c *Chape) writeMetadata(metadata *Metadata) error {
-	// Get audio duration for chapter end times
-	audioDuration, err := c.getAudioDuration()
-	if err != nil {
-		return fmt.Errorf("failed to get audio duration: %w", err)
-	}
+// assumeYes reports whether CHAPE_YES is set to true, which applies changes without
+// confirmation as -y does
+func assumeYes() bool {
+	yes, _ := strconv.ParseBool(os.Getenv("CHAPE_YES"))
+	return yes
+}
 
-	// Open the MP3 file for writing
-	id3tag, err := id3v2.Open(c.audio, id3v2.Options{Parse: true})
+// confirm asks whether to apply the changes. When the input is stdin or the output is
+// redirected, e.g. "chape apply f.mp3 < meta.yaml > log", it asks on the terminal device.
+// It returns ErrNoTerminal rather than the default answer when there's no terminal to ask on.
+func (c *Chape) confirm(fromStdin bool) (bool, error) {
+	if !fromStdin && term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd())) {
+		return prompter.YN("Apply these changes?", true), nil
+	}
+	if c.NoPromptReopen {
+		return false, ErrNoTerminal
+	}
+	device := consoleDevice()
+	tty, err := os.OpenFile(device, os.O_RDWR, 0)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
-	}
-	defer id3tag.Close()
-
-	// Set version and encoding
-	id3tag.SetVersion(4)
-	id3tag.SetDefaultEncoding(id3v2.EncodingUTF8)
-
-	// Apply all text frames using the centralized mapping
-	applyTextFrames(id3tag, metadata)
-
-	// Set date using TDRC tag (ID3v2.4) and Year for compatibility
-	id3tag.DeleteFrames("TDRC")
-	id3tag.DeleteFrames("TYER") // Also delete legacy year frame
-	if metadata.Date != nil && !metadata.Date.Time.IsZero() {
-		// Set Year for ID3v2.3 compatibility. It should be performed before add TDRC
-		yearStr := metadata.Date.Time.Format("2006")
-		id3tag.SetYear(yearStr)
-
-		dateStr := metadata.Date.String()
-		id3tag.AddTextFrame("TDRC", id3v2.EncodingUTF8, dateStr)
-	}
-
-	// Set comment
-	id3tag.DeleteFrames(id3tag.CommonID("Comments"))
-	if metadata.Comment != "" {
-		id3tag.AddCommentFrame(id3v2.CommentFrame{
-			Encoding:    id3v2.EncodingUTF8,
-			Language:    metadata.getLanguageForFrames(),
-			Description: "",
-			Text:        metadata.Comment,
-		})
-	}
-
-	// Set lyrics
-	// First, delete existing lyrics frames
-	id3tag.DeleteFrames("USLT") // Unsynchronised lyrics/text transcription
-	if metadata.Lyrics != "" {
-		id3tag.AddUnsynchronisedLyricsFrame(id3v2.UnsynchronisedLyricsFrame{
-			Encoding: id3v2.EncodingUTF8,
-			Language: metadata.getLanguageForFrames(),
-			Lyrics:   metadata.Lyrics,
-		})
-	}
-
-	// Set artwork
-	if metadata.Artwork != "" {
-		pictureData, mimeType, err := parseArtwork(metadata.Artwork)
-		if err != nil {
-			return fmt.Errorf("failed to parse artwork: %w", err)
-		}
+		return false, fmt.Errorf("%w (failed to open %s: %v)", ErrNoTerminal, device, err)
+	}
+	defer tty.Close()
+	return promptYN(tty, "Apply these changes?", true)
+}
 
-		if len(pictureData) > 0 {
-			// Delete existing picture frames
-			id3tag.DeleteFrames("APIC")
+// consoleDevice returns the terminal device: /dev/tty on Unix-like systems, CON on Windows
+func consoleDevice() string {
+	if runtime.GOOS == "windows" {
+		return "CON"
+	}
+	return "/dev/tty"
+}
 
-			pictureFrame := id3v2.PictureFrame{
-				Encoding:    id3v2.EncodingUTF8,
-				MimeType:    mimeType,
-				PictureType: id3v2.PTFrontCover,
-				Description: "",
-				Picture:     pictureData,
-			}
-			id3tag.AddAttachedPicture(pictureFrame)
-
-			// Store artwork source in TXXX frame
-			// Skip data URIs as they don't need source tracking
-			if !strings.HasPrefix(metadata.Artwork, "data:") {
-				txxxFrames := id3tag.GetFrames("TXXX")
-				var preservedFrames []id3v2.UserDefinedTextFrame
-				// Collect all non-CHAPE_SOURCE TXXX frames
-				for _, frame := range txxxFrames {
-					if udtf, ok := frame.(id3v2.UserDefinedTextFrame); ok {
-						if udtf.Description != "CHAPE_SOURCE" {
-							preservedFrames = append(preservedFrames, udtf)
-						}
-					}
-				}
-				// Clear all TXXX frames and re-add preserved ones
-				id3tag.DeleteFrames("TXXX")
-				for _, frame := range preservedFrames {
-					id3tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
-						Encoding:    frame.Encoding,
-						Description: frame.Description,
-						Value:       frame.Value,
-					})
-				}
-				// Add new CHAPE_SOURCE frame
-				id3tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
-					Encoding:    id3v2.EncodingUTF8,
-					Description: "CHAPE_SOURCE",
-					Value:       metadata.Artwork,
-				})
-			}
+// promptYN asks the yes/no question on the terminal as prompter.YN does on stdin and stdout
+func promptYN(tty io.ReadWriter, message string, defaultYes bool) (bool, error) {
+	defaultChoice := "n"
+	if defaultYes {
+		defaultChoice = "y"
+	}
+	r := bufio.NewReader(tty)
+	for {
+		fmt.Fprintf(tty, "%s (y/n) [%s]: ", message, defaultChoice)
+		line, err := r.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return false, fmt.Errorf("failed to read the answer: %w", err)
 		}
+		switch answer := strings.ToLower(strings.TrimSpace(line)); answer {
+		case "":
+			return defaultYes, nil
+		case "y", "n":
+			return answer == "y", nil
+		}
+		fmt.Fprintln(tty, "# Enter `y` or `n`")
 	}
+}
 
-	// Set chapters
-	// First, delete existing chapter frames
-	id3tag.DeleteFrames("CHAP")
-
-	for i, chapter := range metadata.Chapters {
-		// Create proper chapter frame
-		startTime := chapter.Start
-		var endTime time.Duration
-
-		// Set end time to next chapter's start time or audio duration for last chapter
-		if i+1 < len(metadata.Chapters) {
-			endTime = metadata.Chapters[i+1].Start
-		} else {
-			endTime = audioDuration // Use actual audio duration for last chapter
+// withBackup calls write, backing up the audio file before it and restoring the file
+// from the backup if it fails when Backup is set
+func (c *Chape) withBackup(write func() error) error {
+	if !c.Backup {
+		return write()
+	}
+	backupPath, err := backupFile(c.audio)
+	if err != nil {
+		return fmt.Errorf("failed to back up %s: %w", c.audio, err)
+	}
+	c.logf("Backed up the original file to %s", backupPath)
+	if err := write(); err != nil {
+		if rerr := restoreBackup(backupPath, c.audio); rerr != nil {
+			return fmt.Errorf("%w (and failed to restore from %s: %v)", err, backupPath, rerr)
 		}
+		log.Printf("Restored the original file from %s", backupPath)
+		return err
+	}
+	return nil
+}
 
-		chapterFrame := id3v2.ChapterFrame{
-			ElementID: fmt.Sprintf("chp%d", i),
-			StartTime: startTime,
-			EndTime:   endTime,
-			// If these bytes are all set to 0xFF then the value should be ignored and
-			// the start/end time value should be utilized.
-			// cf. https://id3.org/id3v2-chapters-1.0
-			StartOffset: math.MaxUint32,
-			EndOffset:   math.MaxUint32,
-			Title: &id3v2.TextFrame{
-				Encoding: id3v2.EncodingUTF8,
-				Text:     chapter.Title,
-			},
-			Description: &id3v2.TextFrame{
-				Encoding: id3v2.EncodingUTF8,
-				Text:     "",
-			},
+// prepareMetadata validates newMetadata and returns it as written: with the frame language
+// option applied, the texts normalized and the chapters sorted if SortChapters is set.
+// newMetadata isn't modified.
+func (c *Chape) prepareMetadata(newMetadata *Metadata) (*Metadata, error) {
+	if c.FrameLanguage != "" || newMetadata.FrameLanguage != "" {
+		m := *newMetadata
+		m.FrameLanguage = cmp.Or(c.FrameLanguage, m.FrameLanguage)
+		if err := validateLanguageCode(m.FrameLanguage); err != nil {
+			return nil, fmt.Errorf("invalid frame language: %w", err)
+		}
+		// The language derived from TLAN is omitted as readMetadata does
+		if m.FrameLanguage == m.defaultFrameLanguage() {
+			m.FrameLanguage = ""
+		}
+		newMetadata = &m
+	}
+	if newMetadata.Rating < 0 || newMetadata.Rating > 255 {
+		return nil, fmt.Errorf("invalid rating %d: must be between 0 and 255", newMetadata.Rating)
+	}
+	// Legacy ISRCs are often malformed, so they're written as is
+	if isrc := newMetadata.ISRC; isrc != "" && !isValidISRC(isrc) {
+		log.Printf("Warning: ISRC %q doesn't look like 12 alphanumerics", isrc)
+	}
+	if key := newMetadata.InitialKey; key != "" && !isValidInitialKey(key) {
+		log.Printf("Warning: initial key %q doesn't look like a musical key such as \"Abm\"", key)
+	}
+	for _, comment := range newMetadata.Comments {
+		if comment.Language == "" {
+			continue
 		}
+		if err := validateLanguageCode(comment.Language); err != nil {
+			return nil, fmt.Errorf("invalid language of comment %q: %w", comment.Description, err)
+		}
+	}
 
-		id3tag.AddChapterFrame(chapterFrame)
+	// Line endings of the texts are normalized, so that a dump, edit and apply cycle is stable
+	// even with CRLF pasted from Windows tools
+	m := *newMetadata
+	m.Comment = normalizeText(m.Comment)
+	m.Lyrics = normalizeText(m.Lyrics)
+	if c.StampEncoder && strings.TrimSpace(m.EncoderSettings) == "" {
+		m.EncoderSettings = encoderStamp()
 	}
+	if m.Comments != nil {
+		m.Comments = make([]*Comment, len(newMetadata.Comments))
+		for i, comment := range newMetadata.Comments {
+			cm := *comment
+			cm.Text = normalizeText(cm.Text)
+			m.Comments[i] = &cm
+		}
+	}
+	newMetadata = &m
 
-	// Save changes
-	err = id3tag.Save()
-	if err != nil {
-		return fmt.Errorf("failed to save metadata: %w", err)
+	if c.SortChapters && !slices.IsSortedFunc(newMetadata.Chapters, compareChapterStart) {
+		m := *newMetadata
+		m.Chapters = slices.Clone(m.Chapters)
+		slices.SortStableFunc(m.Chapters, compareChapterStart)
+		newMetadata = &m
+	}
+	if err := checkChapterOrder(newMetadata.Chapters, c.AllowDuplicateChapterStarts); err != nil {
+		return nil, err
 	}
+	return newMetadata, nil
+}
 
-	return nil
+// normalizeText converts the line endings of s to LF and trims the trailing spaces of each line.
+// Blank lines are kept as they are.
+func normalizeText(s string) string {
+	if !strings.ContainsAny(s, "\r \t") {
+		return s
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.Join(lines, "\n")
 }
 
-// getAudioDuration calculates the actual duration of the MP3 file
-func (c *Chape) getAudioDuration() (time.Duration, error) {
-	file, err := os.Open(c.audio)
+// compareMetadata reads the current metadata of the audio file, and returns it, newMetadata
+// as written and both of them normalized by marshaling them to YAML. The artwork of the
+// unchanged source without the picture type and description keeps the current ones, as
+// the taggers do, so that it doesn't show up as a change. Likewise the unchanged comment of
+// MP3 files keeps the language of its frame when the language field changes.
+func (c *Chape) compareMetadata(newMetadata *Metadata) (currentMetadata, written *Metadata, currentYAML, newYAML string, err error) {
+	currentMetadata, err = c.Metadata()
 	if err != nil {
-		return 0, fmt.Errorf("failed to open file: %w", err)
+		return nil, nil, "", "", fmt.Errorf("failed to read current metadata: %w", err)
+	}
+	if ext, _ := c.audioExt(); ext == ".mp3" && c.FrameLanguage == "" && newMetadata.FrameLanguage == "" &&
+		newMetadata.Comment != "" && newMetadata.Comment == currentMetadata.Comment {
+		if lang := currentMetadata.getLanguageForFrames(); lang != newMetadata.defaultFrameLanguage() {
+			m := *newMetadata
+			m.FrameLanguage = lang
+			newMetadata = &m
+		}
+	}
+	if aw := newMetadata.Artwork; !aw.explicit() && aw.Src != "" && aw.Src == currentMetadata.Artwork.Src {
+		m := *newMetadata
+		m.Artwork = currentMetadata.Artwork
+		newMetadata = &m
 	}
-	defer file.Close()
+	currentYAMLData, err := yaml.Marshal(currentMetadata)
+	if err != nil {
+		return nil, nil, "", "", fmt.Errorf("failed to marshal current metadata: %w", err)
+	}
+	newYAMLData, err := yaml.Marshal(newMetadata)
+	if err != nil {
+		return nil, nil, "", "", fmt.Errorf("failed to marshal new metadata: %w", err)
+	}
+	return currentMetadata, newMetadata, string(currentYAMLData), string(newYAMLData), nil
+}
 
-	return readMP3Duration(file)
+// metadataEqual reports whether a and b are the same metadata, ignoring the differences
+// that don't change what's written: the order of chapters, nil and zero numbers, nil and
+// empty lists, the time zone of the date, times finer than milliseconds and the explicit
+// front cover type
+func metadataEqual(a, b *Metadata) bool {
+	return reflect.DeepEqual(comparableMetadata(a), comparableMetadata(b))
 }
 
-// readMP3Duration calculates the duration of MP3 file by decoding frames
-func readMP3Duration(r io.ReadSeeker) (time.Duration, error) {
-	var (
-		t       time.Duration
-		f       mp3.Frame
-		skipped int
-		d       = mp3.NewDecoder(r)
-	)
+// comparableMetadata returns the normalized copy of m for metadataEqual
+func comparableMetadata(m *Metadata) any {
+	c := *m
+	// The dates are compared in their written form, which is in UTC and of the precision
+	date, originalDate := "", ""
+	if c.Date != nil {
+		date = c.Date.String()
+	}
+	if c.OriginalDate != nil {
+		originalDate = c.OriginalDate.String()
+	}
+	c.Date, c.OriginalDate = nil, nil
+	for _, n := range []**NumberInSet{&c.Track, &c.Disc, &c.MovementNumber} {
+		if *n != nil && (*n).Current == 0 {
+			*n = nil
+		}
+	}
+	// "front" is the default picture type, which is read as empty
+	if c.Artwork.Type == pictureTypeNames[pictureTypeFront] {
+		c.Artwork.Type = ""
+	}
+	c.Chapters = nil
+	for _, ch := range m.Chapters {
+		cc := *ch
+		cc.Start = cc.Start.Truncate(time.Millisecond)
+		cc.End = max(cc.End.Truncate(time.Millisecond), 0)
+		c.Chapters = append(c.Chapters, &cc)
+	}
+	slices.SortStableFunc(c.Chapters, compareChapterStart)
+	c.SyncedLyrics = nil
+	for _, l := range m.SyncedLyrics {
+		c.SyncedLyrics = append(c.SyncedLyrics, &SyncedLyric{Time: l.Time.Truncate(time.Millisecond), Text: l.Text})
+	}
+	if len(c.Artist) == 0 {
+		c.Artist = nil
+	}
+	if len(c.Genre) == 0 {
+		c.Genre = nil
+	}
+	if len(c.Composer) == 0 {
+		c.Composer = nil
+	}
+	if len(c.Lyricist) == 0 {
+		c.Lyricist = nil
+	}
+	if len(c.OriginalArtist) == 0 {
+		c.OriginalArtist = nil
+	}
+	if len(c.OriginalLyricist) == 0 {
+		c.OriginalLyricist = nil
+	}
+	if len(c.Keywords) == 0 {
+		c.Keywords = nil
+	}
+	if len(c.Comments) == 0 {
+		c.Comments = nil
+	}
+	if len(c.Custom) == 0 {
+		c.Custom = nil
+	}
+	if len(c.URLs) == 0 {
+		c.URLs = nil
+	}
+	return struct {
+		Metadata
+		Date, OriginalDate string
+	}{c, date, originalDate}
+}
 
-	for {
-		if err := d.Decode(&f, &skipped); err != nil {
-			if err == io.EOF {
-				break
+// ANSI escape sequences to color the diff
+const (
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiReset = "\x1b[0m"
+)
+
+// generateDiff creates a human-readable diff between old and new YAML. Changed lines are
+// shown whole, prefixed with "-" and "+", and colored red and green with color.
+func generateDiff(oldYAML, newYAML string, color bool) string {
+	dmp := diffmatchpatch.New()
+	oldChars, newChars, lines := dmp.DiffLinesToChars(oldYAML, newYAML)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(oldChars, newChars, false), lines)
+	var sb strings.Builder
+	for _, d := range diffs {
+		prefix, ansi := "  ", ""
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			prefix, ansi = "- ", ansiRed
+		case diffmatchpatch.DiffInsert:
+			prefix, ansi = "+ ", ansiGreen
+		}
+		for line := range strings.Lines(d.Text) {
+			if color && ansi != "" {
+				line, nl := strings.CutSuffix(line, "\n")
+				sb.WriteString(ansi + prefix + line + ansiReset)
+				if nl {
+					sb.WriteString("\n")
+				}
+				continue
 			}
-			return 0, err
+			sb.WriteString(prefix + line)
 		}
-		t = t + f.Duration()
 	}
+	return sb.String()
+}
+
+// colorEnabled reports whether the output written to w should be colored: w is a terminal
+// and the NO_COLOR environment variable isn't set.
+// cf. https://no-color.org/
+func colorEnabled(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// writeMetadata writes metadata to the audio file, downloading artwork within DownloadTimeout
+func (c *Chape) writeMetadata(ctx context.Context, metadata *Metadata) error {
+	t, err := c.tagger()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.downloadContext(ctx)
+	defer cancel()
+	return c.fileError(t.writeMetadata(ctx, metadata))
+}
 
-	return t, nil
+// getAudioDuration calculates the actual duration of the audio file
+func (c *Chape) getAudioDuration() (time.Duration, error) {
+	t, err := c.tagger()
+	if err != nil {
+		return 0, err
+	}
+	return t.duration()
 }
 
 // parseArtwork parses artwork string (data URI, HTTP/HTTPS URL, or file path) and returns picture data and MIME type
-func parseArtwork(artwork string) ([]byte, string, error) {
+// retries is the number of retries of the download from the URL.
+func parseArtwork(ctx context.Context, artwork string, retries int) ([]byte, string, error) {
 	if strings.HasPrefix(artwork, "data:") {
 		// Parse data URI
 		return parseDataURI(artwork)
 	} else if strings.HasPrefix(artwork, "http://") || strings.HasPrefix(artwork, "https://") {
 		// Download from HTTP/HTTPS URL
-		return parseHTTPURL(artwork)
+		return parseHTTPURL(ctx, artwork, retries)
 	} else {
 		// Treat as file path
 		return parseFilePath(artwork)
 	}
 }
 
-// parseDataURI parses data URI and returns picture data and MIME type
+// checkArtworkSize returns an error if the artwork exceeds maxSize bytes. Zero means no limit.
+func checkArtworkSize(pictureData []byte, maxSize int) error {
+	if maxSize > 0 && len(pictureData) > maxSize {
+		return fmt.Errorf("artwork is too large: %s (%d bytes) exceeds the limit of %s (%d bytes)",
+			formatByteSize(len(pictureData)), len(pictureData), formatByteSize(maxSize), maxSize)
+	}
+	return nil
+}
+
+// formatByteSize formats the number of bytes in a human-readable form, e.g. "5.0 MiB"
+func formatByteSize(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// parseDataURI parses data URI and returns picture data and MIME type.
+// Both base64 and percent-encoded payloads are supported.
 func parseDataURI(dataURI string) ([]byte, string, error) {
-	// Format: data:image/jpeg;base64,<base64data>
+	// Format: data:image/jpeg;base64,<base64data> or data:image/png,<percent-encoded data>
 	parts := strings.SplitN(dataURI, ",", 2)
 	if len(parts) != 2 {
 		return nil, "", fmt.Errorf("invalid data URI format")
@@ -318,16 +655,32 @@ func parseDataURI(dataURI string) ([]byte, string, error) {
 	}
 
 	headerParts := strings.Split(header[5:], ";") // Remove "data:" prefix
-	if len(headerParts) < 2 || headerParts[1] != "base64" {
-		return nil, "", fmt.Errorf("only base64 data URIs are supported")
-	}
+	mimeType := strings.ToLower(strings.TrimSpace(headerParts[0]))
+	isBase64 := len(headerParts) > 1 && headerParts[len(headerParts)-1] == "base64"
 
-	mimeType := headerParts[0]
+	var pictureData []byte
+	if isBase64 {
+		// Decode base64 data
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decode base64 data: %w", err)
+		}
+		pictureData = decoded
+	} else {
+		// Decode percent-encoded data
+		decoded, err := url.PathUnescape(data)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decode percent-encoded data: %w", err)
+		}
+		pictureData = []byte(decoded)
+	}
+	if len(pictureData) == 0 {
+		return nil, "", fmt.Errorf("empty data URI payload")
+	}
 
-	// Decode base64 data
-	pictureData, err := base64.StdEncoding.DecodeString(data)
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to decode base64 data: %w", err)
+	// The media type may be omitted (e.g., "data:;base64,..."), so detect it from content
+	if mimeType == "" {
+		mimeType = detectImageMimeType(pictureData)
 	}
 
 	return pictureData, mimeType, nil
@@ -341,8 +694,11 @@ func parseFilePath(filePath string) ([]byte, string, error) {
 		return nil, "", fmt.Errorf("failed to read file %s: %w", filePath, err)
 	}
 
-	// Determine MIME type from file extension
-	mimeType := getMimeTypeFromExt(filepath.Ext(filePath))
+	// Determine MIME type from file content, falling back to file extension
+	mimeType := detectImageMimeType(pictureData)
+	if mimeType == "" {
+		mimeType = getMimeTypeFromExt(filepath.Ext(filePath))
+	}
 	if mimeType == "" {
 		return nil, "", fmt.Errorf("unsupported image format: %s", filepath.Ext(filePath))
 	}
@@ -350,6 +706,16 @@ func parseFilePath(filePath string) ([]byte, string, error) {
 	return pictureData, mimeType, nil
 }
 
+// detectImageMimeType returns MIME type based on the leading bytes of image data.
+// It returns "" if the data isn't one of the supported image formats.
+func detectImageMimeType(data []byte) string {
+	mimeType := http.DetectContentType(data)
+	if getExtFromMimeType(mimeType) == "" {
+		return ""
+	}
+	return mimeType
+}
+
 // getMimeTypeFromExt returns MIME type based on file extension
 func getMimeTypeFromExt(ext string) string {
 	switch strings.ToLower(ext) {
@@ -363,6 +729,12 @@ func getMimeTypeFromExt(ext string) string {
 		return "image/bmp"
 	case ".webp":
 		return "image/webp"
+	case ".heic":
+		return "image/heic"
+	case ".avif":
+		return "image/avif"
+	case ".tif", ".tiff":
+		return "image/tiff"
 	default:
 		return ""
 	}
@@ -370,15 +742,109 @@ func getMimeTypeFromExt(ext string) string {
 
 var userAgent = "chape/" + Version + " (+https://github.com/Songmu/chape)"
 
-// parseHTTPURL downloads artwork from HTTP/HTTPS URL and returns picture data and MIME type
-func parseHTTPURL(url string) ([]byte, string, error) {
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+const (
+	// defaultDownloadTimeout is the default of Chape.DownloadTimeout
+	defaultDownloadTimeout = 30 * time.Second
+	// defaultDownloadRetries is the default of Chape.DownloadRetries
+	defaultDownloadRetries = 3
+	// defaultMaxArtworkSize is the default of Chape.MaxArtworkSize
+	defaultMaxArtworkSize = 5 << 20
+	// defaultMaxRedirects is the default of Chape.MaxRedirects, the same as net/http
+	defaultMaxRedirects = 10
+)
+
+// downloadPolicy limits the downloads of artwork
+type downloadPolicy struct {
+	// maxRedirects is the maximum number of redirects, zero to forbid them
+	maxRedirects int
+	// sameHostRedirects forbids redirects to a host other than the one of the URL
+	sameHostRedirects bool
+	// maxSize is the maximum size in bytes of the body, zero if unlimited
+	maxSize int
+}
+
+type downloadPolicyKey struct{}
+
+// errRedirect is the error of a redirect forbidden by the download policy
+var errRedirect = errors.New("redirect not allowed")
+
+// errTooLarge is the error of a download exceeding the maximum size of the download policy
+var errTooLarge = errors.New("artwork is too large")
+
+// downloadContext returns ctx limited by DownloadTimeout, carrying the download policy of
+// MaxRedirects, SameHostRedirects and MaxArtworkSize for the downloads of artwork
+func (c *Chape) downloadContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	policy := downloadPolicy{
+		maxRedirects:      defaultMaxRedirects,
+		sameHostRedirects: c.SameHostRedirects,
+		maxSize:           c.maxArtworkSize(),
+	}
+	switch {
+	case c.MaxRedirects < 0:
+		policy.maxRedirects = 0
+	case c.MaxRedirects > 0:
+		policy.maxRedirects = c.MaxRedirects
+	}
+	ctx = context.WithValue(ctx, downloadPolicyKey{}, policy)
+	return context.WithTimeout(ctx, cmp.Or(c.DownloadTimeout, defaultDownloadTimeout))
+}
+
+// downloadPolicyFrom returns the download policy of ctx, or the default one if ctx has none
+func downloadPolicyFrom(ctx context.Context) downloadPolicy {
+	if policy, ok := ctx.Value(downloadPolicyKey{}).(downloadPolicy); ok {
+		return policy
+	}
+	return downloadPolicy{maxRedirects: defaultMaxRedirects, maxSize: defaultMaxArtworkSize}
+}
+
+// checkRedirect returns the CheckRedirect of http.Client enforcing the policy
+func (p downloadPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > p.maxRedirects {
+		return fmt.Errorf("%w: stopped after %d redirects, at %s", errRedirect, p.maxRedirects, req.URL)
+	}
+	if p.sameHostRedirects && req.URL.Host != via[0].URL.Host {
+		return fmt.Errorf("%w: redirect to another host %s", errRedirect, req.URL.Host)
+	}
+	return nil
+}
+
+// readLimited reads r up to the maximum size of the policy, failing as soon as it's exceeded
+// rather than reading the whole body into memory
+func (p downloadPolicy) readLimited(r io.Reader) ([]byte, error) {
+	if p.maxSize <= 0 {
+		return io.ReadAll(r)
 	}
+	data, err := io.ReadAll(io.LimitReader(r, int64(p.maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > p.maxSize {
+		return nil, fmt.Errorf("%w: more than %s (%d bytes)", errTooLarge, formatByteSize(p.maxSize), p.maxSize)
+	}
+	return data, nil
+}
+
+// retryBaseDelay is the delay before the first retry of a download, doubled on each retry
+var retryBaseDelay = time.Second
+
+// retryableError is an error of a download that may succeed on retry
+type retryableError struct {
+	err error
+	// retryAfter is the delay requested by the Retry-After header, or zero
+	retryAfter time.Duration
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// downloadImage downloads the URL, and returns the body and the Content-Type header.
+// Errors that may succeed on retry are *retryableError.
+func downloadImage(ctx context.Context, url string) ([]byte, string, error) {
+	policy := downloadPolicyFrom(ctx)
+	client := &http.Client{CheckRedirect: policy.checkRedirect}
 
 	// Create request with User-Agent header
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to create request for %s: %w", url, err)
 	}
@@ -386,27 +852,144 @@ func parseHTTPURL(url string) ([]byte, string, error) {
 
 	// Download the image
 	resp, err := client.Do(req)
-	if err != nil {
+	if errors.Is(err, errRedirect) {
 		return nil, "", fmt.Errorf("failed to download image from %s: %w", url, err)
 	}
+	if err != nil {
+		return nil, "", &retryableError{err: fmt.Errorf("failed to download image from %s: %w", url, err)}
+	}
 	defer resp.Body.Close()
 
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
-		return nil, "", fmt.Errorf("failed to download image from %s: HTTP %d", url, resp.StatusCode)
+		err := fmt.Errorf("failed to download image from %s: HTTP %d", url, resp.StatusCode)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return nil, "", &retryableError{err: err, retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+		}
+		return nil, "", err
 	}
 
-	// Read the response body
-	pictureData, err := io.ReadAll(resp.Body)
+	// Fail fast on a body known to be too large, and stop reading one that turns out to be
+	if policy.maxSize > 0 && resp.ContentLength > int64(policy.maxSize) {
+		return nil, "", fmt.Errorf("failed to download image from %s: %w: %s (%d bytes) exceeds the limit of %s (%d bytes)",
+			url, errTooLarge, formatByteSize(int(resp.ContentLength)), resp.ContentLength, formatByteSize(policy.maxSize), policy.maxSize)
+	}
+	pictureData, err := policy.readLimited(resp.Body)
+	if errors.Is(err, errTooLarge) {
+		return nil, "", fmt.Errorf("failed to download image from %s: %w", url, err)
+	}
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to read image data from %s: %w", url, err)
+		return nil, "", &retryableError{err: fmt.Errorf("failed to read image data from %s: %w", url, err)}
 	}
+	// The transport decodes gzip only when it asked for it, so a compressed image sent by
+	// a misconfigured server is decoded here rather than embedded as is
+	if pictureData, err = policy.decodeContentEncoding(pictureData, resp.Header.Get("Content-Encoding")); err != nil {
+		return nil, "", fmt.Errorf("failed to decode image data from %s: %w", url, err)
+	}
+	return pictureData, resp.Header.Get("Content-Type"), nil
+}
+
+// decodeContentEncoding decodes data compressed with the Content-Encoding header value,
+// gzip or deflate, applied in the listed order. deflate is zlib wrapped as the HTTP spec
+// defines, but raw deflate is also accepted as some servers send it. The decoded data is
+// limited to the maximum size of the policy.
+func (p downloadPolicy) decodeContentEncoding(data []byte, contentEncoding string) ([]byte, error) {
+	codings := strings.Split(contentEncoding, ",")
+	for _, coding := range slices.Backward(codings) {
+		var r io.Reader
+		switch coding = strings.ToLower(strings.TrimSpace(coding)); coding {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			zr, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			r = zr
+		case "deflate":
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				r = flate.NewReader(bytes.NewReader(data))
+			} else {
+				r = zr
+			}
+		default:
+			return nil, fmt.Errorf("unsupported Content-Encoding %q", coding)
+		}
+		decoded, err := p.readLimited(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", coding, err)
+		}
+		data = decoded
+	}
+	return data, nil
+}
 
-	// Determine MIME type from Content-Type header
-	mimeType := resp.Header.Get("Content-Type")
+// parseRetryAfter parses the value of the Retry-After header, either seconds or an HTTP date.
+// It returns zero if the value is empty or invalid.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// parseHTTPURL downloads artwork from HTTP/HTTPS URL and returns picture data and MIME type.
+// Network errors, 429 and 5xx responses are retried up to retries times with exponential
+// backoff, or after Retry-After if the response has it. The download is aborted when ctx is done.
+func parseHTTPURL(ctx context.Context, url string, retries int) ([]byte, string, error) {
+	var (
+		pictureData []byte
+		contentType string
+		err         error
+	)
+	for attempt := 0; ; attempt++ {
+		pictureData, contentType, err = downloadImage(ctx, url)
+		if err == nil {
+			break
+		}
+		var re *retryableError
+		if attempt >= retries || !errors.As(err, &re) || ctx.Err() != nil {
+			return nil, "", err
+		}
+		delay := cmp.Or(re.retryAfter, retryBaseDelay<<attempt)
+		log.Printf("%v; retrying in %s", err, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, "", fmt.Errorf("failed to download image from %s: %w", url, ctx.Err())
+		case <-timer.C:
+		}
+	}
+
+	// Determine MIME type from Content-Type header, dropping parameters such as charset
+	var mimeType string
+	if contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid Content-Type %q from %s: %w", contentType, url, err)
+		}
+		// application/octet-stream tells nothing about the format, so detect it as if missing
+		if mediaType != "application/octet-stream" {
+			if !strings.HasPrefix(mediaType, "image/") {
+				return nil, "", fmt.Errorf("unexpected Content-Type %q from %s: not an image", mediaType, url)
+			}
+			mimeType = mediaType
+		}
+	}
 	if mimeType == "" {
-		// Fallback: try to determine from URL extension
-		mimeType = getMimeTypeFromExt(filepath.Ext(url))
+		// Fallback: try to determine from content or URL extension
+		mimeType = detectImageMimeType(pictureData)
+		if mimeType == "" {
+			mimeType = getMimeTypeFromExt(filepath.Ext(url))
+		}
 		if mimeType == "" {
 			return nil, "", fmt.Errorf("unable to determine MIME type for %s", url)
 		}
@@ -0,0 +1,1006 @@
+package chape
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+func TestApplyPreservesUnknownFrames(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+
+	// Seed the tag with frames chape doesn't manage
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatalf("failed to open tag: %v", err)
+	}
+	tag.SetVersion(4)
+	tag.SetTitle("Old Title")
+	tag.AddFrame("PRIV", id3v2.UnknownFrame{Body: []byte("com.example\x00private data")})
+	tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+		Encoding:    id3v2.EncodingUTF8,
+		Description: "REPLAYGAIN_TRACK_GAIN",
+		Value:       "-2.14 dB",
+	})
+	if err := tag.Save(); err != nil {
+		t.Fatalf("failed to save tag: %v", err)
+	}
+	tag.Close()
+
+	c := New(mp3Path)
+	// TXXX frames are kept through custom
+	if err := c.Apply(strings.NewReader("title: New Title\ncustom:\n  REPLAYGAIN_TRACK_GAIN: -2.14 dB\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	tag, err = id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatalf("failed to reopen tag: %v", err)
+	}
+	defer tag.Close()
+
+	if got := tag.Title(); got != "New Title" {
+		t.Errorf("title = %q, want %q", got, "New Title")
+	}
+	privFrames := tag.GetFrames("PRIV")
+	if len(privFrames) != 1 {
+		t.Fatalf("expected 1 PRIV frame, got %d", len(privFrames))
+	}
+	if uf, ok := privFrames[0].(id3v2.UnknownFrame); !ok || string(uf.Body) != "com.example\x00private data" {
+		t.Errorf("PRIV frame was not preserved: %#v", privFrames[0])
+	}
+	var found bool
+	for _, f := range tag.GetFrames("TXXX") {
+		if udtf, ok := f.(id3v2.UserDefinedTextFrame); ok && udtf.Description == "REPLAYGAIN_TRACK_GAIN" {
+			found = udtf.Value == "-2.14 dB"
+		}
+	}
+	if !found {
+		t.Error("REPLAYGAIN_TRACK_GAIN TXXX frame was not preserved")
+	}
+}
+
+func TestApplyFrameLanguage(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+
+	c := New(mp3Path)
+	c.FrameLanguage = "eng"
+	if err := c.Apply(strings.NewReader("title: Test\ncomment: Hello\nlyrics: La la\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	comm := tag.GetFrames("COMM")[0].(id3v2.CommentFrame)
+	uslt := tag.GetFrames("USLT")[0].(id3v2.UnsynchronisedLyricsFrame)
+	tag.Close()
+	if comm.Language != "eng" || uslt.Language != "eng" {
+		t.Errorf("frame languages = %q, %q, want eng", comm.Language, uslt.Language)
+	}
+
+	// The language is surfaced on read and kept on a round trip
+	metadata, err := New(mp3Path).Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if metadata.FrameLanguage != "eng" {
+		t.Errorf("FrameLanguage = %q, want eng", metadata.FrameLanguage)
+	}
+	if err := New(mp3Path).Write(metadata, true); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	// The unchanged comment keeps the language of its frame
+	if err := New(mp3Path).Apply(strings.NewReader("title: Test\ncomment: Hello\nlanguage: de\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if metadata, err = New(mp3Path).Metadata(); err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if metadata.FrameLanguage != "eng" {
+		t.Errorf("FrameLanguage = %q, want eng", metadata.FrameLanguage)
+	}
+
+	// The language derived from TLAN isn't surfaced
+	if err := New(mp3Path).Apply(strings.NewReader("title: Test\ncomment: Bonjour\nlanguage: fr\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if metadata, err = New(mp3Path).Metadata(); err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if metadata.FrameLanguage != "" {
+		t.Errorf("FrameLanguage = %q, want empty", metadata.FrameLanguage)
+	}
+
+	for _, lang := range []string{"EN", "en", "e1g", "engl"} {
+		c := New(mp3Path)
+		c.FrameLanguage = lang
+		if err := c.Apply(strings.NewReader("title: Test\ncomment: Hello\n"), true); err == nil {
+			t.Errorf("expected an error for frame language %q", lang)
+		}
+	}
+}
+
+func TestApplyComments(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+
+	// Seed the tag with comments as iTunes writes
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.SetTitle("Test")
+	for _, cf := range []id3v2.CommentFrame{
+		{Encoding: id3v2.EncodingUTF8, Language: "eng", Description: "iTunNORM", Text: " 00000316 00000311"},
+		{Encoding: id3v2.EncodingUTF8, Language: "jpn", Description: "", Text: "Main comment"},
+		{Encoding: id3v2.EncodingUTF8, Language: "eng", Description: "Songs-DB_Custom1", Text: "custom"},
+	} {
+		tag.AddCommentFrame(cf)
+	}
+	if err := tag.Save(); err != nil {
+		t.Fatal(err)
+	}
+	tag.Close()
+
+	metadata, err := New(mp3Path).Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if metadata.Comment != "Main comment" {
+		t.Errorf("Comment = %q", metadata.Comment)
+	}
+	expected := []*Comment{
+		{Language: "eng", Description: "iTunNORM", Text: " 00000316 00000311"},
+		{Language: "eng", Description: "Songs-DB_Custom1", Text: "custom"},
+	}
+	if !reflect.DeepEqual(metadata.Comments, expected) {
+		t.Errorf("Comments = %v, want %v", metadata.Comments, expected)
+	}
+
+	// The comments are written back as they are
+	var buf bytes.Buffer
+	if err := New(mp3Path).Dump(&buf); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	dumped := buf.String()
+	if err := New(mp3Path).Apply(strings.NewReader(dumped), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	buf.Reset()
+	if err := New(mp3Path).Dump(&buf); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	if buf.String() != dumped {
+		t.Errorf("round trip changed the metadata:\n%s\nwant:\n%s", buf.String(), dumped)
+	}
+
+	// A comment without language gets the frame language
+	yamlContent := "title: Test\ncomments:\n- description: note\n  text: hello\n"
+	if err := New(mp3Path).Apply(strings.NewReader(yamlContent), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if metadata, err = New(mp3Path).Metadata(); err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	expected = []*Comment{{Language: "jpn", Description: "note", Text: "hello"}}
+	if metadata.Comment != "" || !reflect.DeepEqual(metadata.Comments, expected) {
+		t.Errorf("Comment = %q, Comments = %v", metadata.Comment, metadata.Comments)
+	}
+}
+
+func TestApplyCustom(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+
+	yamlContent := `title: Test
+artwork: ./testdata/assets/logo.png
+custom:
+  EPISODE_GUID: abc-123
+  TRANSCRIPT_URL: https://example.com/transcript.vtt
+  CHAPE_SOURCE: ignored
+`
+	if err := New(mp3Path).Apply(strings.NewReader(yamlContent), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	metadata, err := New(mp3Path).Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	expected := map[string]string{
+		"EPISODE_GUID":   "abc-123",
+		"TRANSCRIPT_URL": "https://example.com/transcript.vtt",
+	}
+	if !reflect.DeepEqual(metadata.Custom, expected) {
+		t.Errorf("Custom = %v, want %v", metadata.Custom, expected)
+	}
+	if metadata.Artwork.Src != "./testdata/assets/logo.png" {
+		t.Errorf("Artwork = %q", metadata.Artwork.Src)
+	}
+
+	// TXXX frames not in custom are removed while CHAPE_SOURCE is kept
+	yamlContent = "title: Test\nartwork: ./testdata/assets/logo.png\ncustom:\n  EPISODE_GUID: abc-123\n"
+	if err := New(mp3Path).Apply(strings.NewReader(yamlContent), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if metadata, err = New(mp3Path).Metadata(); err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if !reflect.DeepEqual(metadata.Custom, map[string]string{"EPISODE_GUID": "abc-123"}) {
+		t.Errorf("Custom = %v", metadata.Custom)
+	}
+	if metadata.Artwork.Src != "./testdata/assets/logo.png" {
+		t.Errorf("Artwork = %q", metadata.Artwork.Src)
+	}
+}
+
+func TestApplyMerge(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+	input := "title: Episode\nartist: Host\ngenre: Podcast\ncomment: Notes\nartwork: ./testdata/assets/logo.png\nchapters:\n- 0:00 Intro\n"
+	if err := New(mp3Path).Apply(strings.NewReader(input), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	c := New(mp3Path)
+	c.Merge = true
+	c.Unset = []string{"comment"}
+	if err := c.Apply(strings.NewReader("genre: Technology\n"), true); err != nil {
+		t.Fatalf("Apply with Merge failed: %v", err)
+	}
+	metadata, err := New(mp3Path).Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if metadata.Title != "Episode" || metadata.Artist.String() != "Host" {
+		t.Errorf("title and artist should be kept: %q, %q", metadata.Title, metadata.Artist)
+	}
+	if metadata.Genre.String() != "Technology" {
+		t.Errorf("genre = %q, want Technology", metadata.Genre)
+	}
+	if metadata.Comment != "" {
+		t.Errorf("comment should be unset: %q", metadata.Comment)
+	}
+	if len(metadata.Chapters) != 1 || metadata.Artwork.Src != "./testdata/assets/logo.png" {
+		t.Errorf("chapters and artwork should be kept: %v, %q", metadata.Chapters, metadata.Artwork.Src)
+	}
+
+	c.Unset = []string{"unknown"}
+	if err := c.Apply(strings.NewReader("genre: Technology\n"), true); err == nil {
+		t.Error("Apply should fail on an unknown field to unset")
+	}
+	c.Unset = []string{"genre"}
+	if err := c.Apply(strings.NewReader("genre: Technology\n"), true); err == nil {
+		t.Error("Apply should fail on a field both set and unset")
+	}
+
+	// A field given as null is cleared, while an omitted or empty one is kept
+	c.Unset = nil
+	if err := c.Apply(strings.NewReader("artist: null\ngenre: ~\ntitle: \"\"\nchapters:\nunknown: null\n"), true); err != nil {
+		t.Fatalf("Apply with nulls failed: %v", err)
+	}
+	if metadata, err = New(mp3Path).Metadata(); err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if len(metadata.Artist) != 0 || len(metadata.Genre) != 0 || len(metadata.Chapters) != 0 {
+		t.Errorf("artist, genre and chapters should be cleared: %q, %q, %v", metadata.Artist, metadata.Genre, metadata.Chapters)
+	}
+	if metadata.Title != "Episode" || metadata.Artwork.Src != "./testdata/assets/logo.png" {
+		t.Errorf("title and artwork should be kept: %q, %q", metadata.Title, metadata.Artwork.Src)
+	}
+}
+
+func TestApplyURLs(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+
+	// Seed the tag with duplicate WXXX frames as some taggers write
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.SetTitle("Test")
+	tag.AddFrame("WXXX", id3v2.UnknownFrame{Body: encodeWXXX(id3v2.EncodingUTF8, "Shop", "https://example.com/old")})
+	tag.AddFrame("WXXX", id3v2.UnknownFrame{Body: encodeWXXX(id3v2.EncodingUTF8, "Shop", "https://example.com/shop")})
+	if err := tag.Save(); err != nil {
+		t.Fatal(err)
+	}
+	tag.Close()
+	metadata, err := New(mp3Path).Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if !reflect.DeepEqual(metadata.URLs, map[string]string{"Shop": "https://example.com/shop"}) {
+		t.Errorf("URLs = %v", metadata.URLs)
+	}
+
+	yamlContent := `title: Test
+artistUrl: https://example.com/artist
+urls:
+  Episode: https://example.com/1
+  エピソード: https://example.com/ja/1
+`
+	c := New(mp3Path)
+	c.ID3Version = 3
+	if err := c.Apply(strings.NewReader(yamlContent), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if metadata, err = New(mp3Path).Metadata(); err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	expected := map[string]string{"Episode": "https://example.com/1", "エピソード": "https://example.com/ja/1"}
+	if !reflect.DeepEqual(metadata.URLs, expected) {
+		t.Errorf("URLs = %v, want %v", metadata.URLs, expected)
+	}
+	if metadata.ArtistURL != "https://example.com/artist" {
+		t.Errorf("ArtistURL = %q", metadata.ArtistURL)
+	}
+
+	// URL frames have no encoding byte
+	if tag, err = id3v2.Open(mp3Path, id3v2.Options{Parse: true}); err != nil {
+		t.Fatal(err)
+	}
+	woar, _ := tag.GetLastFrame("WOAR").(id3v2.UnknownFrame)
+	n := len(tag.GetFrames("WXXX"))
+	tag.Close()
+	if string(woar.Body) != "https://example.com/artist" {
+		t.Errorf("WOAR = %q", woar.Body)
+	}
+	if n != 2 {
+		t.Errorf("%d WXXX frames, want 2", n)
+	}
+}
+
+func TestApplyDryRun(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+	if err := New(mp3Path).Apply(strings.NewReader("title: Before\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	original, err := os.ReadFile(mp3Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logBuf bytes.Buffer
+	log.SetOutput(&logBuf)
+	defer log.SetOutput(os.Stderr)
+
+	c := New(mp3Path)
+	c.DryRun = true
+	if err := c.Apply(strings.NewReader("title: After\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	got, err := os.ReadFile(mp3Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, original) {
+		t.Error("dry run should not write the audio file")
+	}
+	if !strings.Contains(logBuf.String(), "The following changes will be applied:") ||
+		!strings.Contains(logBuf.String(), "Dry run: changes not applied.") {
+		t.Errorf("dry run should show the diff:\n%s", logBuf.String())
+	}
+}
+
+func TestApplyDownloadTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	c := New(createDummyMP3(t, time.Second))
+	c.DownloadTimeout = 50 * time.Millisecond
+	err := c.Apply(strings.NewReader("title: Slow\nartwork: "+ts.URL+"/cover.png\n"), true)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Apply should time out downloading artwork: %v", err)
+	}
+}
+
+func TestApplyKeepArtwork(t *testing.T) {
+	png, err := os.ReadFile("testdata/assets/logo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+	}))
+	defer ts.Close()
+
+	for _, tt := range []struct {
+		keepArtwork bool
+		want        int
+	}{
+		{false, 2},
+		{true, 1},
+	} {
+		t.Run(fmt.Sprintf("KeepArtwork=%v", tt.keepArtwork), func(t *testing.T) {
+			requests = 0
+			c := New(createDummyMP3(t, time.Second))
+			c.KeepArtwork = tt.keepArtwork
+			artwork := "artwork: " + ts.URL + "/cover.png\n"
+			if err := c.Apply(strings.NewReader("title: First\n"+artwork), true); err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+			if err := c.Apply(strings.NewReader("title: Second\n"+artwork), true); err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+			if requests != tt.want {
+				t.Errorf("artwork downloaded %d times, want %d", requests, tt.want)
+			}
+			metadata, err := c.Metadata()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if metadata.Title != "Second" || metadata.Artwork.Src != ts.URL+"/cover.png" {
+				t.Errorf("unexpected metadata: title %q, artwork %q", metadata.Title, metadata.Artwork.Src)
+			}
+		})
+	}
+}
+
+func TestApplyMaxArtworkSize(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+	artwork, err := filepath.Abs("testdata/assets/logo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(artwork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := "title: Big\nartwork: " + artwork + "\n"
+
+	c := New(mp3Path)
+	c.MaxArtworkSize = 100
+	err = c.Apply(strings.NewReader(input), true)
+	if err == nil {
+		t.Fatal("expected an error for the artwork exceeding the limit")
+	}
+	if want := fmt.Sprintf("(%d bytes) exceeds the limit of 100 B (100 bytes)", fi.Size()); !strings.Contains(err.Error(), want) {
+		t.Errorf("error should name the size and the limit: %v", err)
+	}
+
+	c.MaxArtworkSize = -1
+	if err := c.Apply(strings.NewReader(input), true); err != nil {
+		t.Fatalf("Apply without limit failed: %v", err)
+	}
+
+	// The artwork already embedded is kept regardless of the limit
+	c.MaxArtworkSize = 100
+	if err := c.Apply(strings.NewReader("title: Renamed\nartwork: "+artwork+"\n"), true); err != nil {
+		t.Fatalf("Apply keeping the artwork failed: %v", err)
+	}
+}
+
+func TestApplyChapterOrder(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+	input := "title: Chapters\nchapters:\n- \"0:00.400 Outro\"\n- \"0:00 Intro\"\n- \"0:00.200 Main\"\n"
+	err := New(mp3Path).Apply(strings.NewReader(input), true)
+	if err == nil || !strings.Contains(err.Error(), `"0:00 Intro" starts before "0:00.400 Outro"`) {
+		t.Fatalf("Apply should fail on chapters out of order: %v", err)
+	}
+
+	c := New(mp3Path)
+	c.SortChapters = true
+	if err := c.Apply(strings.NewReader(input), true); err != nil {
+		t.Fatalf("Apply with SortChapters failed: %v", err)
+	}
+	metadata, err := New(mp3Path).Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	var titles []string
+	for _, ch := range metadata.Chapters {
+		titles = append(titles, ch.Title)
+	}
+	if want := []string{"Intro", "Main", "Outro"}; !slices.Equal(titles, want) {
+		t.Errorf("chapters = %v, want %v", titles, want)
+	}
+
+	// Chapters out of order are fine when the previous one has an explicit end
+	input = "title: Chapters\nchapters:\n- \"0:00.400-0:00.500 Outro\"\n- \"0:00 Intro\"\n- \"0:00.200 Main\"\n"
+	if err := New(mp3Path).Apply(strings.NewReader(input), true); err != nil {
+		t.Errorf("Apply failed: %v", err)
+	}
+
+	input = "title: Chapters\nchapters:\n- \"0:00 Intro\"\n- \"0:00 Main\"\n"
+	if err := New(mp3Path).Apply(strings.NewReader(input), true); err == nil {
+		t.Error("Apply should fail on chapters starting at the same time")
+	}
+	c = New(mp3Path)
+	c.AllowDuplicateChapterStarts = true
+	if err := c.Apply(strings.NewReader(input), true); err != nil {
+		t.Errorf("Apply with AllowDuplicateChapterStarts failed: %v", err)
+	}
+}
+
+func TestApplyChapterBeyondDuration(t *testing.T) {
+	// The test MP3 lasts 40 frames, about 1.04s
+	mp3Path := createDummyMP3(t, time.Second)
+	t.Setenv("CHAPE_YES", "")
+	input := "title: Chapters\nchapters:\n- \"0:00 Intro\"\n- \"0:05 Outro\"\n"
+	err := New(mp3Path).Apply(strings.NewReader(input), false)
+	if err == nil || !strings.Contains(err.Error(), `"0:05 Outro"`) {
+		t.Fatalf("Apply should fail naming the chapter beyond the duration: %v", err)
+	}
+
+	// The last chapter may start within the last frame
+	input = "title: Chapters\nchapters:\n- \"0:00 Intro\"\n- \"0:01.100 Outro\"\n"
+	if err := New(mp3Path).Apply(strings.NewReader(input), true); err != nil {
+		t.Errorf("Apply failed: %v", err)
+	}
+
+	// Confirmed upfront, the chapter is written with a warning
+	input = "title: Chapters\nchapters:\n- \"0:00 Intro\"\n- \"0:05 Outro\"\n"
+	if err := New(mp3Path).Apply(strings.NewReader(input), true); err != nil {
+		t.Fatalf("Apply with yes failed: %v", err)
+	}
+	metadata, err := New(mp3Path).Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if n := len(metadata.Chapters); n != 2 || metadata.Chapters[1].Start != 5*time.Second {
+		t.Errorf("chapters = %v, want the Outro at 0:05", metadata.Chapters)
+	}
+}
+
+func TestApplyPrune(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.SetTitle("Test")
+	tag.AddTextFrame("TPE1", id3v2.EncodingUTF8, "")
+	tag.AddTextFrame("TENC", id3v2.EncodingUTF8, " \x00 ")
+	tag.AddTextFrame("TSSE", id3v2.EncodingUTF8, "LAME")
+	tag.AddTextFrame("TZZZ", id3v2.EncodingUTF8, "")
+	if err := tag.Save(); err != nil {
+		t.Fatal(err)
+	}
+	tag.Close()
+
+	c := New(mp3Path)
+	c.Prune = true
+	ids, err := c.emptyFrameIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"TENC", "TPE1"}; !slices.Equal(ids, want) {
+		t.Errorf("empty frames = %v, want %v", ids, want)
+	}
+	// The metadata is unchanged, but the empty frames are pruned
+	if err := c.Apply(strings.NewReader("title: Test\nencoderSettings: LAME\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if tag, err = id3v2.Open(mp3Path, id3v2.Options{Parse: true}); err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+	for id, want := range map[string]int{"TPE1": 0, "TENC": 0, "TSSE": 1, "TZZZ": 1} {
+		if n := len(tag.GetFrames(id)); n != want {
+			t.Errorf("%d %s frames, want %d", n, id, want)
+		}
+	}
+}
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"line 1\r\nline 2\r\n", "line 1\nline 2\n"},
+		{"old mac\rline", "old mac\nline"},
+		{"trailing  \nspaces\t\n", "trailing\nspaces\n"},
+		{"para 1\r\n\r\npara 2", "para 1\n\npara 2"},
+		{"  indented", "  indented"},
+	}
+	for _, tt := range tests {
+		if got := normalizeText(tt.in); got != tt.want {
+			t.Errorf("normalizeText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestApplyCRLFText(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+	input := "title: Transcript\r\n" +
+		"comment: \"Notes  \\r\\nsecond line\"\r\n" +
+		"lyrics: \"First line\\r\\n\\r\\nAfter a blank line \\r\\n\"\r\n"
+	if err := New(mp3Path).Apply(strings.NewReader(input), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	metadata, err := New(mp3Path).Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Comment != "Notes\nsecond line" || metadata.Lyrics != "First line\n\nAfter a blank line\n" {
+		t.Errorf("unexpected texts: %q, %q", metadata.Comment, metadata.Lyrics)
+	}
+
+	var logBuf bytes.Buffer
+	log.SetOutput(&logBuf)
+	defer log.SetOutput(os.Stderr)
+	if err := New(mp3Path).Apply(strings.NewReader(input), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !strings.Contains(logBuf.String(), "No changes to apply.") {
+		t.Errorf("applying the same input again should make no changes:\n%s", logBuf.String())
+	}
+}
+
+func TestMetadataEqual(t *testing.T) {
+	base := func() *Metadata {
+		return &Metadata{
+			Title:  "Episode",
+			Artist: Values{"Alice"},
+			Date:   &Timestamp{Time: time.Date(2024, 8, 15, 5, 30, 0, 0, time.UTC), Precision: PrecisionMinute},
+			Track:  &NumberInSet{Current: 3},
+			Chapters: []*Chapter{
+				{Title: "Intro", Start: 0},
+				{Title: "Main", Start: 30 * time.Second},
+			},
+		}
+	}
+	tests := []struct {
+		name  string
+		edit  func(*Metadata)
+		equal bool
+	}{
+		{"same", func(*Metadata) {}, true},
+		{"chapters out of order", func(m *Metadata) {
+			m.Chapters[0], m.Chapters[1] = m.Chapters[1], m.Chapters[0]
+		}, true},
+		{"zero disc", func(m *Metadata) { m.Disc = &NumberInSet{} }, true},
+		{"empty genre", func(m *Metadata) { m.Genre = Values{} }, true},
+		{"empty custom", func(m *Metadata) { m.Custom = map[string]string{} }, true},
+		{"date in another time zone", func(m *Metadata) {
+			m.Date.Time = m.Date.Time.In(time.FixedZone("JST", 9*60*60))
+		}, true},
+		{"chapter start under a millisecond", func(m *Metadata) { m.Chapters[1].Start += 100 * time.Microsecond }, true},
+		{"title", func(m *Metadata) { m.Title = "Other" }, false},
+		{"chapter title", func(m *Metadata) { m.Chapters[1].Title = "Other" }, false},
+		{"date precision", func(m *Metadata) { m.Date.Precision = PrecisionDay }, false},
+		{"track total", func(m *Metadata) { m.Track.Total = 10 }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := base()
+			tt.edit(m)
+			if got := metadataEqual(base(), m); got != tt.equal {
+				t.Errorf("metadataEqual = %v, want %v", got, tt.equal)
+			}
+		})
+	}
+}
+
+func TestApplyEditThenReapply(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+	if err := New(mp3Path).Apply(strings.NewReader("title: Before\nchapters:\n- 0:00 Intro\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	// An edit with the keys in another order than dump writes them and a date with an offset
+	edited := `chapters:
+- 0:00 Intro
+- 0:01 Main
+date: 2024-08-15T14:30+09:00
+track: 3
+title: After
+album: ""
+artist: []
+`
+	if err := New(mp3Path).Apply(strings.NewReader(edited), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	var logBuf bytes.Buffer
+	log.SetOutput(&logBuf)
+	defer log.SetOutput(os.Stderr)
+	if err := New(mp3Path).Apply(strings.NewReader(edited), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !strings.Contains(logBuf.String(), "No changes to apply.") {
+		t.Errorf("re-applying the edit should be a no-op:\n%s", logBuf.String())
+	}
+}
+
+func TestApplyStream(t *testing.T) {
+	audio, err := os.ReadFile(createDummyMP3(t, time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	output := filepath.Join(dir, "out.mp3")
+
+	c := New(output)
+	c.DryRun = true
+	if err := c.ApplyStream(context.Background(), bytes.NewReader(audio), output, strings.NewReader("title: Piped\n")); err != nil {
+		t.Fatalf("ApplyStream failed: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("dry run left files: %v", entries)
+	}
+
+	c.DryRun = false
+	if err := c.ApplyStream(context.Background(), bytes.NewReader(audio), output, strings.NewReader("title: Piped\n")); err != nil {
+		t.Fatalf("ApplyStream failed: %v", err)
+	}
+	metadata, err := New(output).Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if metadata.Title != "Piped" {
+		t.Errorf("title = %q, want Piped", metadata.Title)
+	}
+	// The temporary file is moved into place
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("unexpected files: %v", entries)
+	}
+
+	if err := c.ApplyStream(context.Background(), bytes.NewReader(audio), "", strings.NewReader("title: Piped\n")); err == nil {
+		t.Error("expected an error for no output file")
+	}
+}
+
+func TestEditNoChanges(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the editors are Unix commands")
+	}
+	mp3Path := createDummyMP3(t, time.Second)
+	if err := New(mp3Path).Apply(strings.NewReader("title: Before\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	tests := []struct {
+		name   string
+		editor string
+		log    string
+		title  string
+	}{
+		{"never saved", "true", "No changes made.", "Before"},
+		{"saved as is", "touch", "No changes made.", "Before"},
+		{"aborted", "false", "The editor exited with status 1. No changes made.", "Before"},
+		{"edited", "sed -i s/Before/After/", "Metadata updated successfully.", "After"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CHAPE_EDITOR", tt.editor)
+			var logBuf bytes.Buffer
+			log.SetOutput(&logBuf)
+			defer log.SetOutput(os.Stderr)
+			if err := New(mp3Path).Edit(true); err != nil {
+				t.Fatalf("Edit failed: %v", err)
+			}
+			if !strings.Contains(logBuf.String(), tt.log) {
+				t.Errorf("log doesn't contain %q:\n%s", tt.log, logBuf.String())
+			}
+			metadata, err := New(mp3Path).Metadata()
+			if err != nil {
+				t.Fatalf("Metadata failed: %v", err)
+			}
+			if metadata.Title != tt.title {
+				t.Errorf("title = %q, want %q", metadata.Title, tt.title)
+			}
+		})
+	}
+}
+
+func TestEditWithoutEditor(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+
+	// A pipe isn't a terminal, as stdin of a CI job
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+
+	t.Setenv("CHAPE_EDITOR", "")
+	t.Setenv("EDITOR", "true")
+	err = New(mp3Path).Edit(true)
+	if err == nil || !strings.Contains(err.Error(), "set CHAPE_EDITOR or run apply with piped YAML") {
+		t.Errorf("expected an error for no terminal, got %v", err)
+	}
+
+	// A quoted path is left to the shell
+	for _, editor := range []string{`"/Applications/No Such Editor.app/bin/subl" -w`, `"C:\Program Files\Editor\editor.exe"`} {
+		t.Setenv("CHAPE_EDITOR", editor)
+		if got, err := resolveEditor(); err != nil || got != editor {
+			t.Errorf("resolveEditor() = %q, %v, want %q", got, err, editor)
+		}
+	}
+
+	t.Setenv("CHAPE_EDITOR", "chape-no-such-editor --wait")
+	err = New(mp3Path).Edit(true)
+	if err == nil || !strings.Contains(err.Error(), `editor "chape-no-such-editor" not found`) {
+		t.Errorf("expected an error for the missing editor, got %v", err)
+	}
+}
+
+func TestPromptYN(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"\n", true},
+		{"Y\n", true},
+		{"n\n", false},
+		{"maybe\nN\n", false},
+		{"y", true},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		tty := struct {
+			io.Reader
+			io.Writer
+		}{strings.NewReader(tt.input), &out}
+		got, err := promptYN(tty, "Apply these changes?", true)
+		if err != nil || got != tt.want {
+			t.Errorf("promptYN(%q) = %v, %v, want %v", tt.input, got, err, tt.want)
+		}
+		if !strings.HasPrefix(out.String(), "Apply these changes? (y/n) [y]: ") {
+			t.Errorf("unexpected prompt: %q", out.String())
+		}
+	}
+	tty := struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader(""), io.Discard}
+	if _, err := promptYN(tty, "Apply these changes?", true); err == nil {
+		t.Error("expected an error for no answer")
+	}
+}
+
+func TestApplyNoTerminal(t *testing.T) {
+	if tty, err := os.OpenFile(consoleDevice(), os.O_RDWR, 0); err == nil {
+		tty.Close()
+		t.Skip("the terminal device is available to ask on")
+	}
+	mp3Path := createDummyMP3(t, time.Second)
+	t.Setenv("CHAPE_YES", "")
+	if err := New(mp3Path).Apply(strings.NewReader("title: New\n"), false); !errors.Is(err, ErrNoTerminal) {
+		t.Errorf("expected ErrNoTerminal, got %v", err)
+	}
+
+	// The input from stdin doesn't reopen the terminal
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	w.WriteString("title: New\n")
+	w.Close()
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+	c := New(mp3Path)
+	c.NoPromptReopen = true
+	if err := c.Apply(os.Stdin, false); !errors.Is(err, ErrNoTerminal) {
+		t.Errorf("expected ErrNoTerminal, got %v", err)
+	}
+
+	t.Setenv("CHAPE_YES", "1")
+	if err := New(mp3Path).Apply(strings.NewReader("title: New\n"), false); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	metadata, err := New(mp3Path).Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if metadata.Title != "New" {
+		t.Errorf("title = %q, want New", metadata.Title)
+	}
+}
+
+func TestApplyStampEncoder(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+	c := New(mp3Path)
+	c.StampEncoder = true
+	if err := c.Apply(strings.NewReader("title: Test\nencodedBy: Example Studio\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	m, err := c.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.EncodedBy != "Example Studio" || m.EncoderSettings != encoderStamp() {
+		t.Errorf("got EncodedBy=%q, EncoderSettings=%q, want %q, %q",
+			m.EncodedBy, m.EncoderSettings, "Example Studio", encoderStamp())
+	}
+
+	// The encoder settings given are kept
+	if err := c.Apply(strings.NewReader("title: Test\nencoderSettings: LAME 3.100 -V2\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if m, err = c.Metadata(); err != nil {
+		t.Fatal(err)
+	}
+	if m.EncoderSettings != "LAME 3.100 -V2" {
+		t.Errorf("EncoderSettings = %q, want %q", m.EncoderSettings, "LAME 3.100 -V2")
+	}
+}
+
+func TestApplyQuiet(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+
+	var logBuf bytes.Buffer
+	log.SetOutput(&logBuf)
+	defer log.SetOutput(os.Stderr)
+
+	c := New(mp3Path)
+	c.Quiet = true
+	c.Backup = true
+	if err := c.Apply(strings.NewReader("title: Quiet\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if err := c.Apply(strings.NewReader("title: Quiet\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if logBuf.Len() > 0 {
+		t.Errorf("quiet apply should log nothing, got %q", logBuf.String())
+	}
+
+	// Warnings are still logged
+	if err := c.Apply(strings.NewReader("title: Quiet\nisrc: bad\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if got := logBuf.String(); !strings.Contains(got, "Warning:") || strings.Contains(got, "successfully") {
+		t.Errorf("quiet apply should log only the warning, got %q", got)
+	}
+
+	// The diff of a dry run is still logged
+	logBuf.Reset()
+	c.DryRun = true
+	if err := c.Apply(strings.NewReader("title: Dry\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if got := logBuf.String(); !strings.Contains(got, "+ title: Dry") || strings.Contains(got, "Dry run:") {
+		t.Errorf("quiet dry run should log only the diff, got %q", got)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	_, err := New("audio.ogg").Metadata()
+	var fe *FileError
+	if !errors.Is(err, ErrUnsupportedFormat) || !errors.As(err, &fe) || fe.Path != "audio.ogg" {
+		t.Errorf("unsupported file: got %v", err)
+	}
+	if err == nil || err.Error() != `unsupported audio file type ".ogg": audio.ogg` {
+		t.Errorf("message of unsupported file changed: %v", err)
+	}
+	if _, err := NewFromReader(strings.NewReader("not audio")).Metadata(); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("unsupported reader: got %v", err)
+	}
+
+	mp3Path := createDummyMP3(t, time.Second)
+	if _, err := New(mp3Path).ExtractArtwork(""); !errors.Is(err, ErrNoArtwork) || !errors.As(err, &fe) || fe.Path != mp3Path {
+		t.Errorf("no artwork: got %v", err)
+	}
+
+	if _, err := parseChapterTime("1:xx"); !errors.Is(err, ErrInvalidChapterTime) || err.Error() != "invalid seconds: xx" {
+		t.Errorf("invalid chapter time: got %v", err)
+	}
+	err = New(mp3Path).Apply(strings.NewReader("title: Bad\nchapters:\n- 1:xx Intro\n"), true)
+	if !errors.Is(err, ErrInvalidChapterTime) {
+		t.Errorf("invalid chapter time in the input: got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package chape
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ExtractArtwork writes the embedded artwork, the front cover if there are multiple pictures,
+// to outputPath. The extension is chosen from the type of the picture if outputPath has
+// none or has one of another image type. The audio file name without its extension, or
+// "cover" for a reader, is used if outputPath is empty. It returns the path written.
+func (c *Chape) ExtractArtwork(outputPath string) (string, error) {
+	t, err := c.tagger()
+	if err != nil {
+		return "", err
+	}
+	dataURI, err := t.embeddedArtwork()
+	if err != nil {
+		return "", fmt.Errorf("failed to get embedded artwork: %w", err)
+	}
+	if dataURI == "" {
+		return "", c.fileError(&kindError{err: fmt.Errorf("no embedded artwork in %s", c.audio), kind: ErrNoArtwork})
+	}
+	if outputPath == "" {
+		outputPath = cmp.Or(strings.TrimSuffix(c.audio, filepath.Ext(c.audio)), "cover")
+	}
+	outputPath, err = extractArtworkToFile(dataURI, outputPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to extract artwork: %w", err)
+	}
+	return outputPath, nil
+}
+
+// SetArtwork embeds artwork, a file path, HTTP(S) URL or data URI as Apply accepts, as
+// the front cover and records its source, without reading or rewriting the other tags.
+// Unlike Apply, it leaves the chapters, dates and so on exactly as they are.
+func (c *Chape) SetArtwork(artwork string) error {
+	return c.SetArtworkContext(context.Background(), artwork)
+}
+
+// SetArtworkContext is like SetArtwork, but ctx cancels downloading artwork.
+func (c *Chape) SetArtworkContext(ctx context.Context, artwork string) error {
+	if artwork == "" {
+		return errors.New("no artwork specified")
+	}
+	if c.DryRun {
+		c.logf("Dry run: artwork not set to %s.", artwork)
+		return nil
+	}
+	if c.reader != nil {
+		return ErrReadOnly
+	}
+	t, err := c.tagger()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.downloadContext(ctx)
+	defer cancel()
+	if err := c.withBackup(func() error { return t.writeArtwork(ctx, artwork) }); err != nil {
+		return fmt.Errorf("failed to set artwork: %w", err)
+	}
+	c.logf("Artwork updated successfully.")
+	return nil
+}
+
+// loadArtwork reads the picture of artwork and checks its size against maxSize, zero if unlimited
+func loadArtwork(ctx context.Context, artwork string, retries, maxSize int) ([]byte, string, error) {
+	pictureData, mimeType, err := parseArtwork(ctx, artwork, retries)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse artwork: %w", err)
+	}
+	if len(pictureData) == 0 {
+		return nil, "", fmt.Errorf("empty artwork: %s", artwork)
+	}
+	if err := checkArtworkSize(pictureData, maxSize); err != nil {
+		return nil, "", err
+	}
+	return pictureData, mimeType, nil
+}
+
+// artworkSource returns the source of artwork recorded in CHAPE_SOURCE, or "" for data URIs
+// as they don't need source tracking
+func artworkSource(artwork string) string {
+	if strings.HasPrefix(artwork, "data:") {
+		return ""
+	}
+	return artwork
+}
+
+// pictureTypeNames is the names of the picture types of ID3v2 APIC frames and FLAC
+// PICTURE blocks, indexed by the type
+var pictureTypeNames = []string{
+	"other", "icon", "other-icon", "front", "back", "leaflet", "media", "lead-artist",
+	"artist", "conductor", "band", "composer", "lyricist", "recording-location",
+	"during-recording", "during-performance", "screen-capture", "fish", "illustration",
+	"band-logo", "publisher-logo",
+}
+
+// pictureTypeFront is the picture type of the front cover
+const pictureTypeFront = 3
+
+// pictureTypeName returns the name of the picture type, or "" for the front cover
+func pictureTypeName(t uint32) string {
+	if t == pictureTypeFront || int(t) >= len(pictureTypeNames) {
+		return ""
+	}
+	return pictureTypeNames[t]
+}
+
+// parsePictureType parses the name of the picture type. An empty name is the front cover.
+func parsePictureType(name string) (byte, error) {
+	if name == "" {
+		return pictureTypeFront, nil
+	}
+	i := slices.Index(pictureTypeNames, name)
+	if i < 0 {
+		return 0, fmt.Errorf("unknown picture type %q: must be one of %s", name, strings.Join(pictureTypeNames, ", "))
+	}
+	return byte(i), nil
+}
@@ -0,0 +1,354 @@
+package chape_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Songmu/chape"
+	"github.com/bogem/id3v2/v2"
+)
+
+func TestExtractArtwork(t *testing.T) {
+	want, err := os.ReadFile("testdata/assets/logo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	artwork, err := filepath.Abs("testdata/assets/logo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, create := range audioFixtures {
+		t.Run(name, func(t *testing.T) {
+			audioFile := create(t, 10*time.Second)
+			c := chape.New(audioFile)
+			if _, err := c.ExtractArtwork(""); err == nil || !strings.Contains(err.Error(), "no embedded artwork") {
+				t.Errorf("expected no embedded artwork error, got %v", err)
+			}
+
+			if err := c.Apply(strings.NewReader("title: Cover\nartwork: "+artwork+"\n"), true); err != nil {
+				t.Fatalf("Failed to apply YAML: %v", err)
+			}
+			path, err := c.ExtractArtwork(filepath.Join(t.TempDir(), "cover"))
+			if err != nil {
+				t.Fatalf("ExtractArtwork failed: %v", err)
+			}
+			if filepath.Ext(path) != ".png" {
+				t.Errorf("path = %s, want the .png extension", path)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Error("extracted artwork differs from the embedded one")
+			}
+
+			// The audio file name is used by default
+			path, err = c.ExtractArtwork("")
+			if err != nil {
+				t.Fatalf("ExtractArtwork failed: %v", err)
+			}
+			if want := strings.TrimSuffix(audioFile, filepath.Ext(audioFile)) + ".png"; path != want {
+				t.Errorf("path = %s, want %s", path, want)
+			}
+		})
+	}
+}
+
+func TestSetArtwork(t *testing.T) {
+	artwork, err := filepath.Abs("testdata/assets/logo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jpeg, err := os.ReadFile("testdata/assets/logo.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	yamlContent := `title: Keep Me
+date: 2024-08-15
+chapters:
+- 0:00 Intro
+- 0:05 Main
+`
+	for name, tc := range map[string]struct {
+		create func(*testing.T, time.Duration) string
+		yaml   string
+	}{
+		"mp3":  {createDummyMP3, yamlContent + "- start: \"0:08\"\n  title: Linked\n  url: https://example.com/\n"},
+		"flac": {createDummyFLAC, yamlContent},
+		"m4a":  {createDummyM4A, yamlContent},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// A file without tags gets them
+			fresh := chape.New(tc.create(t, 10*time.Second))
+			if err := fresh.SetArtwork(artwork); err != nil {
+				t.Fatalf("SetArtwork failed: %v", err)
+			}
+			m, err := fresh.Metadata()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Artwork.Src != artwork {
+				t.Errorf("artwork of the file without tags = %q, want %q", m.Artwork.Src, artwork)
+			}
+
+			audioFile := tc.create(t, 10*time.Second)
+			c := chape.New(audioFile)
+			if err := c.Apply(strings.NewReader(tc.yaml), true); err != nil {
+				t.Fatalf("Failed to apply YAML: %v", err)
+			}
+			before, err := c.Metadata()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := c.SetArtwork(artwork); err != nil {
+				t.Fatalf("SetArtwork failed: %v", err)
+			}
+			after, err := c.Metadata()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if after.Artwork.Src != artwork {
+				t.Errorf("artwork = %q, want %q", after.Artwork.Src, artwork)
+			}
+			after.Artwork.Src = ""
+			if !reflect.DeepEqual(before, after) {
+				t.Errorf("SetArtwork changed other metadata:\nbefore: %+v\nafter:  %+v", before, after)
+			}
+
+			// A data URI replaces the picture and clears the recorded source
+			dataURI := "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(jpeg)
+			if err := c.SetArtwork(dataURI); err != nil {
+				t.Fatalf("SetArtwork failed: %v", err)
+			}
+			after, err = c.Metadata()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if after.Artwork.Src != dataURI {
+				t.Errorf("artwork = %.40q..., want the data URI", after.Artwork.Src)
+			}
+		})
+	}
+}
+
+func TestMissingArtworkExtractedWithRealExtension(t *testing.T) {
+	jpeg, err := os.ReadFile("testdata/assets/logo.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A JPEG image named as PNG
+	source := filepath.Join(t.TempDir(), "cover.png")
+	if err := os.WriteFile(source, jpeg, 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := chape.New(createDummyMP3(t, 10*time.Second))
+	if err := c.SetArtwork(source); err != nil {
+		t.Fatalf("SetArtwork failed: %v", err)
+	}
+	if err := os.Remove(source); err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err := c.Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	want := strings.TrimSuffix(source, ".png") + ".jpg"
+	if metadata.Artwork.Src != want {
+		t.Errorf("artwork = %q, want %q", metadata.Artwork.Src, want)
+	}
+	got, err := os.ReadFile(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, jpeg) {
+		t.Error("extracted artwork differs from the embedded one")
+	}
+	if _, err := os.Stat(source); !os.IsNotExist(err) {
+		t.Errorf("%s should not be written", source)
+	}
+}
+
+func TestArtworkPictureTypePreserved(t *testing.T) {
+	png, err := filepath.Abs("testdata/assets/logo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jpg, err := filepath.Abs("testdata/assets/logo.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp3Path := createDummyMP3(t, 10*time.Second)
+	c := chape.New(mp3Path)
+	if err := c.Apply(strings.NewReader("title: Before\nartwork: "+png+"\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	// Tag the cover carefully as another tool would
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatalf("failed to open tag: %v", err)
+	}
+	pf := tag.GetFrames("APIC")[0].(id3v2.PictureFrame)
+	pf.PictureType = id3v2.PTOther
+	pf.Description = "Cover (front)"
+	tag.DeleteFrames("APIC")
+	tag.AddAttachedPicture(pf)
+	if err := tag.Save(); err != nil {
+		t.Fatal(err)
+	}
+	tag.Close()
+
+	picture := func() id3v2.PictureFrame {
+		t.Helper()
+		tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+		if err != nil {
+			t.Fatalf("failed to open tag: %v", err)
+		}
+		defer tag.Close()
+		frames := tag.GetFrames("APIC")
+		if len(frames) != 1 {
+			t.Fatalf("got %d APIC frames, want 1", len(frames))
+		}
+		return frames[0].(id3v2.PictureFrame)
+	}
+
+	// The same source keeps the picture type and description
+	if err := c.Apply(strings.NewReader("title: After\nartwork: "+png+"\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if got := picture(); got.PictureType != id3v2.PTOther || got.Description != "Cover (front)" {
+		t.Errorf("picture type and description = %d, %q, want them kept", got.PictureType, got.Description)
+	}
+
+	// A new artwork resets them
+	if err := c.Apply(strings.NewReader("title: After\nartwork: "+jpg+"\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if got := picture(); got.PictureType != id3v2.PTFrontCover || got.Description != "" {
+		t.Errorf("picture type and description = %d, %q, want the defaults", got.PictureType, got.Description)
+	}
+}
+
+func TestLegacyArtworkSource(t *testing.T) {
+	png, err := filepath.Abs("testdata/assets/logo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp3Path := createDummyMP3(t, 10*time.Second)
+	c := chape.New(mp3Path)
+	if err := c.Apply(strings.NewReader("title: Before\nartwork: "+png+"\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	// Record the source under the name older versions used
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatalf("failed to open tag: %v", err)
+	}
+	tag.DeleteFrames("TXXX")
+	tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+		Encoding:    id3v2.EncodingUTF8,
+		Description: "CHAPEL_SOURCE",
+		Value:       png,
+	})
+	if err := tag.Save(); err != nil {
+		t.Fatal(err)
+	}
+	tag.Close()
+
+	metadata, err := c.Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if metadata.Artwork.Src != png {
+		t.Errorf("artwork = %q, want %q", metadata.Artwork.Src, png)
+	}
+	if len(metadata.Custom) > 0 {
+		t.Errorf("custom = %v, want empty", metadata.Custom)
+	}
+
+	// Writing migrates the source to the canonical name
+	if err := c.Apply(strings.NewReader("title: After\nartwork: "+png+"\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	tag, err = id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatalf("failed to open tag: %v", err)
+	}
+	defer tag.Close()
+	var descriptions []string
+	for _, f := range tag.GetFrames("TXXX") {
+		descriptions = append(descriptions, f.(id3v2.UserDefinedTextFrame).Description)
+	}
+	if !reflect.DeepEqual(descriptions, []string{chape.ArtworkSourceName}) {
+		t.Errorf("TXXX descriptions = %v, want [%s]", descriptions, chape.ArtworkSourceName)
+	}
+}
+
+func TestArtworkPictureTypeFromYAML(t *testing.T) {
+	png, err := filepath.Abs("testdata/assets/logo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, create := range audioFixtures {
+		// MP4 has no picture type nor description
+		if name == "m4a" {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			audioFile := create(t, 10*time.Second)
+			c := chape.New(audioFile)
+			input := "title: Episode\nartwork:\n  src: " + png + "\n  type: back\n  description: Album cover\n"
+			if err := c.Apply(strings.NewReader(input), true); err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+			want := chape.Artwork{Src: png, Type: "back", Description: "Album cover"}
+			metadata, err := c.Metadata()
+			if err != nil {
+				t.Fatalf("Metadata failed: %v", err)
+			}
+			if metadata.Artwork != want {
+				t.Errorf("artwork = %+v, want %+v", metadata.Artwork, want)
+			}
+			var buf bytes.Buffer
+			c.NoSchema = true
+			if err := c.Dump(&buf); err != nil {
+				t.Fatalf("Dump failed: %v", err)
+			}
+			if !strings.Contains(buf.String(), "artwork:\n  src: "+png+"\n  type: back\n  description: Album cover\n") {
+				t.Errorf("artwork should be dumped as a mapping:\n%s", buf.String())
+			}
+
+			// The scalar form of the same source keeps them
+			var diff bytes.Buffer
+			changed, err := c.Diff(&diff, strings.NewReader("title: Episode\nartwork: "+png+"\n"))
+			if err != nil {
+				t.Fatalf("Diff failed: %v", err)
+			}
+			if changed {
+				t.Errorf("the scalar form of the same source should be no change:\n%s", diff.String())
+			}
+
+			// The explicit front cover resets them
+			input = "title: Episode\nartwork:\n  src: " + png + "\n  type: front\n"
+			if err := c.Apply(strings.NewReader(input), true); err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+			if metadata, err = c.Metadata(); err != nil {
+				t.Fatalf("Metadata failed: %v", err)
+			}
+			if want := (chape.Artwork{Src: png}); metadata.Artwork != want {
+				t.Errorf("artwork = %+v, want %+v", metadata.Artwork, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package chape
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// backupFile copies the file to "<path>.bak" and returns the backup path.
+// When the path already exists, a number is appended like "<path>.bak.1".
+func backupFile(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer src.Close()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	backupPath := path + ".bak"
+	var dst *os.File
+	for i := 1; ; i++ {
+		// O_EXCL never overwrites an existing backup even if it's created concurrently
+		dst, err = os.OpenFile(backupPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", fmt.Errorf("failed to create backup file: %w", err)
+		}
+		backupPath = fmt.Sprintf("%s.bak.%d", path, i)
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(backupPath)
+		return "", fmt.Errorf("failed to write backup file: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(backupPath)
+		return "", fmt.Errorf("failed to write backup file: %w", err)
+	}
+	return backupPath, nil
+}
+
+// restoreBackup overwrites the file at path with the content of the backup.
+// The backup file is left as it is.
+func restoreBackup(backupPath, path string) error {
+	src, err := os.Open(backupPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
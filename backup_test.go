@@ -0,0 +1,65 @@
+package chape
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackupFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audio.mp3")
+	if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{path + ".bak", path + ".bak.1", path + ".bak.2"} {
+		got, err := backupFile(path)
+		if err != nil {
+			t.Fatalf("backupFile failed: %v", err)
+		}
+		if got != want {
+			t.Errorf("backup path = %q, want %q", got, want)
+		}
+		data, err := os.ReadFile(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "original" {
+			t.Errorf("backup content = %q, want %q", data, "original")
+		}
+	}
+}
+
+func TestApplyBackupRestoresOnFailure(t *testing.T) {
+	path := createDummyMP3(t, time.Second)
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(path)
+	c.Backup = true
+	// The artwork is broken, so writing fails after the backup is made
+	err = c.Apply(strings.NewReader("title: Broken\nartwork: data:image/png;base64,!!!\n"), true)
+	if err == nil {
+		t.Fatal("Apply should fail with invalid artwork")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, original) {
+		t.Error("audio file should be restored from the backup")
+	}
+	backup, err := os.ReadFile(path + ".bak")
+	if err != nil {
+		t.Fatalf("backup file should be kept: %v", err)
+	}
+	if !bytes.Equal(backup, original) {
+		t.Error("backup file should have the original content")
+	}
+}
@@ -0,0 +1,77 @@
+package chape
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// BatchResult is the result of applying metadata to an audio file in ApplyBatch
+type BatchResult struct {
+	Path string
+	Err  error
+}
+
+// ApplyBatch reads metadata from input once and writes it to each of the audio files with
+// the options of c. The audio file of c itself is not used. Chapters usually differ between
+// files, so each file keeps its chapters unless the input contains chapters, in which case
+// they are written to all the files. With ffmetadata input, each file keeps its artwork.
+// It continues past the failure of a file and returns the results of all the files.
+// When ctx is done, the download in progress is aborted and the remaining files are skipped.
+// The returned error is for the failure of reading input or ctx being done.
+func (c *Chape) ApplyBatch(ctx context.Context, paths []string, input io.Reader, yes bool, format ...Format) ([]*BatchResult, error) {
+	f := FormatYAML
+	if len(format) > 0 && format[0] != "" {
+		f = format[0]
+	}
+	newMetadata, nulls, err := c.decodeMetadata(input, f)
+	if err != nil {
+		return nil, err
+	}
+	keepChapters := len(newMetadata.Chapters) == 0
+	if keepChapters {
+		c.logf("No chapters in the input. Each file keeps its own chapters.")
+	} else {
+		c.logf("The input has %d chapters. They replace the chapters of every file.", len(newMetadata.Chapters))
+	}
+	file, ok := input.(*os.File)
+	fromStdin := ok && file == os.Stdin
+
+	results := make([]*BatchResult, 0, len(paths))
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		fc := *c
+		fc.audio = path
+		results = append(results, &BatchResult{
+			Path: path,
+			Err:  fc.applyBatchItem(ctx, newMetadata, nulls, keepChapters, f == FormatFFMetadata, yes, fromStdin),
+		})
+	}
+	return results, nil
+}
+
+// applyBatchItem writes a copy of newMetadata to the audio file, keeping its chapters
+// and artwork as specified. nulls are the fields given as null, cleared on merging.
+func (c *Chape) applyBatchItem(ctx context.Context, newMetadata *Metadata, nulls []string, keepChapters, keepArtwork, yes, fromStdin bool) error {
+	m := *newMetadata
+	if keepChapters || keepArtwork {
+		currentMetadata, err := c.Metadata()
+		if err != nil {
+			return fmt.Errorf("failed to read current metadata: %w", err)
+		}
+		if keepChapters {
+			m.Chapters = currentMetadata.Chapters
+		}
+		if keepArtwork {
+			m.Artwork = currentMetadata.Artwork
+		}
+	}
+	merged, err := c.mergeInput(&m, nulls...)
+	if err != nil {
+		return err
+	}
+	return c.write(ctx, merged, yes, fromStdin)
+}
@@ -0,0 +1,63 @@
+package chape
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyBatch(t *testing.T) {
+	first, second := createDummyMP3(t, time.Second), createDummyMP3(t, time.Second)
+	if err := New(first).Apply(strings.NewReader("title: Episode 1\nchapters:\n- 0:00 Opening\n- 0:00.500 Talk\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing.mp3")
+
+	c := New("")
+	results, err := c.ApplyBatch(context.Background(), []string{first, missing, second},
+		strings.NewReader("artist: Host\nalbum: Season 1\n"), true)
+	if err != nil {
+		t.Fatalf("ApplyBatch failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("unexpected results: %v", results)
+	}
+	if results[0].Err != nil || results[2].Err != nil {
+		t.Errorf("unexpected errors: %v, %v", results[0].Err, results[2].Err)
+	}
+	if results[1].Err == nil {
+		t.Error("expected an error for the missing file")
+	}
+
+	metadata, err := New(first).Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if metadata.Artist.String() != "Host" || metadata.Album != "Season 1" {
+		t.Errorf("unexpected metadata: %+v", metadata)
+	}
+	if len(metadata.Chapters) != 2 || metadata.Chapters[1].Start != 500*time.Millisecond {
+		t.Errorf("chapters should be kept: %v", metadata.Chapters)
+	}
+
+	// Chapters in the input replace those of every file
+	results, err = c.ApplyBatch(context.Background(), []string{first, second},
+		strings.NewReader("artist: Host\nchapters:\n- 0:00 Only\n"), true)
+	if err != nil {
+		t.Fatalf("ApplyBatch failed: %v", err)
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatalf("failed to apply to %s: %v", r.Path, r.Err)
+		}
+		metadata, err := New(r.Path).Metadata()
+		if err != nil {
+			t.Fatalf("Metadata failed: %v", err)
+		}
+		if len(metadata.Chapters) != 1 || metadata.Chapters[0].Title != "Only" {
+			t.Errorf("unexpected chapters of %s: %v", r.Path, metadata.Chapters)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package chape
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf16"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+// chapFrame is a CHAP frame with the sub-frames id3v2.ChapterFrame doesn't support:
+// APIC for the chapter image and WXXX for the chapter URL. The source of the image is
+// recorded in a TXXX:CHAPE_SOURCE sub-frame as the top-level artwork is.
+// cf. https://id3.org/id3v2-chapters-1.0
+type chapFrame struct {
+	id3v2.ChapterFrame
+	encoding id3v2.Encoding // of the TXXX sub-frame
+	picture  *id3v2.PictureFrame
+	source   string
+	url      string
+}
+
+// chapSubframe is a sub-frame of a CHAP frame
+type chapSubframe struct {
+	id    string
+	frame id3v2.Framer
+}
+
+// subframes returns the sub-frames other than TIT2 and TIT3 written by id3v2.ChapterFrame
+func (cf *chapFrame) subframes() []chapSubframe {
+	var frames []chapSubframe
+	if cf.picture != nil {
+		frames = append(frames, chapSubframe{"APIC", *cf.picture})
+		if cf.source != "" {
+			// TXXX is encoded here since id3v2 writes a stray byte after UTF-16 text,
+			// which misaligns the value when read as the spec says
+			key := cf.encoding.Key
+			body := append([]byte{key}, encodeID3Text(key, chapeSourceDescription)...)
+			body = append(body, id3Terminator(key)...)
+			body = append(body, encodeID3Text(key, cf.source)...)
+			frames = append(frames, chapSubframe{"TXXX", id3v2.UnknownFrame{Body: body}})
+		}
+	}
+	if cf.url != "" {
+		// WXXX: encoding, empty description and the URL in ISO-8859-1
+		frames = append(frames, chapSubframe{"WXXX", id3v2.UnknownFrame{Body: append([]byte{0, 0}, cf.url...)}})
+	}
+	return frames
+}
+
+// Size implements id3v2.Framer
+func (cf *chapFrame) Size() int {
+	size := cf.ChapterFrame.Size()
+	for _, sf := range cf.subframes() {
+		size += 10 + sf.frame.Size()
+	}
+	return size
+}
+
+// WriteTo implements id3v2.Framer
+func (cf *chapFrame) WriteTo(w io.Writer) (int64, error) {
+	n, err := cf.ChapterFrame.WriteTo(w)
+	if err != nil {
+		return n, err
+	}
+	for _, sf := range cf.subframes() {
+		// Sub-frame header: ID, synchsafe size (as id3v2 writes sub-frames) and flags
+		header := make([]byte, 10)
+		copy(header, sf.id)
+		putSynchsafe(header[4:8], sf.frame.Size())
+		m, err := w.Write(header)
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+		l, err := sf.frame.WriteTo(w)
+		n += l
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// chapterExtras holds the sub-frames of a CHAP frame that id3v2 ignores
+type chapterExtras struct {
+	picture *id3v2.PictureFrame
+	source  string
+	url     string
+}
+
+// readID3Tag parses the ID3v2 tag at the beginning of r. id3v2 neither parses nor skips
+// the CHAP sub-frames other than TIT2 and TIT3, and loses the frames following them, so they
+// are removed from the tag before parsing and returned separately keyed by element ID.
+// It also returns the size of the tag in r, where the audio starts.
+func readID3Tag(r io.ReadSeeker) (*id3v2.Tag, map[string]*chapterExtras, int64, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, 0, err
+	}
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return id3v2.NewEmptyTag(), nil, 0, nil
+		}
+		return nil, nil, 0, err
+	}
+	if string(header[:3]) != "ID3" {
+		return id3v2.NewEmptyTag(), nil, 0, nil
+	}
+	version := header[3]
+	tagSize := int64(10 + synchsafe(header[6:10]))
+	if header[5]&0x10 != 0 {
+		tagSize += 10 // footer
+	}
+	if version < 3 || header[5]&0x80 != 0 {
+		// ID3v2.2 has no CHAP frames, and unsynchronised tags are parsed as they are
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return nil, nil, 0, err
+		}
+		id3tag, err := id3v2.ParseReader(io.LimitReader(r, tagSize), id3v2.Options{Parse: true})
+		return id3tag, nil, tagSize, err
+	}
+	body := make([]byte, synchsafe(header[6:10]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to read ID3v2 tag: %w", err)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(header)
+	if header[5]&0x40 != 0 && len(body) >= 4 {
+		// Keep the extended header as it is
+		size := int(binary.BigEndian.Uint32(body))
+		if version == 4 {
+			size = synchsafe(body[:4])
+		} else {
+			size += 4 // the size in ID3v2.3 excludes itself
+		}
+		if size > len(body) {
+			return nil, nil, 0, errors.New("invalid ID3v2 extended header")
+		}
+		buf.Write(body[:size])
+		body = body[size:]
+	}
+
+	extras := map[string]*chapterExtras{}
+	for _, f := range splitID3Frames(body, version == 4) {
+		if f.id != "CHAP" {
+			buf.Write(f.raw)
+			continue
+		}
+		elementID, rest, ok := bytes.Cut(f.body, []byte{0})
+		if !ok || len(rest) < 16 {
+			// Leave it to id3v2
+			buf.Write(f.raw)
+			continue
+		}
+		// Sub-frames follow the times and offsets
+		chap := append([]byte{}, f.body[:len(f.body)-len(rest)+16]...)
+		e := &chapterExtras{}
+		for _, sf := range splitChapSubframes(rest[16:], version) {
+			switch sf.id {
+			case "TIT2", "TIT3":
+				chap = append(chap, sf.raw...)
+			case "APIC":
+				e.picture = parseAPIC(sf.body)
+			case "TXXX":
+				if desc, value := parseTXXX(sf.body); isArtworkSourceName(desc) {
+					e.source = value
+				}
+			case "WXXX":
+				_, e.url = parseWXXX(sf.body)
+			}
+		}
+		if e.picture != nil || e.url != "" {
+			extras[string(elementID)] = e
+		}
+		frameHeader := append([]byte{}, f.raw[:10]...)
+		if version == 4 {
+			putSynchsafe(frameHeader[4:8], len(chap))
+		} else {
+			binary.BigEndian.PutUint32(frameHeader[4:8], uint32(len(chap)))
+		}
+		buf.Write(frameHeader)
+		buf.Write(chap)
+	}
+	// Padding is dropped; the tag is written without it anyway
+	b := buf.Bytes()
+	b[5] &^= 0x10 // footer
+	putSynchsafe(b[6:10], len(b)-10)
+
+	id3tag, err := id3v2.ParseReader(bytes.NewReader(b), id3v2.Options{Parse: true})
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return id3tag, extras, tagSize, nil
+}
+
+// saveID3Tag writes id3tag followed by the audio of file, which starts at audioOffset and
+// ends at audioEnd, or the end of file if negative, and trailer to a temporary file and
+// replaces file with it
+func saveID3Tag(file *os.File, id3tag io.WriterTo, audioOffset, audioEnd int64, trailer []byte) error {
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	path := file.Name()
+	tmpPath := path + "-chape"
+	tmpFile, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, stat.Mode())
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmpPath)
+	defer tmpFile.Close()
+
+	if _, err := id3tag.WriteTo(tmpFile); err != nil {
+		return fmt.Errorf("failed to write tag: %w", err)
+	}
+	if _, err := file.Seek(audioOffset, io.SeekStart); err != nil {
+		return err
+	}
+	var audio io.Reader = file
+	if audioEnd >= 0 {
+		audio = io.LimitReader(file, max(audioEnd-audioOffset, 0))
+	}
+	if _, err := io.Copy(tmpFile, audio); err != nil {
+		return fmt.Errorf("failed to copy audio: %w", err)
+	}
+	if _, err := tmpFile.Write(trailer); err != nil {
+		return fmt.Errorf("failed to write tag: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	file.Close()
+	return os.Rename(tmpPath, path)
+}
+
+// id3Frame is a raw ID3v2 frame
+type id3Frame struct {
+	id   string
+	body []byte
+	raw  []byte // including the header
+}
+
+// splitID3Frames splits b into frames until padding or the end of b
+func splitID3Frames(b []byte, synchsafeSize bool) []id3Frame {
+	var frames []id3Frame
+	for len(b) >= 10 && b[0] != 0 {
+		size := int(binary.BigEndian.Uint32(b[4:8]))
+		if synchsafeSize {
+			size = synchsafe(b[4:8])
+		}
+		if size > len(b)-10 {
+			break
+		}
+		frames = append(frames, id3Frame{id: string(b[:4]), body: b[10 : 10+size], raw: b[:10+size]})
+		b = b[10+size:]
+	}
+	return frames
+}
+
+// splitChapSubframes splits the sub-frames of a CHAP frame. Their sizes are synchsafe in
+// ID3v2.4 and should not be in ID3v2.3, but id3v2 (and so chape) writes them synchsafe
+// in ID3v2.3 as well, so both are tried.
+func splitChapSubframes(b []byte, version byte) []id3Frame {
+	frames := splitID3Frames(b, version == 4)
+	if version == 3 {
+		n := 0
+		for _, f := range frames {
+			n += len(f.raw)
+		}
+		if n < len(b) && b[n] != 0 {
+			return splitID3Frames(b, true)
+		}
+	}
+	return frames
+}
+
+// parseAPIC parses the body of an APIC frame
+func parseAPIC(b []byte) *id3v2.PictureFrame {
+	if len(b) < 1 {
+		return nil
+	}
+	enc := b[0]
+	mimeType, rest, ok := bytes.Cut(b[1:], []byte{0})
+	if !ok || len(rest) < 1 {
+		return nil
+	}
+	pictureType := rest[0]
+	description, data := cutID3Text(enc, rest[1:])
+	return &id3v2.PictureFrame{
+		Encoding:    id3v2.EncodingUTF8,
+		MimeType:    string(mimeType),
+		PictureType: pictureType,
+		Description: description,
+		Picture:     data,
+	}
+}
+
+// parseTXXX parses the body of a TXXX frame
+func parseTXXX(b []byte) (description, value string) {
+	if len(b) < 1 {
+		return "", ""
+	}
+	description, rest := cutID3Text(b[0], b[1:])
+	value, _ = cutID3Text(b[0], rest)
+	return description, value
+}
+
+// parseWXXX parses the body of a WXXX frame and returns the description and URL
+func parseWXXX(b []byte) (description, url string) {
+	if len(b) < 1 {
+		return "", ""
+	}
+	description, rest := cutID3Text(b[0], b[1:])
+	// The URL is always in ISO-8859-1
+	u, _, _ := bytes.Cut(rest, []byte{0})
+	return description, decodeID3Text(0, u)
+}
+
+// encodeWXXX encodes the body of a WXXX frame with the description in enc
+func encodeWXXX(enc id3v2.Encoding, description, url string) []byte {
+	body := append([]byte{enc.Key}, encodeID3Text(enc.Key, description)...)
+	body = append(body, id3Terminator(enc.Key)...)
+	return append(body, encodeID3Text(0, url)...)
+}
+
+// cutID3Text cuts the text terminated in the encoding from b and returns the decoded text
+// and the rest. If there's no terminator, all of b is the text.
+func cutID3Text(enc byte, b []byte) (string, []byte) {
+	if enc == 1 || enc == 2 { // UTF-16 is terminated by 0x00 0x00
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				return decodeID3Text(enc, b[:i]), b[i+2:]
+			}
+		}
+		return decodeID3Text(enc, b), nil
+	}
+	text, rest, _ := bytes.Cut(b, []byte{0})
+	return decodeID3Text(enc, text), rest
+}
+
+// decodeID3Text decodes the text in the ID3v2 encoding:
+// 0 for ISO-8859-1, 1 for UTF-16 with BOM, 2 for UTF-16BE and 3 for UTF-8
+func decodeID3Text(enc byte, b []byte) string {
+	switch enc {
+	case 0:
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		return string(runes)
+	case 1, 2:
+		bigEndian := true
+		if enc == 1 && len(b) >= 2 {
+			bigEndian = !(b[0] == 0xFF && b[1] == 0xFE)
+			if (b[0] == 0xFF && b[1] == 0xFE) || (b[0] == 0xFE && b[1] == 0xFF) {
+				b = b[2:]
+			}
+		}
+		u := make([]uint16, len(b)/2)
+		for i := range u {
+			if bigEndian {
+				u[i] = binary.BigEndian.Uint16(b[2*i:])
+			} else {
+				u[i] = binary.LittleEndian.Uint16(b[2*i:])
+			}
+		}
+		return string(utf16.Decode(u))
+	default:
+		return string(b)
+	}
+}
+
+// encodeID3Text encodes s in the ID3v2 encoding without the terminator.
+// Characters that ISO-8859-1 can't represent are replaced with '?'.
+func encodeID3Text(enc byte, s string) []byte {
+	switch enc {
+	case 0:
+		b := make([]byte, 0, len(s))
+		for _, r := range s {
+			if r > 0xFF {
+				r = '?'
+			}
+			b = append(b, byte(r))
+		}
+		return b
+	case 1, 2:
+		var b []byte
+		order := binary.AppendByteOrder(binary.BigEndian)
+		if enc == 1 {
+			b = []byte{0xFF, 0xFE}
+			order = binary.LittleEndian
+		}
+		for _, u := range utf16.Encode([]rune(s)) {
+			b = order.AppendUint16(b, u)
+		}
+		return b
+	default:
+		return []byte(s)
+	}
+}
+
+// id3Terminator returns the terminator of text in the ID3v2 encoding
+func id3Terminator(enc byte) []byte {
+	if enc == 1 || enc == 2 {
+		return []byte{0, 0}
+	}
+	return []byte{0}
+}
+
+// synchsafe decodes a 4-byte synchsafe integer
+func synchsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// putSynchsafe encodes n as a 4-byte synchsafe integer into b
+func putSynchsafe(b []byte, n int) {
+	b[0] = byte(n>>21) & 0x7f
+	b[1] = byte(n>>14) & 0x7f
+	b[2] = byte(n>>7) & 0x7f
+	b[3] = byte(n) & 0x7f
+}
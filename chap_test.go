@@ -0,0 +1,164 @@
+package chape
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+func TestApplyChapterImageAndURL(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+
+	yamlContent := `title: Chapter Extras
+chapters:
+- 0:00 Intro
+- start: "0:00.500"
+  title: "Main: with extras"
+  image: ./testdata/assets/logo.png
+  url: https://example.com/main
+- start: "0:00.800"
+  title: Link only
+  url: https://example.com/link
+`
+	c := New(mp3Path)
+	if err := c.Apply(strings.NewReader(yamlContent), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	metadata, err := c.Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if len(metadata.Chapters) != 3 {
+		t.Fatalf("unexpected chapters: %v", metadata.Chapters)
+	}
+	if ch := metadata.Chapters[0]; ch.Image != "" || ch.URL != "" {
+		t.Errorf("chapter without extras got image %q and URL %q", ch.Image, ch.URL)
+	}
+	if ch := metadata.Chapters[1]; ch.Title != "Main: with extras" || ch.Image != "./testdata/assets/logo.png" || ch.URL != "https://example.com/main" {
+		t.Errorf("unexpected chapter: %+v", ch)
+	}
+	if ch := metadata.Chapters[2]; ch.Image != "" || ch.URL != "https://example.com/link" {
+		t.Errorf("unexpected chapter: %+v", ch)
+	}
+
+	// The image is embedded as an APIC sub-frame
+	f, err := os.Open(mp3Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	id3tag, extras, _, err := readID3Tag(f)
+	if err != nil {
+		t.Fatalf("readID3Tag failed: %v", err)
+	}
+	// The frames following the CHAP frame with sub-frames id3v2 doesn't support are kept
+	if len(id3tag.GetFrames("CHAP")) != 3 || topLevelCTOC(id3tag) == nil {
+		t.Errorf("frames after the chapter image were lost")
+	}
+	logo, err := os.ReadFile("testdata/assets/logo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := extras["chp1"]; e == nil || e.picture == nil || e.picture.MimeType != "image/png" || !bytes.Equal(e.picture.Picture, logo) {
+		t.Errorf("chapter image was not embedded: %+v", e)
+	}
+
+	// Applying the same YAML again is a no-op
+	if err := c.Apply(strings.NewReader(yamlContent), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+}
+
+func TestDecodeID3Text(t *testing.T) {
+	tests := []struct {
+		enc  byte
+		in   []byte
+		want string
+	}{
+		{0, []byte{'c', 'a', 'f', 0xE9}, "café"},
+		{1, []byte{0xFF, 0xFE, 'h', 0, 'i', 0}, "hi"},
+		{1, []byte{0xFE, 0xFF, 0, 'h', 0, 'i'}, "hi"},
+		{2, []byte{0, 'h', 0, 'i'}, "hi"},
+		{3, []byte("日本語"), "日本語"},
+	}
+	for _, tt := range tests {
+		if got := decodeID3Text(tt.enc, tt.in); got != tt.want {
+			t.Errorf("decodeID3Text(%d, %v) = %q, want %q", tt.enc, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestChapFrameSize(t *testing.T) {
+	cf := &chapFrame{
+		ChapterFrame: id3v2.ChapterFrame{
+			ElementID: "chp0",
+			Title:     &id3v2.TextFrame{Encoding: id3v2.EncodingUTF8, Text: "Intro"},
+		},
+		encoding: id3v2.EncodingUTF16,
+		picture:  &id3v2.PictureFrame{Encoding: id3v2.EncodingUTF8, MimeType: "image/png", Picture: []byte("png")},
+		source:   "cover.png",
+		url:      "https://example.com",
+	}
+	var buf bytes.Buffer
+	n, err := cf.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	if int(n) != buf.Len() || buf.Len() != cf.Size() {
+		t.Errorf("Size() = %d, written %d bytes (reported %d)", cf.Size(), buf.Len(), n)
+	}
+}
+
+func TestApplyChapterDescription(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+
+	yamlContent := `title: Chapter Descriptions
+chapters:
+- 0:00 Intro
+- start: "0:00.500"
+  title: Main
+  description: The main topic in depth
+- start: "0:00.800"
+  title: Link
+  url: https://example.com/link
+  description: Links for the listeners
+`
+	c := New(mp3Path)
+	if err := c.Apply(strings.NewReader(yamlContent), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	metadata, err := c.Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if len(metadata.Chapters) != 3 {
+		t.Fatalf("unexpected chapters: %v", metadata.Chapters)
+	}
+	for i, want := range []string{"", "The main topic in depth", "Links for the listeners"} {
+		if got := metadata.Chapters[i].Description; got != want {
+			t.Errorf("description of chapter %d = %q, want %q", i, got, want)
+		}
+	}
+
+	// Only the chapters with a description take the mapping form
+	var buf bytes.Buffer
+	c.NoSchema = true
+	if err := c.Dump(&buf); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	for _, want := range []string{"- 0:00 Intro\n", "  description: The main topic in depth\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("dump doesn't contain %q:\n%s", want, buf.String())
+		}
+	}
+
+	// Applying the same YAML again is a no-op
+	if err := c.Apply(strings.NewReader(yamlContent), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+}
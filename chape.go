@@ -1,18 +1,150 @@
 package chape
 
 import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
+
+	"golang.org/x/term"
 )
 
 type Chape struct {
 	audio   string
 	artwork string
+	// reader is the audio given to NewFromReader, read instead of the audio file
+	reader io.ReadSeeker
+
+	// Backup makes Apply, Edit and Write copy the original audio file to "<audio>.bak"
+	// before writing, and restore it if writing fails
+	Backup bool
+
+	// DryRun makes Apply, Edit and Write only show the diff to the current metadata,
+	// never writing the audio file nor asking for confirmation
+	DryRun bool
+
+	// NoPromptReopen makes Apply fail with ErrNoTerminal rather than reopen the terminal
+	// to ask for confirmation when the input is stdin or the output is redirected, for
+	// automation that must never wait for an answer
+	NoPromptReopen bool
+
+	// Verbose makes Dump write the details of the tag, e.g. the ID3v2 version and size of MP3
+	// files, as comments above the YAML output
+	Verbose bool
+
+	// NoSchema makes Dump and Edit omit the YAML Language Server schema comment of the YAML output
+	NoSchema bool
+
+	// SchemaURL is the URL of the schema referred to by the schema comment of the YAML output,
+	// e.g. of a release tag. It defaults to the CHAPE_SCHEMA_URL environment variable, or
+	// the schema of the main branch.
+	SchemaURL string
+
+	// ChapterPrecision is the precision of the chapter times on Dump: ChapterPrecisionAuto
+	// (default), ChapterPrecisionSeconds or ChapterPrecisionMillis
+	ChapterPrecision ChapterPrecision
+
+	// ChapterSort is how the chapters read from the audio file are ordered: ChapterSortAuto
+	// (default) follows the table of contents if any, ChapterSortTime sorts them by start time
+	// and ChapterSortNone keeps the stored order
+	ChapterSort ChapterSort
+
+	// LyricsFrom is the path to an LRC file whose lines replace the synchronised lyrics on Apply
+	LyricsFrom string
+
+	// KeepArtwork makes Apply, Edit and Write keep the embedded picture as is, without
+	// fetching the artwork again, when its source is the same as the recorded one
+	KeepArtwork bool
+
+	// ID3Version is the ID3v2 version (3 or 4) of the tags written to MP3 files.
+	// It defaults to 4. When it's set, a tag of the other version is converted even if the
+	// metadata is unchanged.
+	ID3Version int
+
+	// FrameLanguage overrides the ISO 639-2 code of the comment and lyrics frames on writing
+	FrameLanguage string
+
+	// RatingEmail is the email identifier of the POPM frame holding the rating of MP3 files.
+	// It defaults to "no@email" as MediaMonkey writes.
+	RatingEmail string
+
+	// DownloadTimeout limits the time to download the artwork and chapter images from
+	// HTTP(S) URLs on writing an audio file. It defaults to 30 seconds.
+	DownloadTimeout time.Duration
+
+	// DownloadRetries is the number of retries of downloading the artwork and chapter images
+	// on network errors and 429 or 5xx responses. It defaults to 3, and a negative value disables retries.
+	DownloadRetries int
+
+	// MaxRedirects is the maximum number of HTTP redirects followed on downloading the artwork
+	// and chapter images. It defaults to 10, and a negative value forbids redirects.
+	MaxRedirects int
+
+	// SameHostRedirects makes the downloads of the artwork and chapter images fail on
+	// a redirect to another host, e.g. for pipelines fetching untrusted URLs
+	SameHostRedirects bool
+
+	// MaxArtworkSize is the maximum size in bytes of the artwork to embed. Writing fails when
+	// a new artwork exceeds it, while the artwork already embedded is kept as is. Downloads of
+	// the artwork and chapter images are aborted as soon as they exceed it.
+	// It defaults to 5 MiB, and a negative value disables the limit.
+	MaxArtworkSize int
+
+	// ChaptersFrom is the path to a plain text chapter list, e.g. copied from a YouTube
+	// description, whose chapters replace the chapters on Apply
+	ChaptersFrom string
+
+	// ChapterTemplate is the fmt template of the titles given to the chapters without a title
+	// on Apply, formatted with the 1-based chapter number, e.g. "Chapter %02d"
+	ChapterTemplate string
+
+	// SortChapters makes Apply, Edit and Write sort the chapters by start time before writing,
+	// instead of failing on chapters out of order
+	SortChapters bool
+
+	// AllowDuplicateChapterStarts makes Apply, Edit and Write accept chapters starting at
+	// the same time, which are rejected by default
+	AllowDuplicateChapterStarts bool
+
+	// Prune makes Apply, Edit and Write delete the standard text frames of MP3 files that are
+	// empty or whitespace only, e.g. left by buggy taggers. Frames chape doesn't know are kept.
+	Prune bool
+
+	// StampEncoder makes Apply, Edit and Write record the chape version in the encoder
+	// settings (TSSE) when they're left blank
+	StampEncoder bool
+
+	// ID3v1 is how Apply, Edit and Write treat the ID3v1 tag at the end of MP3 files:
+	// ID3v1Keep (default) keeps it with a warning when it disagrees with the metadata,
+	// ID3v1Sync writes it from the metadata and ID3v1Strip removes it
+	ID3v1 ID3v1Mode
+
+	// Merge makes Apply overlay the fields set in the input onto the current metadata, keeping
+	// the fields omitted from the input as they are. Empty, zero and false values count as
+	// omitted, so merging clears only the fields given as null in the YAML input, e.g.
+	// "comment: null"; Unset clears them otherwise.
+	Merge bool
+
+	// Unset is the fields, by their YAML names like "genre", cleared on Apply. It's meant for
+	// Merge, as a field omitted from the input is cleared without it.
+	Unset []string
+
+	// Quiet suppresses the informational logs, e.g. "Metadata updated successfully.", for
+	// scripts. Warnings and errors are still logged, and so is the diff to confirm without yes.
+	Quiet bool
+
+	// strip makes writing remove all the frames of the tag before writing metadata
+	strip bool
 }
 
 func New(audio string, artwork ...string) *Chape {
@@ -25,7 +157,290 @@ func New(audio string, artwork ...string) *Chape {
 	return c
 }
 
+// NewFromReader returns a Chape reading the audio from rs instead of a file, e.g. an object
+// in a storage. The format is detected from the content. Reading methods such as Dump,
+// Metadata and Diff work without touching the filesystem, while writing ones fail
+// with ErrReadOnly.
+func NewFromReader(rs io.ReadSeeker) *Chape {
+	return &Chape{reader: rs}
+}
+
+// ArtworkSourceName is the tag name recording the source of the artwork, shared by all formats
+const ArtworkSourceName = "CHAPE_SOURCE"
+
+// legacyArtworkSourceName is the tag name recorded by older versions. It's still read,
+// and replaced with ArtworkSourceName on writing.
+const legacyArtworkSourceName = "CHAPEL_SOURCE"
+
+// isArtworkSourceName reports whether the tag name records the source of the artwork
+func isArtworkSourceName(name string) bool {
+	return name == ArtworkSourceName || name == legacyArtworkSourceName
+}
+
+// ErrReadOnly is returned on writing the audio read by a Chape of NewFromReader
+var ErrReadOnly = errors.New("the audio given as a reader can't be written")
+
+// ErrNoTerminal is returned on writing without yes when there's no terminal to ask for
+// confirmation on
+var ErrNoTerminal = errors.New("no terminal to confirm the changes: use -y, or set CHAPE_YES=1 to apply them without confirmation")
+
+// ErrUnsupportedFormat is matched by the errors of an audio file of a format chape doesn't
+// support, e.g. an unknown extension
+var ErrUnsupportedFormat = errors.New("unsupported audio format")
+
+// ErrNoArtwork is matched by the error of extracting the artwork of an audio file without one
+var ErrNoArtwork = errors.New("no embedded artwork")
+
+// ErrInvalidChapterTime is matched by the errors of a malformed chapter time, e.g. "1:xx"
+var ErrInvalidChapterTime = errors.New("invalid chapter time")
+
+// FileError is an error about the audio file of Path, for callers processing many files.
+// The message is the one of Err, which usually names the file.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string { return e.Err.Error() }
+func (e *FileError) Unwrap() error { return e.Err }
+
+// fileError wraps err in a *FileError of the audio file, if any
+func (c *Chape) fileError(err error) error {
+	if err == nil || c.audio == "" {
+		return err
+	}
+	return &FileError{Path: c.audio, Err: err}
+}
+
+// kindError makes err match the sentinel kind with errors.Is, keeping the message of err
+type kindError struct {
+	err  error
+	kind error
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.err, e.kind} }
+
+// audioSource opens the audio to read, the file of path or the reader given to NewFromReader
+type audioSource struct {
+	path   string
+	reader io.ReadSeeker
+}
+
+// open opens the audio from the beginning. Closing a reader given to NewFromReader is a no-op.
+func (s audioSource) open() (io.ReadSeekCloser, error) {
+	if s.reader == nil {
+		return os.Open(s.path)
+	}
+	if _, err := s.reader.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return nopReadSeekCloser{s.reader}, nil
+}
+
+// nopReadSeekCloser is an io.ReadSeekCloser whose Close does nothing
+type nopReadSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopReadSeekCloser) Close() error { return nil }
+
+// audioExt returns the extension telling the format of the audio, detected from
+// the content for the reader given to NewFromReader
+func (c *Chape) audioExt() (string, error) {
+	if c.reader == nil {
+		return strings.ToLower(filepath.Ext(c.audio)), nil
+	}
+	if _, err := c.reader.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to seek the reader: %w", err)
+	}
+	head := make([]byte, 12)
+	n, err := io.ReadFull(c.reader, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", fmt.Errorf("failed to read the reader: %w", err)
+	}
+	head = head[:n]
+	switch {
+	case string(head[:min(n, 4)]) == "fLaC":
+		return ".flac", nil
+	case n >= 8 && string(head[4:8]) == "ftyp":
+		return ".m4a", nil
+	case string(head[:min(n, 3)]) == "ID3", n >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0:
+		return ".mp3", nil
+	}
+	return "", &kindError{err: errors.New("unknown audio format of the reader"), kind: ErrUnsupportedFormat}
+}
+
+// tagger reads and writes the format specific tags of an audio file
+type tagger interface {
+	// readMetadata reads metadata from the tags. Artwork is CHAPE_SOURCE if recorded,
+	// otherwise the embedded picture as data URI. Chapters are in the stored order.
+	readMetadata() (*Metadata, error)
+	// writeMetadata writes metadata to the tags. ctx cancels downloading artwork.
+	writeMetadata(context.Context, *Metadata) error
+	// embeddedArtwork returns the embedded picture as data URI, or "" if none
+	embeddedArtwork() (string, error)
+	// writeArtwork replaces the front cover with artwork and records its source,
+	// keeping the other tags as they are. ctx cancels downloading artwork.
+	writeArtwork(ctx context.Context, artwork string) error
+	duration() (time.Duration, error)
+}
+
+// chapterOrderer is implemented by taggers whose format can define the chapter order,
+// e.g. the CTOC frame of ID3v2. Such chapters are not sorted by start time.
+type chapterOrderer interface {
+	// chaptersOrdered reports whether the chapters read by readMetadata are in the defined order
+	chaptersOrdered() bool
+}
+
+// detailer is implemented by taggers that can describe the tag and the stream for Verbose
+type detailer interface {
+	// details returns the lines describing the tag and the stream, e.g. "ID3v2.4.0, 2048 bytes"
+	details() ([]string, error)
+}
+
+// pruner is implemented by taggers that can delete the empty frames left by other taggers
+type pruner interface {
+	// emptyFrameIDs returns the IDs of the empty frames that writing with Prune deletes
+	emptyFrameIDs() ([]string, error)
+}
+
+// emptyFrameIDs returns the IDs of the empty frames to delete for Prune, or nil if the
+// format has none
+func (c *Chape) emptyFrameIDs() ([]string, error) {
+	if !c.Prune {
+		return nil, nil
+	}
+	t, err := c.tagger()
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := t.(pruner); ok {
+		return p.emptyFrameIDs()
+	}
+	return nil, nil
+}
+
+// versioner is implemented by taggers whose tag version can be chosen on writing
+type versioner interface {
+	// tagVersion returns the major version of the tag in the file, or zero if there's none
+	tagVersion() (byte, error)
+}
+
+// versionPending returns the version of the tag in the file when writing converts it to
+// ID3Version, or zero otherwise
+func (c *Chape) versionPending() (byte, error) {
+	if c.ID3Version == 0 {
+		return 0, nil
+	}
+	t, err := c.tagger()
+	if err != nil {
+		return 0, err
+	}
+	v, ok := t.(versioner)
+	if !ok {
+		return 0, nil
+	}
+	version, err := v.tagVersion()
+	if err != nil || version == 0 || version == byte(c.ID3Version) {
+		return 0, err
+	}
+	return version, nil
+}
+
+// id3v1Checker is implemented by taggers of the formats that can have an ID3v1 tag
+type id3v1Checker interface {
+	// checkID3v1 reports whether the file has an ID3v1 tag and whether it agrees with metadata
+	checkID3v1(m *Metadata) (exists, agrees bool, err error)
+}
+
+// tagDetails returns the details of the tag for Verbose, or nil if the format has none
+func (c *Chape) tagDetails() ([]string, error) {
+	t, err := c.tagger()
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := t.(detailer); ok {
+		return d.details()
+	}
+	return nil, nil
+}
+
+// tagger returns the tagger for the audio file based on its extension
+func (c *Chape) tagger() (tagger, error) {
+	ext, err := c.audioExt()
+	if err != nil {
+		return nil, err
+	}
+	src := audioSource{path: c.audio, reader: c.reader}
+	switch ext {
+	case ".mp3":
+		if c.ID3Version != 0 && c.ID3Version != 3 && c.ID3Version != 4 {
+			return nil, fmt.Errorf("unsupported ID3v2 version %d: must be 3 or 4", c.ID3Version)
+		}
+		return &mp3Tagger{
+			audioSource:     src,
+			version:         byte(c.ID3Version),
+			ratingEmail:     cmp.Or(c.RatingEmail, defaultRatingEmail),
+			downloadRetries: c.downloadRetries(),
+			maxArtworkSize:  c.maxArtworkSize(),
+			strip:           c.strip,
+			prune:           c.Prune,
+			id3v1:           c.ID3v1,
+		}, nil
+	case ".flac":
+		return &flacTagger{audioSource: src, downloadRetries: c.downloadRetries(), maxArtworkSize: c.maxArtworkSize()}, nil
+	case ".m4a", ".m4b", ".mp4":
+		return &mp4Tagger{audioSource: src, downloadRetries: c.downloadRetries(), maxArtworkSize: c.maxArtworkSize()}, nil
+	default:
+		return nil, c.fileError(&kindError{
+			err:  fmt.Errorf("unsupported audio file type %q: %s", filepath.Ext(c.audio), c.audio),
+			kind: ErrUnsupportedFormat,
+		})
+	}
+}
+
+// downloadRetries returns the number of retries of downloading artwork from DownloadRetries
+func (c *Chape) downloadRetries() int {
+	switch {
+	case c.DownloadRetries < 0:
+		return 0
+	case c.DownloadRetries == 0:
+		return defaultDownloadRetries
+	default:
+		return c.DownloadRetries
+	}
+}
+
+// maxArtworkSize returns the maximum size of the artwork from MaxArtworkSize, zero if unlimited
+func (c *Chape) maxArtworkSize() int {
+	switch {
+	case c.MaxArtworkSize < 0:
+		return 0
+	case c.MaxArtworkSize == 0:
+		return defaultMaxArtworkSize
+	default:
+		return c.MaxArtworkSize
+	}
+}
+
+// Edit opens the metadata of the audio file as YAML in the editor and applies the edited one.
+// Nothing is applied when the editor exits with a nonzero status, e.g. :cq of Vim, or the
+// content is left unchanged.
 func (c *Chape) Edit(yes bool) error {
+	return c.EditContext(context.Background(), yes)
+}
+
+// EditContext is like Edit, but ctx cancels downloading artwork.
+func (c *Chape) EditContext(ctx context.Context, yes bool) error {
+	// Fail before editing rather than discarding the edit
+	if c.reader != nil && !c.DryRun {
+		return ErrReadOnly
+	}
+	editor, err := resolveEditor()
+	if err != nil {
+		return err
+	}
 	// Create a temporary YAML file with current metadata
 	tempFile, err := os.CreateTemp("", "chape-*.yaml")
 	if err != nil {
@@ -35,17 +450,17 @@ func (c *Chape) Edit(yes bool) error {
 	defer tempFile.Close()
 
 	// Dump current metadata to temp file with artwork handling
-	err = c.Dump(tempFile)
-	if err != nil {
+	var dumped bytes.Buffer
+	if err := c.Dump(&dumped); err != nil {
 		return fmt.Errorf("failed to dump metadata: %w", err)
 	}
+	if _, err := tempFile.Write(dumped.Bytes()); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
 
 	// Close file before opening with editor
 	tempFile.Close()
 
-	// Get editor command
-	editor := getEditor()
-
 	// Build command - use shell only if editor contains whitespace
 	var cmd *exec.Cmd
 	if strings.ContainsFunc(editor, unicode.IsSpace) {
@@ -74,20 +489,30 @@ func (c *Chape) Edit(yes bool) error {
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	err = cmd.Run()
-	if err != nil {
+	if err := cmd.Run(); err != nil {
+		// Exiting with a nonzero status is the way to abort the edit in some editors
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			c.logf("The editor exited with status %d. No changes made.", exitErr.ExitCode())
+			return nil
+		}
 		return fmt.Errorf("editor command failed: %w", err)
 	}
 
-	// Read edited content back
-	editedFile, err := os.Open(tempFile.Name())
+	// Read edited content back. The content is compared rather than the modification time,
+	// which doesn't tell a save without edits from an edit, and may not change on a quick
+	// save on file systems of coarse timestamps.
+	edited, err := os.ReadFile(tempFile.Name())
 	if err != nil {
 		return fmt.Errorf("failed to read edited file: %w", err)
 	}
-	defer editedFile.Close()
+	if bytes.Equal(edited, dumped.Bytes()) {
+		c.logf("No changes made.")
+		return nil
+	}
 
 	// Apply the edited metadata
-	err = c.Apply(editedFile, yes)
+	err = c.ApplyContext(ctx, bytes.NewReader(edited), yes)
 	if err != nil {
 		return fmt.Errorf("failed to apply changes: %w", err)
 	}
@@ -95,6 +520,33 @@ func (c *Chape) Edit(yes bool) error {
 	return nil
 }
 
+// resolveEditor returns the editor command to use. Unless CHAPE_EDITOR is set, e.g. to
+// a script, it fails rather than blocking when stdin isn't a terminal, as on a headless
+// server where the default vi would hang.
+func resolveEditor() (string, error) {
+	editor := getEditor()
+	if os.Getenv("CHAPE_EDITOR") == "" && !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("no terminal to run the editor %q: set CHAPE_EDITOR or run apply with piped YAML", editor)
+	}
+	// The editor may have arguments, e.g. "code --wait"
+	fields := strings.Fields(editor)
+	if len(fields) == 0 {
+		return "", errors.New("no editor specified: set CHAPE_EDITOR or EDITOR")
+	}
+	// An editor with quotes or shell metacharacters, e.g. a quoted path with spaces, is left
+	// to the shell running it
+	if strings.ContainsAny(editor, shellSpecialChars) {
+		return editor, nil
+	}
+	if _, err := exec.LookPath(fields[0]); err != nil {
+		return "", fmt.Errorf("editor %q not found: set CHAPE_EDITOR or EDITOR to an installed editor", fields[0])
+	}
+	return editor, nil
+}
+
+// shellSpecialChars is the characters the shell treats specially, such as quotes
+const shellSpecialChars = "\"'\\`$|&;<>()*?[]{}~#!%^"
+
 // getEditor returns the editor command to use
 func getEditor() string {
 	// Check environment variables in order of preference
@@ -2,63 +2,90 @@ package chape_test
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/Songmu/chape"
+	"github.com/bogem/id3v2/v2"
 	"github.com/goccy/go-yaml"
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
-// createDummyMP3 creates a dummy MP3 file with approximately the specified duration
-func createDummyMP3(t *testing.T, duration time.Duration) string {
+// createDummyMP3 is shared with the internal tests
+var createDummyMP3 = chape.CreateDummyMP3
+
+// createDummyFLAC creates a dummy FLAC file with the specified duration.
+// It only contains a STREAMINFO block followed by placeholder audio bytes.
+func createDummyFLAC(t *testing.T, duration time.Duration) string {
 	t.Helper()
 
-	tmpDir := t.TempDir()
-	mp3Path := filepath.Join(tmpDir, "chape_test.mp3")
-	tmpFile, err := os.Create(mp3Path)
-	if err != nil {
-		t.Fatalf("Failed to create MP3 file: %v", err)
-	}
-	defer tmpFile.Close()
+	const sampleRate = 44100
+	totalSamples := uint64(duration.Seconds() * sampleRate)
 
-	// Write ID3v2 header (empty)
-	id3v2Header := []byte{
-		0x49, 0x44, 0x33, // "ID3"
-		0x04, 0x00, // Version 2.4.0
-		0x00,                   // Flags
-		0x00, 0x00, 0x00, 0x00, // Size (0, will be updated by id3v2 library)
-	}
-	if _, err := tmpFile.Write(id3v2Header); err != nil {
-		t.Fatalf("Failed to write ID3v2 header: %v", err)
+	streamInfo := make([]byte, 34)
+	binary.BigEndian.PutUint16(streamInfo[0:], 4096) // min block size
+	binary.BigEndian.PutUint16(streamInfo[2:], 4096) // max block size
+	// sample rate (20 bits), channels-1 (3 bits), bits per sample-1 (5 bits), total samples (36 bits)
+	binary.BigEndian.PutUint64(streamInfo[10:], sampleRate<<44|1<<41|15<<36|totalSamples)
+
+	var buf bytes.Buffer
+	buf.WriteString("fLaC")
+	buf.Write([]byte{0x80, 0x00, 0x00, byte(len(streamInfo))}) // last block, STREAMINFO
+	buf.Write(streamInfo)
+	buf.Write(bytes.Repeat([]byte{0xFF, 0xF8, 0x69, 0x18}, 1024))
+
+	flacPath := filepath.Join(t.TempDir(), "chape_test.flac")
+	if err := os.WriteFile(flacPath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to create FLAC file: %v", err)
 	}
+	return flacPath
+}
 
-	// Calculate approximate number of frames needed
-	// MP3 frame duration is typically around 26ms for 44.1kHz
-	frameDurationMs := 26
-	totalFrames := int(duration.Milliseconds()) / frameDurationMs
+// mp4Box builds an MP4 atom from its type and body
+func mp4Box(typ string, body ...[]byte) []byte {
+	b := bytes.Join(body, nil)
+	return append(binary.BigEndian.AppendUint32(nil, uint32(8+len(b))), append([]byte(typ), b...)...)
+}
 
-	// MP3 frame header for 44.1kHz, 128kbps, stereo
-	frameHeader := []byte{0xFF, 0xFB, 0x90, 0x00}
+// createDummyM4A creates a dummy M4A file with the specified duration.
+// The moov atom precedes mdat, so chunk offsets must be kept in sync on write.
+func createDummyM4A(t *testing.T, duration time.Duration) string {
+	t.Helper()
 
-	// Create frames with minimal data
-	frameSize := 417 // Typical frame size for 128kbps
-	frameData := make([]byte, frameSize)
-	copy(frameData, frameHeader)
-	// Fill rest with pattern to make it look like audio data
-	for i := 4; i < frameSize; i++ {
-		frameData[i] = byte(i % 256)
+	ftyp := mp4Box("ftyp", []byte("M4A \x00\x00\x00\x00M4A mp42isom"))
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)                            // timescale
+	binary.BigEndian.PutUint32(mvhd[16:], uint32(duration.Milliseconds())) // duration
+	buildMoov := func(chunkOffset uint32) []byte {
+		stco := binary.BigEndian.AppendUint32(make([]byte, 4), 1)
+		stco = binary.BigEndian.AppendUint32(stco, chunkOffset)
+		return mp4Box("moov",
+			mp4Box("mvhd", mvhd),
+			mp4Box("trak", mp4Box("mdia", mp4Box("minf", mp4Box("stbl", mp4Box("stco", stco))))))
 	}
+	mdat := mp4Box("mdat", bytes.Repeat([]byte{0x21, 0x10, 0x04, 0x60}, 1024))
+	// The chunk offset points at the body of mdat
+	moov := buildMoov(uint32(len(ftyp) + len(buildMoov(0)) + 8))
 
-	for i := range totalFrames {
-		if _, err := tmpFile.Write(frameData); err != nil {
-			t.Fatalf("Failed to write MP3 frame %d: %v", i, err)
-		}
+	m4aPath := filepath.Join(t.TempDir(), "chape_test.m4a")
+	if err := os.WriteFile(m4aPath, bytes.Join([][]byte{ftyp, moov, mdat}, nil), 0644); err != nil {
+		t.Fatalf("Failed to create M4A file: %v", err)
 	}
-	return mp3Path
+	return m4aPath
+}
+
+// audioFixtures creates a dummy audio file of each format, keyed by the format name
+var audioFixtures = map[string]func(*testing.T, time.Duration) string{
+	"mp3":  createDummyMP3,
+	"flac": createDummyFLAC,
+	"m4a":  createDummyM4A,
 }
 
 // normalizeYAMLForComparison normalizes YAML content like apply.go does
@@ -83,49 +110,58 @@ func TestIntegration(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to find test files: %v", err)
 	}
+	dummyAudios := []struct {
+		ext    string
+		create func(*testing.T, time.Duration) string
+	}{
+		{"mp3", createDummyMP3},
+		{"flac", createDummyFLAC},
+		{"m4a", createDummyM4A},
+	}
 	for _, testFile := range testFiles {
-		t.Run(filepath.Base(testFile), func(t *testing.T) {
-			// Read original YAML
-			originalYAML, err := os.ReadFile(testFile)
-			if err != nil {
-				t.Fatalf("Failed to read test file %s: %v", testFile, err)
-			}
-
-			// Create dummy MP3 file (10 minutes)
-			mp3File := createDummyMP3(t, 10*time.Minute)
-			defer os.Remove(mp3File)
-
-			// Apply YAML to MP3
-			chape := chape.New(mp3File)
-			originalReader := bytes.NewReader(originalYAML)
-
-			err = chape.Apply(originalReader, true) // Use -y flag to skip prompts
-			if err != nil {
-				t.Fatalf("Failed to apply YAML to MP3: %v", err)
-			}
-
-			// Dump metadata back to YAML
-			var dumpedYAML bytes.Buffer
-			err = chape.Dump(&dumpedYAML)
-			if err != nil {
-				t.Fatalf("Failed to dump metadata from MP3: %v", err)
-			}
-
-			// Normalize both YAMLs for comparison like apply.go does
-			originalNormalized := normalizeYAMLForComparison(t, string(originalYAML))
-			dumpedNormalized := normalizeYAMLForComparison(t, dumpedYAML.String())
-
-			// Compare normalized content
-			if originalNormalized != dumpedNormalized {
-				// Generate diff for better error reporting
-				dmp := diffmatchpatch.New()
-				diffs := dmp.DiffMain(originalNormalized, dumpedNormalized, false)
-				diffText := dmp.DiffPrettyText(diffs)
-
-				t.Errorf("YAML content mismatch for %s:\n%s", testFile, diffText)
-				t.Logf("\nOriginal normalized:\n%s\n\nDumped normalized:\n%s", originalNormalized, dumpedNormalized)
-			}
-		})
+		for _, dummy := range dummyAudios {
+			t.Run(filepath.Base(testFile)+"/"+dummy.ext, func(t *testing.T) {
+				// Read original YAML
+				originalYAML, err := os.ReadFile(testFile)
+				if err != nil {
+					t.Fatalf("Failed to read test file %s: %v", testFile, err)
+				}
+
+				// Create dummy audio file (10 minutes)
+				audioFile := dummy.create(t, 10*time.Minute)
+
+				// Apply YAML to audio file
+				chape := chape.New(audioFile)
+				originalReader := bytes.NewReader(originalYAML)
+
+				err = chape.Apply(originalReader, true) // Use -y flag to skip prompts
+				if err != nil {
+					t.Fatalf("Failed to apply YAML to %s: %v", dummy.ext, err)
+				}
+
+				// Dump metadata back to YAML
+				var dumpedYAML bytes.Buffer
+				err = chape.Dump(&dumpedYAML)
+				if err != nil {
+					t.Fatalf("Failed to dump metadata from %s: %v", dummy.ext, err)
+				}
+
+				// Normalize both YAMLs for comparison like apply.go does
+				originalNormalized := normalizeYAMLForComparison(t, string(originalYAML))
+				dumpedNormalized := normalizeYAMLForComparison(t, dumpedYAML.String())
+
+				// Compare normalized content
+				if originalNormalized != dumpedNormalized {
+					// Generate diff for better error reporting
+					dmp := diffmatchpatch.New()
+					diffs := dmp.DiffMain(originalNormalized, dumpedNormalized, false)
+					diffText := dmp.DiffPrettyText(diffs)
+
+					t.Errorf("YAML content mismatch for %s:\n%s", testFile, diffText)
+					t.Logf("\nOriginal normalized:\n%s\n\nDumped normalized:\n%s", originalNormalized, dumpedNormalized)
+				}
+			})
+		}
 	}
 }
 
@@ -242,3 +278,535 @@ func TestIntegrationEmptyMP3(t *testing.T) {
 		t.Error("Dumped YAML should contain schema comment")
 	}
 }
+
+func TestIntegrationM4AChunkOffsets(t *testing.T) {
+	m4aFile := createDummyM4A(t, 1*time.Minute)
+
+	yamlContent := `title: "Chunk Offset Test"
+comment: "Media data moves as the metadata grows"
+chapters:
+- 0:00 Opening
+- 0:30.250 Second Half
+`
+	c := chape.New(m4aFile)
+	if err := c.Apply(strings.NewReader(yamlContent), true); err != nil {
+		t.Fatalf("Failed to apply YAML to M4A: %v", err)
+	}
+
+	data, err := os.ReadFile(m4aFile)
+	if err != nil {
+		t.Fatalf("Failed to read M4A file: %v", err)
+	}
+	stco := bytes.Index(data, []byte("stco"))
+	mdat := bytes.Index(data, []byte("mdat"))
+	if stco < 0 || mdat < 0 {
+		t.Fatalf("stco or mdat atom not found")
+	}
+	// stco body: version/flags (4), entry count (4), chunk offsets
+	chunkOffset := binary.BigEndian.Uint32(data[stco+12:])
+	if want := uint32(mdat + 4); chunkOffset != want {
+		t.Errorf("chunk offset = %d, want %d (body of mdat)", chunkOffset, want)
+	}
+
+	var dumped bytes.Buffer
+	if err := c.Dump(&dumped); err != nil {
+		t.Fatalf("Failed to dump metadata from M4A: %v", err)
+	}
+	if !strings.Contains(dumped.String(), "0:30.250 Second Half") {
+		t.Errorf("chapter was not round-tripped:\n%s", dumped.String())
+	}
+}
+
+func TestUnsupportedAudioFile(t *testing.T) {
+	var buf bytes.Buffer
+	err := chape.New("audio.ogg").Dump(&buf)
+	if err == nil || !strings.Contains(err.Error(), "unsupported audio file type") {
+		t.Errorf("expected unsupported audio file type error, got %v", err)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	mp3File := createDummyMP3(t, 1*time.Minute)
+	c := chape.New(mp3File)
+
+	yamlContent := `title: "Programmatic Access"
+track: "3/10"
+chapters:
+- 0:00 Intro
+- 0:30 Outro
+`
+	if err := c.Apply(strings.NewReader(yamlContent), true); err != nil {
+		t.Fatalf("Failed to apply YAML: %v", err)
+	}
+
+	metadata, err := c.Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if metadata.Title != "Programmatic Access" {
+		t.Errorf("Title = %q, want %q", metadata.Title, "Programmatic Access")
+	}
+	if metadata.Track == nil || metadata.Track.Current != 3 || metadata.Track.Total != 10 {
+		t.Errorf("Track = %v, want 3/10", metadata.Track)
+	}
+	if len(metadata.Chapters) != 2 || metadata.Chapters[1].Start != 30*time.Second {
+		t.Errorf("unexpected chapters: %v", metadata.Chapters)
+	}
+}
+
+func TestNewFromReader(t *testing.T) {
+	yamlContent := `title: "From Reader"
+chapters:
+- 0:00 Intro
+- 0:30 Outro
+`
+	for name, create := range audioFixtures {
+		t.Run(name, func(t *testing.T) {
+			audioFile := create(t, 1*time.Minute)
+			if err := chape.New(audioFile).Apply(strings.NewReader(yamlContent), true); err != nil {
+				t.Fatalf("Failed to apply YAML: %v", err)
+			}
+			var want bytes.Buffer
+			if err := chape.New(audioFile).Dump(&want); err != nil {
+				t.Fatalf("Failed to dump metadata: %v", err)
+			}
+
+			b, err := os.ReadFile(audioFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := chape.NewFromReader(bytes.NewReader(b))
+			var got bytes.Buffer
+			if err := c.Dump(&got); err != nil {
+				t.Fatalf("Failed to dump metadata from reader: %v", err)
+			}
+			if got.String() != want.String() {
+				t.Errorf("dump from reader = %s, want %s", got.String(), want.String())
+			}
+			if err := c.Apply(strings.NewReader("title: Changed\n"), true); !errors.Is(err, chape.ErrReadOnly) {
+				t.Errorf("Apply error = %v, want ErrReadOnly", err)
+			}
+		})
+	}
+
+	_, err := chape.NewFromReader(strings.NewReader("OggS")).Metadata()
+	if err == nil || !strings.Contains(err.Error(), "unknown audio format") {
+		t.Errorf("expected unknown audio format error, got %v", err)
+	}
+}
+
+func TestWriteEmptyNumberInSet(t *testing.T) {
+	for name, create := range audioFixtures {
+		t.Run(name, func(t *testing.T) {
+			audioFile := create(t, 10*time.Second)
+			metadata := &chape.Metadata{
+				Title:          "No Numbers",
+				Disc:           &chape.NumberInSet{},
+				Track:          &chape.NumberInSet{Total: 10},
+				MovementNumber: &chape.NumberInSet{Total: 4},
+			}
+			if err := chape.New(audioFile).Write(metadata, true); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			got, err := chape.New(audioFile).Metadata()
+			if err != nil {
+				t.Fatalf("Metadata failed: %v", err)
+			}
+			if got.Title != "No Numbers" || got.Track != nil || got.Disc != nil || got.MovementNumber != nil {
+				t.Errorf("unexpected metadata: %+v", got)
+			}
+			if name != "mp3" {
+				return
+			}
+			tag, err := id3v2.Open(audioFile, id3v2.Options{Parse: true})
+			if err != nil {
+				t.Fatalf("failed to open tag: %v", err)
+			}
+			defer tag.Close()
+			for _, id := range []string{"TRCK", "TPOS", "MVIN"} {
+				if frames := tag.GetFrames(id); len(frames) > 0 {
+					t.Errorf("stray %s frame: %v", id, frames)
+				}
+			}
+		})
+	}
+}
+
+func TestClearSortOrder(t *testing.T) {
+	for name, create := range audioFixtures {
+		t.Run(name, func(t *testing.T) {
+			audioFile := create(t, 10*time.Second)
+			metadata := &chape.Metadata{
+				Title:           "Abbey Road",
+				Artist:          chape.Values{"The Beatles"},
+				TitleSort:       "Abbey Road",
+				ArtistSort:      "Beatles, The",
+				AlbumSort:       "Abbey Road",
+				AlbumArtistSort: "Beatles, The",
+			}
+			if err := chape.New(audioFile).Write(metadata, true); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			got, err := chape.New(audioFile).Metadata()
+			if err != nil {
+				t.Fatalf("Metadata failed: %v", err)
+			}
+			if got.ArtistSort != "Beatles, The" || got.AlbumArtistSort != "Beatles, The" || got.AlbumSort != "Abbey Road" {
+				t.Errorf("unexpected metadata: %+v", got)
+			}
+
+			// Empty values remove the stale sort order
+			metadata = &chape.Metadata{Title: "Abbey Road", Artist: chape.Values{"The Beatles"}}
+			if err := chape.New(audioFile).Write(metadata, true); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			got, err = chape.New(audioFile).Metadata()
+			if err != nil {
+				t.Fatalf("Metadata failed: %v", err)
+			}
+			if got.TitleSort != "" || got.ArtistSort != "" || got.AlbumSort != "" || got.AlbumArtistSort != "" {
+				t.Errorf("stale sort order: %+v", got)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	mp3File := createDummyMP3(t, 1*time.Minute)
+	c := chape.New(mp3File)
+
+	date := &chape.Timestamp{Time: time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), Precision: chape.PrecisionDay}
+	metadata := &chape.Metadata{
+		Title:    "Written Directly",
+		Date:     date,
+		Chapters: []*chape.Chapter{{Title: "Intro", Start: 0}, {Title: "Main", Start: 20 * time.Second}},
+	}
+	if err := c.Write(metadata, true); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	var dumped bytes.Buffer
+	if err := c.Dump(&dumped); err != nil {
+		t.Fatalf("Failed to dump metadata: %v", err)
+	}
+	for _, want := range []string{"title: Written Directly", "date: 2024-03-15", "- 0:20 Main"} {
+		if !strings.Contains(dumped.String(), want) {
+			t.Errorf("dumped YAML should contain %q:\n%s", want, dumped.String())
+		}
+	}
+}
+
+func TestIntegrationChapterEnd(t *testing.T) {
+	mp3File := createDummyMP3(t, 1*time.Minute)
+	c := chape.New(mp3File)
+
+	yamlContent := `title: "Gapped Chapters"
+chapters:
+- 0:00-0:15 Intro
+- 0:20 Main
+- 0:40-0:50 Outro
+`
+	if err := c.Apply(strings.NewReader(yamlContent), true); err != nil {
+		t.Fatalf("Failed to apply YAML: %v", err)
+	}
+
+	metadata, err := c.Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	expected := []string{"0:00-0:15 Intro", "0:20 Main", "0:40-0:50 Outro"}
+	if len(metadata.Chapters) != len(expected) {
+		t.Fatalf("unexpected chapters: %v", metadata.Chapters)
+	}
+	for i, want := range expected {
+		if got := metadata.Chapters[i].String(); got != want {
+			t.Errorf("chapter[%d] = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestIntegrationChapterMilliseconds(t *testing.T) {
+	mp3File := createDummyMP3(t, 2*time.Minute)
+	c := chape.New(mp3File)
+
+	yamlContent := `title: "Precise Mix"
+chapters:
+- 0:00 Intro
+- 1:30.123 Topic
+`
+	if err := c.Apply(strings.NewReader(yamlContent), true); err != nil {
+		t.Fatalf("Failed to apply YAML: %v", err)
+	}
+
+	var dumped bytes.Buffer
+	if err := c.Dump(&dumped); err != nil {
+		t.Fatalf("Failed to dump metadata: %v", err)
+	}
+	var metadata chape.Metadata
+	if err := yaml.Unmarshal(dumped.Bytes(), &metadata); err != nil {
+		t.Fatalf("Failed to parse dumped YAML: %v", err)
+	}
+	if len(metadata.Chapters) != 2 {
+		t.Fatalf("unexpected chapters: %v", metadata.Chapters)
+	}
+	if got, want := metadata.Chapters[1].Start, 90123*time.Millisecond; got != want {
+		t.Errorf("chapter start = %v, want %v", got, want)
+	}
+}
+
+func TestMultipleValues(t *testing.T) {
+	input := "title: Episode\nartist:\n- Alice\n- Bob\ngenre:\n- Podcast\n- Technology\ncomposer: Carol\n"
+	expected := chape.Values{"Podcast", "Technology"}
+
+	tests := []struct {
+		name     string
+		path     string
+		version  int
+		readBack chape.Values
+	}{
+		{"mp3", createDummyMP3(t, time.Second), 4, expected},
+		{"mp3 ID3v2.3", createDummyMP3(t, time.Second), 3, chape.Values{"Podcast; Technology"}},
+		{"flac", createDummyFLAC(t, time.Second), 0, expected},
+		{"m4a", createDummyM4A(t, time.Second), 0, chape.Values{"Podcast; Technology"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := chape.New(tt.path)
+			c.ID3Version = tt.version
+			if err := c.Apply(strings.NewReader(input), true); err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+			metadata, err := chape.New(tt.path).Metadata()
+			if err != nil {
+				t.Fatalf("Metadata failed: %v", err)
+			}
+			if !reflect.DeepEqual(metadata.Genre, tt.readBack) {
+				t.Errorf("unexpected genre: %q", metadata.Genre)
+			}
+			artists := chape.Values{"Alice", "Bob"}
+			if len(tt.readBack) == 1 {
+				artists = chape.Values{"Alice; Bob"}
+			}
+			if !reflect.DeepEqual(metadata.Artist, artists) {
+				t.Errorf("unexpected artist: %q", metadata.Artist)
+			}
+			if !reflect.DeepEqual(metadata.Composer, chape.Values{"Carol"}) {
+				t.Errorf("unexpected composer: %q", metadata.Composer)
+			}
+		})
+	}
+
+	// ID3v2.4 separates the values with NUL
+	mp3Path := createDummyMP3(t, time.Second)
+	if err := chape.New(mp3Path).Apply(strings.NewReader(input), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatalf("failed to open tag: %v", err)
+	}
+	if got := tag.Artist(); got != "Alice\x00Bob" {
+		t.Errorf("unexpected TPE1: %q", got)
+	}
+	tag.Close()
+	var buf bytes.Buffer
+	if err := chape.New(mp3Path).Dump(&buf); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "artist:\n- Alice\n- Bob\n") || !strings.Contains(buf.String(), "composer: Carol\n") {
+		t.Errorf("unexpected YAML:\n%s", buf.String())
+	}
+
+	var m chape.Metadata
+	if err := yaml.Unmarshal([]byte("genre: Podcast\n"), &m); err != nil {
+		t.Fatal(err)
+	}
+	out, err := yaml.Marshal(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "genre: Podcast\n") {
+		t.Errorf("a single genre should be a scalar:\n%s", out)
+	}
+	m.Genre = expected
+	if out, err = yaml.Marshal(&m); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "genre:\n- Podcast\n- Technology\n") {
+		t.Errorf("multiple genres should be a list:\n%s", out)
+	}
+}
+
+func TestFractionalBPM(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		version  int
+		readBack chape.BPM
+	}{
+		{"mp3", createDummyMP3(t, time.Second), 4, 128.5},
+		{"mp3 ID3v2.3", createDummyMP3(t, time.Second), 3, 129},
+		{"flac", createDummyFLAC(t, time.Second), 0, 128.5},
+		{"m4a", createDummyM4A(t, time.Second), 0, 129},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := chape.New(tt.path)
+			c.ID3Version = tt.version
+			if err := c.Apply(strings.NewReader("title: Track\nbpm: 128.5\n"), true); err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+			metadata, err := chape.New(tt.path).Metadata()
+			if err != nil {
+				t.Fatalf("Metadata failed: %v", err)
+			}
+			if metadata.BPM != tt.readBack {
+				t.Errorf("unexpected BPM: %v, want %v", metadata.BPM, tt.readBack)
+			}
+		})
+	}
+
+	// Integer BPM is dumped without a fraction
+	mp3Path := createDummyMP3(t, time.Second)
+	if err := chape.New(mp3Path).Apply(strings.NewReader("title: Track\nbpm: 120\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := chape.New(mp3Path).Dump(&buf); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "bpm: 120\n") {
+		t.Errorf("unexpected YAML:\n%s", buf.String())
+	}
+}
+
+func TestCompilation(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		version int
+	}{
+		{"mp3", createDummyMP3(t, time.Second), 4},
+		{"mp3 ID3v2.3", createDummyMP3(t, time.Second), 3},
+		{"flac", createDummyFLAC(t, time.Second), 0},
+		{"m4a", createDummyM4A(t, time.Second), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, want := range []bool{true, false} {
+				c := chape.New(tt.path)
+				c.ID3Version = tt.version
+				input := fmt.Sprintf("title: Track\ncompilation: %t\n", want)
+				if err := c.Apply(strings.NewReader(input), true); err != nil {
+					t.Fatalf("Apply failed: %v", err)
+				}
+				metadata, err := chape.New(tt.path).Metadata()
+				if err != nil {
+					t.Fatalf("Metadata failed: %v", err)
+				}
+				if metadata.Compilation != want {
+					t.Errorf("unexpected compilation: %t, want %t", metadata.Compilation, want)
+				}
+			}
+		})
+	}
+
+	// false removes the TCMP frame
+	mp3Path := tests[0].path
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatalf("failed to open tag: %v", err)
+	}
+	defer tag.Close()
+	if f := tag.GetLastFrame("TCMP"); f != nil {
+		t.Errorf("TCMP frame is left: %v", f)
+	}
+}
+
+func TestMovement(t *testing.T) {
+	input := "title: Allegro\nwork: Symphony No. 9\nmovement: Molto vivace\nmovementNumber: 2/4\n"
+	tests := []struct {
+		name    string
+		path    string
+		version int
+	}{
+		{"mp3", createDummyMP3(t, time.Second), 4},
+		{"mp3 ID3v2.3", createDummyMP3(t, time.Second), 3},
+		{"flac", createDummyFLAC(t, time.Second), 0},
+		{"m4a", createDummyM4A(t, time.Second), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := chape.New(tt.path)
+			c.ID3Version = tt.version
+			if err := c.Apply(strings.NewReader(input), true); err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+			var buf bytes.Buffer
+			if err := chape.New(tt.path).Dump(&buf); err != nil {
+				t.Fatalf("Dump failed: %v", err)
+			}
+			for _, want := range []string{"work: Symphony No. 9\n", "movement: Molto vivace\n", "movementNumber: 2/4\n"} {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("%q not found in YAML:\n%s", want, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestPodcastFrames(t *testing.T) {
+	input := `title: Episode 1
+description: The first episode
+podcastId: https://example.com/episodes/1
+feedUrl: https://example.com/feed.xml
+podcast: true
+category: Technology
+keywords:
+- go
+- audio
+`
+	tests := []struct {
+		name    string
+		path    string
+		version int
+	}{
+		{"mp3", createDummyMP3(t, time.Second), 4},
+		{"mp3 ID3v2.3", createDummyMP3(t, time.Second), 3},
+		{"flac", createDummyFLAC(t, time.Second), 0},
+		{"m4a", createDummyM4A(t, time.Second), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := chape.New(tt.path)
+			c.ID3Version = tt.version
+			if err := c.Apply(strings.NewReader(input), true); err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+			metadata, err := chape.New(tt.path).Metadata()
+			if err != nil {
+				t.Fatalf("Metadata failed: %v", err)
+			}
+			if metadata.Description != "The first episode" || metadata.PodcastID != "https://example.com/episodes/1" ||
+				metadata.FeedURL != "https://example.com/feed.xml" || !metadata.Podcast || metadata.Category != "Technology" {
+				t.Errorf("unexpected metadata: %+v", metadata)
+			}
+			if !reflect.DeepEqual(metadata.Keywords, chape.Values{"go", "audio"}) {
+				t.Errorf("unexpected keywords: %q", metadata.Keywords)
+			}
+		})
+	}
+
+	// WFED is a URL frame without the encoding and TKWD is comma separated
+	tag, err := id3v2.Open(tests[0].path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatalf("failed to open tag: %v", err)
+	}
+	defer tag.Close()
+	if uf, ok := tag.GetLastFrame("WFED").(id3v2.UnknownFrame); !ok || string(uf.Body) != "https://example.com/feed.xml" {
+		t.Errorf("unexpected WFED: %#v", tag.GetLastFrame("WFED"))
+	}
+	if got := tag.GetTextFrame("TKWD").Text; got != "go,audio" {
+		t.Errorf("unexpected TKWD: %q", got)
+	}
+}
@@ -0,0 +1,196 @@
+package chape
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FormatWebVTT is the WebVTT format for chapters
+const FormatWebVTT Format = "webvtt"
+
+// DumpChapters writes the chapters of the audio file to output in the given format.
+// Currently only WebVTT is supported.
+func (c *Chape) DumpChapters(output io.Writer, format Format) error {
+	if format != FormatWebVTT {
+		return fmt.Errorf("unsupported chapter format %q", format)
+	}
+	metadata, t, err := c.readMetadata()
+	if err != nil {
+		return err
+	}
+	var audioDuration time.Duration
+	if len(metadata.Chapters) > 0 {
+		if audioDuration, err = t.duration(); err != nil {
+			return fmt.Errorf("failed to get audio duration: %w", err)
+		}
+	}
+	return writeWebVTT(output, metadata.Chapters, audioDuration)
+}
+
+// webVTTEscaper escapes the characters of cue text that start tags or character references,
+// and ">" so that a title can't contain "-->"
+var webVTTEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// writeWebVTT writes chapters as a WebVTT document, one cue per chapter
+// cf. https://www.w3.org/TR/webvtt1/
+func writeWebVTT(w io.Writer, chapters []*Chapter, audioDuration time.Duration) error {
+	var sb strings.Builder
+	sb.WriteString("WEBVTT\n")
+	for i, chapter := range chapters {
+		fmt.Fprintf(&sb, "\n%s --> %s\n%s\n",
+			formatWebVTTTime(chapter.Start),
+			formatWebVTTTime(chapterEnd(chapters, i, audioDuration)),
+			webVTTEscaper.Replace(chapter.Title))
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// formatWebVTTTime formats duration as a WebVTT timestamp (HH:MM:SS.mmm)
+func formatWebVTTTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, (ms%3600000)/60000, (ms%60000)/1000, ms%1000)
+}
+
+// Chapter list lines with a timestamp at the start, e.g. "0:00 Intro" and "1:02:03 - Topic",
+// or after the title, e.g. "Intro 0:00" and "Topic (1:02:03)"
+var (
+	chapterListLeadingTimeReg  = regexp.MustCompile(`^(\d+(?::\d{1,2}){1,2}(?:\.\d+)?)(?:\s*[-–—:|]\s*|\s+|$)(.*)$`)
+	chapterListTrailingTimeReg = regexp.MustCompile(`^(.*?)(?:\s*[-–—:|]\s*|\s+)[(\[]?(\d+(?::\d{1,2}){1,2}(?:\.\d+)?)[)\]]?$`)
+)
+
+// parseChapterList parses a plain text chapter list such as YouTube descriptions have,
+// one chapter per line. Leading bullets and dashes are ignored, and lines without a
+// timestamp at the start or the end are skipped.
+func parseChapterList(r io.Reader) ([]*Chapter, error) {
+	var chapters []*Chapter
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		line = strings.TrimSpace(strings.TrimLeft(line, "-*+•–—"))
+		var timeStr, title string
+		if m := chapterListLeadingTimeReg.FindStringSubmatch(line); m != nil {
+			timeStr, title = m[1], m[2]
+		} else if m := chapterListTrailingTimeReg.FindStringSubmatch(line); m != nil {
+			title, timeStr = m[1], m[2]
+		} else {
+			continue
+		}
+		start, err := parseChapterTime(timeStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chapter %q: %w", line, err)
+		}
+		chapters = append(chapters, &Chapter{Title: strings.TrimSpace(title), Start: start})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(chapters) == 0 {
+		return nil, errors.New("no timestamped lines in chapter list")
+	}
+	return chapters, nil
+}
+
+// webVTTTagReg matches the tags of WebVTT cue text, e.g. <v Speaker>, </v>, <c.loud> and
+// the <00:01.000> timestamps
+var webVTTTagReg = regexp.MustCompile(`<[^>]*>`)
+
+// parseWebVTT parses a WebVTT document, one chapter per cue. NOTE, STYLE and REGION blocks
+// are skipped, and the tags of the cue text are stripped. The end of a cue is kept only
+// when it isn't the start of the next cue, as chape derives the end from it.
+// cf. https://www.w3.org/TR/webvtt1/
+func parseWebVTT(r io.Reader) ([]*Chapter, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimPrefix(strings.ReplaceAll(string(b), "\r\n", "\n"), "\ufeff")
+	blocks := strings.Split(strings.ReplaceAll(text, "\r", "\n"), "\n\n")
+	var chapters []*Chapter
+	var ends []time.Duration
+	// The first block is the WEBVTT header
+	for _, block := range blocks[1:] {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+		switch strings.SplitN(strings.TrimSpace(lines[0]), " ", 2)[0] {
+		case "NOTE", "STYLE", "REGION", "":
+			continue
+		}
+		// The cue identifier is optional
+		if !strings.Contains(lines[0], "-->") && len(lines) > 1 {
+			lines = lines[1:]
+		}
+		startStr, rest, ok := strings.Cut(lines[0], "-->")
+		if !ok {
+			continue
+		}
+		start, err := parseChapterTime(strings.TrimSpace(startStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid cue %q: %w", lines[0], err)
+		}
+		// Cue settings may follow the end
+		end, err := parseChapterTime(strings.SplitN(strings.TrimSpace(rest), " ", 2)[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cue %q: %w", lines[0], err)
+		}
+		var titles []string
+		for _, line := range lines[1:] {
+			if line = strings.TrimSpace(html.UnescapeString(webVTTTagReg.ReplaceAllString(line, ""))); line != "" {
+				titles = append(titles, line)
+			}
+		}
+		chapters = append(chapters, &Chapter{Title: strings.Join(titles, " "), Start: start})
+		ends = append(ends, end)
+	}
+	if len(chapters) == 0 {
+		return nil, errors.New("no cues in WebVTT")
+	}
+	for i, chapter := range chapters[:len(chapters)-1] {
+		if ends[i] != chapters[i+1].Start {
+			chapter.End = ends[i]
+		}
+	}
+	return chapters, nil
+}
+
+// readChaptersFile reads chapters from the file of a plain text chapter list, or a WebVTT
+// document starting with "WEBVTT"
+func readChaptersFile(path string) ([]*Chapter, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open chapters file: %w", err)
+	}
+	parse := parseChapterList
+	if strings.HasPrefix(strings.TrimPrefix(string(b), "\ufeff"), "WEBVTT") {
+		parse = parseWebVTT
+	}
+	chapters, err := parse(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse chapters file: %w", err)
+	}
+	return chapters, nil
+}
+
+// fillChapterTitles sets the titles of the chapters without a title by formatting template
+// with the 1-based chapter number. The chapters with a title are left intact.
+func fillChapterTitles(chapters []*Chapter, template string) error {
+	for i, chapter := range chapters {
+		if chapter.Title != "" {
+			continue
+		}
+		title := fmt.Sprintf(template, i+1)
+		// fmt reports a wrong or missing verb in the output, e.g. "%!(EXTRA int=1)"
+		if strings.Contains(title, "%!") {
+			return fmt.Errorf("invalid chapter template %q: it must have one integer verb, e.g. %%02d", template)
+		}
+		chapter.Title = title
+	}
+	return nil
+}
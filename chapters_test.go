@@ -0,0 +1,166 @@
+package chape
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteWebVTT(t *testing.T) {
+	chapters := []*Chapter{
+		{Title: "Introduction", Start: 0},
+		{Title: "Main Topic", Start: 90500 * time.Millisecond, End: 50 * time.Minute},
+		{Title: "Closing", Start: time.Hour},
+	}
+	var buf bytes.Buffer
+	if err := writeWebVTT(&buf, chapters, time.Hour+5*time.Minute+123*time.Millisecond); err != nil {
+		t.Fatalf("writeWebVTT failed: %v", err)
+	}
+	expected := `WEBVTT
+
+00:00:00.000 --> 00:01:30.500
+Introduction
+
+00:01:30.500 --> 00:50:00.000
+Main Topic
+
+01:00:00.000 --> 01:05:00.123
+Closing
+`
+	if buf.String() != expected {
+		t.Errorf("writeWebVTT() =\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestDumpChaptersUnsupportedFormat(t *testing.T) {
+	if err := New(createDummyMP3(t, time.Second)).DumpChapters(&bytes.Buffer{}, "srt"); err == nil {
+		t.Error("DumpChapters should fail with unsupported format")
+	}
+}
+
+func TestFillChapterTitles(t *testing.T) {
+	chapters := []*Chapter{
+		{Start: 0},
+		{Title: "Interlude", Start: time.Minute},
+		{Start: 2 * time.Minute},
+	}
+	if err := fillChapterTitles(chapters, "Chapter %02d"); err != nil {
+		t.Fatalf("fillChapterTitles failed: %v", err)
+	}
+	for i, want := range []string{"Chapter 01", "Interlude", "Chapter 03"} {
+		if chapters[i].Title != want {
+			t.Errorf("chapters[%d].Title = %q, want %q", i, chapters[i].Title, want)
+		}
+	}
+
+	if err := fillChapterTitles([]*Chapter{{Start: 0}}, "Chapter"); err == nil {
+		t.Error("fillChapterTitles should fail with a template without a verb")
+	}
+}
+
+func TestParseChapterList(t *testing.T) {
+	input := `Chapters of this episode:
+0:00 Intro
+- 1:30 - Main Topic
+• 12:05.500 Q&A: Listener questions
+Wrap-up (1:02:03)
+Bonus track 1:10:00
+Thanks for watching!
+`
+	chapters, err := parseChapterList(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseChapterList failed: %v", err)
+	}
+	expected := []*Chapter{
+		{Title: "Intro", Start: 0},
+		{Title: "Main Topic", Start: 90 * time.Second},
+		{Title: "Q&A: Listener questions", Start: 12*time.Minute + 5500*time.Millisecond},
+		{Title: "Wrap-up", Start: time.Hour + 2*time.Minute + 3*time.Second},
+		{Title: "Bonus track", Start: time.Hour + 10*time.Minute},
+	}
+	if !reflect.DeepEqual(chapters, expected) {
+		t.Errorf("parseChapterList() = %v, want %v", chapters, expected)
+	}
+
+	if _, err := parseChapterList(strings.NewReader("no timestamps here\n")); err == nil {
+		t.Error("parseChapterList should fail without timestamped lines")
+	}
+}
+
+func TestParseWebVTT(t *testing.T) {
+	input := "\ufeffWEBVTT - chapters\r\n" +
+		"Kind: chapters\r\n" +
+		"\r\n" +
+		"STYLE\r\n" +
+		"::cue { color: yellow }\r\n" +
+		"\r\n" +
+		"REGION\r\n" +
+		"id:fred width:40%\r\n" +
+		"\r\n" +
+		"NOTE This file was made\r\n" +
+		"by a captioning tool\r\n" +
+		"\r\n" +
+		"intro\r\n" +
+		"00:00:00.000 --> 00:01:30.000 align:start\r\n" +
+		"<v Host>Intro</v>\r\n" +
+		"\r\n" +
+		"NOTE\r\n" +
+		"00:05:00.000 --> 00:06:00.000\r\n" +
+		"\r\n" +
+		"01:30.000 --> 12:00.000\r\n" +
+		"<v.loud Guest>Q&amp;A</v> with\r\n" +
+		"<c.yellow>listeners</c>\r\n" +
+		"\r\n" +
+		"00:12:05.500 --> 01:02:03.000\r\n" +
+		"Wrap-up\r\n"
+	chapters, err := parseWebVTT(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseWebVTT failed: %v", err)
+	}
+	expected := []*Chapter{
+		{Title: "Intro", Start: 0},
+		{Title: "Q&A with listeners", Start: 90 * time.Second, End: 12 * time.Minute},
+		{Title: "Wrap-up", Start: 12*time.Minute + 5500*time.Millisecond},
+	}
+	if !reflect.DeepEqual(chapters, expected) {
+		t.Errorf("parseWebVTT() = %v, want %v", chapters, expected)
+	}
+
+	// The output of writeWebVTT is read back
+	var buf bytes.Buffer
+	if err := writeWebVTT(&buf, expected, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if chapters, err = parseWebVTT(&buf); err != nil {
+		t.Fatalf("parseWebVTT failed: %v", err)
+	}
+	if !reflect.DeepEqual(chapters, expected) {
+		t.Errorf("parseWebVTT() of writeWebVTT = %v, want %v", chapters, expected)
+	}
+
+	// Titles with the characters of tags, character references and the cue timing arrow
+	// are escaped and read back as they are
+	escaped := []*Chapter{
+		{Title: "Q&A <Live>", Start: 0},
+		{Title: "A --> B &amp; C", Start: time.Minute},
+	}
+	buf.Reset()
+	if err := writeWebVTT(&buf, escaped, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "\nQ&amp;A &lt;Live&gt;\n") {
+		t.Errorf("title is not escaped:\n%s", buf.String())
+	}
+	if chapters, err = parseWebVTT(&buf); err != nil {
+		t.Fatalf("parseWebVTT failed: %v", err)
+	}
+	if !reflect.DeepEqual(chapters, escaped) {
+		t.Errorf("parseWebVTT() of escaped titles = %v, want %v", chapters, escaped)
+	}
+
+	if _, err := parseWebVTT(strings.NewReader("WEBVTT\n\nNOTE only a note\n")); err == nil {
+		t.Error("parseWebVTT should fail without cues")
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/Songmu/chape"
 )
@@ -17,16 +19,129 @@ var cmdApply = &command{
 		fs := flag.NewFlagSet("chape apply", flag.ContinueOnError)
 		fs.SetOutput(errStream)
 		yes := fs.Bool("y", false, "Skip confirmation prompts")
+		dryRun := fs.Bool("dry-run", false, "Show the diff without writing, even with -y")
+		quiet := fs.Bool("quiet", false, "Suppress the informational logs, keeping warnings and errors")
+		noPromptReopen := fs.Bool("no-prompt-reopen", false, "Fail instead of reopening the terminal to confirm the changes when the input is stdin or the output is redirected")
+		backup := fs.Bool("backup", false, "Copy the original file to <file>.bak before writing")
+		format := fs.String("format", "yaml", "Input format (yaml, toml, ffmetadata)")
+		id3Version := fs.Int("id3-version", 4, "ID3v2 version (3 or 4) of the tag written to MP3 files")
+		frameLanguage := fs.String("frame-language", "", "ISO 639-2 code of the comment and lyrics frames (derived from the language field by default)")
+		ratingEmail := fs.String("rating-email", "no@email", "Email identifier of the POPM frame holding the rating")
+		maxArtworkSize := byteSize(5 << 20)
+		fs.Var(&maxArtworkSize, "max-artwork-size", "Maximum size of artwork to embed, e.g. 5MB (0 for no limit)")
+		downloadTimeout := fs.Duration("download-timeout", 30*time.Second, "Time limit to download artwork from URLs")
+		downloadRetries := fs.Int("download-retries", 3, "Number of retries to download artwork on transient failures")
+		noRedirect := fs.Bool("no-redirect", false, "Fail on HTTP redirects when downloading artwork")
+		maxRedirects := fs.Int("max-redirects", 10, "Maximum number of HTTP redirects followed when downloading artwork")
+		sameHostRedirects := fs.Bool("same-host-redirects", false, "Fail on HTTP redirects to another host when downloading artwork")
+		keepArtwork := fs.Bool("keep-artwork", false, "Keep the embedded artwork without fetching it again when its source is unchanged")
+		lyricsFrom := fs.String("lyrics-from", "", "LRC file to set the synchronised lyrics from")
+		chaptersFrom := fs.String("chapters-from", "", "Plain text chapter list (e.g. from a YouTube description) or WebVTT file to set the chapters from")
+		chapterTemplate := fs.String("chapter-template", "", `Template of the titles of the chapters without a title, e.g. "Chapter %02d"`)
+		sortChapters := fs.Bool("sort-chapters", false, "Sort the chapters by start time instead of failing on chapters out of order")
+		allowDuplicateStarts := fs.Bool("allow-duplicate-chapter-starts", false, "Accept chapters starting at the same time")
+		prune := fs.Bool("prune", false, "Delete the standard text frames of MP3 files that are empty or whitespace only")
+		id3v1 := fs.String("id3v1", "keep", "How to treat the ID3v1 tag of MP3 files: keep, sync or strip")
+		stampEncoder := fs.Bool("stamp-encoder", false, "Record the chape version in the encoder settings (TSSE) when they're left blank")
+		merge := fs.Bool("merge", false, "Apply only the fields set in the input, keeping the others as they are")
+		unset := fs.String("unset", "", "Comma separated fields to clear, e.g. genre,comment (for --merge)")
+		batch := fs.Bool("batch", false, "Apply the same input to all the audio files given as args")
+		stdinMP3 := fs.Bool("stdin-mp3", false, "Read the MP3 audio from stdin and write the tagged audio to the -o file. The metadata is read from the file given as the arg")
+		output := fs.String("o", "", "Output file of the tagged audio with --stdin-mp3")
 		if err := fs.Parse(argv); err != nil {
 			return err
 		}
 		argv = fs.Args()
+		if *stdinMP3 {
+			switch {
+			case *output == "":
+				return fmt.Errorf("-o is required with --stdin-mp3 to write the tagged audio")
+			case strings.ToLower(filepath.Ext(*output)) != ".mp3":
+				return fmt.Errorf("output file of --stdin-mp3 must be an MP3 file: %s", *output)
+			case len(argv) < 1:
+				return fmt.Errorf("no metadata file specified: stdin is the audio with --stdin-mp3")
+			case *batch:
+				return fmt.Errorf("--batch can't be used with --stdin-mp3")
+			case !*yes && !*dryRun:
+				return fmt.Errorf("-y or --dry-run is required with --stdin-mp3, as stdin is the audio")
+			}
+		} else if *output != "" {
+			return fmt.Errorf("-o can be used only with --stdin-mp3")
+		}
 		if len(argv) < 1 {
 			return fmt.Errorf("no args specified")
 		}
-		if strings.HasSuffix(argv[0], ".mp3") {
-			return chape.New(argv[0]).Apply(os.Stdin, *yes)
+		audio := argv[0]
+		if *stdinMP3 {
+			audio = *output
+		} else if *batch {
+			for _, f := range argv {
+				if !isAudioFile(f) {
+					return fmt.Errorf("unknown file type %q", f)
+				}
+			}
+		} else if !isAudioFile(argv[0]) {
+			return fmt.Errorf("unknown file type %q", argv[0])
+		}
+		c := chape.New(audio)
+		c.Backup = *backup
+		c.DryRun = *dryRun
+		c.Quiet = *quiet
+		c.NoPromptReopen = *noPromptReopen
+		c.KeepArtwork = *keepArtwork
+		c.LyricsFrom = *lyricsFrom
+		c.ChaptersFrom = *chaptersFrom
+		c.ChapterTemplate = *chapterTemplate
+		c.SortChapters = *sortChapters
+		c.AllowDuplicateChapterStarts = *allowDuplicateStarts
+		c.Prune = *prune
+		c.StampEncoder = *stampEncoder
+		c.ID3v1 = chape.ID3v1Mode(*id3v1)
+		c.Merge = *merge
+		for _, u := range strings.Split(*unset, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				c.Unset = append(c.Unset, u)
+			}
+		}
+		c.ID3Version = id3VersionOption(fs, *id3Version)
+		c.FrameLanguage = *frameLanguage
+		c.RatingEmail = *ratingEmail
+		c.DownloadTimeout = *downloadTimeout
+		c.DownloadRetries = downloadRetriesOption(*downloadRetries)
+		c.MaxRedirects = maxRedirectsOption(*noRedirect, *maxRedirects)
+		c.SameHostRedirects = *sameHostRedirects
+		c.MaxArtworkSize = maxArtworkSizeOption(maxArtworkSize)
+		if *stdinMP3 {
+			f, err := os.Open(argv[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return c.ApplyStream(ctx, os.Stdin, *output, f, metadataFormat(fs, *format, argv[0]))
+		}
+		if !*batch {
+			return c.ApplyContext(ctx, os.Stdin, *yes, chape.Format(*format))
+		}
+
+		results, err := c.ApplyBatch(ctx, argv, os.Stdin, *yes, chape.Format(*format))
+		if err != nil && results == nil {
+			return err
+		}
+		var failed int
+		for _, r := range results {
+			if r.Err != nil {
+				failed++
+				fmt.Fprintf(errStream, "FAIL %s: %v\n", r.Path, r.Err)
+				continue
+			}
+			fmt.Fprintf(outStream, "ok   %s\n", r.Path)
+		}
+		if err != nil {
+			return fmt.Errorf("aborted after %d of %d files: %w", len(results), len(argv), err)
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to apply to %d of %d files", failed, len(results))
 		}
-		return fmt.Errorf("unknown file type %q", argv[0])
+		return nil
 	},
 }
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/Songmu/chape"
+)
+
+var cmdArtwork = &command{
+	Name:        "artwork",
+	Description: "extract or set the embedded artwork (artwork extract|set)",
+	Run: func(ctx context.Context, argv []string, outStream, errStream io.Writer) error {
+		if len(argv) < 1 {
+			return fmt.Errorf("no subcommand specified: must be extract or set")
+		}
+		switch argv[0] {
+		case "extract":
+			return runArtworkExtract(argv[1:], errStream)
+		case "set":
+			return runArtworkSet(ctx, argv[1:], errStream)
+		}
+		return fmt.Errorf("unknown artwork subcommand %q: must be extract or set", argv[0])
+	},
+}
+
+func runArtworkExtract(argv []string, errStream io.Writer) error {
+	fs := flag.NewFlagSet("chape artwork extract", flag.ContinueOnError)
+	fs.SetOutput(errStream)
+	output := fs.String("o", "", "Output path; the extension is chosen from the MIME type if it has none (default: the audio file name)")
+	quiet := fs.Bool("quiet", false, "Suppress the informational logs, keeping warnings and errors")
+	if err := fs.Parse(argv); err != nil {
+		return err
+	}
+	argv = fs.Args()
+	if len(argv) < 1 {
+		return fmt.Errorf("no args specified")
+	}
+	audio := argv[0]
+	// Accept the flags after the audio file too, e.g. "artwork extract file.mp3 -o cover.jpg"
+	if err := fs.Parse(argv[1:]); err != nil {
+		return err
+	}
+	if !isAudioFile(audio) {
+		return fmt.Errorf("unknown file type %q", audio)
+	}
+	path, err := chape.New(audio).ExtractArtwork(*output)
+	if err != nil {
+		return err
+	}
+	if !*quiet {
+		log.Printf("Extracted the artwork to %s", path)
+	}
+	return nil
+}
+
+func runArtworkSet(ctx context.Context, argv []string, errStream io.Writer) error {
+	fs := flag.NewFlagSet("chape artwork set", flag.ContinueOnError)
+	fs.SetOutput(errStream)
+	dryRun := fs.Bool("dry-run", false, "Show the artwork to set without writing")
+	quiet := fs.Bool("quiet", false, "Suppress the informational logs, keeping warnings and errors")
+	backup := fs.Bool("backup", false, "Copy the original file to <file>.bak before writing")
+	id3Version := fs.Int("id3-version", 4, "ID3v2 version (3 or 4) of the tag created for MP3 files without one")
+	maxArtworkSize := byteSize(5 << 20)
+	fs.Var(&maxArtworkSize, "max-artwork-size", "Maximum size of artwork to embed, e.g. 5MB (0 for no limit)")
+	downloadTimeout := fs.Duration("download-timeout", 30*time.Second, "Time limit to download artwork from URLs")
+	downloadRetries := fs.Int("download-retries", 3, "Number of retries to download artwork on transient failures")
+	noRedirect := fs.Bool("no-redirect", false, "Fail on HTTP redirects when downloading artwork")
+	maxRedirects := fs.Int("max-redirects", 10, "Maximum number of HTTP redirects followed when downloading artwork")
+	sameHostRedirects := fs.Bool("same-host-redirects", false, "Fail on HTTP redirects to another host when downloading artwork")
+	if err := fs.Parse(argv); err != nil {
+		return err
+	}
+	argv = fs.Args()
+	if len(argv) < 2 {
+		return fmt.Errorf("usage: chape artwork set <file> <artwork>")
+	}
+	if !isAudioFile(argv[0]) {
+		return fmt.Errorf("unknown file type %q", argv[0])
+	}
+	c := chape.New(argv[0])
+	c.DryRun = *dryRun
+	c.Quiet = *quiet
+	c.Backup = *backup
+	c.ID3Version = *id3Version
+	c.DownloadTimeout = *downloadTimeout
+	c.DownloadRetries = downloadRetriesOption(*downloadRetries)
+	c.MaxRedirects = maxRedirectsOption(*noRedirect, *maxRedirects)
+	c.SameHostRedirects = *sameHostRedirects
+	c.MaxArtworkSize = maxArtworkSizeOption(maxArtworkSize)
+	return c.SetArtworkContext(ctx, argv[1])
+}
@@ -5,13 +5,21 @@ import (
 	"flag"
 	"log"
 	"os"
+	"os/signal"
 
 	"github.com/Songmu/chape/cmd"
 )
 
 func main() {
 	log.SetFlags(0)
-	err := cmd.Run(context.Background(), os.Args[1:], os.Stdout, os.Stderr)
+	// Ctrl-C cancels downloading artwork. Pressing it again terminates immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	err := cmd.Run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
 	if err != nil && err != flag.ErrHelp {
 		log.Println(err)
 		exitCode := 1
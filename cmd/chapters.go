@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/Songmu/chape"
+)
+
+var cmdChapters = &command{
+	Name:        "chapters",
+	Description: "export chapters in another format such as WebVTT",
+	Run: func(ctx context.Context, argv []string, outStream, errStream io.Writer) error {
+		fs := flag.NewFlagSet("chape chapters", flag.ContinueOnError)
+		fs.SetOutput(errStream)
+		format := fs.String("format", "webvtt", "output format (webvtt)")
+		if err := fs.Parse(argv); err != nil {
+			return err
+		}
+		argv = fs.Args()
+		if len(argv) < 1 {
+			return fmt.Errorf("no args specified")
+		}
+		if isAudioFile(argv[0]) {
+			return chape.New(argv[0]).DumpChapters(outStream, chape.Format(*format))
+		}
+		return fmt.Errorf("unknown file type %q", argv[0])
+	},
+}
@@ -35,7 +35,15 @@ var cmder = &commander{}
 func init() {
 	cmder.register(
 		cmdApply,
+		cmdArtwork,
+		cmdChapters,
+		cmdCp,
+		cmdDiff,
 		cmdDump,
+		cmdFrames,
+		cmdSchema,
+		cmdStrip,
+		cmdValidate,
 	)
 }
 
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/Songmu/chape"
+)
+
+var cmdCp = &command{
+	Name:        "cp",
+	Description: "copy metadata, artwork and chapters from one audio file to another",
+	Run: func(ctx context.Context, argv []string, outStream, errStream io.Writer) error {
+		fs := flag.NewFlagSet("chape cp", flag.ContinueOnError)
+		fs.SetOutput(errStream)
+		yes := fs.Bool("y", false, "Skip confirmation prompts")
+		backup := fs.Bool("backup", false, "Copy the original destination file to <file>.bak before writing")
+		quiet := fs.Bool("quiet", false, "Suppress the informational logs, keeping warnings and errors")
+		maxArtworkSize := byteSize(5 << 20)
+		fs.Var(&maxArtworkSize, "max-artwork-size", "Maximum size of artwork to embed, e.g. 5MB (0 for no limit)")
+		id3Version := fs.Int("id3-version", 4, "ID3v2 version (3 or 4) of the tag written to MP3 files")
+		if err := fs.Parse(argv); err != nil {
+			return err
+		}
+		argv = fs.Args()
+		if len(argv) < 2 {
+			return fmt.Errorf("usage: chape cp [options] source dest")
+		}
+		for _, f := range argv[:2] {
+			if !isAudioFile(f) {
+				return fmt.Errorf("unknown file type %q", f)
+			}
+		}
+		c := chape.New(argv[1])
+		c.Backup = *backup
+		c.Quiet = *quiet
+		c.ID3Version = id3VersionOption(fs, *id3Version)
+		c.MaxArtworkSize = maxArtworkSizeOption(maxArtworkSize)
+		return c.CopyFromContext(ctx, argv[0], *yes)
+	},
+}
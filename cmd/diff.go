@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Songmu/chape"
+)
+
+var cmdDiff = &command{
+	Name:        "diff",
+	Description: "show the changes apply would make, exiting 1 if there are any",
+	Run: func(ctx context.Context, argv []string, outStream, errStream io.Writer) error {
+		fs := flag.NewFlagSet("chape diff", flag.ContinueOnError)
+		fs.SetOutput(errStream)
+		format := fs.String("format", "yaml", "Input format (yaml, toml, ffmetadata)")
+		frameLanguage := fs.String("frame-language", "", "ISO 639-2 code of the comment and lyrics frames (derived from the language field by default)")
+		sortChapters := fs.Bool("sort-chapters", false, "Sort the chapters by start time instead of failing on chapters out of order")
+		allowDuplicateStarts := fs.Bool("allow-duplicate-chapter-starts", false, "Accept chapters starting at the same time")
+		if err := fs.Parse(argv); err != nil {
+			return err
+		}
+		argv = fs.Args()
+		if len(argv) < 1 {
+			return fmt.Errorf("no args specified")
+		}
+		if !isAudioFile(argv[0]) {
+			return fmt.Errorf("unknown file type %q", argv[0])
+		}
+		input := io.Reader(os.Stdin)
+		inputFormat := chape.Format(*format)
+		if len(argv) > 1 {
+			inputFormat = metadataFormat(fs, *format, argv[1])
+			f, err := os.Open(argv[1])
+			if err != nil {
+				return fmt.Errorf("failed to open input file: %w", err)
+			}
+			defer f.Close()
+			input = f
+		}
+		c := chape.New(argv[0])
+		c.FrameLanguage = *frameLanguage
+		c.SortChapters = *sortChapters
+		c.AllowDuplicateChapterStarts = *allowDuplicateStarts
+		changed, err := c.Diff(outStream, input, inputFormat)
+		if err != nil {
+			return err
+		}
+		if changed {
+			return fmt.Errorf("%s differs from the input", argv[0])
+		}
+		return nil
+	},
+}
@@ -5,7 +5,8 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"strings"
+	"os"
+	"path/filepath"
 
 	"github.com/Songmu/chape"
 )
@@ -16,7 +17,17 @@ var cmdDump = &command{
 		fs := flag.NewFlagSet("chape dump", flag.ContinueOnError)
 		fs.SetOutput(errStream)
 		var artworkPath string
-		fs.StringVar(&artworkPath, "artwork", "", "path or URL for artwork (extracts from MP3 if file doesn't exist)")
+		fs.StringVar(&artworkPath, "artwork", "", "path or URL for artwork (extracts from audio file if file doesn't exist)")
+		format := fs.String("format", "yaml", "output format (yaml, toml, json, ffmetadata, lrc)")
+		ratingEmail := fs.String("rating-email", "no@email", "email identifier of the POPM frame holding the rating")
+		output := fs.String("o", "", "file to write to instead of stdout (overwritten if it exists)")
+		mkdir := fs.Bool("mkdir", false, "create the parent directories of the -o file")
+		schemaURL := fs.String("schema-url", "", "URL of the schema referred to by the YAML output (default $CHAPE_SCHEMA_URL or the schema of the main branch)")
+		noSchema := fs.Bool("no-schema", false, "omit the schema comment of the YAML output")
+		chapterPrecision := fs.String("chapter-precision", "auto", "precision of the chapter times (auto, seconds, millis)")
+		sortChapters := fs.String("sort", "auto", "order of the chapters (auto: the table of contents if any, or by start time; time; none: as stored)")
+		quiet := fs.Bool("quiet", false, "suppress the informational logs, keeping warnings and errors")
+		verbose := fs.Bool("v", false, "write the tag details, e.g. the ID3v2 version and size, as comments above the YAML output")
 		if err := fs.Parse(argv); err != nil {
 			return err
 		}
@@ -24,9 +35,59 @@ var cmdDump = &command{
 		if len(argv) < 1 {
 			return fmt.Errorf("no args specified")
 		}
-		if strings.HasSuffix(argv[0], ".mp3") {
-			return chape.New(argv[0], artworkPath).Dump(outStream)
+		if isAudioFile(argv[0]) {
+			c := chape.New(argv[0], artworkPath)
+			c.RatingEmail = *ratingEmail
+			c.NoSchema = *noSchema
+			c.Verbose = *verbose
+			c.Quiet = *quiet
+			c.SchemaURL = *schemaURL
+			c.ChapterPrecision = chape.ChapterPrecision(*chapterPrecision)
+			c.ChapterSort = chape.ChapterSort(*sortChapters)
+			if *output == "" {
+				return c.Dump(outStream, chape.Format(*format))
+			}
+			outputFormat := metadataFormat(fs, *format, *output)
+			return writeOutputFile(*output, *mkdir, func(w io.Writer) error {
+				return c.Dump(w, outputFormat)
+			})
 		}
 		return fmt.Errorf("unknown file type %q", argv[0])
 	},
 }
+
+// writeOutputFile writes the output by write to a temporary file next to path and renames
+// it to path on success, so that a failed write leaves no empty or partial file. It refuses
+// to overwrite anything other than a regular file, e.g. a directory or a device.
+func writeOutputFile(path string, mkdir bool, write func(io.Writer) error) error {
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		if !fi.Mode().IsRegular() {
+			return fmt.Errorf("refusing to overwrite %s: not a regular file", path)
+		}
+		mode = fi.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if mkdir {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", path, err)
+		}
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if err := write(f); err != nil {
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/Songmu/chape"
+)
+
+var cmdFrames = &command{
+	Name:        "frames",
+	Description: "list the raw ID3v2 frames of an MP3 file for debugging",
+	Run: func(ctx context.Context, argv []string, outStream, errStream io.Writer) error {
+		fs := flag.NewFlagSet("chape frames", flag.ContinueOnError)
+		fs.SetOutput(errStream)
+		if err := fs.Parse(argv); err != nil {
+			return err
+		}
+		argv = fs.Args()
+		if len(argv) < 1 {
+			return fmt.Errorf("no args specified")
+		}
+		if isAudioFile(argv[0]) {
+			return chape.New(argv[0]).DumpFrames(outStream)
+		}
+		return fmt.Errorf("unknown file type %q", argv[0])
+	},
+}
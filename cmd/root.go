@@ -6,13 +6,38 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Songmu/chape"
 )
 
 const cmdName = "chape"
 
+// audioExts lists the audio file extensions chape can handle
+var audioExts = []string{".mp3", ".flac", ".m4a", ".m4b", ".mp4"}
+
+func isAudioFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return slices.Contains(audioExts, ext)
+}
+
+// metadataFormat returns the format given by the -format flag of fs. Unless the flag is
+// given, TOML is detected by the extension of the metadata file path.
+func metadataFormat(fs *flag.FlagSet, format, path string) chape.Format {
+	explicit := false
+	fs.Visit(func(f *flag.Flag) {
+		explicit = explicit || f.Name == "format"
+	})
+	if !explicit && strings.EqualFold(filepath.Ext(path), ".toml") {
+		return chape.FormatTOML
+	}
+	return chape.Format(format)
+}
+
 // Run the chape
 func Run(ctx context.Context, argv []string, outStream, errStream io.Writer) error {
 	log.SetOutput(errStream)
@@ -29,8 +54,23 @@ func Run(ctx context.Context, argv []string, outStream, errStream io.Writer) err
 	}
 	ver := fs.Bool("version", false, "display version")
 	yes := fs.Bool("y", false, "skip confirmation prompts")
+	backup := fs.Bool("backup", false, "copy the original file to <file>.bak before writing")
+	quiet := fs.Bool("quiet", false, "suppress the informational logs, keeping warnings and errors")
+	id3Version := fs.Int("id3-version", 4, "ID3v2 version (3 or 4) of the tag written to MP3 files")
+	frameLanguage := fs.String("frame-language", "", "ISO 639-2 code of the comment and lyrics frames (derived from the language field by default)")
+	ratingEmail := fs.String("rating-email", "no@email", "email identifier of the POPM frame holding the rating")
+	downloadRetries := fs.Int("download-retries", 3, "number of retries to download artwork on transient failures")
+	maxArtworkSize := byteSize(5 << 20)
+	fs.Var(&maxArtworkSize, "max-artwork-size", "maximum size of artwork to embed, e.g. 5MB (0 for no limit)")
+	downloadTimeout := fs.Duration("download-timeout", 30*time.Second, "time limit to download artwork from URLs")
+	noRedirect := fs.Bool("no-redirect", false, "fail on HTTP redirects when downloading artwork")
+	maxRedirects := fs.Int("max-redirects", 10, "maximum number of HTTP redirects followed when downloading artwork")
+	sameHostRedirects := fs.Bool("same-host-redirects", false, "fail on HTTP redirects to another host when downloading artwork")
+	keepArtwork := fs.Bool("keep-artwork", false, "keep the embedded artwork without fetching it again when its source is unchanged")
+	sortChapters := fs.Bool("sort-chapters", false, "sort the chapters by start time instead of failing on chapters out of order")
+	allowDuplicateStarts := fs.Bool("allow-duplicate-chapter-starts", false, "accept chapters starting at the same time")
 	var artworkPath string
-	fs.StringVar(&artworkPath, "artwork", "", "path or URL for artwork (extracts from MP3 if file doesn't exist)")
+	fs.StringVar(&artworkPath, "artwork", "", "path or URL for artwork (extracts from audio file if file doesn't exist)")
 	if err := fs.Parse(argv); err != nil {
 		return err
 	}
@@ -41,8 +81,22 @@ func Run(ctx context.Context, argv []string, outStream, errStream io.Writer) err
 	if len(argv) < 1 {
 		return fmt.Errorf("no args specified")
 	}
-	if strings.HasSuffix(argv[0], ".mp3") {
-		return chape.New(argv[0], artworkPath).Edit(*yes)
+	if isAudioFile(argv[0]) {
+		c := chape.New(argv[0], artworkPath)
+		c.Backup = *backup
+		c.Quiet = *quiet
+		c.ID3Version = id3VersionOption(fs, *id3Version)
+		c.FrameLanguage = *frameLanguage
+		c.RatingEmail = *ratingEmail
+		c.KeepArtwork = *keepArtwork
+		c.SortChapters = *sortChapters
+		c.AllowDuplicateChapterStarts = *allowDuplicateStarts
+		c.DownloadTimeout = *downloadTimeout
+		c.DownloadRetries = downloadRetriesOption(*downloadRetries)
+		c.MaxRedirects = maxRedirectsOption(*noRedirect, *maxRedirects)
+		c.SameHostRedirects = *sameHostRedirects
+		c.MaxArtworkSize = maxArtworkSizeOption(maxArtworkSize)
+		return c.EditContext(ctx, *yes)
 	}
 	if cmd, ok := cmder.dispatch[argv[0]]; ok {
 		return cmd.Run(ctx, argv[1:], outStream, errStream)
@@ -50,6 +104,70 @@ func Run(ctx context.Context, argv []string, outStream, errStream io.Writer) err
 	return fmt.Errorf("unknown command %q", argv[0])
 }
 
+// downloadRetriesOption converts the -download-retries flag to Chape.DownloadRetries,
+// where zero means the default rather than no retries
+func downloadRetriesOption(n int) int {
+	if n == 0 {
+		return -1
+	}
+	return n
+}
+
+// maxRedirectsOption converts the -no-redirect and -max-redirects flags to Chape.MaxRedirects,
+// where zero means the default rather than no redirects
+func maxRedirectsOption(noRedirect bool, n int) int {
+	if noRedirect || n <= 0 {
+		return -1
+	}
+	return n
+}
+
+// id3VersionOption converts the -id3-version flag to Chape.ID3Version, which is zero
+// unless the flag is given, so that a tag of the other version isn't converted by default
+func id3VersionOption(fs *flag.FlagSet, version int) int {
+	var given bool
+	fs.Visit(func(f *flag.Flag) {
+		given = given || f.Name == "id3-version"
+	})
+	if !given {
+		return 0
+	}
+	return version
+}
+
+// byteSize is a flag value of a size in bytes, with an optional unit KB or MB (1024-based)
+type byteSize int
+
+func (b *byteSize) String() string {
+	return strconv.Itoa(int(*b))
+}
+
+func (b *byteSize) Set(s string) error {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	unit := 1
+	for suffix, u := range map[string]int{"KB": 1 << 10, "MB": 1 << 20} {
+		if strings.HasSuffix(str, suffix) {
+			str, unit = strings.TrimSpace(strings.TrimSuffix(str, suffix)), u
+			break
+		}
+	}
+	n, err := strconv.Atoi(str)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q", s)
+	}
+	*b = byteSize(n * unit)
+	return nil
+}
+
+// maxArtworkSizeOption converts the -max-artwork-size flag to Chape.MaxArtworkSize,
+// where zero means the default rather than no limit
+func maxArtworkSizeOption(b byteSize) int {
+	if b == 0 {
+		return -1
+	}
+	return int(b)
+}
+
 func printVersion(out io.Writer) error {
 	_, err := fmt.Fprintf(out, "%s v%s (rev:%s)\n", cmdName, chape.Version, chape.Revision)
 	return err
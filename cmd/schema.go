@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"io"
+
+	"github.com/Songmu/chape"
+)
+
+var cmdSchema = &command{
+	Name:        "schema",
+	Description: "print the JSON Schema of the metadata YAML generated from the fields",
+	Run: func(ctx context.Context, argv []string, outStream, errStream io.Writer) error {
+		fs := flag.NewFlagSet("chape schema", flag.ContinueOnError)
+		fs.SetOutput(errStream)
+		if err := fs.Parse(argv); err != nil {
+			return err
+		}
+		return chape.WriteSchema(outStream)
+	},
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Songmu/chape"
+)
+
+var cmdStrip = &command{
+	Name:        "strip",
+	Description: "remove the entire tag of an MP3 file",
+	Run: func(ctx context.Context, argv []string, outStream, errStream io.Writer) error {
+		fs := flag.NewFlagSet("chape strip", flag.ContinueOnError)
+		fs.SetOutput(errStream)
+		yes := fs.Bool("y", false, "Skip confirmation prompts")
+		backup := fs.Bool("backup", false, "Copy the original file to <file>.bak before writing")
+		quiet := fs.Bool("quiet", false, "Suppress the informational logs, keeping warnings and errors")
+		keep := fs.String("keep", "", "Comma separated categories to keep (chapters, artwork)")
+		if err := fs.Parse(argv); err != nil {
+			return err
+		}
+		argv = fs.Args()
+		if len(argv) < 1 {
+			return fmt.Errorf("no args specified")
+		}
+		if !isAudioFile(argv[0]) {
+			return fmt.Errorf("unknown file type %q", argv[0])
+		}
+		var categories []string
+		for _, k := range strings.Split(*keep, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				categories = append(categories, k)
+			}
+		}
+		c := chape.New(argv[0])
+		c.Backup = *backup
+		c.Quiet = *quiet
+		return c.Strip(*yes, categories...)
+	},
+}
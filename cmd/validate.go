@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/Songmu/chape"
+)
+
+var cmdValidate = &command{
+	Name:        "validate",
+	Description: "report problems in the metadata without modifying the file",
+	Run: func(ctx context.Context, argv []string, outStream, errStream io.Writer) error {
+		fs := flag.NewFlagSet("chape validate", flag.ContinueOnError)
+		fs.SetOutput(errStream)
+		if err := fs.Parse(argv); err != nil {
+			return err
+		}
+		argv = fs.Args()
+		if len(argv) < 1 {
+			return fmt.Errorf("no args specified")
+		}
+		if !isAudioFile(argv[0]) {
+			return fmt.Errorf("unknown file type %q", argv[0])
+		}
+		problems, err := chape.New(argv[0]).Validate()
+		if err != nil {
+			return err
+		}
+		for _, p := range problems {
+			fmt.Fprintln(errStream, p)
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("%d problem(s) found in %s", len(problems), argv[0])
+		}
+		return nil
+	},
+}
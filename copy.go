@@ -0,0 +1,64 @@
+package chape
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// CopyFrom copies the metadata of the source audio file to the audio file. The artwork is
+// embedded as data URI, so the source of the artwork doesn't have to exist. Chapters starting
+// beyond the duration of the audio file are dropped, and the ends beyond it are clamped to it.
+// Unless yes is true, it shows the diff and asks for confirmation before writing as Write does.
+func (c *Chape) CopyFrom(source string, yes bool) error {
+	return c.CopyFromContext(context.Background(), source, yes)
+}
+
+// CopyFromContext is like CopyFrom, but ctx cancels downloading chapter images.
+func (c *Chape) CopyFromContext(ctx context.Context, source string, yes bool) error {
+	src := New(source)
+	src.RatingEmail = c.RatingEmail
+	metadata, t, err := src.readMetadata()
+	if err != nil {
+		return fmt.Errorf("failed to read metadata of %s: %w", source, err)
+	}
+	embedded, err := t.embeddedArtwork()
+	if err != nil {
+		return fmt.Errorf("failed to get embedded artwork of %s: %w", source, err)
+	}
+	if embedded != "" {
+		metadata.Artwork.Src = embedded
+	}
+
+	if len(metadata.Chapters) > 0 {
+		audioDuration, err := c.getAudioDuration()
+		if err != nil {
+			return fmt.Errorf("failed to get audio duration: %w", err)
+		}
+		metadata.Chapters = dropChaptersBeyond(metadata.Chapters, audioDuration)
+	}
+	return c.write(ctx, metadata, yes, false)
+}
+
+// dropChaptersBeyond drops the chapters starting beyond audioDuration, which players can't
+// seek to, and clamps the ends beyond it to it. A chapter may start within the last frame as
+// Write accepts, and then it ends at the end of the audio.
+func dropChaptersBeyond(chapters []*Chapter, audioDuration time.Duration) []*Chapter {
+	var kept []*Chapter
+	for _, chapter := range chapters {
+		if startsBeyond(chapter, audioDuration) {
+			log.Printf("Warning: chapter %q starting at %s is dropped, as it's beyond the duration %s",
+				chapter.Title, formatChapterTime(chapter.Start), formatChapterTime(audioDuration))
+			continue
+		}
+		if chapter.End > audioDuration {
+			chapter.End = audioDuration
+			if chapter.Start >= audioDuration {
+				chapter.End = 0
+			}
+		}
+		kept = append(kept, chapter)
+	}
+	return kept
+}
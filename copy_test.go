@@ -0,0 +1,74 @@
+package chape
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCopyFrom(t *testing.T) {
+	src := createDummyMP3(t, time.Second)
+	err := New(src).Apply(strings.NewReader(`title: Episode 1
+artist: Host
+artwork: `+testPNGDataURI+`
+chapters:
+- 0:00 Opening
+- 0:00.400-0:00.900 Middle
+- 0:00.800 Ending
+- 0:00.900 Credits
+`), true)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	// Destination shorter than the source: 20 frames (about 0.52s)
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+	dest := filepath.Join(t.TempDir(), "dest.mp3")
+	if err := os.WriteFile(dest, bytes.Repeat(frame, 20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(dest).CopyFrom(src, true); err != nil {
+		t.Fatalf("CopyFrom failed: %v", err)
+	}
+
+	metadata, err := New(dest).Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if metadata.Title != "Episode 1" || metadata.Artist.String() != "Host" {
+		t.Errorf("unexpected metadata: %+v", metadata)
+	}
+	if metadata.Artwork.Src != testPNGDataURI {
+		t.Errorf("artwork is not embedded: %q", metadata.Artwork.Src)
+	}
+	// The chapters starting beyond the duration are dropped
+	if len(metadata.Chapters) != 2 {
+		t.Fatalf("unexpected chapters: %v", metadata.Chapters)
+	}
+	// The end clamped to the duration is the end of the last chapter
+	if ch := metadata.Chapters[1]; ch.Start != 400*time.Millisecond || ch.End != 0 {
+		t.Errorf("the end beyond the duration should be clamped: %+v", ch)
+	}
+}
+
+func TestDropChaptersBeyond(t *testing.T) {
+	chapters := []*Chapter{
+		{Title: "A", Start: 0, End: 10 * time.Second},
+		{Title: "B", Start: 20 * time.Second, End: 40 * time.Second},
+		// Within the last frame, as Write accepts
+		{Title: "C", Start: 30100 * time.Millisecond, End: 40 * time.Second},
+		{Title: "D", Start: 30200 * time.Millisecond},
+		{Title: "E", Start: 50 * time.Second},
+	}
+	got := dropChaptersBeyond(chapters, 30*time.Second)
+	if len(got) != 3 || got[0].Title != "A" || got[1].Title != "B" || got[2].Title != "C" {
+		t.Fatalf("unexpected chapters: %v", got)
+	}
+	if got[0].End != 10*time.Second || got[1].End != 30*time.Second || got[2].End != 0 {
+		t.Errorf("ends = %s, %s, %s", got[0].End, got[1].End, got[2].End)
+	}
+}
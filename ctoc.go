@@ -0,0 +1,112 @@
+package chape
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+const (
+	ctocFlagOrdered  = 0x01
+	ctocFlagTopLevel = 0x02
+)
+
+// ctocFrame represents a CTOC (table of contents) frame, which id3v2 doesn't support.
+// Embedded sub-frames are neither read nor written.
+// cf. https://id3.org/id3v2-chapters-1.0
+type ctocFrame struct {
+	elementID       string
+	topLevel        bool
+	ordered         bool
+	childElementIDs []string
+}
+
+// parseCTOCFrame parses the body of a CTOC frame
+func parseCTOCFrame(body []byte) (*ctocFrame, error) {
+	elementID, rest, ok := bytes.Cut(body, []byte{0})
+	if !ok || len(rest) < 2 {
+		return nil, errors.New("invalid CTOC frame")
+	}
+	f := &ctocFrame{
+		elementID: string(elementID),
+		topLevel:  rest[0]&ctocFlagTopLevel != 0,
+		ordered:   rest[0]&ctocFlagOrdered != 0,
+	}
+	count := int(rest[1])
+	rest = rest[2:]
+	for range count {
+		id, r, ok := bytes.Cut(rest, []byte{0})
+		if !ok {
+			return nil, errors.New("invalid CTOC frame: truncated child element IDs")
+		}
+		f.childElementIDs = append(f.childElementIDs, string(id))
+		rest = r
+	}
+	return f, nil
+}
+
+// bytes returns the body of the CTOC frame
+func (f *ctocFrame) bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(f.elementID)
+	buf.WriteByte(0)
+	var flags byte
+	if f.topLevel {
+		flags |= ctocFlagTopLevel
+	}
+	if f.ordered {
+		flags |= ctocFlagOrdered
+	}
+	buf.WriteByte(flags)
+	buf.WriteByte(byte(len(f.childElementIDs)))
+	for _, id := range f.childElementIDs {
+		buf.WriteString(id)
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+// Size implements id3v2.Framer
+func (f *ctocFrame) Size() int {
+	return len(f.bytes())
+}
+
+// UniqueIdentifier implements id3v2.Framer
+func (f *ctocFrame) UniqueIdentifier() string {
+	return f.elementID
+}
+
+// WriteTo implements id3v2.Framer
+func (f *ctocFrame) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(f.bytes())
+	return int64(n), err
+}
+
+// topLevelCTOC returns the top-level CTOC frame of the tag. If no frame is flagged
+// as top-level, the first one is returned. It returns nil if the tag has no CTOC.
+func topLevelCTOC(id3tag *id3v2.Tag) *ctocFrame {
+	var first *ctocFrame
+	for _, frame := range id3tag.GetFrames("CTOC") {
+		var f *ctocFrame
+		switch fr := frame.(type) {
+		case *ctocFrame:
+			f = fr
+		case id3v2.UnknownFrame:
+			var err error
+			if f, err = parseCTOCFrame(fr.Body); err != nil {
+				continue
+			}
+		default:
+			continue
+		}
+		if f.topLevel {
+			return f
+		}
+		if first == nil {
+			first = f
+		}
+	}
+	return first
+}
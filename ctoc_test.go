@@ -0,0 +1,161 @@
+package chape
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+func TestCTOCFrameRoundTrip(t *testing.T) {
+	f := &ctocFrame{
+		elementID:       "toc",
+		topLevel:        true,
+		ordered:         true,
+		childElementIDs: []string{"chp0", "chp1", "chp2"},
+	}
+	body := f.bytes()
+	if want := "toc\x00\x03\x03chp0\x00chp1\x00chp2\x00"; string(body) != want {
+		t.Errorf("bytes() = %q, want %q", body, want)
+	}
+
+	got, err := parseCTOCFrame(body)
+	if err != nil {
+		t.Fatalf("parseCTOCFrame failed: %v", err)
+	}
+	if got.elementID != f.elementID || got.topLevel != f.topLevel || got.ordered != f.ordered ||
+		!slices.Equal(got.childElementIDs, f.childElementIDs) {
+		t.Errorf("parseCTOCFrame() = %+v, want %+v", got, f)
+	}
+
+	if _, err := parseCTOCFrame([]byte("toc\x00\x03\x02chp0\x00")); err == nil {
+		t.Error("parseCTOCFrame should fail with truncated child element IDs")
+	}
+}
+
+func TestApplyWritesCTOC(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+
+	c := New(mp3Path)
+	if err := c.Apply(strings.NewReader("title: TOC\nchapters:\n- 0:00 Intro\n- 0:00.500 Main\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatalf("failed to open tag: %v", err)
+	}
+	defer tag.Close()
+
+	ctoc := topLevelCTOC(tag)
+	if ctoc == nil {
+		t.Fatal("CTOC frame should be written")
+	}
+	if !ctoc.topLevel || !ctoc.ordered {
+		t.Errorf("CTOC should be top-level and ordered: %+v", ctoc)
+	}
+	if want := []string{"chp0", "chp1"}; !slices.Equal(ctoc.childElementIDs, want) {
+		t.Errorf("CTOC children = %v, want %v", ctoc.childElementIDs, want)
+	}
+}
+
+func TestReadMetadataOrdersChaptersByCTOC(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatalf("failed to open tag: %v", err)
+	}
+	tag.SetVersion(4)
+	for i, title := range []string{"Intro", "Main", "Outro"} {
+		tag.AddChapterFrame(id3v2.ChapterFrame{
+			ElementID: []string{"a", "b", "c"}[i],
+			StartTime: time.Duration(i) * 100 * time.Millisecond,
+			EndTime:   time.Duration(i+1) * 100 * time.Millisecond,
+			Title:     &id3v2.TextFrame{Encoding: id3v2.EncodingUTF8, Text: title},
+		})
+	}
+	// The table of contents lists the chapters in an order different from their start times
+	tag.AddFrame("CTOC", &ctocFrame{elementID: "toc", topLevel: true, ordered: true, childElementIDs: []string{"c", "a", "b"}})
+	if err := tag.Save(); err != nil {
+		t.Fatalf("failed to save tag: %v", err)
+	}
+	tag.Close()
+
+	metadata, err := New(mp3Path).Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	var titles []string
+	for _, ch := range metadata.Chapters {
+		titles = append(titles, ch.Title)
+	}
+	if want := []string{"Outro", "Intro", "Main"}; !slices.Equal(titles, want) {
+		t.Errorf("chapters = %v, want %v", titles, want)
+	}
+
+	c := New(mp3Path)
+	c.ChapterSort = ChapterSortTime
+	if metadata, err = c.Metadata(); err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	titles = nil
+	for _, ch := range metadata.Chapters {
+		titles = append(titles, ch.Title)
+	}
+	if want := []string{"Intro", "Main", "Outro"}; !slices.Equal(titles, want) {
+		t.Errorf("chapters sorted by time = %v, want %v", titles, want)
+	}
+}
+
+func TestChapterSortNone(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatalf("failed to open tag: %v", err)
+	}
+	tag.SetVersion(4)
+	// No table of contents, and the chapters are stored out of time order
+	for i, title := range []string{"Outro", "Intro", "Main"} {
+		start := time.Duration([]int{2, 0, 1}[i]) * 100 * time.Millisecond
+		tag.AddChapterFrame(id3v2.ChapterFrame{
+			ElementID: title,
+			StartTime: start,
+			EndTime:   start + 100*time.Millisecond,
+			Title:     &id3v2.TextFrame{Encoding: id3v2.EncodingUTF8, Text: title},
+		})
+	}
+	if err := tag.Save(); err != nil {
+		t.Fatalf("failed to save tag: %v", err)
+	}
+	tag.Close()
+
+	for sort, want := range map[ChapterSort][]string{
+		"":              {"Intro", "Main", "Outro"},
+		ChapterSortAuto: {"Intro", "Main", "Outro"},
+		ChapterSortNone: {"Outro", "Intro", "Main"},
+	} {
+		c := New(mp3Path)
+		c.ChapterSort = sort
+		metadata, err := c.Metadata()
+		if err != nil {
+			t.Fatalf("Metadata failed: %v", err)
+		}
+		var titles []string
+		for _, ch := range metadata.Chapters {
+			titles = append(titles, ch.Title)
+		}
+		if !slices.Equal(titles, want) {
+			t.Errorf("chapters of sort %q = %v, want %v", sort, titles, want)
+		}
+	}
+
+	c := New(mp3Path)
+	c.ChapterSort = "random"
+	if _, err := c.Metadata(); err == nil {
+		t.Error("Metadata should fail with an unknown chapter sort")
+	}
+}
@@ -0,0 +1,32 @@
+package chape
+
+import (
+	"fmt"
+	"io"
+)
+
+// Diff reads metadata from input as Apply does and writes the diff from the current metadata
+// of the audio file to output, without writing the audio file nor asking for confirmation.
+// It reports whether there are any differences. The diff is colored only if output is a
+// terminal and NO_COLOR isn't set.
+func (c *Chape) Diff(output io.Writer, input io.Reader, format ...Format) (bool, error) {
+	newMetadata, err := c.readInput(input, format...)
+	if err != nil {
+		return false, err
+	}
+	newMetadata, err = c.prepareMetadata(newMetadata)
+	if err != nil {
+		return false, err
+	}
+	currentMetadata, newMetadata, currentYAML, newYAML, err := c.compareMetadata(newMetadata)
+	if err != nil {
+		return false, err
+	}
+	if metadataEqual(currentMetadata, newMetadata) {
+		return false, nil
+	}
+	if _, err := fmt.Fprint(output, generateDiff(currentYAML, newYAML, colorEnabled(output))); err != nil {
+		return true, err
+	}
+	return true, nil
+}
@@ -0,0 +1,63 @@
+package chape
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+	if err := New(mp3Path).Apply(strings.NewReader("title: Before\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	original, err := os.ReadFile(mp3Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	changed, err := New(mp3Path).Diff(&buf, strings.NewReader("title: After\n"))
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if !changed {
+		t.Error("Diff should report the differences")
+	}
+	if !strings.Contains(buf.String(), "- title: Before\n+ title: After\n") || strings.Contains(buf.String(), "\x1b[") {
+		t.Errorf("unexpected diff:\n%s", buf.String())
+	}
+	got, err := os.ReadFile(mp3Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, original) {
+		t.Error("Diff should not write the audio file")
+	}
+
+	buf.Reset()
+	changed, err = New(mp3Path).Diff(&buf, strings.NewReader("title: Before\n"))
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if changed || buf.Len() > 0 {
+		t.Errorf("Diff should report no differences: %q", buf.String())
+	}
+}
+
+func TestGenerateDiff(t *testing.T) {
+	oldYAML := "title: Episode\nartist: Alice\nalbum: Show\n"
+	newYAML := "title: Episode\nartist: Alice\nalbum: New Show\n"
+
+	expected := "  title: Episode\n  artist: Alice\n- album: Show\n+ album: New Show\n"
+	if got := generateDiff(oldYAML, newYAML, false); got != expected {
+		t.Errorf("generateDiff() =\n%s\nwant:\n%s", got, expected)
+	}
+
+	expected = "  title: Episode\n  artist: Alice\n\x1b[31m- album: Show\x1b[0m\n\x1b[32m+ album: New Show\x1b[0m\n"
+	if got := generateDiff(oldYAML, newYAML, true); got != expected {
+		t.Errorf("generateDiff() with color =\n%q\nwant:\n%q", got, expected)
+	}
+}
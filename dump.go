@@ -2,172 +2,213 @@ package chape
 
 import (
 	"cmp"
-	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"slices"
 	"strings"
+	"time"
 
-	"github.com/bogem/id3v2/v2"
 	"github.com/goccy/go-yaml"
 )
 
-func (c *Chape) Dump(output io.Writer) error {
-	metadata, err := c.getMetadata()
-	if err != nil {
-		return err
-	}
+// Format represents the serialization format of metadata
+type Format string
 
-	yamlData, err := yaml.Marshal(metadata)
-	if err != nil {
-		return fmt.Errorf("failed to marshal to YAML: %w", err)
-	}
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+)
 
-	// Add YAML Language Server schema comment
-	schemaComment := "# yaml-language-server: $schema=https://raw.githubusercontent.com/Songmu/chape/refs/heads/main/schema.yaml\n"
-	if _, err = output.Write([]byte(schemaComment)); err != nil {
-		return err
+// Dump writes the metadata of the audio file to output.
+// The format defaults to YAML when not specified.
+func (c *Chape) Dump(output io.Writer, format ...Format) error {
+	switch c.ChapterPrecision {
+	case "", ChapterPrecisionAuto, ChapterPrecisionSeconds, ChapterPrecisionMillis:
+	default:
+		return fmt.Errorf("unknown chapter precision %q: must be %s, %s or %s", c.ChapterPrecision,
+			ChapterPrecisionAuto, ChapterPrecisionSeconds, ChapterPrecisionMillis)
 	}
-	_, err = output.Write(yamlData)
-	return err
-}
-
-// getMetadata extracts metadata from the MP3 file
-func (c *Chape) getMetadata() (*Metadata, error) {
-	// Open the MP3 file
-	file, err := os.Open(c.audio)
+	metadata, err := c.Metadata()
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
+		return err
 	}
-	defer file.Close()
-
-	id3tag, err := id3v2.Open(c.audio, id3v2.Options{Parse: true})
-	if err != nil {
-		return nil, err
+	if c.ChapterPrecision != "" && c.ChapterPrecision != ChapterPrecisionAuto && len(metadata.Chapters) > 0 {
+		m := *metadata
+		m.Chapters = make([]*Chapter, len(metadata.Chapters))
+		for i, ch := range metadata.Chapters {
+			cc := *ch
+			cc.precision = c.ChapterPrecision
+			m.Chapters[i] = &cc
+		}
+		metadata = &m
 	}
-	defer id3tag.Close()
-
-	var metadata = &Metadata{}
-
-	// Read all text frames using the centralized mapping
-	readTextFrames(id3tag, metadata)
 
-	// Try to get date from TDRC (ID3v2.4) or fall back to Year
-	if dateFramer := id3tag.GetLastFrame("TDRC"); dateFramer != nil {
-		if tf, ok := dateFramer.(id3v2.TextFrame); ok && tf.Text != "" {
-			// Parse TDRC format
-			var ts Timestamp
-			if err := ts.UnmarshalYAML([]byte(tf.Text)); err == nil {
-				metadata.Date = &ts
+	f := FormatYAML
+	if len(format) > 0 && format[0] != "" {
+		f = format[0]
+	}
+	switch f {
+	case FormatYAML:
+		var schemaURL string
+		if !c.NoSchema {
+			schemaURL = c.schemaURL()
+		}
+		var details []string
+		if c.Verbose {
+			if details, err = c.tagDetails(); err != nil {
+				return err
 			}
 		}
-	} else if id3tag.Year() != "" {
-		// Fall back to Year for ID3v2.3 compatibility
-		var ts Timestamp
-		if err := ts.UnmarshalYAML([]byte(id3tag.Year())); err == nil {
-			metadata.Date = &ts
+		return dumpYAML(output, metadata, schemaURL, details...)
+	case FormatJSON:
+		enc := json.NewEncoder(output)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(metadata)
+	case FormatTOML:
+		return writeTOML(output, metadata)
+	case FormatFFMetadata:
+		var audioDuration time.Duration
+		if len(metadata.Chapters) > 0 {
+			if audioDuration, err = c.getAudioDuration(); err != nil {
+				return fmt.Errorf("failed to get audio duration: %w", err)
+			}
 		}
+		return writeFFMetadata(output, metadata, audioDuration)
+	case FormatLRC:
+		return writeLRC(output, metadata)
+	default:
+		return fmt.Errorf("unsupported format %q", f)
 	}
+}
 
-	// Comment frames
-	commentFrames := id3tag.GetFrames(id3tag.CommonID("Comments"))
-	if len(commentFrames) > 0 {
-		if cf, ok := commentFrames[0].(id3v2.CommentFrame); ok {
-			metadata.Comment = cf.Text
-		}
+// defaultSchemaURL is the URL of the JSON schema referred to by the schema comment of the YAML output
+const defaultSchemaURL = "https://raw.githubusercontent.com/Songmu/chape/refs/heads/main/schema.yaml"
+
+// schemaURL returns the URL of the schema from SchemaURL, the CHAPE_SCHEMA_URL environment
+// variable or the default in that order
+func (c *Chape) schemaURL() string {
+	return cmp.Or(c.SchemaURL, os.Getenv("CHAPE_SCHEMA_URL"), defaultSchemaURL)
+}
+
+// dumpYAML writes metadata as YAML, preceded by the YAML Language Server schema comment
+// referring to schemaURL unless it's empty
+func dumpYAML(output io.Writer, metadata *Metadata, schemaURL string, comments ...string) error {
+	yamlData, err := yaml.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal to YAML: %w", err)
 	}
 
-	// Lyrics frames
-	lyricsFrames := id3tag.GetFrames("USLT") // Unsynchronised lyrics/text transcription
-	if len(lyricsFrames) > 0 {
-		if ulf, ok := lyricsFrames[0].(id3v2.UnsynchronisedLyricsFrame); ok {
-			metadata.Lyrics = ulf.Lyrics
+	// Add YAML Language Server schema comment
+	if schemaURL != "" {
+		schemaComment := "# yaml-language-server: $schema=" + schemaURL + "\n"
+		if _, err = output.Write([]byte(schemaComment)); err != nil {
+			return err
 		}
 	}
-
-	// Priority: Chape struct artwork > CHAPE_SOURCE from MP3
-	if c.artwork != "" {
-		metadata.Artwork = c.artwork
-	} else {
-		pictureFrames := id3tag.GetFrames(id3tag.CommonID("Attached picture"))
-		if len(pictureFrames) > 0 {
-			if pf, ok := pictureFrames[0].(id3v2.PictureFrame); ok {
-				if len(pf.Picture) > 0 {
-					// Check for chape source in TXXX frames first
-					chapeSource := ""
-					txxxFrames := id3tag.GetFrames("TXXX")
-					for _, frame := range txxxFrames {
-						if udtf, ok := frame.(id3v2.UserDefinedTextFrame); ok {
-							// UserDefinedTextFrame has Description and Value fields
-							if udtf.Description == "CHAPE_SOURCE" {
-								chapeSource = udtf.Value
-								break
-							}
-						}
-					}
-					// Always prefer CHAPE_SOURCE if available, regardless of file existence
-					if chapeSource != "" {
-						metadata.Artwork = chapeSource
-					} else {
-						metadata.Artwork = fmt.Sprintf("data:%s;base64,%s",
-							pf.MimeType,
-							base64.StdEncoding.EncodeToString(pf.Picture))
-					}
-				}
-			}
+	for _, comment := range comments {
+		if _, err = fmt.Fprintf(output, "# %s\n", comment); err != nil {
+			return err
 		}
 	}
+	_, err = output.Write(yamlData)
+	return err
+}
 
-	// Chapter frames
-	chapterFrames := id3tag.GetFrames("CHAP")
-	for _, frame := range chapterFrames {
-		if cf, ok := frame.(id3v2.ChapterFrame); ok {
-			chapter := &Chapter{
-				Title: cf.Title.Text,
-				Start: cf.StartTime,
-			}
-			metadata.Chapters = append(metadata.Chapters, chapter)
-		}
+// Metadata extracts metadata from the audio file.
+// The artwork is resolved the same way as Dump does: the artwork given to New takes priority,
+// and a missing local artwork file is extracted from the embedded picture.
+func (c *Chape) Metadata() (*Metadata, error) {
+	metadata, t, err := c.readMetadata()
+	if err != nil {
+		return nil, err
 	}
-	slices.SortFunc(metadata.Chapters, func(a, b *Chapter) int {
-		return cmp.Compare(a.Start, b.Start)
-	})
 
 	// Override artwork with Chape struct setting if specified
 	if c.artwork != "" {
-		metadata.Artwork = c.artwork
+		metadata.Artwork.Src = c.artwork
 	}
 
 	// Apply artwork processing (file creation, etc.)
-	if err := c.processArtwork(metadata); err != nil {
+	if err := c.processArtwork(metadata, t); err != nil {
 		return nil, fmt.Errorf("failed to process artwork: %w", err)
 	}
 
 	return metadata, nil
 }
 
-// processArtwork handles artwork processing logic shared between Dump and Apply
-func (c *Chape) processArtwork(metadata *Metadata) error {
-	aw := metadata.Artwork
+// ChapterSort is how the chapters read from the audio file are ordered
+type ChapterSort string
+
+const (
+	// ChapterSortAuto follows the order defined by the format, e.g. the CTOC frame of ID3v2,
+	// and sorts the chapters by start time without it
+	ChapterSortAuto ChapterSort = "auto"
+	// ChapterSortTime always sorts the chapters by start time
+	ChapterSortTime ChapterSort = "time"
+	// ChapterSortNone keeps the chapters in the order defined by the format, or in the stored
+	// order without it
+	ChapterSortNone ChapterSort = "none"
+)
+
+// readMetadata reads metadata from the audio file without resolving the artwork.
+// Chapters are ordered as ChapterSort specifies.
+// The tagger is returned to read further from the same file.
+func (c *Chape) readMetadata() (*Metadata, tagger, error) {
+	switch c.ChapterSort {
+	case "", ChapterSortAuto, ChapterSortTime, ChapterSortNone:
+	default:
+		return nil, nil, fmt.Errorf("unknown chapter sort %q: must be %s, %s or %s", c.ChapterSort,
+			ChapterSortAuto, ChapterSortTime, ChapterSortNone)
+	}
+	t, err := c.tagger()
+	if err != nil {
+		return nil, nil, err
+	}
+	metadata, err := t.readMetadata()
+	if err != nil {
+		return nil, nil, c.fileError(err)
+	}
+	switch c.ChapterSort {
+	case ChapterSortNone:
+	case ChapterSortTime:
+		slices.SortStableFunc(metadata.Chapters, compareChapterStart)
+	default:
+		if o, ok := t.(chapterOrderer); !ok || !o.chaptersOrdered() {
+			slices.SortFunc(metadata.Chapters, compareChapterStart)
+		}
+	}
+	return metadata, t, nil
+}
+
+// processArtwork handles artwork processing logic shared between Dump and Apply.
+// The embedded artwork is taken from the tagger that read the metadata, so the file isn't parsed again.
+func (c *Chape) processArtwork(metadata *Metadata, t tagger) error {
+	aw := metadata.Artwork.Src
 	if aw != "" {
 		if !strings.HasPrefix(aw, "http://") && !strings.HasPrefix(aw, "https://") &&
 			!strings.HasPrefix(aw, "data:") {
 			// Local file path - check if file exists
 			if _, err := os.Stat(aw); os.IsNotExist(err) {
 				// File doesn't exist, try to extract from embedded artwork
-				// Need to get embedded artwork data from MP3
-				embeddedDataURI, err := c.getEmbeddedArtwork()
+				embeddedDataURI, err := t.embeddedArtwork()
 				if err != nil {
 					return fmt.Errorf("failed to get embedded artwork: %w", err)
 				}
 				if embeddedDataURI != "" {
-					// Extract from embedded data URI
-					// XXX: How do we handle file extension mismatch?
-					if err := c.extractArtworkToFile(embeddedDataURI, aw); err != nil {
+					// Extract from embedded data URI. The extension is rewritten if it doesn't
+					// match the picture, and the artwork refers to the file actually written.
+					path, err := extractArtworkToFile(embeddedDataURI, aw)
+					if err != nil {
 						return fmt.Errorf("failed to extract artwork: %w", err)
 					}
+					if path != aw {
+						c.logf("Extracted the artwork to %s instead of %s to match its image type", path, aw)
+						metadata.Artwork.Src = path
+					}
 				}
 			} else if err != nil {
 				return fmt.Errorf("failed to check artwork file: %w", err)
@@ -177,46 +218,33 @@ func (c *Chape) processArtwork(metadata *Metadata) error {
 	return nil
 }
 
-// getEmbeddedArtwork extracts embedded artwork from MP3 as data URI
-func (c *Chape) getEmbeddedArtwork() (string, error) {
-	id3tag, err := id3v2.Open(c.audio, id3v2.Options{Parse: true})
-	if err != nil {
-		return "", err
-	}
-	defer id3tag.Close()
-
-	// Picture frames
-	pictureFrames := id3tag.GetFrames(id3tag.CommonID("Attached picture"))
-	if len(pictureFrames) > 0 {
-		if pf, ok := pictureFrames[0].(id3v2.PictureFrame); ok {
-			if len(pf.Picture) > 0 {
-				return fmt.Sprintf("data:%s;base64,%s",
-					pf.MimeType,
-					base64.StdEncoding.EncodeToString(pf.Picture)), nil
-			}
-		}
-	}
-	return "", nil
-}
-
-// extractArtworkToFile extracts artwork from data URI and saves to file
-func (c *Chape) extractArtworkToFile(dataURI, outputPath string) error {
+// extractArtworkToFile extracts artwork from data URI and saves to file.
+// It returns the path written, with the extension added if outputPath has none, or
+// replaced if it's of another image type, so that the extension doesn't lie about the content.
+func extractArtworkToFile(dataURI, outputPath string) (string, error) {
 	// Parse data URI
 	pictureData, mimeType, err := parseDataURI(dataURI)
 	if err != nil {
-		return err
+		return "", err
 	}
+	// The content tells the image type better than the MIME type stored with it
+	mimeType = cmp.Or(detectImageMimeType(pictureData), mimeType)
 
-	// Determine file extension from MIME type if outputPath doesn't have one
-	if filepath.Ext(outputPath) == "" {
-		ext := getExtFromMimeType(mimeType)
-		if ext != "" {
+	// Determine file extension from MIME type if outputPath doesn't have one or it mismatches
+	if ext := getExtFromMimeType(mimeType); ext != "" {
+		current := filepath.Ext(outputPath)
+		if current == "" {
 			outputPath = outputPath + ext
+		} else if m := getMimeTypeFromExt(current); m != "" && m != mimeType {
+			outputPath = strings.TrimSuffix(outputPath, current) + ext
 		}
 	}
 
 	// Write to file
-	return os.WriteFile(outputPath, pictureData, 0644)
+	if err := os.WriteFile(outputPath, pictureData, 0644); err != nil {
+		return "", err
+	}
+	return outputPath, nil
 }
 
 // getExtFromMimeType returns file extension for a MIME type
@@ -232,6 +260,12 @@ func getExtFromMimeType(mimeType string) string {
 		return ".bmp"
 	case "image/webp":
 		return ".webp"
+	case "image/heic":
+		return ".heic"
+	case "image/avif":
+		return ".avif"
+	case "image/tiff":
+		return ".tiff"
 	default:
 		return ""
 	}
@@ -0,0 +1,4 @@
+package chape
+
+// CreateDummyMP3 exports createDummyMP3 to the external tests
+var CreateDummyMP3 = createDummyMP3
@@ -0,0 +1,255 @@
+package chape
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormatFFMetadata is the FFmpeg metadata format (ffmpeg -f ffmetadata)
+const FormatFFMetadata Format = "ffmetadata"
+
+const ffmetadataHeader = ";FFMETADATA1"
+
+// FFmpeg metadata keys of the fields not in textFrameMappings
+const (
+	ffmetaKeyDate    = "date"
+	ffmetaKeyComment = "comment"
+	ffmetaKeyLyrics  = "lyrics"
+)
+
+// writeFFMetadata writes metadata in the FFmpeg metadata format.
+// Chapter times are written in milliseconds, and the end of the last chapter is audioDuration
+// unless it has an explicit end. Artwork can't be represented and is omitted.
+// cf. https://ffmpeg.org/ffmpeg-formats.html#Metadata-2
+func writeFFMetadata(w io.Writer, metadata *Metadata, audioDuration time.Duration) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, ffmetadataHeader)
+
+	writeKV := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(bw, "%s=%s\n", key, escapeFFMetadata(value))
+		}
+	}
+	for _, mapping := range textFrameMappings {
+		writeKV(mapping.ffmetaKey, joinMultiValues(mapping.getValue(metadata)))
+	}
+	if metadata.Date != nil && !metadata.Date.Time.IsZero() {
+		writeKV(ffmetaKeyDate, metadata.Date.String())
+	}
+	writeKV(ffmetaKeyComment, metadata.Comment)
+	writeKV(ffmetaKeyLyrics, metadata.Lyrics)
+
+	for i, chapter := range metadata.Chapters {
+		fmt.Fprintf(bw, "\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\n",
+			chapter.Start.Milliseconds(),
+			chapterEnd(metadata.Chapters, i, audioDuration).Milliseconds())
+		writeKV("title", chapter.Title)
+	}
+	return bw.Flush()
+}
+
+// ffmetadataChapter holds the raw values of a [CHAPTER] section
+type ffmetadataChapter struct {
+	timebase   string
+	start, end string
+	title      string
+}
+
+// parseFFMetadata parses metadata in the FFmpeg metadata format. Chapter times are
+// converted from the TIMEBASE of each chapter (1/1000000000 if omitted, as FFmpeg does).
+// A chapter gets an explicit end only when it ends before the next chapter starts.
+func parseFFMetadata(r io.Reader) (*Metadata, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lines := splitFFMetadataLines(string(b))
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], ";FFMETADATA") {
+		return nil, errors.New("invalid ffmetadata: missing ;FFMETADATA1 header")
+	}
+
+	metadata := &Metadata{}
+	var (
+		section  string
+		chapters []*ffmetadataChapter
+	)
+	for _, line := range lines[1:] {
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line[1 : len(line)-1]
+			if section == "CHAPTER" {
+				chapters = append(chapters, &ffmetadataChapter{})
+			}
+			continue
+		}
+		k, v, ok := cutFFMetadataLine(line)
+		if !ok {
+			return nil, fmt.Errorf("invalid ffmetadata line: %q", line)
+		}
+		switch section {
+		case "":
+			setFFMetadataValue(metadata, k, v)
+		case "CHAPTER":
+			ch := chapters[len(chapters)-1]
+			switch k {
+			case "TIMEBASE":
+				ch.timebase = v
+			case "START":
+				ch.start = v
+			case "END":
+				ch.end = v
+			case "title":
+				ch.title = v
+			}
+		}
+		// Other sections such as [STREAM] are ignored
+	}
+
+	ends := make([]time.Duration, len(chapters))
+	for i, ch := range chapters {
+		start, end, err := ch.times()
+		if err != nil {
+			return nil, fmt.Errorf("invalid chapter %q: %w", ch.title, err)
+		}
+		metadata.Chapters = append(metadata.Chapters, &Chapter{Title: ch.title, Start: start})
+		ends[i] = end
+	}
+	for i, chapter := range metadata.Chapters {
+		if i+1 < len(metadata.Chapters) && ends[i] > chapter.Start && ends[i] < metadata.Chapters[i+1].Start {
+			chapter.End = ends[i]
+		}
+	}
+	return metadata, nil
+}
+
+// times returns START and END of the chapter converted from its TIMEBASE
+func (ch *ffmetadataChapter) times() (start, end time.Duration, err error) {
+	tb := big.NewRat(1, int64(time.Second))
+	if ch.timebase != "" {
+		var ok bool
+		if tb, ok = new(big.Rat).SetString(ch.timebase); !ok || tb.Sign() <= 0 {
+			return 0, 0, fmt.Errorf("invalid TIMEBASE: %q", ch.timebase)
+		}
+	}
+	convert := func(name, v string) (time.Duration, error) {
+		ticks, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s: %q", name, v)
+		}
+		// ticks * timebase seconds, rounded down to nanoseconds
+		ns := new(big.Rat).Mul(new(big.Rat).SetInt64(ticks), tb)
+		ns.Mul(ns, new(big.Rat).SetInt64(int64(time.Second)))
+		q := new(big.Int).Quo(ns.Num(), ns.Denom())
+		if !q.IsInt64() {
+			return 0, fmt.Errorf("%s out of range: %q", name, v)
+		}
+		return time.Duration(q.Int64()), nil
+	}
+	if start, err = convert("START", ch.start); err != nil {
+		return 0, 0, err
+	}
+	if ch.end != "" {
+		if end, err = convert("END", ch.end); err != nil {
+			return 0, 0, err
+		}
+	}
+	return start, end, nil
+}
+
+// setFFMetadataValue sets the value of the global FFmpeg metadata key to metadata
+func setFFMetadataValue(metadata *Metadata, key, value string) {
+	switch strings.ToLower(key) {
+	case ffmetaKeyDate:
+		var ts Timestamp
+		if err := ts.UnmarshalYAML([]byte(value)); err == nil {
+			metadata.Date = &ts
+		}
+		return
+	case ffmetaKeyComment:
+		metadata.Comment = value
+		return
+	case ffmetaKeyLyrics:
+		metadata.Lyrics = value
+		return
+	}
+	for _, mapping := range textFrameMappings {
+		if strings.EqualFold(mapping.ffmetaKey, key) {
+			mapping.setValue(metadata, value)
+			return
+		}
+	}
+}
+
+// escapeFFMetadata escapes the special characters ('=', ';', '#', '\' and newline) with a backslash
+func escapeFFMetadata(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch r {
+		case '=', ';', '#', '\\', '\n':
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// splitFFMetadataLines splits s into lines. Escaped newlines don't split lines and
+// escape sequences are kept as they are.
+func splitFFMetadataLines(s string) []string {
+	var (
+		lines []string
+		sb    strings.Builder
+	)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			sb.WriteByte(s[i])
+			if i+1 < len(s) {
+				i++
+				sb.WriteByte(s[i])
+			}
+		case '\n':
+			lines = append(lines, strings.TrimSuffix(sb.String(), "\r"))
+			sb.Reset()
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	if sb.Len() > 0 {
+		lines = append(lines, sb.String())
+	}
+	return lines
+}
+
+// cutFFMetadataLine splits the line around the first unescaped '=' and unescapes the key and value
+func cutFFMetadataLine(line string) (key, value string, ok bool) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '=':
+			return unescapeFFMetadata(line[:i]), unescapeFFMetadata(line[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// unescapeFFMetadata removes the backslashes escaping characters
+func unescapeFFMetadata(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,129 @@
+package chape
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteFFMetadata(t *testing.T) {
+	metadata := &Metadata{
+		Title:   "Episode 1",
+		Artist:  Values{"Host"},
+		Track:   &NumberInSet{Current: 3, Total: 10},
+		Comment: "a=b; c#d\nsecond line",
+		Chapters: []*Chapter{
+			{Title: "Intro", Start: 0},
+			{Title: "Main", Start: 90500 * time.Millisecond, End: 10 * time.Minute},
+			{Title: "Outro", Start: 11 * time.Minute},
+		},
+	}
+	var buf bytes.Buffer
+	if err := writeFFMetadata(&buf, metadata, 12*time.Minute+345*time.Millisecond); err != nil {
+		t.Fatalf("writeFFMetadata failed: %v", err)
+	}
+	expected := `;FFMETADATA1
+title=Episode 1
+artist=Host
+track=3/10
+comment=a\=b\; c\#d\
+second line
+
+[CHAPTER]
+TIMEBASE=1/1000
+START=0
+END=90500
+title=Intro
+
+[CHAPTER]
+TIMEBASE=1/1000
+START=90500
+END=600000
+title=Main
+
+[CHAPTER]
+TIMEBASE=1/1000
+START=660000
+END=720345
+title=Outro
+`
+	if buf.String() != expected {
+		t.Errorf("writeFFMetadata() =\n%s\nwant:\n%s", buf.String(), expected)
+	}
+
+	// The written metadata reads back the same
+	got, err := parseFFMetadata(&buf)
+	if err != nil {
+		t.Fatalf("parseFFMetadata failed: %v", err)
+	}
+	if got.Comment != metadata.Comment {
+		t.Errorf("comment = %q, want %q", got.Comment, metadata.Comment)
+	}
+	if got.Track.String() != "3/10" {
+		t.Errorf("track = %v, want 3/10", got.Track)
+	}
+	for i, want := range []string{"0:00 Intro", "1:30.500-10:00 Main", "11:00 Outro"} {
+		if s := got.Chapters[i].String(); s != want {
+			t.Errorf("chapter[%d] = %q, want %q", i, s, want)
+		}
+	}
+}
+
+func TestParseFFMetadataTimebase(t *testing.T) {
+	input := `;FFMETADATA1
+title=Mix
+encoder=Lavf60.3.100
+
+[CHAPTER]
+TIMEBASE=1/44100
+START=0
+END=3969000
+title=First
+
+[CHAPTER]
+TIMEBASE=1/1000
+START=90000
+END=180000
+title=Second
+
+[CHAPTER]
+START=180000000000
+END=200000000000
+title=Default timebase
+
+[STREAM]
+title=ignored
+`
+	metadata, err := parseFFMetadata(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseFFMetadata failed: %v", err)
+	}
+	if metadata.Title != "Mix" {
+		t.Errorf("title = %q, want %q", metadata.Title, "Mix")
+	}
+	expected := []*Chapter{
+		{Title: "First", Start: 0},
+		{Title: "Second", Start: 90 * time.Second},
+		{Title: "Default timebase", Start: 3 * time.Minute},
+	}
+	if len(metadata.Chapters) != len(expected) {
+		t.Fatalf("chapters = %v, want %v", metadata.Chapters, expected)
+	}
+	for i, want := range expected {
+		if got := metadata.Chapters[i]; *got != *want {
+			t.Errorf("chapter[%d] = %+v, want %+v", i, got, want)
+		}
+	}
+
+	for _, invalid := range []string{
+		"title=no header\n",
+		";FFMETADATA1\n[CHAPTER]\nTIMEBASE=1/0\nSTART=0\n",
+		";FFMETADATA1\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=abc\n",
+		";FFMETADATA1\nno equal sign\n",
+	} {
+		if _, err := parseFFMetadata(strings.NewReader(invalid)); err == nil {
+			t.Errorf("parseFFMetadata(%q) should fail", invalid)
+		}
+	}
+}
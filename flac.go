@@ -0,0 +1,721 @@
+package chape
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FLAC metadata block types
+// cf. https://xiph.org/flac/format.html#metadata_block_header
+const (
+	flacBlockStreamInfo    byte = 0
+	flacBlockPadding       byte = 1
+	flacBlockVorbisComment byte = 4
+	flacBlockPicture       byte = 6
+)
+
+const flacMarker = "fLaC"
+
+// flacTagger reads and writes Vorbis comments and pictures of FLAC files
+type flacTagger struct {
+	audioSource
+	// downloadRetries is the number of retries of downloading artwork
+	downloadRetries int
+	// maxArtworkSize is the maximum size of the artwork to embed, zero if unlimited
+	maxArtworkSize int
+
+	blocks []*flacBlock // cache of readBlocks
+}
+
+// flacBlock represents a FLAC metadata block
+type flacBlock struct {
+	blockType byte
+	data      []byte
+}
+
+// readFLACBlocks reads the "fLaC" marker and all metadata blocks.
+// The reader is left at the beginning of the audio frames.
+func readFLACBlocks(r io.Reader) ([]*flacBlock, error) {
+	marker := make([]byte, len(flacMarker))
+	if _, err := io.ReadFull(r, marker); err != nil {
+		return nil, fmt.Errorf("failed to read FLAC marker: %w", err)
+	}
+	if string(marker) != flacMarker {
+		return nil, errors.New("not a FLAC file")
+	}
+
+	var blocks []*flacBlock
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, fmt.Errorf("failed to read metadata block header: %w", err)
+		}
+		isLast := header[0]&0x80 != 0
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("failed to read metadata block: %w", err)
+		}
+		blocks = append(blocks, &flacBlock{blockType: header[0] & 0x7F, data: data})
+		if isLast {
+			return blocks, nil
+		}
+	}
+}
+
+// writeFLACBlocks writes the "fLaC" marker and the metadata blocks
+func writeFLACBlocks(w io.Writer, blocks []*flacBlock) error {
+	if _, err := io.WriteString(w, flacMarker); err != nil {
+		return err
+	}
+	for i, b := range blocks {
+		if len(b.data) >= 1<<24 {
+			return fmt.Errorf("metadata block too large: %d bytes", len(b.data))
+		}
+		header := []byte{b.blockType, byte(len(b.data) >> 16), byte(len(b.data) >> 8), byte(len(b.data))}
+		if i == len(blocks)-1 {
+			header[0] |= 0x80
+		}
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		if _, err := w.Write(b.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBlocks reads the metadata blocks of the FLAC file. The blocks are read once
+// and reused by later calls.
+func (t *flacTagger) readBlocks() ([]*flacBlock, error) {
+	if t.blocks != nil {
+		return t.blocks, nil
+	}
+	file, err := t.open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	blocks, err := readFLACBlocks(file)
+	if err != nil {
+		return nil, err
+	}
+	t.blocks = blocks
+	return blocks, nil
+}
+
+// vorbisComment represents a VORBIS_COMMENT metadata block
+// cf. https://www.xiph.org/vorbis/doc/v-comment.html
+type vorbisComment struct {
+	vendor   string
+	comments []string // "KEY=value" pairs
+}
+
+// parseVorbisComment parses the body of a VORBIS_COMMENT block
+func parseVorbisComment(data []byte) (*vorbisComment, error) {
+	r := bytes.NewReader(data)
+	readString := func() (string, error) {
+		var length uint32
+		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+			return "", err
+		}
+		if int64(length) > int64(r.Len()) {
+			return "", io.ErrUnexpectedEOF
+		}
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		return string(buf), nil
+	}
+
+	vendor, err := readString()
+	if err != nil {
+		return nil, fmt.Errorf("invalid vorbis comment vendor: %w", err)
+	}
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, fmt.Errorf("invalid vorbis comment count: %w", err)
+	}
+	vc := &vorbisComment{vendor: vendor}
+	for range count {
+		comment, err := readString()
+		if err != nil {
+			return nil, fmt.Errorf("invalid vorbis comment: %w", err)
+		}
+		vc.comments = append(vc.comments, comment)
+	}
+	return vc, nil
+}
+
+// bytes returns the body of the VORBIS_COMMENT block
+func (vc *vorbisComment) bytes() []byte {
+	var buf bytes.Buffer
+	writeString := func(s string) {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(s)))
+		buf.WriteString(s)
+	}
+	writeString(vc.vendor)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(vc.comments)))
+	for _, c := range vc.comments {
+		writeString(c)
+	}
+	return buf.Bytes()
+}
+
+// get returns the first value for the key. Keys are case-insensitive.
+func (vc *vorbisComment) get(key string) string {
+	for _, c := range vc.comments {
+		if k, v, ok := strings.Cut(c, "="); ok && strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// getAll returns all the non-empty values for the key. Keys are case-insensitive.
+func (vc *vorbisComment) getAll(key string) []string {
+	var values []string
+	for _, c := range vc.comments {
+		if k, v, ok := strings.Cut(c, "="); ok && strings.EqualFold(k, key) && v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// add appends a comment if the value is not empty
+func (vc *vorbisComment) add(key, value string) {
+	if value != "" {
+		vc.comments = append(vc.comments, key+"="+value)
+	}
+}
+
+// chapeSource returns the source of the artwork, also recorded under the legacy key
+func (vc *vorbisComment) chapeSource() string {
+	return cmp.Or(vc.get(vorbisKeyChapeSource), vc.get(legacyArtworkSourceName))
+}
+
+// deleteFunc removes comments whose upper-cased key matches the predicate
+func (vc *vorbisComment) deleteFunc(del func(key string) bool) {
+	vc.comments = slices.DeleteFunc(vc.comments, func(c string) bool {
+		k, _, _ := strings.Cut(c, "=")
+		return del(strings.ToUpper(k))
+	})
+}
+
+// flacPicture represents a PICTURE metadata block
+// cf. https://xiph.org/flac/format.html#metadata_block_picture
+type flacPicture struct {
+	pictureType uint32
+	mimeType    string
+	description string
+	width       uint32
+	height      uint32
+	depth       uint32
+	colors      uint32
+	data        []byte
+}
+
+// dataURI returns the picture as data URI
+func (p *flacPicture) dataURI() string {
+	return fmt.Sprintf("data:%s;base64,%s", p.mimeType, base64.StdEncoding.EncodeToString(p.data))
+}
+
+// flacPictureTypeFrontCover is the picture type of the front cover (same as ID3v2 APIC)
+const flacPictureTypeFrontCover = 3
+
+// parseFLACPicture parses the body of a PICTURE block
+func parseFLACPicture(data []byte) (*flacPicture, error) {
+	r := bytes.NewReader(data)
+	readUint32 := func() uint32 {
+		var v uint32
+		binary.Read(r, binary.BigEndian, &v)
+		return v
+	}
+	readBytes := func() ([]byte, error) {
+		length := readUint32()
+		if int64(length) > int64(r.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		buf := make([]byte, length)
+		_, err := io.ReadFull(r, buf)
+		return buf, err
+	}
+
+	p := &flacPicture{pictureType: readUint32()}
+	mimeType, err := readBytes()
+	if err != nil {
+		return nil, fmt.Errorf("invalid picture MIME type: %w", err)
+	}
+	description, err := readBytes()
+	if err != nil {
+		return nil, fmt.Errorf("invalid picture description: %w", err)
+	}
+	p.mimeType, p.description = string(mimeType), string(description)
+	p.width, p.height, p.depth, p.colors = readUint32(), readUint32(), readUint32(), readUint32()
+	if p.data, err = readBytes(); err != nil {
+		return nil, fmt.Errorf("invalid picture data: %w", err)
+	}
+	return p, nil
+}
+
+// bytes returns the body of the PICTURE block
+func (p *flacPicture) bytes() []byte {
+	var buf bytes.Buffer
+	writeUint32 := func(v uint32) {
+		binary.Write(&buf, binary.BigEndian, v)
+	}
+	writeUint32(p.pictureType)
+	writeUint32(uint32(len(p.mimeType)))
+	buf.WriteString(p.mimeType)
+	writeUint32(uint32(len(p.description)))
+	buf.WriteString(p.description)
+	writeUint32(p.width)
+	writeUint32(p.height)
+	writeUint32(p.depth)
+	writeUint32(p.colors)
+	writeUint32(uint32(len(p.data)))
+	buf.Write(p.data)
+	return buf.Bytes()
+}
+
+// Vorbis comment keys that are not covered by textFrameMappings
+const (
+	vorbisKeyDate        = "DATE"
+	vorbisKeyComment     = "COMMENT"
+	vorbisKeyLyrics      = "LYRICS"
+	vorbisKeyChapeSource = ArtworkSourceName
+)
+
+// vorbisChapterKeyReg matches the chapter keys of the Vorbis chapter extension,
+// e.g. "CHAPTER001" and "CHAPTER001NAME"
+// cf. https://wiki.xiph.org/Chapter_Extension
+var vorbisChapterKeyReg = regexp.MustCompile(`^CHAPTER(\d+)(NAME)?$`)
+
+// readMetadata extracts metadata from the Vorbis comments and pictures
+func (t *flacTagger) readMetadata() (*Metadata, error) {
+	blocks, err := t.readBlocks()
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata = &Metadata{}
+	vc := &vorbisComment{}
+	var pictures []*flacPicture
+	for _, b := range blocks {
+		switch b.blockType {
+		case flacBlockVorbisComment:
+			if vc, err = parseVorbisComment(b.data); err != nil {
+				return nil, err
+			}
+		case flacBlockPicture:
+			p, err := parseFLACPicture(b.data)
+			if err != nil {
+				return nil, err
+			}
+			pictures = append(pictures, p)
+		}
+	}
+
+	for _, mapping := range textFrameMappings {
+		v := vc.get(mapping.vorbisKey)
+		if mapping.multiValued {
+			// Vorbis comments hold multiple values as repeated fields
+			v = strings.Join(vc.getAll(mapping.vorbisKey), multiValueNUL)
+		}
+		if v != "" {
+			mapping.setValue(metadata, v)
+		}
+	}
+
+	if v := vc.get(vorbisKeyDate); v != "" {
+		var ts Timestamp
+		if err := ts.UnmarshalYAML([]byte(v)); err == nil {
+			metadata.Date = &ts
+		}
+	}
+	metadata.Comment = vc.get(vorbisKeyComment)
+	metadata.Lyrics = vc.get(vorbisKeyLyrics)
+
+	if p := frontCover(pictures); p != nil && len(p.data) > 0 {
+		// Always prefer CHAPE_SOURCE if available, regardless of file existence
+		if chapeSource := vc.chapeSource(); chapeSource != "" {
+			metadata.Artwork.Src = chapeSource
+		} else {
+			metadata.Artwork.Src = p.dataURI()
+		}
+		metadata.Artwork.Type = pictureTypeName(p.pictureType)
+		metadata.Artwork.Description = p.description
+	}
+
+	// Chapters: CHAPTERxxx holds the start time and CHAPTERxxxNAME the title
+	chapters := map[string]*Chapter{}
+	var chapterNums []string
+	for _, c := range vc.comments {
+		k, v, _ := strings.Cut(c, "=")
+		m := vorbisChapterKeyReg.FindStringSubmatch(strings.ToUpper(k))
+		if m == nil {
+			continue
+		}
+		chapter, ok := chapters[m[1]]
+		if !ok {
+			chapter = &Chapter{Start: -1}
+			chapters[m[1]] = chapter
+			chapterNums = append(chapterNums, m[1])
+		}
+		if m[2] != "" {
+			chapter.Title = v
+		} else if start, err := parseVorbisChapterTime(v); err == nil {
+			chapter.Start = start
+		}
+	}
+	for _, num := range chapterNums {
+		if chapter := chapters[num]; chapter.Start >= 0 {
+			metadata.Chapters = append(metadata.Chapters, chapter)
+		}
+	}
+
+	return metadata, nil
+}
+
+// frontCover returns the front cover picture, or the first picture if there is no front cover
+func frontCover(pictures []*flacPicture) *flacPicture {
+	for _, p := range pictures {
+		if p.pictureType == flacPictureTypeFrontCover {
+			return p
+		}
+	}
+	if len(pictures) > 0 {
+		return pictures[0]
+	}
+	return nil
+}
+
+// writeMetadata writes metadata to the FLAC file.
+// Only the Vorbis comments that chape manages are replaced; other comments and
+// metadata blocks (SEEKTABLE, CUESHEET, APPLICATION and so on) are kept as is.
+func (t *flacTagger) writeMetadata(ctx context.Context, metadata *Metadata) error {
+	file, err := os.Open(t.path)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	blocks, err := readFLACBlocks(file)
+	if err != nil {
+		return err
+	}
+	if len(blocks) == 0 || blocks[0].blockType != flacBlockStreamInfo {
+		return errors.New("STREAMINFO block not found")
+	}
+
+	vc := &vorbisComment{vendor: "chape " + Version}
+	vcIndex := -1
+	for i, b := range blocks {
+		if b.blockType == flacBlockVorbisComment {
+			if vc, err = parseVorbisComment(b.data); err != nil {
+				return err
+			}
+			vcIndex = i
+			break
+		}
+	}
+
+	// Delete managed comments and add them again
+	managedKeys := map[string]bool{
+		vorbisKeyDate:    true,
+		vorbisKeyComment: true,
+		vorbisKeyLyrics:  true,
+	}
+	for _, mapping := range textFrameMappings {
+		managedKeys[mapping.vorbisKey] = true
+	}
+	vc.deleteFunc(func(key string) bool {
+		return managedKeys[key] || vorbisChapterKeyReg.MatchString(key)
+	})
+
+	for _, mapping := range textFrameMappings {
+		for v := range strings.SplitSeq(mapping.getValue(metadata), multiValueNUL) {
+			vc.add(mapping.vorbisKey, v)
+		}
+	}
+	if metadata.Date != nil && !metadata.Date.Time.IsZero() {
+		vc.add(vorbisKeyDate, metadata.Date.String())
+	}
+	vc.add(vorbisKeyComment, metadata.Comment)
+	vc.add(vorbisKeyLyrics, metadata.Lyrics)
+	for i, chapter := range metadata.Chapters {
+		key := fmt.Sprintf("CHAPTER%03d", i)
+		vc.add(key, formatVorbisChapterTime(chapter.Start))
+		vc.add(key+"NAME", chapter.Title)
+	}
+
+	// The picture type and description of the cover are kept unless the artwork is replaced,
+	// i.e. it's the recorded source or the embedded picture itself
+	var pictures []*flacPicture
+	for _, b := range blocks {
+		if b.blockType == flacBlockPicture {
+			p, err := parseFLACPicture(b.data)
+			if err != nil {
+				return err
+			}
+			pictures = append(pictures, p)
+		}
+	}
+	pictureType, pictureDescription := uint32(flacPictureTypeFrontCover), ""
+	if metadata.Artwork.explicit() {
+		pt, err := parsePictureType(metadata.Artwork.Type)
+		if err != nil {
+			return err
+		}
+		pictureType, pictureDescription = uint32(pt), metadata.Artwork.Description
+	} else if cover := frontCover(pictures); cover != nil && metadata.Artwork.Src != "" &&
+		(metadata.Artwork.Src == vc.chapeSource() || metadata.Artwork.Src == cover.dataURI()) {
+		pictureType, pictureDescription = cover.pictureType, cover.description
+	}
+
+	var newPicture *flacPicture
+	if metadata.Artwork.Src != "" {
+		pictureData, mimeType, err := parseArtwork(ctx, metadata.Artwork.Src, t.downloadRetries)
+		if err != nil {
+			return fmt.Errorf("failed to parse artwork: %w", err)
+		}
+		if err := checkArtworkSize(pictureData, t.maxArtworkSize); err != nil {
+			return err
+		}
+		if len(pictureData) > 0 {
+			newPicture = &flacPicture{
+				pictureType: pictureType,
+				mimeType:    mimeType,
+				description: pictureDescription,
+				data:        pictureData,
+			}
+			// Store artwork source in a comment
+			// Skip data URIs as they don't need source tracking
+			if !strings.HasPrefix(metadata.Artwork.Src, "data:") {
+				vc.deleteFunc(isArtworkSourceName)
+				vc.add(vorbisKeyChapeSource, metadata.Artwork.Src)
+			}
+		}
+	}
+
+	// Rebuild the block list
+	var newBlocks []*flacBlock
+	for i, b := range blocks {
+		switch {
+		case i == vcIndex:
+			newBlocks = append(newBlocks, &flacBlock{blockType: flacBlockVorbisComment, data: vc.bytes()})
+		case b.blockType == flacBlockPicture && newPicture != nil:
+			// Delete existing pictures
+		default:
+			newBlocks = append(newBlocks, b)
+		}
+		if i == 0 && vcIndex < 0 {
+			newBlocks = append(newBlocks, &flacBlock{blockType: flacBlockVorbisComment, data: vc.bytes()})
+		}
+	}
+	if newPicture != nil {
+		newBlocks = append(newBlocks, &flacBlock{blockType: flacBlockPicture, data: newPicture.bytes()})
+	}
+	if err := saveFLACBlocks(file, newBlocks); err != nil {
+		return err
+	}
+	t.blocks = nil
+	return nil
+}
+
+// writeArtwork replaces the front cover PICTURE block and the CHAPE_SOURCE comment,
+// keeping the other blocks and comments as they are
+func (t *flacTagger) writeArtwork(ctx context.Context, artwork string) error {
+	pictureData, mimeType, err := loadArtwork(ctx, artwork, t.downloadRetries, t.maxArtworkSize)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(t.path)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	blocks, err := readFLACBlocks(file)
+	if err != nil {
+		return err
+	}
+	if len(blocks) == 0 || blocks[0].blockType != flacBlockStreamInfo {
+		return errors.New("STREAMINFO block not found")
+	}
+
+	hasComment := slices.ContainsFunc(blocks, func(b *flacBlock) bool { return b.blockType == flacBlockVorbisComment })
+	var newBlocks []*flacBlock
+	for i, b := range blocks {
+		switch b.blockType {
+		case flacBlockVorbisComment:
+			vc, err := parseVorbisComment(b.data)
+			if err != nil {
+				return err
+			}
+			vc.deleteFunc(isArtworkSourceName)
+			vc.add(vorbisKeyChapeSource, artworkSource(artwork))
+			b = &flacBlock{blockType: flacBlockVorbisComment, data: vc.bytes()}
+		case flacBlockPicture:
+			p, err := parseFLACPicture(b.data)
+			if err != nil {
+				return err
+			}
+			if p.pictureType == flacPictureTypeFrontCover {
+				continue
+			}
+		}
+		newBlocks = append(newBlocks, b)
+		if i == 0 && !hasComment && artworkSource(artwork) != "" {
+			vc := &vorbisComment{vendor: "chape " + Version}
+			vc.add(vorbisKeyChapeSource, artworkSource(artwork))
+			newBlocks = append(newBlocks, &flacBlock{blockType: flacBlockVorbisComment, data: vc.bytes()})
+		}
+	}
+	newPicture := &flacPicture{pictureType: flacPictureTypeFrontCover, mimeType: mimeType, data: pictureData}
+	newBlocks = append(newBlocks, &flacBlock{blockType: flacBlockPicture, data: newPicture.bytes()})
+
+	if err := saveFLACBlocks(file, newBlocks); err != nil {
+		return err
+	}
+	t.blocks = nil
+	return nil
+}
+
+// saveFLACBlocks writes blocks followed by the audio frames of file, which is positioned
+// at them, to a temporary file and replaces file with it. Padding blocks are moved to the end.
+func saveFLACBlocks(file *os.File, blocks []*flacBlock) error {
+	// Keep padding blocks at the end as encoders do
+	slices.SortStableFunc(blocks, func(a, b *flacBlock) int {
+		return cmp.Compare(boolToInt(a.blockType == flacBlockPadding), boolToInt(b.blockType == flacBlockPadding))
+	})
+
+	// Write to a temporary file next to the original and replace it
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	path := file.Name()
+	tmpPath := path + "-chape"
+	tmpFile, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, stat.Mode())
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmpPath)
+	defer tmpFile.Close()
+
+	if err := writeFLACBlocks(tmpFile, blocks); err != nil {
+		return fmt.Errorf("failed to write metadata blocks: %w", err)
+	}
+	if _, err := io.Copy(tmpFile, file); err != nil {
+		return fmt.Errorf("failed to copy audio data: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	file.Close()
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+	return nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// embeddedArtwork extracts embedded artwork from FLAC as data URI
+func (t *flacTagger) embeddedArtwork() (string, error) {
+	blocks, err := t.readBlocks()
+	if err != nil {
+		return "", err
+	}
+	var pictures []*flacPicture
+	for _, b := range blocks {
+		if b.blockType == flacBlockPicture {
+			p, err := parseFLACPicture(b.data)
+			if err != nil {
+				return "", err
+			}
+			pictures = append(pictures, p)
+		}
+	}
+	if p := frontCover(pictures); p != nil && len(p.data) > 0 {
+		return p.dataURI(), nil
+	}
+	return "", nil
+}
+
+// duration calculates the duration of the FLAC file from the STREAMINFO block
+func (t *flacTagger) duration() (time.Duration, error) {
+	blocks, err := t.readBlocks()
+	if err != nil {
+		return 0, err
+	}
+	if len(blocks) == 0 || blocks[0].blockType != flacBlockStreamInfo || len(blocks[0].data) < 18 {
+		return 0, errors.New("STREAMINFO block not found")
+	}
+	// Bytes 10-17: sample rate (20 bits), channels (3), bits per sample (5), total samples (36)
+	v := binary.BigEndian.Uint64(blocks[0].data[10:18])
+	sampleRate := v >> 44
+	totalSamples := v & (1<<36 - 1)
+	if sampleRate == 0 {
+		return 0, errors.New("invalid sample rate in STREAMINFO")
+	}
+	return durationOf(totalSamples, sampleRate), nil
+}
+
+// durationOf returns the duration of count units at perSecond units per second, e.g. the
+// samples at the sample rate. The whole seconds are split off, so that long audio doesn't
+// overflow on converting to nanoseconds.
+func durationOf(count, perSecond uint64) time.Duration {
+	return time.Duration(count/perSecond)*time.Second +
+		time.Duration((count%perSecond)*uint64(time.Second)/perSecond)
+}
+
+// formatVorbisChapterTime formats a chapter start as HH:MM:SS.mmm
+func formatVorbisChapterTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, (ms%3600000)/60000, (ms%60000)/1000, ms%1000)
+}
+
+// parseVorbisChapterTime parses a chapter start in HH:MM:SS.mmm format
+func parseVorbisChapterTime(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid chapter time: %s", s)
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid hours: %s", parts[0])
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid minutes: %s", parts[1])
+	}
+	seconds, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid seconds: %s", parts[2])
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		(time.Duration(seconds*1000+0.5) * time.Millisecond), nil
+}
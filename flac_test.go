@@ -0,0 +1,23 @@
+package chape
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDurationOf(t *testing.T) {
+	tests := []struct {
+		count, perSecond uint64
+		want             time.Duration
+	}{
+		{44100, 44100, time.Second},
+		{66150, 44100, 1500 * time.Millisecond},
+		// The largest sample count of STREAMINFO (36 bits) at 192kHz is about 99 hours
+		{1<<36 - 1, 192000, 357913*time.Second + 941328125},
+	}
+	for _, tt := range tests {
+		if got := durationOf(tt.count, tt.perSecond); got != tt.want {
+			t.Errorf("durationOf(%d, %d) = %s, want %s", tt.count, tt.perSecond, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package chape
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// framePreviewLength is the maximum number of characters of a frame value to show
+const framePreviewLength = 60
+
+// DumpFrames writes every ID3v2 frame of the MP3 file as stored, one per line with the
+// frame ID, the body size and a short preview of the value. Unlike Dump, nothing is
+// interpreted or normalized, which helps to see why a round trip doesn't match.
+func (c *Chape) DumpFrames(output io.Writer) error {
+	ext, err := c.audioExt()
+	if err != nil {
+		return err
+	}
+	if ext != ".mp3" {
+		return fmt.Errorf("frames are listed only for MP3 files: %s", c.audio)
+	}
+	file, err := audioSource{path: c.audio, reader: c.reader}.open()
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(file, header); err != nil || string(header[:3]) != "ID3" {
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		_, err := fmt.Fprintln(output, "no ID3v2 tag")
+		return err
+	}
+	version := header[3]
+	if version < 3 {
+		return fmt.Errorf("frames of ID3v2.%d are not supported", version)
+	}
+	body := make([]byte, synchsafe(header[6:10]))
+	if _, err := io.ReadFull(file, body); err != nil {
+		return fmt.Errorf("failed to read ID3v2 tag: %w", err)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "ID3v2.%d.%d, %d bytes", version, header[4], len(body)+10)
+	if header[5]&0x80 != 0 {
+		sb.WriteString(", unsynchronised")
+	}
+	sb.WriteString("\n")
+	if header[5]&0x40 != 0 && len(body) >= 4 {
+		size := int(binary.BigEndian.Uint32(body))
+		if version == 4 {
+			size = synchsafe(body[:4])
+		} else {
+			size += 4 // the size in ID3v2.3 excludes itself
+		}
+		if size > len(body) {
+			return errors.New("invalid ID3v2 extended header")
+		}
+		fmt.Fprintf(&sb, "extended header, %d bytes\n", size)
+		body = body[size:]
+	}
+	frames := splitID3Frames(body, version == 4)
+	n := 0
+	for _, f := range frames {
+		writeFrameLine(&sb, f, version, "")
+		n += len(f.raw)
+	}
+	if padding := len(body) - n; padding > 0 {
+		fmt.Fprintf(&sb, "padding, %d bytes\n", padding)
+	}
+	_, err = io.WriteString(output, sb.String())
+	return err
+}
+
+// writeFrameLine writes the line of the frame, followed by the lines of its sub-frames
+// for CHAP frames
+func writeFrameLine(sb *strings.Builder, f id3Frame, version byte, indent string) {
+	fmt.Fprintf(sb, "%s%s %6d  %s\n", indent, f.id, len(f.body), framePreview(f))
+	if f.id != "CHAP" {
+		return
+	}
+	if _, rest, ok := bytes.Cut(f.body, []byte{0}); ok && len(rest) >= 16 {
+		for _, sf := range splitChapSubframes(rest[16:], version) {
+			writeFrameLine(sb, sf, version, indent+"  ")
+		}
+	}
+}
+
+// framePreview returns a short description of the value of the frame
+func framePreview(f id3Frame) string {
+	b := f.body
+	switch {
+	case f.id == "TXXX":
+		description, value := parseTXXX(b)
+		return truncatePreview(fmt.Sprintf("%q = %q", description, value))
+	case f.id == "WXXX":
+		_, url := parseWXXX(b)
+		return truncatePreview(fmt.Sprintf("%q", url))
+	case f.id == "APIC":
+		if p := parseAPIC(b); p != nil {
+			return fmt.Sprintf("%s, picture type %d, %d bytes, %q", p.MimeType, p.PictureType, len(p.Picture), p.Description)
+		}
+	case f.id == "COMM", f.id == "USLT":
+		// Encoding, language, description and the text
+		if len(b) >= 4 {
+			description, rest := cutID3Text(b[0], b[4:])
+			text, _ := cutID3Text(b[0], rest)
+			return truncatePreview(fmt.Sprintf("[%s] %q = %q", b[1:4], description, text))
+		}
+	case f.id == "CHAP":
+		if elementID, rest, ok := bytes.Cut(b, []byte{0}); ok && len(rest) >= 16 {
+			start := time.Duration(binary.BigEndian.Uint32(rest[0:4])) * time.Millisecond
+			end := time.Duration(binary.BigEndian.Uint32(rest[4:8])) * time.Millisecond
+			return fmt.Sprintf("%q %s - %s", elementID, formatChapterTime(start), formatChapterTime(end))
+		}
+	case f.id == "CTOC":
+		if ctoc, err := parseCTOCFrame(b); err == nil {
+			return fmt.Sprintf("%q top-level=%t ordered=%t %v", ctoc.elementID, ctoc.topLevel, ctoc.ordered, ctoc.childElementIDs)
+		}
+	case strings.HasPrefix(f.id, "T") && len(b) >= 1:
+		return truncatePreview(fmt.Sprintf("%q", decodeID3Text(b[0], b[1:])))
+	case strings.HasPrefix(f.id, "W"):
+		return truncatePreview(fmt.Sprintf("%q", decodeID3Text(0, b)))
+	}
+	return fmt.Sprintf("% x", b[:min(len(b), 16)])
+}
+
+// truncatePreview truncates s to framePreviewLength characters
+func truncatePreview(s string) string {
+	if r := []rune(s); len(r) > framePreviewLength {
+		return string(r[:framePreviewLength]) + "..."
+	}
+	return s
+}
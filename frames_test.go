@@ -0,0 +1,65 @@
+package chape
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDumpFrames(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+	// Drop the empty ID3v2 header
+	b, err := os.ReadFile(mp3Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(mp3Path, b[10:], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := New(mp3Path).DumpFrames(&buf); err != nil {
+		t.Fatalf("DumpFrames failed: %v", err)
+	}
+	if got := buf.String(); got != "no ID3v2 tag\n" {
+		t.Errorf("got %q for no tag", got)
+	}
+
+	input := `title: Episode
+custom:
+  FOO: bar
+artwork: ` + testPNGDataURI + `
+chapters:
+- 0:00 Intro
+- start: "0:00.500"
+  title: Main
+  url: https://example.com
+`
+	if err := New(mp3Path).Apply(strings.NewReader(input), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	buf.Reset()
+	if err := New(mp3Path).DumpFrames(&buf); err != nil {
+		t.Fatalf("DumpFrames failed: %v", err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		"ID3v2.4.0, ",
+		`TIT2      9  "Episode\x00"`,
+		`TXXX      8  "FOO" = "bar"`,
+		"APIC     83  image/png, picture type 3, 70 bytes, \"\"\n",
+		`CHAP     50  "chp0" 0:00 - 0:00.500`,
+		`  WXXX     21  "https://example.com"`,
+		`CTOC     16  "toc" top-level=true ordered=true [chp0 chp1]`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output should contain %q:\n%s", want, got)
+		}
+	}
+
+	if err := New("test.flac").DumpFrames(&buf); err == nil {
+		t.Error("expected an error for a FLAC file")
+	}
+}
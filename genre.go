@@ -0,0 +1,105 @@
+package chape
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// id3v1Genres is the ID3v1 genre table including the Winamp extensions, indexed by the genre code
+// cf. https://en.wikipedia.org/wiki/List_of_ID3v1_genres
+var id3v1Genres = [...]string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge", "Hip-Hop",
+	"Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "Rhythm and Blues", "Rap",
+	"Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska", "Death Metal", "Pranks",
+	"Soundtrack", "Euro-Techno", "Ambient", "Trip-Hop", "Vocal", "Jazz & Funk", "Fusion", "Trance",
+	"Classical", "Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"Alternative Rock", "Bass", "Soul", "Punk", "Space", "Meditative", "Instrumental Pop", "Instrumental Rock",
+	"Ethnic", "Gothic", "Darkwave", "Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap", "Pop/Funk", "Jungle",
+	"Native US", "Cabaret", "New Wave", "Psychedelic", "Rave", "Showtunes", "Trailer", "Lo-Fi",
+	"Tribal", "Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock 'n' Roll", "Hard Rock",
+	"Folk", "Folk-Rock", "National Folk", "Swing", "Fast Fusion", "Bebop", "Latin", "Revival",
+	"Celtic", "Bluegrass", "Avantgarde", "Gothic Rock", "Progressive Rock", "Psychedelic Rock", "Symphonic Rock", "Slow Rock",
+	"Big Band", "Chorus", "Easy Listening", "Acoustic", "Humour", "Speech", "Chanson", "Opera",
+	"Chamber Music", "Sonata", "Symphony", "Booty Bass", "Primus", "Porn Groove", "Satire", "Slow Jam",
+	"Club", "Tango", "Samba", "Folklore", "Ballad", "Power Ballad", "Rhythmic Soul", "Freestyle",
+	"Duet", "Punk Rock", "Drum Solo", "A Cappella", "Euro-House", "Dance Hall", "Goa", "Drum & Bass",
+	"Club-House", "Hardcore Techno", "Terror", "Indie", "BritPop", "Negerpunk", "Polsk Punk", "Beat",
+	"Christian Gangsta Rap", "Heavy Metal", "Black Metal", "Crossover", "Contemporary Christian", "Christian Rock", "Merengue", "Salsa",
+	"Thrash Metal", "Anime", "Jpop", "Synthpop", "Abstract", "Art Rock", "Baroque", "Bhangra",
+	"Big Beat", "Breakbeat", "Chillout", "Downtempo", "Dub", "EBM", "Eclectic", "Electro",
+	"Electroclash", "Emo", "Experimental", "Garage", "Global", "IDM", "Illbient", "Industro-Goth",
+	"Jam Band", "Krautrock", "Leftfield", "Lounge", "Math Rock", "New Romantic", "Nu-Breakz", "Post-Punk",
+	"Post-Rock", "Psytrance", "Shoegaze", "Space Rock", "Trop Rock", "World Music", "Neoclassical", "Audiobook",
+	"Audio Theatre", "Neue Deutsche Welle", "Podcast", "Indie Rock", "G-Funk", "Dubstep", "Garage Rock", "Psybient",
+}
+
+// Special genre references of ID3v2
+const (
+	genreRemix = "Remix"
+	genreCover = "Cover"
+)
+
+// normalizeGenre maps the numeric genre references of the ID3v1 genre table in a TCON value
+// to their names, e.g. "(17)" or "17" to "Rock", "(RX)" to "Remix" and "(CR)" to "Cover".
+// A refinement following the references, as in "(4)Eurodisco", is preferred over them, and
+// "((" escapes a literal parenthesis. Free-form text and unknown references are returned as is.
+// Multiple values, separated by NUL or given as references, are returned in order without duplicates.
+func normalizeGenre(value string) Values {
+	var names Values
+	// ID3v2.4 separates multiple values with NUL
+	for v := range strings.SplitSeq(value, multiValueNUL) {
+		for _, name := range parseGenreValue(v) {
+			if name != "" && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// parseGenreValue parses a single TCON value into the genre names
+func parseGenreValue(v string) []string {
+	if name, ok := genreName(v); ok {
+		return []string{name}
+	}
+	// ID3v2.3: references in parentheses, optionally followed by a refinement
+	var names []string
+	rest := v
+	for strings.HasPrefix(rest, "(") && !strings.HasPrefix(rest, "((") {
+		ref, after, ok := strings.Cut(rest[1:], ")")
+		if !ok {
+			break
+		}
+		name, ok := genreName(ref)
+		if !ok {
+			break
+		}
+		names = append(names, name)
+		rest = after
+	}
+	if rest != "" {
+		if strings.HasPrefix(rest, "((") {
+			rest = rest[1:]
+		}
+		// The refinement of the references
+		return []string{rest}
+	}
+	return names
+}
+
+// genreName returns the name of the genre reference: a code of the ID3v1 genre table, RX or CR
+func genreName(ref string) (string, bool) {
+	switch ref {
+	case "RX":
+		return genreRemix, true
+	case "CR":
+		return genreCover, true
+	}
+	code, err := strconv.Atoi(ref)
+	if err != nil || code < 0 || code >= len(id3v1Genres) || strconv.Itoa(code) != ref {
+		return "", false
+	}
+	return id3v1Genres[code], true
+}
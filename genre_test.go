@@ -0,0 +1,60 @@
+package chape
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+func TestNormalizeGenre(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Values
+	}{
+		{"(17)", Values{"Rock"}},
+		{"17", Values{"Rock"}},
+		{"0", Values{"Blues"}},
+		{"(186)", Values{"Podcast"}},
+		{"(4)Eurodisco", Values{"Eurodisco"}},
+		{"(17)(31)", Values{"Rock", "Trance"}},
+		{"(RX)", Values{"Remix"}},
+		{"(CR)(17)", Values{"Cover", "Rock"}},
+		{"17\x00Jazz", Values{"Rock", "Jazz"}},
+		{"((Not a reference)", Values{"(Not a reference)"}},
+		{"Rock", Values{"Rock"}},
+		{"Technology", Values{"Technology"}},
+		{"(255)", Values{"(255)"}},
+		{"192", Values{"192"}},
+		{"017", Values{"017"}},
+		{"(17", Values{"(17"}},
+	}
+	for _, tt := range tests {
+		if got := normalizeGenre(tt.input); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("normalizeGenre(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestReadNumericGenre(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatalf("failed to open tag: %v", err)
+	}
+	tag.SetVersion(3)
+	tag.SetGenre("(17)")
+	if err := tag.Save(); err != nil {
+		t.Fatalf("failed to save tag: %v", err)
+	}
+	tag.Close()
+
+	metadata, err := New(mp3Path).Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if !reflect.DeepEqual(metadata.Genre, Values{"Rock"}) {
+		t.Errorf("unexpected genre: %q", metadata.Genre)
+	}
+}
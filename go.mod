@@ -3,16 +3,17 @@ module github.com/Songmu/chape
 go 1.25.0
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/Songmu/prompter v0.5.1
 	github.com/bogem/id3v2/v2 v2.1.4
 	github.com/goccy/go-yaml v1.18.0
 	github.com/sergi/go-diff v1.4.0
 	github.com/tcolgate/mp3 v0.0.0-20170426193717-e79c5a46d300
+	golang.org/x/term v0.0.0-20220526004731-065cf7ba2467
 	golang.org/x/text v0.28.0
 )
 
 require (
 	github.com/mattn/go-isatty v0.0.14 // indirect
 	golang.org/x/sys v0.0.0-20220722155257-8c9f86f7a55f // indirect
-	golang.org/x/term v0.0.0-20220526004731-065cf7ba2467 // indirect
 )
@@ -0,0 +1,201 @@
+package chape
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// ID3v1Mode is how Apply, Edit and Write treat the ID3v1 tag at the end of MP3 files,
+// which legacy players read instead of ID3v2
+type ID3v1Mode string
+
+const (
+	// ID3v1Keep keeps the ID3v1 tag as it is, warning when it disagrees with the metadata
+	ID3v1Keep ID3v1Mode = "keep"
+	// ID3v1Sync writes the ID3v1 tag from the metadata, adding one if there's none
+	ID3v1Sync ID3v1Mode = "sync"
+	// ID3v1Strip removes the ID3v1 tag
+	ID3v1Strip ID3v1Mode = "strip"
+)
+
+// id3v1Size is the size of the ID3v1 tag, which is the last bytes of the file
+const id3v1Size = 128
+
+// id3v1Tag is the fields of an ID3v1 tag. The track is of ID3v1.1, which takes the last
+// two bytes of the comment; zero means there's none.
+type id3v1Tag struct {
+	title, artist, album, year, comment string
+	track                               byte
+	genre                               byte
+}
+
+// newID3v1Tag returns the ID3v1 tag holding metadata. Multiple values are joined with "; ",
+// and the genre is the first one in the ID3v1 genre table, or 255 for none.
+// The fields are truncated to their sizes by bytes.
+func newID3v1Tag(m *Metadata) *id3v1Tag {
+	t := &id3v1Tag{
+		title:   m.Title,
+		artist:  m.Artist.String(),
+		album:   m.Album,
+		comment: m.Comment,
+		genre:   255,
+	}
+	if m.Date != nil {
+		t.year = fmt.Sprintf("%04d", m.Date.Year())
+	}
+	if m.Track != nil && m.Track.Current > 0 && m.Track.Current <= 255 {
+		t.track = byte(m.Track.Current)
+	}
+genres:
+	for _, g := range m.Genre {
+		for i, name := range id3v1Genres {
+			if strings.EqualFold(g, name) {
+				t.genre = byte(i)
+				break genres
+			}
+		}
+	}
+	return t
+}
+
+// bytes encodes the tag in ISO-8859-1, truncating the fields to their sizes
+func (t *id3v1Tag) bytes() []byte {
+	b := make([]byte, id3v1Size)
+	copy(b, "TAG")
+	copy(b[3:33], encodeID3Text(0, t.title))
+	copy(b[33:63], encodeID3Text(0, t.artist))
+	copy(b[63:93], encodeID3Text(0, t.album))
+	copy(b[93:97], t.year)
+	if t.track > 0 {
+		copy(b[97:125], encodeID3Text(0, t.comment))
+		b[126] = t.track
+	} else {
+		copy(b[97:127], encodeID3Text(0, t.comment))
+	}
+	b[127] = t.genre
+	return b
+}
+
+// parseID3v1 parses the ID3v1 tag, or returns nil if b isn't one
+func parseID3v1(b []byte) *id3v1Tag {
+	if len(b) != id3v1Size || string(b[:3]) != "TAG" {
+		return nil
+	}
+	t := &id3v1Tag{
+		title:  id3v1Text(b[3:33]),
+		artist: id3v1Text(b[33:63]),
+		album:  id3v1Text(b[63:93]),
+		year:   id3v1Text(b[93:97]),
+		genre:  b[127],
+	}
+	if b[125] == 0 && b[126] != 0 {
+		t.comment = id3v1Text(b[97:125])
+		t.track = b[126]
+	} else {
+		t.comment = id3v1Text(b[97:127])
+	}
+	return t
+}
+
+// id3v1Text decodes the field in ISO-8859-1, which is padded with NULs or spaces
+func id3v1Text(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimRight(decodeID3Text(0, b), " ")
+}
+
+// readID3v1 reads the ID3v1 tag at the end of r and returns the size of r without it.
+// The tag is nil if there's none.
+func readID3v1(r io.ReadSeeker) (*id3v1Tag, int64, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, err
+	}
+	if size < id3v1Size {
+		return nil, size, nil
+	}
+	b := make([]byte, id3v1Size)
+	if err := readAt(r, b, size-id3v1Size); err != nil {
+		return nil, 0, err
+	}
+	t := parseID3v1(b)
+	if t != nil {
+		size -= id3v1Size
+	}
+	return t, size, nil
+}
+
+// id3v1Agrees reports whether the ID3v1 tag holds metadata as written by ID3v1Sync
+func id3v1Agrees(t *id3v1Tag, m *Metadata) bool {
+	return *t == *parseID3v1(newID3v1Tag(m).bytes())
+}
+
+// checkID3v1 reports whether the MP3 file has an ID3v1 tag and whether it agrees with metadata
+func (t *mp3Tagger) checkID3v1(m *Metadata) (exists, agrees bool, err error) {
+	file, err := t.open()
+	if err != nil {
+		return false, false, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+	v1, _, err := readID3v1(file)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to read ID3v1 tag: %w", err)
+	}
+	if v1 == nil {
+		return false, false, nil
+	}
+	return true, id3v1Agrees(v1, m), nil
+}
+
+// id3v1Trailer returns the end of the audio to copy and the ID3v1 tag to write after it
+// for the ID3v1 mode. The end is negative to copy the rest of the file as it is.
+func (t *mp3Tagger) id3v1Trailer(r io.ReadSeeker, m *Metadata) (int64, []byte, error) {
+	if t.id3v1 != ID3v1Sync && t.id3v1 != ID3v1Strip {
+		return -1, nil, nil
+	}
+	_, end, err := readID3v1(r)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read ID3v1 tag: %w", err)
+	}
+	if t.id3v1 == ID3v1Strip {
+		return end, nil, nil
+	}
+	return end, newID3v1Tag(m).bytes(), nil
+}
+
+// id3v1Pending reports whether writing changes the ID3v1 tag for the ID3v1 mode.
+// With ID3v1Keep, a tag disagreeing with newMetadata is warned about instead.
+func (c *Chape) id3v1Pending(newMetadata *Metadata) (bool, error) {
+	switch c.ID3v1 {
+	case "", ID3v1Keep, ID3v1Sync, ID3v1Strip:
+	default:
+		return false, fmt.Errorf("unknown ID3v1 mode %q: must be %s, %s or %s", c.ID3v1,
+			ID3v1Keep, ID3v1Sync, ID3v1Strip)
+	}
+	t, err := c.tagger()
+	if err != nil {
+		return false, err
+	}
+	s, ok := t.(id3v1Checker)
+	if !ok {
+		return false, nil
+	}
+	exists, agrees, err := s.checkID3v1(newMetadata)
+	if err != nil {
+		return false, err
+	}
+	switch c.ID3v1 {
+	case ID3v1Sync:
+		return !exists || !agrees, nil
+	case ID3v1Strip:
+		return exists, nil
+	}
+	if exists && !agrees {
+		log.Printf("Warning: the ID3v1 tag, which legacy players read, disagrees with the metadata; sync or strip it")
+	}
+	return false, nil
+}
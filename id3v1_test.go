@@ -0,0 +1,178 @@
+package chape
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestID3v1Tag(t *testing.T) {
+	m := &Metadata{
+		Title:   "A Title Longer Than Thirty Bytes Is Truncated",
+		Artist:  Values{"Alice", "Bob"},
+		Album:   "Café",
+		Date:    &Timestamp{Time: time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC), Precision: PrecisionDay},
+		Track:   &NumberInSet{Current: 3, Total: 10},
+		Genre:   Values{"Unknown", "rock"},
+		Comment: "日本語",
+	}
+	b := newID3v1Tag(m).bytes()
+	if len(b) != id3v1Size {
+		t.Fatalf("size = %d", len(b))
+	}
+	got := parseID3v1(b)
+	want := id3v1Tag{
+		title:   "A Title Longer Than Thirty Byt",
+		artist:  "Alice; Bob",
+		album:   "Café",
+		year:    "2024",
+		comment: "???",
+		track:   3,
+		genre:   17,
+	}
+	if *got != want {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+	if b[66] != 0xE9 {
+		t.Errorf("album should be in ISO-8859-1, got % x", b[63:68])
+	}
+	if !id3v1Agrees(got, m) {
+		t.Error("synced tag should agree with the metadata")
+	}
+	if id3v1Agrees(got, &Metadata{Title: m.Title}) {
+		t.Error("synced tag shouldn't agree with other metadata")
+	}
+
+	// ID3v1.0 has a 30-byte comment and no track, and fields padded with spaces
+	b = newID3v1Tag(&Metadata{Comment: strings.Repeat("c", 40)}).bytes()
+	copy(b[3:33], "Padded"+strings.Repeat(" ", 24))
+	got = parseID3v1(b)
+	if got.title != "Padded" || got.comment != strings.Repeat("c", 30) || got.track != 0 || got.genre != 255 {
+		t.Errorf("got %+v", *got)
+	}
+	if parseID3v1(make([]byte, id3v1Size)) != nil {
+		t.Error("bytes without TAG should not be parsed")
+	}
+}
+
+func TestApplyID3v1(t *testing.T) {
+	stale := newID3v1Tag(&Metadata{Title: "Stale"}).bytes()
+	setup := func(t *testing.T) string {
+		t.Helper()
+		mp3Path := createDummyMP3(t, time.Second)
+		f, err := os.OpenFile(mp3Path, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.Write(stale); err != nil {
+			t.Fatal(err)
+		}
+		return mp3Path
+	}
+	readV1 := func(t *testing.T, path string) *id3v1Tag {
+		t.Helper()
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		v1, _, err := readID3v1(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v1
+	}
+	input := "title: Fresh\nartist: Someone\ngenre: Jazz\n"
+
+	t.Run("keep", func(t *testing.T) {
+		mp3Path := setup(t)
+		var logBuf bytes.Buffer
+		log.SetOutput(&logBuf)
+		defer log.SetOutput(os.Stderr)
+
+		if err := New(mp3Path).Apply(strings.NewReader(input), true); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		if v1 := readV1(t, mp3Path); v1 == nil || v1.title != "Stale" {
+			t.Errorf("ID3v1 tag should be kept, got %+v", v1)
+		}
+		if !strings.Contains(logBuf.String(), "Warning: the ID3v1 tag") {
+			t.Errorf("disagreeing ID3v1 tag should be warned, got %q", logBuf.String())
+		}
+		md, err := New(mp3Path).Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if md.Title != "Fresh" {
+			t.Errorf("title = %q", md.Title)
+		}
+	})
+
+	t.Run("sync", func(t *testing.T) {
+		mp3Path := setup(t)
+		c := New(mp3Path)
+		c.ID3v1 = ID3v1Sync
+		if err := c.Apply(strings.NewReader(input), true); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		v1 := readV1(t, mp3Path)
+		if v1 == nil || v1.title != "Fresh" || v1.artist != "Someone" || v1.genre != 8 {
+			t.Errorf("ID3v1 tag should be synced, got %+v", v1)
+		}
+		b, err := os.ReadFile(mp3Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Count(b, []byte("TAG")) != 1 {
+			t.Error("stale ID3v1 tag should be replaced")
+		}
+
+		// Syncing writes even when ID3v2 is unchanged
+		if err := New(mp3Path).Apply(strings.NewReader("title: Fresh\nartist: Someone\n"), true); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		if err := c.Apply(strings.NewReader("title: Fresh\nartist: Someone\n"), true); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		if v1 := readV1(t, mp3Path); v1 == nil || v1.genre != 255 {
+			t.Errorf("ID3v1 tag should be synced without changes to ID3v2, got %+v", v1)
+		}
+	})
+
+	t.Run("strip", func(t *testing.T) {
+		mp3Path := setup(t)
+		before, err := os.ReadFile(mp3Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := New(mp3Path)
+		c.ID3v1 = ID3v1Strip
+		if err := c.Apply(strings.NewReader(input), true); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		if v1 := readV1(t, mp3Path); v1 != nil {
+			t.Errorf("ID3v1 tag should be stripped, got %+v", v1)
+		}
+		after, err := os.ReadFile(mp3Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		audio := before[len(before)-id3v1Size-417 : len(before)-id3v1Size]
+		if !bytes.HasSuffix(after, audio) {
+			t.Error("audio should be kept when stripping")
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		mp3Path := setup(t)
+		c := New(mp3Path)
+		c.ID3v1 = "drop"
+		if err := c.Apply(strings.NewReader(input), true); err == nil || !strings.Contains(err.Error(), "unknown ID3v1 mode") {
+			t.Errorf("unknown mode should fail, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package chape
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormatLRC is the LRC format for synchronised lyrics
+const FormatLRC Format = "lrc"
+
+// writeLRC writes the synchronised lyrics of metadata in the LRC format, preceded by
+// the title, artist and album as ID tags
+// cf. https://en.wikipedia.org/wiki/LRC_(file_format)
+func writeLRC(w io.Writer, metadata *Metadata) error {
+	bw := bufio.NewWriter(w)
+	for _, tag := range []struct{ key, value string }{
+		{"ti", metadata.Title},
+		{"ar", metadata.Artist.String()},
+		{"al", metadata.Album},
+	} {
+		if tag.value != "" {
+			fmt.Fprintf(bw, "[%s:%s]\n", tag.key, tag.value)
+		}
+	}
+	for _, l := range metadata.SyncedLyrics {
+		fmt.Fprintf(bw, "[%s]%s\n", formatLRCTime(l.Time), l.Text)
+	}
+	return bw.Flush()
+}
+
+// formatLRCTime formats duration as an LRC time tag (mm:ss.xx)
+func formatLRCTime(d time.Duration) string {
+	cs := d.Milliseconds() / 10
+	return fmt.Sprintf("%02d:%02d.%02d", cs/6000, (cs%6000)/100, cs%100)
+}
+
+// parseLRC parses synchronised lyrics in the LRC format. A line with several time tags
+// is repeated at each time, and the offset tag is applied. Other ID tags are ignored.
+// Lines are sorted by time.
+func parseLRC(r io.Reader) ([]*SyncedLyric, error) {
+	var (
+		lines  []*SyncedLyric
+		offset time.Duration
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		var times []time.Duration
+		for strings.HasPrefix(line, "[") {
+			tag, rest, ok := strings.Cut(line[1:], "]")
+			if !ok {
+				break
+			}
+			t, err := parseLRCTime(tag)
+			if err != nil {
+				if key, value, ok := strings.Cut(tag, ":"); ok && len(times) == 0 && strings.TrimSpace(key) == "offset" {
+					// A positive offset shows the lyrics earlier
+					ms, err := strconv.Atoi(strings.TrimSpace(value))
+					if err != nil {
+						return nil, fmt.Errorf("invalid LRC offset: %q", value)
+					}
+					offset = time.Duration(ms) * time.Millisecond
+				}
+				break
+			}
+			times = append(times, t)
+			line = rest
+		}
+		for _, t := range times {
+			lines = append(lines, &SyncedLyric{Time: t, Text: strings.TrimSpace(line)})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, errors.New("no time-tagged lines in LRC")
+	}
+	for _, l := range lines {
+		l.Time = max(l.Time-offset, 0)
+	}
+	slices.SortStableFunc(lines, func(a, b *SyncedLyric) int {
+		return cmp.Compare(a.Time, b.Time)
+	})
+	return lines, nil
+}
+
+// readLRCFile reads synchronised lyrics from the LRC file
+func readLRCFile(path string) ([]*SyncedLyric, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lyrics file: %w", err)
+	}
+	defer f.Close()
+	lines, err := parseLRC(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse lyrics file: %w", err)
+	}
+	return lines, nil
+}
+
+// parseLRCTime parses an LRC time tag: mm:ss, mm:ss.xx or mm:ss.xxx
+func parseLRCTime(s string) (time.Duration, error) {
+	minStr, secStr, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid LRC time: %q", s)
+	}
+	minutes, err := strconv.Atoi(minStr)
+	if err != nil || minutes < 0 {
+		return 0, fmt.Errorf("invalid LRC time: %q", s)
+	}
+	secStr, fracStr, _ := strings.Cut(secStr, ".")
+	seconds, err := strconv.Atoi(secStr)
+	if err != nil || seconds < 0 || seconds >= 60 {
+		return 0, fmt.Errorf("invalid LRC time: %q", s)
+	}
+	d := time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+	if fracStr != "" {
+		if len(fracStr) > 3 {
+			return 0, fmt.Errorf("invalid LRC time: %q", s)
+		}
+		frac, err := strconv.Atoi(fracStr)
+		if err != nil || frac < 0 {
+			return 0, fmt.Errorf("invalid LRC time: %q", s)
+		}
+		// Hundredths in mm:ss.xx, milliseconds in mm:ss.xxx
+		for range 3 - len(fracStr) {
+			frac *= 10
+		}
+		d += time.Duration(frac) * time.Millisecond
+	}
+	return d, nil
+}
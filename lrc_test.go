@@ -0,0 +1,100 @@
+package chape
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLRC(t *testing.T) {
+	input := "\ufeff[ti:Song]\n[ar:Singer]\n[offset:+500]\n" +
+		"[00:12.34]First line\n" +
+		"[00:05.00][01:00.5]Chorus\n" +
+		"[00:20.123]\n" +
+		"not a lyric line\n"
+	got, err := parseLRC(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseLRC failed: %v", err)
+	}
+	expected := []*SyncedLyric{
+		{Time: 4500 * time.Millisecond, Text: "Chorus"},
+		{Time: 11840 * time.Millisecond, Text: "First line"},
+		{Time: 19623 * time.Millisecond, Text: ""},
+		{Time: 60 * time.Second, Text: "Chorus"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("parseLRC() = %v, want %v", got, expected)
+	}
+
+	if _, err := parseLRC(strings.NewReader("[ti:No lyrics]\n")); err == nil {
+		t.Error("expected an error for LRC without time-tagged lines")
+	}
+}
+
+func TestWriteLRC(t *testing.T) {
+	metadata := &Metadata{
+		Title:  "Song",
+		Artist: Values{"Singer"},
+		SyncedLyrics: []*SyncedLyric{
+			{Time: 12340 * time.Millisecond, Text: "First line"},
+			{Time: 61*time.Minute + 5*time.Second, Text: "Late line"},
+		},
+	}
+	var buf bytes.Buffer
+	if err := writeLRC(&buf, metadata); err != nil {
+		t.Fatalf("writeLRC failed: %v", err)
+	}
+	expected := "[ti:Song]\n[ar:Singer]\n[00:12.34]First line\n[61:05.00]Late line\n"
+	if buf.String() != expected {
+		t.Errorf("writeLRC() =\n%s\nwant:\n%s", buf.String(), expected)
+	}
+
+	got, err := parseLRC(&buf)
+	if err != nil {
+		t.Fatalf("parseLRC failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, metadata.SyncedLyrics) {
+		t.Errorf("round trip = %v, want %v", got, metadata.SyncedLyrics)
+	}
+}
+
+func TestApplySyncedLyrics(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+	lrcPath := filepath.Join(t.TempDir(), "song.lrc")
+	if err := os.WriteFile(lrcPath, []byte("[00:00.50]Hello\n[00:01.00]世界\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(mp3Path)
+	c.LyricsFrom = lrcPath
+	if err := c.Apply(strings.NewReader("title: Synced\nlyrics: Hello 世界\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	metadata, err := New(mp3Path).Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if metadata.Lyrics != "Hello 世界" {
+		t.Errorf("unexpected lyrics: %q", metadata.Lyrics)
+	}
+	expected := []*SyncedLyric{
+		{Time: 500 * time.Millisecond, Text: "Hello"},
+		{Time: time.Second, Text: "世界"},
+	}
+	if !reflect.DeepEqual(metadata.SyncedLyrics, expected) {
+		t.Errorf("unexpected synced lyrics: %v", metadata.SyncedLyrics)
+	}
+
+	var buf bytes.Buffer
+	if err := New(mp3Path).Dump(&buf, FormatYAML); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "syncedLyrics:\n- 0:00.500 Hello\n- 0:01 世界\n") {
+		t.Errorf("unexpected YAML:\n%s", buf.String())
+	}
+}
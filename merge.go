@@ -0,0 +1,94 @@
+package chape
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// mergeInput overlays newMetadata onto the current metadata of the audio file when Merge is
+// set, and clears the fields of Unset and nulls, the fields given as null in the input
+func (c *Chape) mergeInput(newMetadata *Metadata, nulls ...string) (*Metadata, error) {
+	if !c.Merge && len(c.Unset) == 0 {
+		return newMetadata, nil
+	}
+	m := *newMetadata
+	if c.Merge {
+		currentMetadata, err := c.Metadata()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read current metadata: %w", err)
+		}
+		m = *mergeMetadata(currentMetadata, newMetadata)
+	}
+	for _, name := range c.Unset {
+		i, ok := metadataFieldIndex(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown field to unset %q", name)
+		}
+		if !isOmitted(reflect.ValueOf(newMetadata).Elem().Field(i)) {
+			return nil, fmt.Errorf("field %q is both set in the input and unset", name)
+		}
+		f := reflect.ValueOf(&m).Elem().Field(i)
+		f.Set(reflect.Zero(f.Type()))
+	}
+	for _, name := range nulls {
+		i, _ := metadataFieldIndex(name)
+		f := reflect.ValueOf(&m).Elem().Field(i)
+		f.Set(reflect.Zero(f.Type()))
+	}
+	return &m, nil
+}
+
+// yamlNullFields returns the Metadata fields given as null in the YAML document, e.g.
+// "comment: null", "comment: ~" and "comment:". Unknown keys are ignored as decoding does.
+func yamlNullFields(b []byte) ([]string, error) {
+	var values map[string]any
+	if err := yaml.Unmarshal(b, &values); err != nil {
+		return nil, err
+	}
+	var nulls []string
+	for name, v := range values {
+		if _, ok := metadataFieldIndex(name); ok && v == nil {
+			nulls = append(nulls, name)
+		}
+	}
+	slices.Sort(nulls)
+	return nulls, nil
+}
+
+// mergeMetadata returns current overlaid with the fields set in overlay. The fields omitted
+// from overlay, including empty, zero and false values, keep the current values.
+func mergeMetadata(current, overlay *Metadata) *Metadata {
+	m := *current
+	mv, ov := reflect.ValueOf(&m).Elem(), reflect.ValueOf(overlay).Elem()
+	for i := range ov.NumField() {
+		if f := ov.Field(i); !isOmitted(f) {
+			mv.Field(i).Set(f)
+		}
+	}
+	return &m
+}
+
+// isOmitted reports whether the field is omitted from the input, i.e. it's zero or empty
+func isOmitted(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+// metadataFieldIndex returns the index of the Metadata field with the YAML name
+func metadataFieldIndex(name string) (int, bool) {
+	t := reflect.TypeFor[Metadata]()
+	for i := range t.NumField() {
+		if tag, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ","); tag == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
@@ -1,36 +1,84 @@
 package chape
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
 	"github.com/goccy/go-yaml/token"
 	"golang.org/x/text/language"
 )
 
 // Metadata represents the metadata of an MP3 file
 type Metadata struct {
-	Title       string       `yaml:"title"`                 // TIT2 tag (Title/songname/content description)
-	Subtitle    string       `yaml:"subtitle,omitempty"`    // TIT3 tag (Subtitle/Description refinement)
-	Artist      string       `yaml:"artist"`                // TPE1 tag (Lead performer(s)/Soloist(s))
-	Album       string       `yaml:"album"`                 // TALB tag (Album/Movie/Show title)
-	AlbumArtist string       `yaml:"albumArtist,omitempty"` // TPE2 tag (Band/orchestra/accompaniment)
-	Grouping    string       `yaml:"grouping,omitempty"`    // TIT1 tag (Content group description)
-	Date        *Timestamp   `yaml:"date,omitempty"`        // TDRC tag for ID3v2.4 (Recording time)
-	Track       *NumberInSet `yaml:"track,omitempty"`       // TRCK tag (Track number/Position in set)
-	Disc        *NumberInSet `yaml:"disc,omitempty"`        // TPOS tag (Part of a set)
-	Genre       string       `yaml:"genre,omitempty"`       // TCON tag (Content type/Genre)
-	Comment     string       `yaml:"comment,omitempty"`     // COMM tag (Comments)
-	Composer    string       `yaml:"composer,omitempty"`    // TCOM tag (Composer)
-	Publisher   string       `yaml:"publisher,omitempty"`   // TPUB tag (Publisher)
-	Copyright   string       `yaml:"copyright,omitempty"`   // TCOP tag (Copyright message)
-	Language    string       `yaml:"language,omitempty"`    // TLAN tag (Language(s))
-	BPM         int          `yaml:"bpm,omitempty"`         // TBPM tag (BPM - Beats per minute)
-	Chapters    []*Chapter   `yaml:"chapters,omitempty"`    // CHAP tag (Chapter frames)
-	Artwork     string       `yaml:"artwork,omitempty"`     // APIC tag (Attached picture)
-	Lyrics      string       `yaml:"lyrics,omitempty"`      // USLT tag (Unsynchronised lyric/text transcription)
+	Title       string       `yaml:"title" json:"title" toml:"title"`                                                 // TIT2 tag (Title/songname/content description)
+	Subtitle    string       `yaml:"subtitle,omitempty" json:"subtitle,omitempty" toml:"subtitle,omitempty"`          // TIT3 tag (Subtitle/Description refinement)
+	Artist      Values       `yaml:"artist" json:"artist" toml:"artist"`                                              // TPE1 tag (Lead performer(s)/Soloist(s))
+	Album       string       `yaml:"album" json:"album" toml:"album"`                                                 // TALB tag (Album/Movie/Show title)
+	AlbumArtist string       `yaml:"albumArtist,omitempty" json:"albumArtist,omitempty" toml:"albumArtist,omitempty"` // TPE2 tag (Band/orchestra/accompaniment)
+	Grouping    string       `yaml:"grouping,omitempty" json:"grouping,omitempty" toml:"grouping,omitempty"`          // TIT1 tag (Content group description)
+	Date        *Timestamp   `yaml:"date,omitempty" json:"date,omitzero" toml:"date,omitempty"`                       // TDRC tag for ID3v2.4 (Recording time)
+	Track       *NumberInSet `yaml:"track,omitempty" json:"track,omitempty" toml:"track,omitempty"`                   // TRCK tag (Track number/Position in set)
+	Disc        *NumberInSet `yaml:"disc,omitempty" json:"disc,omitempty" toml:"disc,omitempty"`                      // TPOS tag (Part of a set)
+	Genre       Values       `yaml:"genre,omitempty" json:"genre,omitempty" toml:"genre,omitempty"`                   // TCON tag (Content type/Genre)
+	Comment     string       `yaml:"comment,omitempty" json:"comment,omitempty" toml:"comment,omitempty"`             // COMM tag (Comments)
+	Composer    Values       `yaml:"composer,omitempty" json:"composer,omitempty" toml:"composer,omitempty"`          // TCOM tag (Composer)
+	Lyricist    Values       `yaml:"lyricist,omitempty" json:"lyricist,omitempty" toml:"lyricist,omitempty"`          // TEXT tag (Lyricist/Text writer)
+	Publisher   string       `yaml:"publisher,omitempty" json:"publisher,omitempty" toml:"publisher,omitempty"`       // TPUB tag (Publisher)
+	Copyright   string       `yaml:"copyright,omitempty" json:"copyright,omitempty" toml:"copyright,omitempty"`       // TCOP tag (Copyright message)
+	ISRC        string       `yaml:"isrc,omitempty" json:"isrc,omitempty" toml:"isrc,omitempty"`                      // TSRC tag (ISRC - International Standard Recording Code)
+	MediaType   string       `yaml:"mediaType,omitempty" json:"mediaType,omitempty" toml:"mediaType,omitempty"`       // TMED tag (Media type)
+	Language    string       `yaml:"language,omitempty" json:"language,omitempty" toml:"language,omitempty"`          // TLAN tag (Language(s))
+	BPM         BPM          `yaml:"bpm,omitempty" json:"bpm,omitempty" toml:"bpm,omitzero"`                          // TBPM tag (BPM - Beats per minute), rounded in ID3v2.3 and M4A
+	InitialKey  string       `yaml:"initialKey,omitempty" json:"initialKey,omitempty" toml:"initialKey,omitempty"`    // TKEY tag (Initial key)
+	Mood        string       `yaml:"mood,omitempty" json:"mood,omitempty" toml:"mood,omitempty"`                      // TMOO tag (Mood)
+	Compilation bool         `yaml:"compilation,omitempty" json:"compilation,omitempty" toml:"compilation,omitempty"` // TCMP tag (iTunes compilation flag)
+	Rating      int          `yaml:"rating,omitempty" json:"rating,omitempty" toml:"rating,omitzero"`                 // POPM tag (Popularimeter, 1-255)
+	Chapters    []*Chapter   `yaml:"chapters,omitempty" json:"chapters,omitempty" toml:"chapters,omitempty"`          // CHAP tag (Chapter frames)
+	Artwork     Artwork      `yaml:"artwork,omitempty" json:"artwork,omitzero" toml:"artwork,omitempty"`              // APIC tag (Attached picture)
+	Lyrics      string       `yaml:"lyrics,omitempty" json:"lyrics,omitempty" toml:"lyrics,omitempty"`                // USLT tag (Unsynchronised lyric/text transcription)
+
+	TitleSort              string            `yaml:"titleSort,omitempty" json:"titleSort,omitempty" toml:"titleSort,omitempty"`                                        // TSOT tag (Title sort order)
+	ArtistSort             string            `yaml:"artistSort,omitempty" json:"artistSort,omitempty" toml:"artistSort,omitempty"`                                     // TSOP tag (Performer sort order)
+	AlbumSort              string            `yaml:"albumSort,omitempty" json:"albumSort,omitempty" toml:"albumSort,omitempty"`                                        // TSOA tag (Album sort order)
+	AlbumArtistSort        string            `yaml:"albumArtistSort,omitempty" json:"albumArtistSort,omitempty" toml:"albumArtistSort,omitempty"`                      // TSO2 tag (iTunes album artist sort order)
+	OriginalDate           *Timestamp        `yaml:"originalDate,omitempty" json:"originalDate,omitzero" toml:"originalDate,omitempty"`                                // TDOR tag for ID3v2.4 (Original release time)
+	OriginalAlbum          string            `yaml:"originalAlbum,omitempty" json:"originalAlbum,omitempty" toml:"originalAlbum,omitempty"`                            // TOAL tag (Original album/movie/show title)
+	OriginalArtist         Values            `yaml:"originalArtist,omitempty" json:"originalArtist,omitempty" toml:"originalArtist,omitempty"`                         // TOPE tag (Original artist(s)/performer(s))
+	OriginalLyricist       Values            `yaml:"originalLyricist,omitempty" json:"originalLyricist,omitempty" toml:"originalLyricist,omitempty"`                   // TOLY tag (Original lyricist(s)/text writer(s))
+	Work                   string            `yaml:"work,omitempty" json:"work,omitempty" toml:"work,omitempty"`                                                       // GRP1 tag (iTunes work)
+	Movement               string            `yaml:"movement,omitempty" json:"movement,omitempty" toml:"movement,omitempty"`                                           // MVNM tag (iTunes movement name)
+	MovementNumber         *NumberInSet      `yaml:"movementNumber,omitempty" json:"movementNumber,omitempty" toml:"movementNumber,omitempty"`                         // MVIN tag (iTunes movement number/count)
+	Description            string            `yaml:"description,omitempty" json:"description,omitempty" toml:"description,omitempty"`                                  // TDES tag (iTunes podcast description)
+	PodcastID              string            `yaml:"podcastId,omitempty" json:"podcastId,omitempty" toml:"podcastId,omitempty"`                                        // TGID tag (iTunes podcast episode GUID)
+	FeedURL                string            `yaml:"feedUrl,omitempty" json:"feedUrl,omitempty" toml:"feedUrl,omitempty"`                                              // WFED tag (iTunes podcast feed URL)
+	Podcast                bool              `yaml:"podcast,omitempty" json:"podcast,omitempty" toml:"podcast,omitempty"`                                              // PCST tag (iTunes podcast flag)
+	Category               string            `yaml:"category,omitempty" json:"category,omitempty" toml:"category,omitempty"`                                           // TCAT tag (iTunes podcast category)
+	Keywords               Values            `yaml:"keywords,omitempty" json:"keywords,omitempty" toml:"keywords,omitempty"`                                           // TKWD tag (iTunes podcast keywords, comma separated)
+	EncodedBy              string            `yaml:"encodedBy,omitempty" json:"encodedBy,omitempty" toml:"encodedBy,omitempty"`                                        // TENC tag (Encoded by)
+	EncoderSettings        string            `yaml:"encoderSettings,omitempty" json:"encoderSettings,omitempty" toml:"encoderSettings,omitempty"`                      // TSSE tag (Software/Hardware and settings used for encoding)
+	ArtistURL              string            `yaml:"artistUrl,omitempty" json:"artistUrl,omitempty" toml:"artistUrl,omitempty"`                                        // WOAR tag (Official artist/performer webpage)
+	CopyrightURL           string            `yaml:"copyrightUrl,omitempty" json:"copyrightUrl,omitempty" toml:"copyrightUrl,omitempty"`                               // WCOP tag (Copyright/Legal information)
+	PublisherURL           string            `yaml:"publisherUrl,omitempty" json:"publisherUrl,omitempty" toml:"publisherUrl,omitempty"`                               // WPUB tag (Publishers official webpage)
+	AudioFileURL           string            `yaml:"audioFileUrl,omitempty" json:"audioFileUrl,omitempty" toml:"audioFileUrl,omitempty"`                               // WOAF tag (Official audio file webpage)
+	SyncedLyrics           []*SyncedLyric    `yaml:"syncedLyrics,omitempty" json:"syncedLyrics,omitempty" toml:"syncedLyrics,omitempty"`                               // SYLT tag (Synchronised lyric/text)
+	Comments               []*Comment        `yaml:"comments,omitempty" json:"comments,omitempty" toml:"comments,omitempty"`                                           // COMM tags other than Comment
+	Custom                 map[string]string `yaml:"custom,omitempty" json:"custom,omitempty" toml:"custom,omitempty"`                                                 // TXXX tags (User defined text) other than CHAPE_SOURCE and MusicBrainz IDs
+	URLs                   map[string]string `yaml:"urls,omitempty" json:"urls,omitempty" toml:"urls,omitempty"`                                                       // WXXX tags (User defined URL link) keyed by description
+	MusicBrainzRecordingID string            `yaml:"musicBrainzRecordingId,omitempty" json:"musicBrainzRecordingId,omitempty" toml:"musicBrainzRecordingId,omitempty"` // UFID tag owned by http://musicbrainz.org
+	MusicBrainzArtistID    string            `yaml:"musicBrainzArtistId,omitempty" json:"musicBrainzArtistId,omitempty" toml:"musicBrainzArtistId,omitempty"`          // TXXX tag "MusicBrainz Artist Id"
+	MusicBrainzReleaseID   string            `yaml:"musicBrainzReleaseId,omitempty" json:"musicBrainzReleaseId,omitempty" toml:"musicBrainzReleaseId,omitempty"`       // TXXX tag "MusicBrainz Album Id"
+
+	// FrameLanguage is the ISO 639-2 code of the COMM, USLT and SYLT frames.
+	// When empty, it's derived from Language.
+	FrameLanguage string `yaml:"frameLanguage,omitempty" json:"frameLanguage,omitempty" toml:"frameLanguage,omitempty"`
 }
 
 // NumberInSet represents a current/total number pair in ID3v2 format (e.g., "3/10", "1/2")
@@ -39,9 +87,75 @@ type NumberInSet struct {
 	Total   int
 }
 
+// Values is the values of a field that can have multiple values, e.g. the artists.
+// ID3v2.4 and Vorbis comments hold multiple values, while the other formats hold them
+// joined with "; ". It's marshaled as a scalar unless it has multiple values.
+type Values []string
+
+// String returns the values joined with "; "
+func (v Values) String() string {
+	return strings.Join(v, multiValueSeparator)
+}
+
+// MarshalYAML marshals values to YAML as a scalar or a list
+func (v Values) MarshalYAML() (any, error) {
+	if len(v) <= 1 {
+		return v.String(), nil
+	}
+	return []string(v), nil
+}
+
+// MarshalJSON marshals values to JSON as a string or an array
+func (v Values) MarshalJSON() ([]byte, error) {
+	if len(v) <= 1 {
+		return marshalJSONNoEscape(v.String())
+	}
+	return marshalJSONNoEscape([]string(v))
+}
+
+// marshalJSONNoEscape marshals v to JSON without escaping HTML characters, as json.Marshal
+// in MarshalJSON isn't affected by SetEscapeHTML of the encoder
+func marshalJSONNoEscape(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// UnmarshalYAML unmarshals values from YAML as either a scalar or a list
+func (v *Values) UnmarshalYAML(b []byte) error {
+	var list []string
+	if err := yaml.Unmarshal(b, &list); err == nil {
+		*v = slices.DeleteFunc(list, func(s string) bool { return s == "" })
+		return nil
+	}
+	var s string
+	if err := yaml.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("invalid value: %w", err)
+	}
+	*v = nil
+	if s != "" {
+		*v = Values{s}
+	}
+	return nil
+}
+
+// BPM is beats per minute, which can be fractional, e.g. 128.5
+type BPM float64
+
+// MarshalYAML marshals BPM to YAML without a trailing ".0" for integer values
+func (b BPM) MarshalYAML() ([]byte, error) {
+	return []byte(formatBPM(float64(b))), nil
+}
+
 // Timestamp wraps time.Time for ID3v2 timestamp format as defined in ID3v2.4.0-structure.
 // The timestamp fields are based on a subset of ISO 8601 and can have varying levels of precision.
 // All time stamps are UTC. Valid formats: yyyy, yyyy-MM, yyyy-MM-dd, yyyy-MM-ddTHH, yyyy-MM-ddTHH:mm, yyyy-MM-ddTHH:mm:ss
+// The formats with a time accept a trailing timezone offset (Z, +09:00 or +0900) as well,
+// which is converted to UTC since tags can't hold it.
 type Timestamp struct {
 	time.Time
 	Precision Precision
@@ -59,43 +173,231 @@ const (
 	PrecisionSecond
 )
 
-// Chapter represents a single chapter with start time and title
+// Chapter represents a single chapter with start time and title.
+// End is optional; when zero, the chapter ends where the next one starts
+// (or at the end of the audio for the last chapter).
+// Image (file path, URL or data URI) and URL are optional as well.
 type Chapter struct {
 	Title string        `json:"title"`
 	Start time.Duration `json:"start"`
+	End   time.Duration `json:"end,omitempty"`
+	Image string        `json:"image,omitempty"`
+	URL   string        `json:"url,omitempty"`
+	// Description is a longer summary of the chapter, stored in the TIT3 sub-frame
+	Description string `json:"description,omitempty"`
+
+	// precision is the precision of the times in the output, set by Dump
+	precision ChapterPrecision
+}
+
+// ChapterPrecision is the precision of the chapter times in the output
+type ChapterPrecision string
+
+const (
+	// ChapterPrecisionAuto shows milliseconds only when they're nonzero, e.g. "1:30" and "1:30.500"
+	ChapterPrecisionAuto ChapterPrecision = "auto"
+	// ChapterPrecisionSeconds always shows whole seconds, truncating milliseconds
+	ChapterPrecisionSeconds ChapterPrecision = "seconds"
+	// ChapterPrecisionMillis always shows milliseconds, e.g. "1:30.000"
+	ChapterPrecisionMillis ChapterPrecision = "millis"
+)
+
+// Comment represents a COMM frame keyed by language and description, such as the
+// "iTunNORM" comment of iTunes. The comment with an empty description is Metadata.Comment.
+type Comment struct {
+	Language    string `yaml:"language,omitempty" json:"language,omitempty" toml:"language,omitempty"` // ISO 639-2 code, FrameLanguage if empty
+	Description string `yaml:"description" json:"description" toml:"description"`
+	Text        string `yaml:"text" json:"text" toml:"text"`
+}
+
+// Artwork represents the artwork: its source, i.e. a file path, HTTP(S) URL or data URI,
+// and optionally the picture type and description of the embedded picture (MP3 and FLAC).
+// It's marshaled as a scalar of the source unless the type or description is set.
+type Artwork struct {
+	Src         string `yaml:"src" json:"src"`
+	Type        string `yaml:"type,omitempty" json:"type,omitempty"` // picture type name, e.g. "back"; the front cover if empty
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+}
+
+// explicit reports whether the picture type or description is given
+func (a Artwork) explicit() bool {
+	return a.Type != "" || a.Description != ""
+}
+
+// IsZero reports whether there's no artwork, so that it's omitted on marshaling
+func (a Artwork) IsZero() bool {
+	return a == Artwork{}
+}
+
+// MarshalYAML marshals the artwork to YAML as a scalar of the source, or as a mapping
+// with the picture type and description
+func (a Artwork) MarshalYAML() (any, error) {
+	if !a.explicit() {
+		return a.Src, nil
+	}
+	type artwork Artwork
+	return artwork(a), nil
+}
+
+// MarshalJSON marshals the artwork to JSON as a string of the source, or as an object
+// with the picture type and description
+func (a Artwork) MarshalJSON() ([]byte, error) {
+	if !a.explicit() {
+		return marshalJSONNoEscape(a.Src)
+	}
+	type artwork Artwork
+	return marshalJSONNoEscape(artwork(a))
+}
+
+// UnmarshalYAML unmarshals the artwork from YAML, either a scalar of the source or
+// a mapping with src, type and description keys
+func (a *Artwork) UnmarshalYAML(b []byte) error {
+	type artwork Artwork
+	var m artwork
+	if err := yaml.Unmarshal(b, &m); err == nil && m.Src != "" {
+		if _, err := parsePictureType(m.Type); err != nil {
+			return err
+		}
+		*a = Artwork(m)
+		return nil
+	}
+	var s string
+	if err := yaml.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("invalid artwork: %w", err)
+	}
+	*a = Artwork{Src: s}
+	return nil
+}
+
+// SyncedLyric represents a line of synchronised lyrics shown from Time
+type SyncedLyric struct {
+	Time time.Duration `json:"time"`
+	Text string        `json:"text"`
+}
+
+// String returns the line as "0:12.340 Text"
+func (l *SyncedLyric) String() string {
+	return strings.TrimSuffix(formatChapterTime(l.Time)+" "+l.Text, " ")
+}
+
+// MarshalYAML marshals the line to YAML in the same form as chapters
+func (l *SyncedLyric) MarshalYAML() ([]byte, error) {
+	s := l.String()
+	if token.IsNeedQuoted(s) {
+		s = strconv.Quote(s)
+	}
+	return []byte(s), nil
+}
+
+// MarshalJSON marshals the line to JSON as an object with time in milliseconds
+func (l *SyncedLyric) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Time int64  `json:"time"`
+		Text string `json:"text"`
+	}{
+		Time: l.Time.Milliseconds(),
+		Text: l.Text,
+	})
+}
+
+// UnmarshalYAML unmarshals the line from "0:12.340 Text". The text may be omitted
+// for a blank line.
+func (l *SyncedLyric) UnmarshalYAML(b []byte) error {
+	str := unquote(strings.TrimSpace(string(b)))
+	timeStr, text, _ := strings.Cut(str, " ")
+	t, err := parseChapterTime(timeStr)
+	if err != nil {
+		return fmt.Errorf("invalid synced lyric %q: %w", str, err)
+	}
+	*l = SyncedLyric{Time: t, Text: text}
+	return nil
+}
+
+// chapterMapping is the mapping form of a chapter in YAML, used when the chapter has
+// an image or URL that the compact "0:00 Title" form can't hold
+type chapterMapping struct {
+	Start string `yaml:"start"`
+	End   string `yaml:"end,omitempty"`
+	Title string `yaml:"title"`
+	Image string `yaml:"image,omitempty"`
+	URL   string `yaml:"url,omitempty"`
+
+	Description string `yaml:"description,omitempty"`
 }
 
-// String returns the chapter as a string in WebVTT format
+// String returns the chapter as a string in WebVTT format.
+// Chapters with an explicit end are formatted as a range like "0:00-1:30 Title".
 func (c *Chapter) String() string {
-	// Format duration to WebVTT time string
-	ms := c.Start.Milliseconds()
+	timeStr := formatChapterTimePrecision(c.Start, c.precision)
+	if c.End > 0 {
+		timeStr += "-" + formatChapterTimePrecision(c.End, c.precision)
+	}
+	return fmt.Sprintf("%s %s", timeStr, c.Title)
+}
+
+// chapterEnd returns the end of the i-th chapter: the explicit end if set, otherwise
+// the next chapter's start or audioDuration for the last chapter
+func chapterEnd(chapters []*Chapter, i int, audioDuration time.Duration) time.Duration {
+	switch {
+	case chapters[i].End > 0:
+		return chapters[i].End
+	case i+1 < len(chapters):
+		return chapters[i+1].Start
+	default:
+		return audioDuration
+	}
+}
+
+// formatChapterTime formats duration to WebVTT time string
+func formatChapterTime(d time.Duration) string {
+	return formatChapterTimePrecision(d, ChapterPrecisionAuto)
+}
+
+// formatChapterTimePrecision formats duration to WebVTT time string of the precision.
+// An empty precision is ChapterPrecisionAuto.
+func formatChapterTimePrecision(d time.Duration, precision ChapterPrecision) string {
+	ms := d.Milliseconds()
 	hours := ms / 3600000
 	minutes := (ms % 3600000) / 60000
 	seconds := (ms % 60000) / 1000
 	millis := ms % 1000
 
-	var timeStr string
 	// Format without milliseconds if they are zero
-	if millis == 0 {
+	if precision == ChapterPrecisionSeconds || millis == 0 && precision != ChapterPrecisionMillis {
 		if hours > 0 {
-			timeStr = fmt.Sprintf("%d:%02d:%02d", hours, minutes, seconds)
-		} else {
-			timeStr = fmt.Sprintf("%d:%02d", minutes, seconds)
-		}
-	} else {
-		// Format with milliseconds
-		if hours > 0 {
-			timeStr = fmt.Sprintf("%d:%02d:%02d.%03d", hours, minutes, seconds, millis)
-		} else {
-			timeStr = fmt.Sprintf("%d:%02d.%03d", minutes, seconds, millis)
+			return fmt.Sprintf("%d:%02d:%02d", hours, minutes, seconds)
 		}
+		return fmt.Sprintf("%d:%02d", minutes, seconds)
+	}
+	// Format with milliseconds
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d.%03d", hours, minutes, seconds, millis)
 	}
+	return fmt.Sprintf("%d:%02d.%03d", minutes, seconds, millis)
+}
 
-	return fmt.Sprintf("%s %s", timeStr, c.Title)
+// mappingForm reports whether the chapter needs the mapping form rather than the compact
+// "0:00 Title" one
+func (c *Chapter) mappingForm() bool {
+	return c.Image != "" || c.URL != "" || c.Description != ""
 }
 
-// MarshalYAML marshals the chapter to YAML format
+// MarshalYAML marshals the chapter to YAML format. It's the compact "0:00 Title" form
+// unless the chapter has an image, URL or description.
 func (c *Chapter) MarshalYAML() ([]byte, error) {
+	if c.mappingForm() {
+		m := chapterMapping{
+			Start:       formatChapterTimePrecision(c.Start, c.precision),
+			Title:       c.Title,
+			Image:       c.Image,
+			URL:         c.URL,
+			Description: c.Description,
+		}
+		if c.End > 0 {
+			m.End = formatChapterTimePrecision(c.End, c.precision)
+		}
+		return yaml.Marshal(m)
+	}
 	s := c.String()
 	if token.IsNeedQuoted(s) {
 		s = strconv.Quote(s)
@@ -103,19 +405,178 @@ func (c *Chapter) MarshalYAML() ([]byte, error) {
 	return []byte(s), nil
 }
 
-// UnmarshalYAML unmarshals the chapter from YAML format
+// MarshalJSON marshals the chapter to JSON as an object with start (and end) in milliseconds
+func (c *Chapter) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Title string `json:"title"`
+		Start int64  `json:"start"`
+		End   int64  `json:"end,omitempty"`
+		Image string `json:"image,omitempty"`
+		URL   string `json:"url,omitempty"`
+
+		Description string `json:"description,omitempty"`
+	}{
+		Title:       c.Title,
+		Start:       c.Start.Milliseconds(),
+		End:         c.End.Milliseconds(),
+		Image:       c.Image,
+		URL:         c.URL,
+		Description: c.Description,
+	})
+}
+
+// UnmarshalYAML unmarshals the chapter from YAML format, either the compact
+// "0:00 Title" form or the mapping form with start, end, title, image, url and
+// description keys
 func (c *Chapter) UnmarshalYAML(b []byte) error {
-	str := unquote(strings.TrimSpace(string(b)))
-	stuff := strings.SplitN(str, " ", 2)
-	if len(stuff) != 2 {
-		return fmt.Errorf("invalid chapter format: %s", str)
+	var m chapterMapping
+	if err := yaml.Unmarshal(b, &m); err == nil && m.Start != "" {
+		start, err := parseChapterTime(m.Start)
+		if err != nil {
+			return err
+		}
+		var end time.Duration
+		if m.End != "" {
+			if end, err = parseChapterTime(m.End); err != nil {
+				return err
+			}
+		}
+		*c = Chapter{
+			Title:       m.Title,
+			Start:       start,
+			End:         end,
+			Image:       m.Image,
+			URL:         m.URL,
+			Description: m.Description,
+		}
+		return nil
+	}
+
+	chapter, err := parseCompactChapter(unquote(strings.TrimSpace(string(b))))
+	if err != nil {
+		return err
+	}
+	*c = *chapter
+	return nil
+}
+
+// parseCompactChapter parses the compact "0:00 Title" form of a chapter, whose time may be
+// a "start-end" range. The title can be omitted, e.g. "0:00", to be filled by
+// Chape.ChapterTemplate.
+func parseCompactChapter(str string) (*Chapter, error) {
+	timeStr, title, _ := strings.Cut(str, " ")
+
+	// Parse WebVTT time format, optionally as a "start-end" range
+	startStr, endStr, hasEnd := strings.Cut(timeStr, "-")
+	start, err := parseChapterTime(startStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chapter format: %s: %w", str, err)
+	}
+	var end time.Duration
+	if hasEnd {
+		if end, err = parseChapterTime(endStr); err != nil {
+			return nil, err
+		}
+	}
+	return &Chapter{
+		Title: title,
+		Start: start,
+		End:   end,
+	}, nil
+}
+
+// UnmarshalYAML unmarshals metadata from YAML. Chapters can be given as a mapping of
+// the time to the title as well as a list, e.g. {"0:00": Intro, "1:30": Topic}, which is
+// converted into the chapters sorted by start time.
+func (m *Metadata) UnmarshalYAML(node ast.Node) error {
+	type metadata Metadata
+	var values []*ast.MappingValueNode
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		values = n.Values
+	case *ast.MappingValueNode:
+		values = []*ast.MappingValueNode{n}
+	default:
+		if err := yaml.NodeToValue(node, (*metadata)(m)); err != nil {
+			return err
+		}
+		m.clearZeroDates()
+		return nil
+	}
+
+	var chapters []*Chapter
+	rest := &ast.MappingNode{BaseNode: &ast.BaseNode{}, Start: node.GetToken()}
+	for _, v := range values {
+		if v.Key.GetToken().Value != "chapters" {
+			rest.Values = append(rest.Values, v)
+			continue
+		}
+		var entries []*ast.MappingValueNode
+		switch n := v.Value.(type) {
+		case *ast.MappingNode:
+			entries = n.Values
+		case *ast.MappingValueNode:
+			entries = []*ast.MappingValueNode{n}
+		default:
+			rest.Values = append(rest.Values, v)
+			continue
+		}
+		for _, e := range entries {
+			var title string
+			if err := yaml.NodeToValue(e.Value, &title); err != nil {
+				return fmt.Errorf("invalid title of the chapter at %s: %w", e.Key.GetToken().Value, err)
+			}
+			chapter, err := parseCompactChapter(strings.TrimSpace(e.Key.GetToken().Value + " " + title))
+			if err != nil {
+				return err
+			}
+			chapters = append(chapters, chapter)
+		}
+		// An empty mapping is no chapters, as an empty list
+		if chapters == nil {
+			chapters = []*Chapter{}
+		}
+	}
+
+	var mm metadata
+	if err := yaml.NodeToValue(rest, &mm); err != nil {
+		return err
 	}
+	if chapters != nil {
+		slices.SortStableFunc(chapters, compareChapterStart)
+		mm.Chapters = chapters
+	}
+	*m = Metadata(mm)
+	m.clearZeroDates()
+	return nil
+}
+
+// clearZeroDates sets the zero dates to nil, so that an empty date in the input is the same
+// as an omitted one
+func (m *Metadata) clearZeroDates() {
+	if m.Date != nil && m.Date.Time.IsZero() {
+		m.Date = nil
+	}
+	if m.OriginalDate != nil && m.OriginalDate.Time.IsZero() {
+		m.OriginalDate = nil
+	}
+}
+
+// parseChapterTime parses WebVTT time string like "1:23", "1:05:30" or "1:23.500".
+// The errors match ErrInvalidChapterTime.
+func parseChapterTime(timeStr string) (time.Duration, error) {
+	d, err := parseChapterTimeParts(timeStr)
+	if err != nil {
+		return 0, &kindError{err: err, kind: ErrInvalidChapterTime}
+	}
+	return d, nil
+}
 
-	// Parse WebVTT time format
-	timeStr := stuff[0]
+// parseChapterTimeParts parses the hours, minutes, seconds and milliseconds of timeStr
+func parseChapterTimeParts(timeStr string) (time.Duration, error) {
 	colonParts := strings.Split(timeStr, ":")
 	if len(colonParts) < 2 || len(colonParts) > 3 {
-		return fmt.Errorf("invalid time format: %s", timeStr)
+		return 0, fmt.Errorf("invalid time format: %s", timeStr)
 	}
 
 	var hours, minutes int
@@ -125,13 +586,13 @@ func (c *Chapter) UnmarshalYAML(b []byte) error {
 		// Format: H:MM:SS.mmm
 		h, err := strconv.Atoi(colonParts[0])
 		if err != nil {
-			return fmt.Errorf("invalid hours: %s", colonParts[0])
+			return 0, fmt.Errorf("invalid hours: %s", colonParts[0])
 		}
 		hours = h
 
 		m, err := strconv.Atoi(colonParts[1])
 		if err != nil {
-			return fmt.Errorf("invalid minutes: %s", colonParts[1])
+			return 0, fmt.Errorf("invalid minutes: %s", colonParts[1])
 		}
 		minutes = m
 		secondsStr = colonParts[2]
@@ -139,7 +600,7 @@ func (c *Chapter) UnmarshalYAML(b []byte) error {
 		// Format: M:SS.mmm or MM:SS.mmm
 		m, err := strconv.Atoi(colonParts[0])
 		if err != nil {
-			return fmt.Errorf("invalid minutes: %s", colonParts[0])
+			return 0, fmt.Errorf("invalid minutes: %s", colonParts[0])
 		}
 		minutes = m
 		secondsStr = colonParts[1]
@@ -153,7 +614,7 @@ func (c *Chapter) UnmarshalYAML(b []byte) error {
 		parts := strings.Split(secondsStr, ".")
 		s, err := strconv.Atoi(parts[0])
 		if err != nil {
-			return fmt.Errorf("invalid seconds: %s", parts[0])
+			return 0, fmt.Errorf("invalid seconds: %s", parts[0])
 		}
 		seconds = s
 
@@ -167,28 +628,24 @@ func (c *Chapter) UnmarshalYAML(b []byte) error {
 			}
 			ms, err := strconv.Atoi(msStr)
 			if err != nil {
-				return fmt.Errorf("invalid milliseconds: %s", parts[1])
+				return 0, fmt.Errorf("invalid milliseconds: %s", parts[1])
 			}
 			millis = ms
 		}
 	} else {
 		s, err := strconv.Atoi(secondsStr)
 		if err != nil {
-			return fmt.Errorf("invalid seconds: %s", secondsStr)
+			return 0, fmt.Errorf("invalid seconds: %s", secondsStr)
 		}
 		seconds = s
 	}
 
 	totalMs := int64(hours)*3600000 + int64(minutes)*60000 + int64(seconds)*1000 + int64(millis)
-
-	*c = Chapter{
-		Title: stuff[1],
-		Start: time.Duration(totalMs) * time.Millisecond,
-	}
-	return nil
+	return time.Duration(totalMs) * time.Millisecond, nil
 }
 
-// String returns number in set in ID3v2 format
+// String returns number in set in ID3v2 format, "3" or "3/10". It's empty for nil and
+// a zero Current even with Total, so that "0/10" is never written.
 func (n *NumberInSet) String() string {
 	if n == nil || n.Current == 0 {
 		return ""
@@ -199,11 +656,21 @@ func (n *NumberInSet) String() string {
 	return fmt.Sprintf("%d", n.Current)
 }
 
+// IsZero reports whether the number in set is empty, so that it's omitted on marshaling
+func (n *NumberInSet) IsZero() bool {
+	return n == nil || n.Current == 0
+}
+
 // MarshalYAML marshals number in set to YAML format
 func (n *NumberInSet) MarshalYAML() ([]byte, error) {
 	return []byte(n.String()), nil
 }
 
+// MarshalJSON marshals number in set to JSON as a string
+func (n *NumberInSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(n.String())
+}
+
 // UnmarshalYAML unmarshals number in set from YAML format
 func (n *NumberInSet) UnmarshalYAML(b []byte) error {
 	str := unquote(strings.TrimSpace(string(b)))
@@ -236,11 +703,57 @@ func (t *Timestamp) String() string {
 	}
 }
 
-// MarshalYAML marshals timestamp to YAML format
+// id3v23Frames returns the ID3v2.3 date frames for the timestamp: TYER (yyyy),
+// TDAT (DDMM) for day precision and TIME (HHMM) for minute precision or finer.
+// Month precision and seconds can't be represented.
+func (t *Timestamp) id3v23Frames() map[string]string {
+	frames := map[string]string{"TYER": t.Time.Format("2006")}
+	if t.Precision >= PrecisionDay {
+		frames["TDAT"] = t.Time.UTC().Format("0201")
+	}
+	if t.Precision >= PrecisionMinute {
+		frames["TIME"] = t.Time.UTC().Format("1504")
+	}
+	return frames
+}
+
+// parseID3v23Date parses the values of the ID3v2.3 date frames TYER, TDAT and TIME.
+// It returns nil if year is invalid, and ignores invalid date and tm.
+func parseID3v23Date(year, date, tm string) *Timestamp {
+	var ts Timestamp
+	if err := ts.UnmarshalYAML([]byte(year)); err != nil || ts.Precision != PrecisionYear {
+		return nil
+	}
+	if len(date) != 4 {
+		return &ts
+	}
+	str := fmt.Sprintf("%s-%s-%s", year, date[2:], date[:2])
+	if len(tm) == 4 {
+		str += fmt.Sprintf("T%s:%s", tm[:2], tm[2:])
+	}
+	var full Timestamp
+	if err := full.UnmarshalYAML([]byte(str)); err != nil {
+		return &ts
+	}
+	return &full
+}
+
+// MarshalYAML marshals timestamp to YAML format, and the zero timestamp to null
 func (t *Timestamp) MarshalYAML() ([]byte, error) {
+	if t.Time.IsZero() {
+		return []byte("null"), nil
+	}
 	return []byte(t.String()), nil
 }
 
+// MarshalJSON marshals timestamp to JSON as a string, and the zero timestamp to null
+func (t *Timestamp) MarshalJSON() ([]byte, error) {
+	if t.Time.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.String())
+}
+
 // UnmarshalYAML unmarshals timestamp from YAML format
 func (t *Timestamp) UnmarshalYAML(b []byte) error {
 	str := unquote(strings.TrimSpace(string(b)))
@@ -267,11 +780,58 @@ func (t *Timestamp) UnmarshalYAML(b []byte) error {
 			*t = Timestamp{Time: parsedTime, Precision: format.precision}
 			return nil
 		}
+		if format.precision < PrecisionHour {
+			continue
+		}
+		for _, zone := range []string{"Z07:00", "Z0700"} {
+			parsedTime, err := time.Parse(format.layout+zone, str)
+			if err != nil {
+				continue
+			}
+			precision := format.precision
+			// Keep the minutes of an offset like +05:30 in UTC
+			if _, offset := parsedTime.Zone(); precision == PrecisionHour && offset%3600 != 0 {
+				precision = PrecisionMinute
+			}
+			*t = Timestamp{Time: parsedTime.UTC(), Precision: precision}
+			return nil
+		}
 	}
 
+	for _, format := range humanDateFormats {
+		if parsedTime, err := time.ParseInLocation(format.layout, str, time.UTC); err == nil {
+			*t = Timestamp{Time: parsedTime, Precision: format.precision}
+			return nil
+		}
+	}
+	if ambiguousDateReg.MatchString(str) {
+		return fmt.Errorf("ambiguous timestamp format: %s, use yyyy-MM-dd", str)
+	}
 	return fmt.Errorf("invalid timestamp format: %s", str)
 }
 
+// humanDateFormats are the date formats accepted for hand-written input in addition to
+// the ID3v2 format. Timestamp.String always emits the ID3v2 format.
+var humanDateFormats = []struct {
+	layout    string
+	precision Precision
+}{
+	{"2006/01/02", PrecisionDay},
+	{"2006/1/2", PrecisionDay},
+	{"2006/01", PrecisionMonth},
+	{"2006/1", PrecisionMonth},
+	{"Jan 2, 2006", PrecisionDay},
+	{"January 2, 2006", PrecisionDay},
+	{"2 Jan 2006", PrecisionDay},
+	{"2 January 2006", PrecisionDay},
+	{"Jan 2006", PrecisionMonth},
+	{"January 2006", PrecisionMonth},
+}
+
+// ambiguousDateReg matches dates like 08/15/2024 or 15.08.2024, where the order of the
+// month and the day can't be told
+var ambiguousDateReg = regexp.MustCompile(`^\d{1,2}[/.-]\d{1,2}[/.-]\d{2,4}$`)
+
 // parseNumberPair parses strings like "1" or "1/10" and returns current and total values
 func parseNumberPair(s string) (current, total int) {
 	parts := strings.Split(s, "/")
@@ -312,9 +872,18 @@ func normalizeLanguageCode(code string) string {
 	return code
 }
 
-// getLanguageForFrames returns the language code to use for COMM/USLT frames
-// Uses metadata.Language if available, otherwise defaults to "jpn"
+// getLanguageForFrames returns the language code to use for COMM/USLT/SYLT frames.
+// Uses metadata.FrameLanguage if set, otherwise the one derived from metadata.Language.
 func (m *Metadata) getLanguageForFrames() string {
+	if m.FrameLanguage != "" {
+		return m.FrameLanguage
+	}
+	return m.defaultFrameLanguage()
+}
+
+// defaultFrameLanguage returns the language code for COMM/USLT/SYLT frames derived from
+// metadata.Language, defaulting to "jpn"
+func (m *Metadata) defaultFrameLanguage() string {
 	if m.Language != "" {
 		normalized := normalizeLanguageCode(m.Language)
 		if len(normalized) == 3 {
@@ -324,6 +893,14 @@ func (m *Metadata) getLanguageForFrames() string {
 	return "jpn" // Default to Japanese
 }
 
+// validateLanguageCode checks that code is an ISO 639-2 code of three lowercase letters
+func validateLanguageCode(code string) error {
+	if len(code) != 3 || strings.IndexFunc(code, func(r rune) bool { return r < 'a' || r > 'z' }) >= 0 {
+		return fmt.Errorf("invalid language code %q: must be three lowercase letters", code)
+	}
+	return nil
+}
+
 // unquote removes quotes from a string, handling both single and double quotes
 func unquote(s string) string {
 	if len(s) <= 1 {
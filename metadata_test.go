@@ -2,6 +2,8 @@ package chape
 
 import (
 	"bytes"
+	"encoding/json"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -13,12 +15,12 @@ func TestMetadataYAMLMarshal(t *testing.T) {
 	date2024, _ := time.Parse("2006", "2024")
 	metadata := &Metadata{
 		Title:       "Test Song",
-		Artist:      "Test Artist",
+		Artist:      Values{"Test Artist"},
 		Album:       "Test Album",
 		AlbumArtist: "Test Album Artist",
 		Date:        &Timestamp{Time: date2024, Precision: PrecisionYear},
 		Track:       &NumberInSet{Current: 1, Total: 10},
-		Genre:       "Podcast",
+		Genre:       Values{"Podcast"},
 		Chapters: []*Chapter{
 			{Start: 0, Title: "Introduction"},
 			{Start: 90 * time.Second, Title: "Main Topic"},
@@ -51,6 +53,32 @@ func TestMetadataYAMLMarshal(t *testing.T) {
 	}
 }
 
+func TestMetadataJSONMarshal(t *testing.T) {
+	date2024, _ := time.Parse("2006-01-02", "2024-03-15")
+	metadata := &Metadata{
+		Title:  "Test Song",
+		Artist: Values{"Test & Artist"},
+		Date:   &Timestamp{Time: date2024, Precision: PrecisionDay},
+		Track:  &NumberInSet{Current: 1, Total: 10},
+		Chapters: []*Chapter{
+			{Start: 0, Title: "Introduction"},
+			{Start: 90*time.Second + 500*time.Millisecond, Title: "Main Topic"},
+		},
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(metadata); err != nil {
+		t.Fatalf("Failed to marshal metadata: %v", err)
+	}
+	expected := `{"title":"Test Song","artist":"Test & Artist","album":"","date":"2024-03-15","track":"1/10",` +
+		`"chapters":[{"title":"Introduction","start":0},{"title":"Main Topic","start":90500}]}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("JSON mismatch:\ngot:  %s\nwant: %s", buf.String(), expected)
+	}
+}
+
 func TestChapterString(t *testing.T) {
 	tests := []struct {
 		chapter  *Chapter
@@ -71,6 +99,9 @@ func TestChapterString(t *testing.T) {
 		{&Chapter{Start: 3750 * time.Second, Title: "Long Chapter"}, "1:02:30 Long Chapter"},
 		{&Chapter{Start: (3750*time.Second + 123*time.Millisecond), Title: "Long Chapter"}, "1:02:30.123 Long Chapter"},
 		{&Chapter{Start: (3661*time.Second + 123*time.Millisecond), Title: "Test"}, "1:01:01.123 Test"},
+		// With explicit end
+		{&Chapter{Start: 0, End: 90 * time.Second, Title: "Introduction"}, "0:00-1:30 Introduction"},
+		{&Chapter{Start: 3600 * time.Second, End: 3661500 * time.Millisecond, Title: "Test"}, "1:00:00-1:01:01.500 Test"},
 	}
 
 	for _, tt := range tests {
@@ -113,20 +144,70 @@ func TestChapterMarshalYAML(t *testing.T) {
 	}
 }
 
+func TestArtworkYAML(t *testing.T) {
+	tests := []struct {
+		yaml    string
+		artwork Artwork
+	}{
+		{"artwork: cover.png\n", Artwork{Src: "cover.png"}},
+		{"artwork:\n  src: cover.png\n  type: back\n  description: Album cover\n",
+			Artwork{Src: "cover.png", Type: "back", Description: "Album cover"}},
+		{"artwork:\n  src: cover.png\n  description: Album cover\n", Artwork{Src: "cover.png", Description: "Album cover"}},
+	}
+	for _, tt := range tests {
+		var m struct {
+			Artwork Artwork `yaml:"artwork,omitempty"`
+		}
+		if err := yaml.Unmarshal([]byte(tt.yaml), &m); err != nil {
+			t.Fatalf("Unmarshal(%q) failed: %v", tt.yaml, err)
+		}
+		if m.Artwork != tt.artwork {
+			t.Errorf("Unmarshal(%q) = %+v, want %+v", tt.yaml, m.Artwork, tt.artwork)
+		}
+		b, err := yaml.Marshal(m)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		if string(b) != tt.yaml {
+			t.Errorf("Marshal(%+v) = %q, want %q", tt.artwork, b, tt.yaml)
+		}
+	}
+
+	// No artwork is omitted
+	b, err := yaml.Marshal(&Metadata{Title: "Title"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "artwork") {
+		t.Errorf("empty artwork should be omitted:\n%s", b)
+	}
+
+	var m Metadata
+	if err := yaml.Unmarshal([]byte("artwork:\n  src: cover.png\n  type: poster\n"), &m); err == nil {
+		t.Error("expected an error for an unknown picture type")
+	}
+}
+
 func TestChapterUnmarshalYAML(t *testing.T) {
 	tests := []struct {
 		yamlStr   string
 		wantStart time.Duration
+		wantEnd   time.Duration
 		wantTitle string
 	}{
-		{"1:30 Main Topic", 90 * time.Second, "Main Topic"},
-		{"1:30.500 Main Topic", 90500 * time.Millisecond, "Main Topic"},
-		{"0:00 Introduction", 0, "Introduction"},
+		{"1:30 Main Topic", 90 * time.Second, 0, "Main Topic"},
+		{"1:30.500 Main Topic", 90500 * time.Millisecond, 0, "Main Topic"},
+		{"0:00 Introduction", 0, 0, "Introduction"},
 		// Test millisecond padding behavior
-		{"1:30.5 Main Topic", 500*time.Millisecond + 90*time.Second, "Main Topic"},    // .5 → .500
-		{"1:30.12 Main Topic", 120*time.Millisecond + 90*time.Second, "Main Topic"},   // .12 → .120
-		{"1:30.1234 Main Topic", 123*time.Millisecond + 90*time.Second, "Main Topic"}, // .1234 → .123 (truncated)
-		{"0:05.05 Short", 5050 * time.Millisecond, "Short"},                           // .05 → .050
+		{"1:30.5 Main Topic", 500*time.Millisecond + 90*time.Second, 0, "Main Topic"},    // .5 → .500
+		{"1:30.12 Main Topic", 120*time.Millisecond + 90*time.Second, 0, "Main Topic"},   // .12 → .120
+		{"1:30.1234 Main Topic", 123*time.Millisecond + 90*time.Second, 0, "Main Topic"}, // .1234 → .123 (truncated)
+		{"0:05.05 Short", 5050 * time.Millisecond, 0, "Short"},                           // .05 → .050
+		// Test range format with explicit end
+		{"0:00-1:30 Introduction", 0, 90 * time.Second, "Introduction"},
+		{"1:30.500-1:00:00 Main Topic - Part 1", 90500 * time.Millisecond, time.Hour, "Main Topic - Part 1"},
+		// Test title omitted
+		{`"2:00"`, 2 * time.Minute, 0, ""},
 	}
 
 	for _, tt := range tests {
@@ -139,6 +220,9 @@ func TestChapterUnmarshalYAML(t *testing.T) {
 		if chapter.Start != tt.wantStart {
 			t.Errorf("Expected start time %v, got %v", tt.wantStart, chapter.Start)
 		}
+		if chapter.End != tt.wantEnd {
+			t.Errorf("Expected end time %v, got %v", tt.wantEnd, chapter.End)
+		}
 		if chapter.Title != tt.wantTitle {
 			t.Errorf("Expected title %q, got %q", tt.wantTitle, chapter.Title)
 		}
@@ -183,6 +267,72 @@ func TestChapterWithQuotes(t *testing.T) {
 	}
 }
 
+func TestChaptersMapping(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []*Chapter
+	}{
+		{
+			name:  "mapping",
+			input: "title: Episode\nchapters:\n  \"1:30\": Main Topic\n  \"0:00\": Intro\n  \"1:00:00.500\": \"Ending: Thanks\"\n",
+			expected: []*Chapter{
+				{Start: 0, Title: "Intro"},
+				{Start: 90 * time.Second, Title: "Main Topic"},
+				{Start: time.Hour + 500*time.Millisecond, Title: "Ending: Thanks"},
+			},
+		},
+		{
+			name:  "flow mapping with range and no title",
+			input: `chapters: {"0:00-0:45": Opening, "0:45": ""}`,
+			expected: []*Chapter{
+				{Start: 0, End: 45 * time.Second, Title: "Opening"},
+				{Start: 45 * time.Second},
+			},
+		},
+		{
+			name:  "list",
+			input: "chapters:\n  - 0:00 Intro\n  - 1:30 Main Topic\n",
+			expected: []*Chapter{
+				{Start: 0, Title: "Intro"},
+				{Start: 90 * time.Second, Title: "Main Topic"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Metadata{}
+			if err := yaml.NewDecoder(strings.NewReader(tt.input)).Decode(m); err != nil {
+				t.Fatalf("Failed to decode metadata: %v", err)
+			}
+			if !reflect.DeepEqual(m.Chapters, tt.expected) {
+				t.Errorf("Chapters mismatch:\ngot:  %v\nwant: %v", m.Chapters, tt.expected)
+			}
+		})
+	}
+
+	m := &Metadata{}
+	if err := yaml.Unmarshal([]byte("title: Episode\nchapters:\n  \"0:00\": Intro\n"), m); err != nil {
+		t.Fatalf("Failed to unmarshal metadata: %v", err)
+	}
+	if m.Title != "Episode" {
+		t.Errorf("Expected title %q, got %q", "Episode", m.Title)
+	}
+	// Dump keeps the list form
+	out, err := yaml.Marshal(m)
+	if err != nil {
+		t.Fatalf("Failed to marshal metadata: %v", err)
+	}
+	if !strings.Contains(string(out), "- 0:00 Intro") {
+		t.Errorf("Chapters should be dumped as a list, got:\n%s", out)
+	}
+
+	if err := yaml.Unmarshal([]byte("chapters:\n  invalid: Intro\n"), &Metadata{}); err == nil {
+		t.Error("Expected an error for an invalid chapter time")
+	}
+}
+
 func TestNumberInSet(t *testing.T) {
 	tests := []struct {
 		input    *NumberInSet
@@ -224,6 +374,55 @@ func TestNumberInSet(t *testing.T) {
 	}
 }
 
+func TestEmptyNumberInSet(t *testing.T) {
+	for _, n := range []*NumberInSet{nil, {}, {Total: 10}} {
+		m := &Metadata{Track: n, Disc: n, MovementNumber: n}
+		for _, mapping := range textFrameMappings {
+			switch mapping.fieldName {
+			case "Track", "Disc", "MovementNumber":
+				if got := mapping.getValue(m); got != "" {
+					t.Errorf("%s of %v = %q, want empty", mapping.tagID, n, got)
+				}
+			}
+		}
+	}
+}
+
+func TestTimestampID3v23(t *testing.T) {
+	tests := []struct {
+		input    string
+		frames   map[string]string
+		readBack string
+	}{
+		{"2024", map[string]string{"TYER": "2024"}, "2024"},
+		{"2024-08", map[string]string{"TYER": "2024"}, "2024"},
+		{"2024-08-15", map[string]string{"TYER": "2024", "TDAT": "1508"}, "2024-08-15"},
+		{"2024-08-15T14", map[string]string{"TYER": "2024", "TDAT": "1508"}, "2024-08-15"},
+		{"2024-08-15T14:30:45", map[string]string{"TYER": "2024", "TDAT": "1508", "TIME": "1430"}, "2024-08-15T14:30"},
+	}
+	for _, tt := range tests {
+		var ts Timestamp
+		if err := ts.UnmarshalYAML([]byte(tt.input)); err != nil {
+			t.Fatalf("Failed to unmarshal Timestamp %q: %v", tt.input, err)
+		}
+		frames := ts.id3v23Frames()
+		if !reflect.DeepEqual(frames, tt.frames) {
+			t.Errorf("id3v23Frames(%q) = %v, want %v", tt.input, frames, tt.frames)
+		}
+		got := parseID3v23Date(frames["TYER"], frames["TDAT"], frames["TIME"])
+		if got == nil || got.String() != tt.readBack {
+			t.Errorf("parseID3v23Date(%v) = %v, want %q", frames, got, tt.readBack)
+		}
+	}
+
+	if got := parseID3v23Date("2024", "3102", ""); got == nil || got.String() != "2024" {
+		t.Errorf("invalid TDAT should be ignored, got %v", got)
+	}
+	if got := parseID3v23Date("abcd", "", ""); got != nil {
+		t.Errorf("invalid TYER should be nil, got %v", got)
+	}
+}
+
 func TestTimestamp(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -236,6 +435,12 @@ func TestTimestamp(t *testing.T) {
 		{"2024-08-15T14", &Timestamp{Time: time.Date(2024, 8, 15, 14, 0, 0, 0, time.UTC), Precision: PrecisionHour}, "2024-08-15T14"},
 		{"2024-08-15T14:30", &Timestamp{Time: time.Date(2024, 8, 15, 14, 30, 0, 0, time.UTC), Precision: PrecisionMinute}, "2024-08-15T14:30"},
 		{"2024-08-15T14:30:45", &Timestamp{Time: time.Date(2024, 8, 15, 14, 30, 45, 0, time.UTC), Precision: PrecisionSecond}, "2024-08-15T14:30:45"},
+		// Timezone offsets are converted to UTC
+		{"2024-08-15T14:30+09:00", &Timestamp{Time: time.Date(2024, 8, 15, 5, 30, 0, 0, time.UTC), Precision: PrecisionMinute}, "2024-08-15T05:30"},
+		{"2024-08-15T14:30:45Z", &Timestamp{Time: time.Date(2024, 8, 15, 14, 30, 45, 0, time.UTC), Precision: PrecisionSecond}, "2024-08-15T14:30:45"},
+		{"2024-01-01T01:00-0500", &Timestamp{Time: time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC), Precision: PrecisionMinute}, "2024-01-01T06:00"},
+		{"2024-01-01T08+09:00", &Timestamp{Time: time.Date(2023, 12, 31, 23, 0, 0, 0, time.UTC), Precision: PrecisionHour}, "2023-12-31T23"},
+		{"2024-08-15T14+05:30", &Timestamp{Time: time.Date(2024, 8, 15, 8, 30, 0, 0, time.UTC), Precision: PrecisionMinute}, "2024-08-15T08:30"},
 	}
 
 	for _, tt := range tests {
@@ -269,3 +474,95 @@ func TestTimestamp(t *testing.T) {
 		}
 	}
 }
+
+func TestEmptyTimestamp(t *testing.T) {
+	for _, input := range []string{`date: ""`, "date:", "date: ~", "date: null"} {
+		var m Metadata
+		if err := yaml.Unmarshal([]byte(input+"\noriginalDate: ''\n"), &m); err != nil {
+			t.Fatalf("Failed to unmarshal %q: %v", input, err)
+		}
+		if m.Date != nil || m.OriginalDate != nil {
+			t.Errorf("%q: got Date=%v, OriginalDate=%v, want nil", input, m.Date, m.OriginalDate)
+		}
+	}
+	m, err := decodeTOML(strings.NewReader("date = \"\"\n"))
+	if err != nil {
+		t.Fatalf("Failed to decode TOML: %v", err)
+	}
+	if m.Date != nil {
+		t.Errorf("TOML: got Date=%v, want nil", m.Date)
+	}
+
+	m = &Metadata{Title: "Song", Date: &Timestamp{}, OriginalDate: &Timestamp{}}
+	yamlData, err := yaml.Marshal(m)
+	if err != nil {
+		t.Fatalf("Failed to marshal YAML: %v", err)
+	}
+	jsonData, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("Failed to marshal JSON: %v", err)
+	}
+	var tomlData bytes.Buffer
+	if err := writeTOML(&tomlData, m); err != nil {
+		t.Fatalf("Failed to marshal TOML: %v", err)
+	}
+	for format, data := range map[string]string{
+		"YAML": string(yamlData), "JSON": string(jsonData), "TOML": tomlData.String(),
+	} {
+		if strings.Contains(strings.ToLower(data), "date") {
+			t.Errorf("%s should omit the zero dates, got %q", format, data)
+		}
+	}
+	if m.Date == nil {
+		t.Error("writeTOML should not modify the metadata")
+	}
+
+	var back Metadata
+	if err := yaml.Unmarshal(yamlData, &back); err != nil {
+		t.Fatalf("Failed to unmarshal %q: %v", yamlData, err)
+	}
+	if back.Title != "Song" || back.Date != nil || back.OriginalDate != nil {
+		t.Errorf("round-trip of %q = %+v", yamlData, back)
+	}
+
+	for _, marshal := range []func(any) ([]byte, error){yaml.Marshal, json.Marshal} {
+		if got, err := marshal(&Timestamp{}); err != nil || strings.TrimSpace(string(got)) != "null" {
+			t.Errorf("zero Timestamp marshaled to %q, %v, want null", got, err)
+		}
+	}
+}
+
+func TestTimestampHumanFormats(t *testing.T) {
+	tests := []struct {
+		input  string
+		output string
+	}{
+		{"2024/08/15", "2024-08-15"},
+		{"2024/8/5", "2024-08-05"},
+		{"2024/08", "2024-08"},
+		{"Aug 15, 2024", "2024-08-15"},
+		{"August 15, 2024", "2024-08-15"},
+		{"15 Aug 2024", "2024-08-15"},
+		{"15 August 2024", "2024-08-15"},
+		{"Aug 2024", "2024-08"},
+		{"August 2024", "2024-08"},
+	}
+	for _, tt := range tests {
+		var ts Timestamp
+		if err := ts.UnmarshalYAML([]byte(tt.input)); err != nil {
+			t.Errorf("Failed to unmarshal Timestamp %q: %v", tt.input, err)
+			continue
+		}
+		if got := ts.String(); got != tt.output {
+			t.Errorf("Timestamp %q = %q, want %q", tt.input, got, tt.output)
+		}
+	}
+
+	for _, input := range []string{"08/15/2024", "15/08/2024", "15.08.2024", "08-15-24"} {
+		var ts Timestamp
+		err := ts.UnmarshalYAML([]byte(input))
+		if err == nil || !strings.Contains(err.Error(), "ambiguous") {
+			t.Errorf("Timestamp %q should be rejected as ambiguous, got %v", input, err)
+		}
+	}
+}
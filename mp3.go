@@ -0,0 +1,958 @@
+package chape
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bogem/id3v2/v2"
+	"github.com/tcolgate/mp3"
+)
+
+// chapeSourceDescription is the description of the TXXX frame recording the source of the artwork
+const chapeSourceDescription = ArtworkSourceName
+
+// fallbackChapterLength is the length of the last chapter when the audio duration is unknown
+const fallbackChapterLength = time.Second
+
+// mp3Tagger reads and writes ID3v2 tags of MP3 files
+type mp3Tagger struct {
+	audioSource
+	// version is the ID3v2 version of the written tag, 4 if zero
+	version byte
+	// ratingEmail is the email identifier of the POPM frame holding the rating
+	ratingEmail string
+	// downloadRetries is the number of retries of downloading artwork
+	downloadRetries int
+	// maxArtworkSize is the maximum size of the artwork to embed, zero if unlimited
+	maxArtworkSize int
+	// strip makes writeMetadata remove all the frames, including unknown ones, before writing
+	strip bool
+	// prune makes writeMetadata delete the empty text frames left by other taggers
+	prune bool
+	// id3v1 is how writeMetadata treats the ID3v1 tag at the end of the file
+	id3v1 ID3v1Mode
+
+	// embedded caches the picture read by readMetadata as data URI,
+	// so that embeddedArtwork doesn't have to parse the tag again
+	embedded *string
+	// ordered reports whether readMetadata ordered chapters by the CTOC frame
+	ordered bool
+}
+
+// readMetadata extracts metadata from the ID3v2 tag
+func (t *mp3Tagger) readMetadata() (*Metadata, error) {
+	// Open the MP3 file once and use it for both the tag and the audio duration
+	file, err := t.open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	id3tag, extras, _, err := readID3Tag(file)
+	if err != nil {
+		return nil, err
+	}
+	// Fall back to the APEv2 tag, which some rippers write instead of ID3v2
+	if id3tag.Count() == 0 {
+		items, err := readAPEItems(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read APEv2 tag: %w", err)
+		}
+		if len(items) > 0 {
+			return apeMetadata(items), nil
+		}
+	}
+
+	var metadata = &Metadata{}
+
+	// Read all text frames using the centralized mapping
+	readTextFrames(id3tag, metadata)
+
+	// Try to get date from TDRC (ID3v2.4) or fall back to the ID3v2.3 frames
+	if dateFramer := id3tag.GetLastFrame("TDRC"); dateFramer != nil {
+		if tf, ok := dateFramer.(id3v2.TextFrame); ok && tf.Text != "" {
+			// Parse TDRC format
+			var ts Timestamp
+			if err := ts.UnmarshalYAML([]byte(tf.Text)); err == nil {
+				metadata.Date = &ts
+			}
+		}
+	} else if year := id3tag.GetTextFrame("TYER").Text; year != "" {
+		// ID3v2.3 splits the date into TYER, TDAT and TIME
+		metadata.Date = parseID3v23Date(year,
+			id3tag.GetTextFrame("TDAT").Text, id3tag.GetTextFrame("TIME").Text)
+	}
+
+	// Comment frames
+	var frameLanguage string
+	// The first comment with an empty description is Comment, and the others are Comments
+	var hasComment bool
+	for _, frame := range id3tag.GetFrames(id3tag.CommonID("Comments")) {
+		cf, ok := frame.(id3v2.CommentFrame)
+		if !ok {
+			continue
+		}
+		if cf.Description == "" && !hasComment {
+			hasComment = true
+			metadata.Comment = cf.Text
+			frameLanguage = cf.Language
+			continue
+		}
+		metadata.Comments = append(metadata.Comments, &Comment{
+			Language:    cf.Language,
+			Description: cf.Description,
+			Text:        cf.Text,
+		})
+	}
+
+	// Lyrics frames
+	lyricsFrames := id3tag.GetFrames("USLT") // Unsynchronised lyrics/text transcription
+	if len(lyricsFrames) > 0 {
+		if ulf, ok := lyricsFrames[0].(id3v2.UnsynchronisedLyricsFrame); ok {
+			metadata.Lyrics = ulf.Lyrics
+			frameLanguage = cmp.Or(frameLanguage, ulf.Language)
+		}
+	}
+	metadata.SyncedLyrics = readSyncedLyrics(id3tag)
+	// Surface the language of the frames only when it isn't the one derived from TLAN,
+	// so that it's kept on a round trip
+	if frameLanguage != "" && frameLanguage != metadata.defaultFrameLanguage() {
+		metadata.FrameLanguage = frameLanguage
+	}
+
+	// User-defined text frames other than CHAPE_SOURCE
+	for _, frame := range id3tag.GetFrames("TXXX") {
+		if udtf, ok := frame.(id3v2.UserDefinedTextFrame); ok && !isArtworkSourceName(udtf.Description) &&
+			!isMusicBrainzDescription(udtf.Description) {
+			if metadata.Custom == nil {
+				metadata.Custom = map[string]string{}
+			}
+			metadata.Custom[udtf.Description] = udtf.Value
+		}
+	}
+
+	// User-defined URL frames
+	for _, frame := range id3tag.GetFrames("WXXX") {
+		if uf, ok := frame.(id3v2.UnknownFrame); ok {
+			description, url := parseWXXX(uf.Body)
+			if url == "" {
+				continue
+			}
+			if metadata.URLs == nil {
+				metadata.URLs = map[string]string{}
+			}
+			metadata.URLs[description] = url
+		}
+	}
+
+	readMusicBrainzIDs(id3tag, metadata)
+	metadata.Rating = readRating(id3tag, t.ratingEmail)
+
+	// Artwork: prefer CHAPE_SOURCE over embedded data URI
+	embedded := pictureDataURI(id3tag)
+	t.embedded = &embedded
+	if embedded != "" {
+		// Always prefer CHAPE_SOURCE if available, regardless of file existence
+		if chapeSource := getChapeSource(id3tag); chapeSource != "" {
+			metadata.Artwork.Src = chapeSource
+		} else {
+			metadata.Artwork.Src = embedded
+		}
+		cover := coverPicture(id3tag)
+		metadata.Artwork.Type = pictureTypeName(uint32(cover.PictureType))
+		metadata.Artwork.Description = cover.Description
+	}
+
+	// Chapter frames
+	chapterFrames := id3tag.GetFrames("CHAP")
+	endTimes := make(map[*Chapter]time.Duration, len(chapterFrames))
+	chaptersByID := make(map[string]*Chapter, len(chapterFrames))
+	var chapters []*Chapter
+	for _, frame := range chapterFrames {
+		if cf, ok := frame.(id3v2.ChapterFrame); ok {
+			chapter := &Chapter{
+				Title: cf.Title.Text,
+				Start: cf.StartTime,
+			}
+			if cf.Description != nil {
+				chapter.Description = cf.Description.Text
+			}
+			chapters = append(chapters, chapter)
+			endTimes[chapter] = cf.EndTime
+			chaptersByID[cf.ElementID] = chapter
+		}
+	}
+	// Chapter images and URLs are read by readID3Tag as id3v2 ignores them
+	for id, e := range extras {
+		chapter, ok := chaptersByID[id]
+		if !ok {
+			continue
+		}
+		if e.picture != nil && len(e.picture.Picture) > 0 {
+			if e.source != "" {
+				chapter.Image = e.source
+			} else {
+				chapter.Image = fmt.Sprintf("data:%s;base64,%s",
+					e.picture.MimeType,
+					base64.StdEncoding.EncodeToString(e.picture.Picture))
+			}
+		}
+		chapter.URL = e.url
+	}
+	// Order chapters as listed in the table of contents if any. Chapters not listed
+	// in it follow in the stored order.
+	if ctoc := topLevelCTOC(id3tag); ctoc != nil {
+		t.ordered = true
+		for _, id := range ctoc.childElementIDs {
+			if chapter, ok := chaptersByID[id]; ok {
+				metadata.Chapters = append(metadata.Chapters, chapter)
+				delete(chaptersByID, id)
+			}
+		}
+		for _, chapter := range chapters {
+			if slices.Contains(metadata.Chapters, chapter) {
+				continue
+			}
+			metadata.Chapters = append(metadata.Chapters, chapter)
+		}
+	} else {
+		metadata.Chapters = chapters
+	}
+	setExplicitChapterEnds(metadata.Chapters, endTimes, func() (time.Duration, error) {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		return readMP3Duration(file)
+	})
+
+	return metadata, nil
+}
+
+// setExplicitChapterEnds sets End of the chapters whose stored end time differs from
+// the one that would be inferred, i.e. the next chapter's start or the audio duration
+// for the last chapter. audioDuration is called only when needed, and without it the last
+// chapter is inferred to end fallbackChapterLength after its start as writeMetadata does.
+func setExplicitChapterEnds(chapters []*Chapter, endTimes map[*Chapter]time.Duration, audioDuration func() (time.Duration, error)) {
+	sorted := slices.Clone(chapters)
+	slices.SortStableFunc(sorted, compareChapterStart)
+	for i, chapter := range sorted {
+		end := endTimes[chapter]
+		// Ignore unset or broken end times
+		if end <= chapter.Start {
+			continue
+		}
+		var inferred time.Duration
+		if i+1 < len(sorted) {
+			inferred = sorted[i+1].Start
+		} else {
+			d, err := audioDuration()
+			if err != nil {
+				d = chapter.Start + fallbackChapterLength
+			}
+			inferred = d
+		}
+		// CHAP stores times in milliseconds
+		if end != inferred.Truncate(time.Millisecond) {
+			chapter.End = end
+		}
+	}
+}
+
+// chaptersOrdered reports whether readMetadata ordered chapters by the CTOC frame
+func (t *mp3Tagger) chaptersOrdered() bool {
+	return t.ordered
+}
+
+// writeMetadata writes metadata to the MP3 file.
+// Only the frames that chape manages, including TXXX for Custom and WXXX for URLs, are deleted and re-added;
+// any other frames (PRIV, UFID of other owners, RVA2 and so on) are kept as parsed and written back by saveID3Tag.
+func (t *mp3Tagger) writeMetadata(ctx context.Context, metadata *Metadata) error {
+	// Open the MP3 file once; saveID3Tag writes the new tag and the audio read from it
+	file, err := os.Open(t.path)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+	id3tag, _, tagSize, err := readID3Tag(file)
+	if err != nil {
+		return fmt.Errorf("failed to parse tag: %w", err)
+	}
+	// The picture type and description of the cover are the given ones, or kept unless the
+	// artwork is replaced, i.e. it's the recorded source or the embedded picture itself
+	pictureType, pictureDescription := byte(id3v2.PTFrontCover), ""
+	if metadata.Artwork.explicit() {
+		if pictureType, err = parsePictureType(metadata.Artwork.Type); err != nil {
+			return err
+		}
+		pictureDescription = metadata.Artwork.Description
+	} else if cover := coverPicture(id3tag); cover != nil && metadata.Artwork.Src != "" &&
+		(metadata.Artwork.Src == getChapeSource(id3tag) || metadata.Artwork.Src == pictureDataURI(id3tag)) {
+		pictureType, pictureDescription = cover.PictureType, cover.Description
+	}
+	if t.strip {
+		id3tag.DeleteAllFrames()
+	}
+
+	// Get audio duration for TLEN and chapter end times. It's best effort, so that a broken
+	// stream doesn't block tagging, and the end of the last chapter falls back without it.
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	audioDuration, durationErr := readMP3Duration(file)
+
+	// Set version and encoding. ID3v2.3 has no UTF-8, so the frames are written in UTF-16
+	// unless ISO-8859-1 can hold their texts.
+	version := cmp.Or(t.version, 4)
+	id3tag.SetVersion(version)
+	if version == 3 {
+		id3tag.SetDefaultEncoding(id3v2.EncodingUTF16)
+	} else {
+		id3tag.SetDefaultEncoding(id3v2.EncodingUTF8)
+	}
+
+	// Apply all text frames using the centralized mapping
+	applyTextFrames(id3tag, metadata)
+
+	// Set length in milliseconds, which is derived from the audio and left out on stripping
+	id3tag.DeleteFrames("TLEN")
+	if !t.strip && durationErr == nil && audioDuration > 0 {
+		id3tag.AddTextFrame("TLEN", frameEncoding(version), strconv.FormatInt(audioDuration.Milliseconds(), 10))
+	}
+
+	// Set date: TDRC in ID3v2.4, TYER/TDAT/TIME in ID3v2.3
+	for _, id := range []string{"TDRC", "TYER", "TDAT", "TIME"} {
+		id3tag.DeleteFrames(id)
+	}
+	if metadata.Date != nil && !metadata.Date.Time.IsZero() {
+		if version == 3 {
+			for id, value := range metadata.Date.id3v23Frames() {
+				id3tag.AddTextFrame(id, frameEncoding(version), value)
+			}
+		} else {
+			id3tag.AddTextFrame("TDRC", frameEncoding(version), metadata.Date.String())
+		}
+	}
+
+	// Set comment
+	id3tag.DeleteFrames(id3tag.CommonID("Comments"))
+	if metadata.Comment != "" {
+		id3tag.AddCommentFrame(id3v2.CommentFrame{
+			Encoding:    frameEncoding(version, metadata.Comment),
+			Language:    metadata.getLanguageForFrames(),
+			Description: "",
+			Text:        metadata.Comment,
+		})
+	}
+	for _, comment := range metadata.Comments {
+		id3tag.AddCommentFrame(id3v2.CommentFrame{
+			Encoding:    frameEncoding(version, comment.Description, comment.Text),
+			Language:    cmp.Or(comment.Language, metadata.getLanguageForFrames()),
+			Description: comment.Description,
+			Text:        comment.Text,
+		})
+	}
+
+	// Set lyrics
+	// First, delete existing lyrics frames
+	id3tag.DeleteFrames("USLT") // Unsynchronised lyrics/text transcription
+	if metadata.Lyrics != "" {
+		id3tag.AddUnsynchronisedLyricsFrame(id3v2.UnsynchronisedLyricsFrame{
+			Encoding: frameEncoding(version, metadata.Lyrics),
+			Language: metadata.getLanguageForFrames(),
+			Lyrics:   metadata.Lyrics,
+		})
+	}
+	id3tag.DeleteFrames("SYLT") // Synchronised lyrics/text
+	if len(metadata.SyncedLyrics) > 0 {
+		texts := make([]string, len(metadata.SyncedLyrics))
+		for i, l := range metadata.SyncedLyrics {
+			texts[i] = l.Text
+		}
+		id3tag.AddFrame("SYLT", &syltFrame{
+			encoding:    frameEncoding(version, texts...),
+			language:    metadata.getLanguageForFrames(),
+			contentType: syltContentLyrics,
+			lines:       metadata.SyncedLyrics,
+		})
+	}
+
+	// Set user-defined text frames. CHAPE_SOURCE is kept here and set with the artwork.
+	chapeSource := getChapeSource(id3tag)
+	id3tag.DeleteFrames("TXXX")
+	if chapeSource != "" {
+		setUserDefinedTextFrame(id3tag, chapeSourceDescription, chapeSource)
+	}
+	for _, description := range slices.Sorted(maps.Keys(metadata.Custom)) {
+		if isArtworkSourceName(description) || isMusicBrainzDescription(description) {
+			continue
+		}
+		setUserDefinedTextFrame(id3tag, description, metadata.Custom[description])
+	}
+	// Set user-defined URL frames, one per description
+	id3tag.DeleteFrames("WXXX")
+	for _, description := range slices.Sorted(maps.Keys(metadata.URLs)) {
+		if url := metadata.URLs[description]; url != "" {
+			id3tag.AddFrame("WXXX", id3v2.UnknownFrame{Body: encodeWXXX(frameEncoding(version, description), description, url)})
+		}
+	}
+	applyMusicBrainzIDs(id3tag, metadata)
+	applyRating(id3tag, metadata.Rating, t.ratingEmail)
+
+	// Set artwork
+	if metadata.Artwork.Src != "" {
+		pictureData, mimeType, err := parseArtwork(ctx, metadata.Artwork.Src, t.downloadRetries)
+		if err != nil {
+			return fmt.Errorf("failed to parse artwork: %w", err)
+		}
+		if err := checkArtworkSize(pictureData, t.maxArtworkSize); err != nil {
+			return err
+		}
+
+		if len(pictureData) > 0 {
+			// Delete existing picture frames
+			id3tag.DeleteFrames("APIC")
+
+			pictureFrame := id3v2.PictureFrame{
+				Encoding:    frameEncoding(version, pictureDescription),
+				MimeType:    mimeType,
+				PictureType: pictureType,
+				Description: pictureDescription,
+				Picture:     pictureData,
+			}
+			id3tag.AddAttachedPicture(pictureFrame)
+
+			// Store artwork source in TXXX frame
+			// Skip data URIs as they don't need source tracking
+			if !strings.HasPrefix(metadata.Artwork.Src, "data:") {
+				setUserDefinedTextFrame(id3tag, chapeSourceDescription, metadata.Artwork.Src)
+			}
+		}
+	}
+
+	// Set chapters
+	// First, delete existing chapter frames and table of contents
+	id3tag.DeleteFrames("CHAP")
+	id3tag.DeleteFrames("CTOC")
+	if len(metadata.Chapters) > 255 {
+		return fmt.Errorf("too many chapters: %d (CTOC frame can hold up to 255)", len(metadata.Chapters))
+	}
+	if n := len(metadata.Chapters); n > 0 && metadata.Chapters[n-1].End == 0 && durationErr != nil {
+		// End the last chapter shortly after its start rather than failing the whole write
+		audioDuration = metadata.Chapters[n-1].Start + fallbackChapterLength
+		log.Printf("Warning: failed to get the audio duration; the last chapter ends at %s: %v",
+			formatChapterTime(audioDuration), durationErr)
+	}
+	toc := &ctocFrame{
+		elementID: "toc",
+		topLevel:  true,
+		ordered:   true,
+	}
+
+	for i, chapter := range metadata.Chapters {
+		// Create proper chapter frame
+		startTime := chapter.Start
+		endTime := chapterEnd(metadata.Chapters, i, audioDuration)
+
+		chapterFrame := id3v2.ChapterFrame{
+			ElementID: fmt.Sprintf("chp%d", i),
+			// CHAP stores times in milliseconds
+			StartTime: startTime.Truncate(time.Millisecond),
+			EndTime:   endTime.Truncate(time.Millisecond),
+			// If these bytes are all set to 0xFF then the value should be ignored and
+			// the start/end time value should be utilized.
+			// cf. https://id3.org/id3v2-chapters-1.0
+			StartOffset: math.MaxUint32,
+			EndOffset:   math.MaxUint32,
+			Title: &id3v2.TextFrame{
+				Encoding: frameEncoding(version, chapter.Title),
+				Text:     chapter.Title,
+			},
+			Description: &id3v2.TextFrame{
+				Encoding: frameEncoding(version, chapter.Description),
+				Text:     chapter.Description,
+			},
+		}
+
+		if chapter.Image == "" && chapter.URL == "" {
+			id3tag.AddChapterFrame(chapterFrame)
+		} else {
+			cf := &chapFrame{ChapterFrame: chapterFrame, encoding: frameEncoding(version, chapter.Image), url: chapter.URL}
+			if chapter.Image != "" {
+				pictureData, mimeType, err := parseArtwork(ctx, chapter.Image, t.downloadRetries)
+				if err != nil {
+					return fmt.Errorf("failed to parse image of chapter %q: %w", chapter.Title, err)
+				}
+				cf.picture = &id3v2.PictureFrame{
+					// The description is empty, which needs no Unicode
+					Encoding:    id3v2.EncodingISO,
+					MimeType:    mimeType,
+					PictureType: id3v2.PTOther,
+					Picture:     pictureData,
+				}
+				// Skip data URIs as they don't need source tracking
+				if !strings.HasPrefix(chapter.Image, "data:") {
+					cf.source = chapter.Image
+				}
+			}
+			id3tag.AddFrame("CHAP", cf)
+		}
+		toc.childElementIDs = append(toc.childElementIDs, chapterFrame.ElementID)
+	}
+	if len(toc.childElementIDs) > 0 {
+		// Players such as Apple Podcasts require the table of contents to show chapters
+		id3tag.AddFrame("CTOC", toc)
+	}
+	if t.prune {
+		pruneEmptyTextFrames(id3tag)
+	}
+	if version == 3 {
+		warnUTF16Frames(utf16FrameIDs(id3tag))
+	}
+
+	// The ID3v1 tag follows the audio, so it's cut off to be synced or stripped
+	audioEnd, id3v1, err := t.id3v1Trailer(file, metadata)
+	if err != nil {
+		return err
+	}
+
+	// Save changes
+	if err := saveID3Tag(file, id3tag, tagSize, audioEnd, id3v1); err != nil {
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+
+	return nil
+}
+
+// frameEncoding returns the encoding of a frame holding the texts. ID3v2.4 uses UTF-8.
+// ID3v2.3 has no UTF-8, so the frame is written in ISO-8859-1 when it can hold the texts,
+// and in UTF-16 otherwise.
+func frameEncoding(version byte, texts ...string) id3v2.Encoding {
+	if version != 3 {
+		return id3v2.EncodingUTF8
+	}
+	for _, s := range texts {
+		if strings.IndexFunc(s, func(r rune) bool { return r > 0xFF }) >= 0 {
+			return id3v2.EncodingUTF16
+		}
+	}
+	return id3v2.EncodingISO
+}
+
+// utf16FrameIDs returns the sorted IDs of the frames of the tag written in UTF-16
+func utf16FrameIDs(id3tag *id3v2.Tag) []string {
+	var ids []string
+	for id, frames := range id3tag.AllFrames() {
+		for _, frame := range frames {
+			var enc id3v2.Encoding
+			switch f := frame.(type) {
+			case id3v2.TextFrame:
+				enc = f.Encoding
+			case id3v2.CommentFrame:
+				enc = f.Encoding
+			case id3v2.UnsynchronisedLyricsFrame:
+				enc = f.Encoding
+			case id3v2.UserDefinedTextFrame:
+				enc = f.Encoding
+			case id3v2.PictureFrame:
+				enc = f.Encoding
+			case *syltFrame:
+				enc = f.encoding
+			case id3v2.ChapterFrame:
+				if f.Title != nil {
+					enc = f.Title.Encoding
+				}
+			case *chapFrame:
+				if f.Title.Encoding.Equals(id3v2.EncodingUTF16) {
+					enc = f.Title.Encoding
+				} else if f.source != "" {
+					enc = f.encoding
+				}
+			}
+			if enc.Equals(id3v2.EncodingUTF16) {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// warnUTF16Frames warns that the frames are written in UTF-16, as ID3v2.3 has no UTF-8
+// and ISO-8859-1 can't hold their texts. Older players may not read UTF-16.
+func warnUTF16Frames(ids []string) {
+	if len(ids) > 0 {
+		log.Printf("Warning: ID3v2.3 has no UTF-8, so %s are written in UTF-16 for the characters ISO-8859-1 can't hold",
+			strings.Join(ids, ", "))
+	}
+}
+
+// getChapeSource returns the source of the artwork, also recorded under the legacy name
+func getChapeSource(id3tag *id3v2.Tag) string {
+	return cmp.Or(getUserDefinedTextFrame(id3tag, chapeSourceDescription),
+		getUserDefinedTextFrame(id3tag, legacyArtworkSourceName))
+}
+
+// getUserDefinedTextFrame returns the value of the TXXX frame with the given description
+func getUserDefinedTextFrame(id3tag *id3v2.Tag, description string) string {
+	for _, frame := range id3tag.GetFrames("TXXX") {
+		if udtf, ok := frame.(id3v2.UserDefinedTextFrame); ok && udtf.Description == description {
+			return udtf.Value
+		}
+	}
+	return ""
+}
+
+// setUserDefinedTextFrame replaces the TXXX frame with the given description,
+// leaving TXXX frames with other descriptions intact
+func setUserDefinedTextFrame(id3tag *id3v2.Tag, description, value string) {
+	var preservedFrames []id3v2.UserDefinedTextFrame
+	// Collect all TXXX frames with other descriptions
+	for _, frame := range id3tag.GetFrames("TXXX") {
+		if udtf, ok := frame.(id3v2.UserDefinedTextFrame); ok {
+			if udtf.Description != description {
+				preservedFrames = append(preservedFrames, udtf)
+			}
+		}
+	}
+	// Clear all TXXX frames and re-add preserved ones
+	id3tag.DeleteFrames("TXXX")
+	for _, frame := range preservedFrames {
+		id3tag.AddUserDefinedTextFrame(frame)
+	}
+	if value != "" {
+		id3tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+			Encoding:    frameEncoding(id3tag.Version(), description, value),
+			Description: description,
+			Value:       value,
+		})
+	}
+}
+
+// writeArtwork replaces the front cover APIC frame and the TXXX:CHAPE_SOURCE frame.
+// The tag is edited as bytes, so that the other frames, including the sub-frames of CHAP
+// that id3v2 doesn't parse, are written back as they are.
+func (t *mp3Tagger) writeArtwork(ctx context.Context, artwork string) error {
+	pictureData, mimeType, err := loadArtwork(ctx, artwork, t.downloadRetries, t.maxArtworkSize)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(t.path)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	// A new tag has no frames to keep
+	header := []byte{'I', 'D', '3', cmp.Or(t.version, 4), 0, 0, 0, 0, 0, 0}
+	var body []byte
+	var tagSize int64
+	h := make([]byte, 10)
+	if _, err := io.ReadFull(file, h); err == nil && string(h[:3]) == "ID3" {
+		if h[3] < 3 {
+			return fmt.Errorf("setting artwork of an ID3v2.%d tag is not supported", h[3])
+		}
+		if h[5]&0x80 != 0 {
+			return errors.New("setting artwork of an unsynchronised tag is not supported")
+		}
+		copy(header, h)
+		header[5] &^= 0x10 // footer
+		body = make([]byte, synchsafe(h[6:10]))
+		if _, err := io.ReadFull(file, body); err != nil {
+			return fmt.Errorf("failed to read ID3v2 tag: %w", err)
+		}
+		tagSize = int64(10 + len(body))
+		if h[5]&0x10 != 0 {
+			tagSize += 10
+		}
+	} else if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	version := header[3]
+
+	var buf bytes.Buffer
+	buf.Write(header)
+	if header[5]&0x40 != 0 && len(body) >= 4 {
+		// Keep the extended header as it is
+		size := int(binary.BigEndian.Uint32(body))
+		if version == 4 {
+			size = synchsafe(body[:4])
+		} else {
+			size += 4 // the size in ID3v2.3 excludes itself
+		}
+		if size > len(body) {
+			return errors.New("invalid ID3v2 extended header")
+		}
+		buf.Write(body[:size])
+		body = body[size:]
+	}
+	for _, f := range splitID3Frames(body, version == 4) {
+		switch f.id {
+		case "APIC":
+			if p := parseAPIC(f.body); p != nil && p.PictureType == id3v2.PTFrontCover {
+				continue
+			}
+		case "TXXX":
+			if description, _ := parseTXXX(f.body); isArtworkSourceName(description) {
+				continue
+			}
+		}
+		buf.Write(f.raw)
+	}
+
+	// APIC: encoding, MIME type, picture type, empty description and the picture
+	enc := frameEncoding(version).Key
+	apic := append([]byte{enc}, mimeType...)
+	apic = append(apic, 0, id3v2.PTFrontCover)
+	apic = append(apic, id3Terminator(enc)...)
+	writeID3Frame(&buf, "APIC", append(apic, pictureData...), version)
+	if source := artworkSource(artwork); source != "" {
+		enc := frameEncoding(version, source).Key
+		if version == 3 && enc == id3v2.EncodingUTF16.Key {
+			warnUTF16Frames([]string{"TXXX"})
+		}
+		txxx := append([]byte{enc}, encodeID3Text(enc, chapeSourceDescription)...)
+		txxx = append(txxx, id3Terminator(enc)...)
+		writeID3Frame(&buf, "TXXX", append(txxx, encodeID3Text(enc, source)...), version)
+	}
+	b := buf.Bytes()
+	putSynchsafe(b[6:10], len(b)-10)
+
+	if err := saveID3Tag(file, &buf, tagSize, -1, nil); err != nil {
+		return fmt.Errorf("failed to save tag: %w", err)
+	}
+	t.embedded = nil
+	return nil
+}
+
+// writeID3Frame writes the frame of the ID and the body in the ID3v2 version to buf
+func writeID3Frame(buf *bytes.Buffer, id string, body []byte, version byte) {
+	header := make([]byte, 10)
+	copy(header, id)
+	if version == 4 {
+		putSynchsafe(header[4:8], len(body))
+	} else {
+		binary.BigEndian.PutUint32(header[4:8], uint32(len(body)))
+	}
+	buf.Write(header)
+	buf.Write(body)
+}
+
+// details returns the version and size of the ID3v2 tag and the VBR header of the first frame
+func (t *mp3Tagger) details() ([]string, error) {
+	file, err := t.open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	var lines []string
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(file, header); err == nil && string(header[:3]) == "ID3" {
+		size := 10 + synchsafe(header[6:10])
+		if header[5]&0x10 != 0 {
+			size += 10 // footer
+		}
+		lines = append(lines, fmt.Sprintf("ID3v2.%d.%d, %d bytes", header[3], header[4], size))
+	} else {
+		lines = append(lines, "no ID3v2 tag")
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := skipID3v2Tag(file); err != nil {
+		return nil, err
+	}
+	vbr := "none"
+	var (
+		f       mp3.Frame
+		skipped int
+	)
+	if err := mp3.NewDecoder(file).Decode(&f, &skipped); err == nil {
+		if id, _ := vbrHeader(&f); id != "" {
+			vbr = id
+		}
+	}
+	return append(lines, "VBR header: "+vbr), nil
+}
+
+// tagVersion returns the major version of the ID3v2 tag, or zero if there's none
+func (t *mp3Tagger) tagVersion() (byte, error) {
+	file, err := t.open()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(file, header); err != nil || string(header[:3]) != "ID3" {
+		return 0, nil
+	}
+	return header[3], nil
+}
+
+// duration calculates the actual duration of the MP3 file
+func (t *mp3Tagger) duration() (time.Duration, error) {
+	file, err := t.open()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	return readMP3Duration(file)
+}
+
+// readMP3Duration calculates the duration of MP3 file. It uses the frame count in the
+// Xing/Info or VBRI header of the first frame if present, and decodes all frames otherwise.
+func readMP3Duration(r io.ReadSeeker) (time.Duration, error) {
+	// Skip the ID3v2 tag, as its bytes (e.g. 0xFF offsets in CHAP frames) can be
+	// mistaken for frame headers
+	if err := skipID3v2Tag(r); err != nil {
+		return 0, err
+	}
+
+	var (
+		t       time.Duration
+		f       mp3.Frame
+		skipped int
+		d       = mp3.NewDecoder(r)
+	)
+
+	for i := 0; ; i++ {
+		if err := d.Decode(&f, &skipped); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return 0, err
+		}
+		if i == 0 {
+			if _, frames := vbrHeader(&f); frames > 0 {
+				// The count excludes the header frame itself, which carries no audio
+				return time.Duration(frames) * f.Duration(), nil
+			}
+		}
+		t = t + f.Duration()
+	}
+
+	return t, nil
+}
+
+// vbrHeader returns the ID of the Xing/Info or VBRI header of the frame and the number of
+// frames recorded in it. id is "" if the frame has no such header, and frames is 0 if it
+// lacks the count.
+func vbrHeader(f *mp3.Frame) (id string, frames uint32) {
+	buf, err := io.ReadAll(f.Reader())
+	if err != nil {
+		return "", 0
+	}
+
+	// Xing/Info header follows the side information
+	offset := 4
+	if f.Header().Protection() {
+		offset += 2
+	}
+	if sideLen, err := f.SideInfoLength(); err == nil {
+		offset += sideLen
+		if len(buf) >= offset+12 {
+			if id := string(buf[offset : offset+4]); id == "Xing" || id == "Info" {
+				flags := binary.BigEndian.Uint32(buf[offset+4:])
+				if flags&0x1 == 0 { // frames field isn't present
+					return id, 0
+				}
+				return id, binary.BigEndian.Uint32(buf[offset+8:])
+			}
+		}
+	}
+
+	// VBRI header is located 32 bytes after the frame header
+	const vbriOffset = 4 + 32
+	if len(buf) >= vbriOffset+18 && string(buf[vbriOffset:vbriOffset+4]) == "VBRI" {
+		// ID(4), version(2), delay(2), quality(2), bytes(4), frames(4)
+		return "VBRI", binary.BigEndian.Uint32(buf[vbriOffset+14:])
+	}
+	return "", 0
+}
+
+// skipID3v2Tag seeks r past the ID3v2 tag at the current position, if any
+func skipID3v2Tag(r io.ReadSeeker) error {
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			_, err = r.Seek(0, io.SeekStart)
+			return err
+		}
+		return err
+	}
+	if string(header[:3]) != "ID3" {
+		_, err := r.Seek(-int64(len(header)), io.SeekCurrent)
+		return err
+	}
+	// The tag size is a 28-bit synchsafe integer excluding the header
+	size := int64(synchsafe(header[6:10]))
+	if header[5]&0x10 != 0 {
+		size += 10 // footer
+	}
+	_, err := r.Seek(size, io.SeekCurrent)
+	return err
+}
+
+// embeddedArtwork extracts embedded artwork from MP3 as data URI
+func (t *mp3Tagger) embeddedArtwork() (string, error) {
+	if t.embedded != nil {
+		return *t.embedded, nil
+	}
+	file, err := t.open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	id3tag, _, _, err := readID3Tag(file)
+	if err != nil {
+		return "", err
+	}
+
+	return pictureDataURI(id3tag), nil
+}
+
+// pictureDataURI returns the cover picture of the tag as data URI, or "" if none
+func pictureDataURI(id3tag *id3v2.Tag) string {
+	pf := coverPicture(id3tag)
+	if pf == nil {
+		return ""
+	}
+	return fmt.Sprintf("data:%s;base64,%s", pf.MimeType, base64.StdEncoding.EncodeToString(pf.Picture))
+}
+
+// coverPicture returns the front cover, or the first attached picture if none, of the tag,
+// or nil if none
+func coverPicture(id3tag *id3v2.Tag) *id3v2.PictureFrame {
+	var pictures []id3v2.PictureFrame
+	for _, f := range id3tag.GetFrames(id3tag.CommonID("Attached picture")) {
+		if pf, ok := f.(id3v2.PictureFrame); ok && len(pf.Picture) > 0 {
+			pictures = append(pictures, pf)
+		}
+	}
+	if len(pictures) == 0 {
+		return nil
+	}
+	if i := slices.IndexFunc(pictures, func(p id3v2.PictureFrame) bool {
+		return p.PictureType == id3v2.PTFrontCover
+	}); i >= 0 {
+		return &pictures[i]
+	}
+	return &pictures[0]
+}
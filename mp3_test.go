@@ -0,0 +1,334 @@
+package chape
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+// buildMP3 builds MPEG-1 Layer III frames (44.1kHz, stereo). With vbr, the bit rate
+// alternates between 128kbps and 160kbps. vbrHeader ("Xing", "Info", "VBRI" or "")
+// is put in an additional first frame holding the frame count.
+func buildMP3(frames int, vbr bool, vbrHeader string) []byte {
+	frame := func(bitRateIndex byte) []byte {
+		size := 144 * []int{9: 128000, 10: 160000}[bitRateIndex] / 44100
+		f := make([]byte, size)
+		copy(f, []byte{0xFF, 0xFB, bitRateIndex << 4, 0x00})
+		return f
+	}
+
+	var buf bytes.Buffer
+	if vbrHeader != "" {
+		f := frame(9)
+		switch vbrHeader {
+		case "VBRI":
+			copy(f[36:], "VBRI")
+			binary.BigEndian.PutUint32(f[36+14:], uint32(frames))
+		default:
+			// Side information of MPEG-1 stereo is 32 bytes
+			copy(f[36:], vbrHeader)
+			binary.BigEndian.PutUint32(f[40:], 0x1) // frames field is present
+			binary.BigEndian.PutUint32(f[44:], uint32(frames))
+		}
+		buf.Write(f)
+	}
+	for i := range frames {
+		if vbr && i%2 == 1 {
+			buf.Write(frame(10))
+		} else {
+			buf.Write(frame(9))
+		}
+	}
+	return buf.Bytes()
+}
+
+// createDummyMP3 creates a dummy MP3 file with an empty ID3v2.4 tag and CBR frames of
+// approximately the specified duration
+func createDummyMP3(t *testing.T, duration time.Duration) string {
+	t.Helper()
+
+	// Write ID3v2 header (empty)
+	data := []byte{
+		0x49, 0x44, 0x33, // "ID3"
+		0x04, 0x00, // Version 2.4.0
+		0x00,                   // Flags
+		0x00, 0x00, 0x00, 0x00, // Size (0, will be updated by id3v2 library)
+	}
+	// MP3 frame duration is typically around 26ms for 44.1kHz
+	data = append(data, buildMP3(int(duration.Milliseconds())/26, false, "")...)
+	mp3Path := filepath.Join(t.TempDir(), "chape_test.mp3")
+	if err := os.WriteFile(mp3Path, data, 0644); err != nil {
+		t.Fatalf("Failed to create MP3 file: %v", err)
+	}
+	return mp3Path
+}
+
+func TestReadMP3Duration(t *testing.T) {
+	const frames = 1000
+	// 1152 samples per frame at 44.1kHz
+	frameDuration := 1152 * time.Second / 44100
+	want := frames * frameDuration
+
+	tests := []struct {
+		name      string
+		vbr       bool
+		vbrHeader string
+	}{
+		{"CBR without header", false, ""},
+		{"CBR with Info header", false, "Info"},
+		{"VBR without header", true, ""},
+		{"VBR with Xing header", true, "Xing"},
+		{"VBR with VBRI header", true, "VBRI"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readMP3Duration(bytes.NewReader(buildMP3(frames, tt.vbr, tt.vbrHeader)))
+			if err != nil {
+				t.Fatalf("readMP3Duration failed: %v", err)
+			}
+			if diff := got - want; diff < -frameDuration || diff > frameDuration {
+				t.Errorf("duration = %v, want %v (within one frame)", got, want)
+			}
+		})
+	}
+}
+
+// BenchmarkReadMP3Duration compares the full frame decode with the frame count of
+// Xing/Info headers on a 3-hour file
+func BenchmarkReadMP3Duration(b *testing.B) {
+	const frames = 3 * 60 * 60 * 44100 / 1152
+
+	benchmarks := []struct {
+		name      string
+		vbr       bool
+		vbrHeader string
+	}{
+		{"CBR/decode", false, ""},
+		{"CBR/Info", false, "Info"},
+		{"VBR/decode", true, ""},
+		{"VBR/Xing", true, "Xing"},
+	}
+
+	for _, bm := range benchmarks {
+		data := buildMP3(frames, bm.vbr, bm.vbrHeader)
+		b.Run(bm.name, func(b *testing.B) {
+			for b.Loop() {
+				if _, err := readMP3Duration(bytes.NewReader(data)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteID3v23(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+
+	yamlContent := `title: 日本語タイトル
+album: Café
+date: 2024-03-15T09:30
+originalDate: 1969-09-26
+syncedLyrics:
+- 0:00.500 歌詞
+- 0:01 Line
+chapters:
+- 0:00 Intro
+- start: "0:00.500"
+  title: Main
+  image: ./testdata/assets/logo.png
+`
+	c := New(mp3Path)
+	c.ID3Version = 3
+	if err := c.Apply(strings.NewReader(yamlContent), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	version := tag.Version()
+	frames := map[string]string{}
+	for _, id := range []string{"TDRC", "TYER", "TDAT", "TIME", "TDOR", "TORY"} {
+		frames[id] = tag.GetTextFrame(id).Text
+	}
+	// Only the frames ISO-8859-1 can't hold are written in UTF-16
+	titleEncoding := tag.GetTextFrame("TIT2").Encoding
+	albumEncoding := tag.GetTextFrame("TALB").Encoding
+	tag.Close()
+	if !titleEncoding.Equals(id3v2.EncodingUTF16) || !albumEncoding.Equals(id3v2.EncodingISO) {
+		t.Errorf("encodings of TIT2 and TALB = %s, %s, want UTF-16 and ISO-8859-1", titleEncoding, albumEncoding)
+	}
+	if version != 3 {
+		t.Errorf("version = %d, want 3", version)
+	}
+	expected := map[string]string{"TDRC": "", "TYER": "2024", "TDAT": "1503", "TIME": "0930", "TDOR": "", "TORY": "1969"}
+	if !reflect.DeepEqual(frames, expected) {
+		t.Errorf("date frames = %v, want %v", frames, expected)
+	}
+
+	metadata, err := New(mp3Path).Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if metadata.Title != "日本語タイトル" || metadata.Album != "Café" {
+		t.Errorf("title, album = %q, %q", metadata.Title, metadata.Album)
+	}
+	if got := metadata.Date.String(); got != "2024-03-15T09:30" {
+		t.Errorf("date = %q", got)
+	}
+	if got := metadata.OriginalDate.String(); got != "1969" {
+		t.Errorf("original date = %q", got)
+	}
+	if len(metadata.SyncedLyrics) != 2 || metadata.SyncedLyrics[0].Text != "歌詞" {
+		t.Errorf("unexpected synced lyrics: %v", metadata.SyncedLyrics)
+	}
+	if len(metadata.Chapters) != 2 || metadata.Chapters[1].Image != "./testdata/assets/logo.png" {
+		t.Errorf("unexpected chapters: %v", metadata.Chapters)
+	}
+
+	// Applying the same YAML again is a no-op
+	if err := c.Apply(strings.NewReader(yamlContent), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	c.ID3Version = 2
+	if err := c.Apply(strings.NewReader(yamlContent), true); err == nil {
+		t.Error("expected an error for ID3v2.2")
+	}
+}
+
+func TestConvertID3Version(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+	yamlContent := "title: Episode\n"
+	if err := New(mp3Path).Apply(strings.NewReader(yamlContent), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	// Unchanged metadata is still written to convert the tag
+	c := New(mp3Path)
+	c.ID3Version = 3
+	if err := c.Apply(strings.NewReader(yamlContent), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	b, err := os.ReadFile(mp3Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b[:3]) != "ID3" || b[3] != 3 {
+		t.Errorf("header = % x, want ID3v2.3", b[:4])
+	}
+	if version, err := c.versionPending(); err != nil || version != 0 {
+		t.Errorf("versionPending = %d, %v after converting", version, err)
+	}
+}
+
+func TestFrameEncoding(t *testing.T) {
+	tests := []struct {
+		version  byte
+		texts    []string
+		expected id3v2.Encoding
+	}{
+		{4, []string{"日本語"}, id3v2.EncodingUTF8},
+		{3, nil, id3v2.EncodingISO},
+		{3, []string{"Café", "Ñandú"}, id3v2.EncodingISO},
+		{3, []string{"Title", "日本語"}, id3v2.EncodingUTF16},
+		{3, []string{"€"}, id3v2.EncodingUTF16},
+	}
+	for _, tt := range tests {
+		if got := frameEncoding(tt.version, tt.texts...); !got.Equals(tt.expected) {
+			t.Errorf("frameEncoding(%d, %q) = %s, want %s", tt.version, tt.texts, got, tt.expected)
+		}
+	}
+}
+
+func TestApplyTextFramesEmptyMetadata(t *testing.T) {
+	for _, version := range []byte{3, 4} {
+		tag := id3v2.NewEmptyTag()
+		tag.SetVersion(version)
+		applyTextFrames(tag, &Metadata{})
+		if n := tag.Count(); n != 0 {
+			t.Errorf("ID3v2.%d: %d frames written for empty metadata", version, n)
+		}
+	}
+}
+
+func TestWriteTLEN(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+	if err := New(mp3Path).Apply(strings.NewReader("title: Episode\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	d, err := (&mp3Tagger{audioSource: audioSource{path: mp3Path}}).duration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := tag.GetTextFrame("TLEN").Text
+	tag.Close()
+	if want := strconv.FormatInt(d.Milliseconds(), 10); got != want {
+		t.Errorf("TLEN = %q, want %q", got, want)
+	}
+}
+
+func TestWriteBrokenStream(t *testing.T) {
+	// A broken stream doesn't block tagging
+	broken := createDummyMP3(t, time.Second)
+	f, err := os.OpenFile(broken, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0xFF, 0xFB, 0x90, 0x00, 0x00}) // a truncated frame
+	f.Close()
+
+	c := New(broken)
+	if err := c.Apply(strings.NewReader("title: Episode\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	tag, err := id3v2.Open(broken, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tag.GetTextFrame("TLEN").Text; got != "" {
+		t.Errorf("TLEN = %q, want none", got)
+	}
+	tag.Close()
+	if err := c.Apply(strings.NewReader("title: Episode\nchapters:\n- start: 0:00\n  end: 0:00.500\n  title: Intro\n"), true); err != nil {
+		t.Errorf("Apply with an explicit chapter end failed: %v", err)
+	}
+
+	// The last chapter ends shortly after its start without the duration
+	if err := c.Apply(strings.NewReader("title: Episode\nchapters:\n- 0:00 Intro\n- 0:00.200 Main\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	tag, err = id3v2.Open(broken, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+	frames := tag.GetFrames("CHAP")
+	if len(frames) != 2 {
+		t.Fatalf("got %d CHAP frames, want 2", len(frames))
+	}
+	if got, want := frames[1].(id3v2.ChapterFrame).EndTime, 1200*time.Millisecond; got != want {
+		t.Errorf("end of the last chapter = %s, want %s", got, want)
+	}
+	metadata, err := c.Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if end := metadata.Chapters[1].End; end != 0 {
+		t.Errorf("end of the last chapter should be inferred, got %s", end)
+	}
+}
@@ -0,0 +1,841 @@
+package chape
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// mp4Tagger reads and writes iTunes style metadata (moov/udta/meta/ilst) of MP4 audio files
+type mp4Tagger struct {
+	audioSource
+	// downloadRetries is the number of retries of downloading artwork
+	downloadRetries int
+	// maxArtworkSize is the maximum size of the artwork to embed, zero if unlimited
+	maxArtworkSize int
+
+	moov *mp4Atom // cache of readMoov
+}
+
+// mp4Atom represents an MP4 atom (box). Container atoms hold children, others hold raw data.
+type mp4Atom struct {
+	typ      string
+	data     []byte // body of a leaf atom
+	prefix   []byte // bytes preceding the children of a container (e.g. version/flags of "meta")
+	children []*mp4Atom
+}
+
+// mp4Containers lists the atoms whose bodies are a sequence of child atoms
+var mp4Containers = map[string]bool{
+	"moov": true, "trak": true, "mdia": true, "minf": true, "stbl": true,
+	"udta": true, "meta": true, "ilst": true, "edts": true, "dinf": true,
+}
+
+// Freeform ("----") item names are stored as "----:<mean>:<name>"
+const mp4FreeformPrefix = "----:"
+
+// iTunes metadata item names not covered by textFrameMappings
+const (
+	mp4ItemDate              = "\xa9day"
+	mp4ItemComment           = "\xa9cmt"
+	mp4ItemLyrics            = "\xa9lyr"
+	mp4ItemCover             = "covr"
+	mp4ItemMovementCount     = "\xa9mvc"
+	mp4ItemChapeSource       = mp4FreeformPrefix + "com.apple.iTunes:" + ArtworkSourceName
+	mp4ItemLegacyChapeSource = mp4FreeformPrefix + "com.apple.iTunes:" + legacyArtworkSourceName
+)
+
+// Well-known data types of iTunes metadata
+// cf. https://developer.apple.com/documentation/quicktime-file-format/well-known_types
+const (
+	mp4DataTypeImplicit = 0
+	mp4DataTypeUTF8     = 1
+	mp4DataTypeGIF      = 12
+	mp4DataTypeJPEG     = 13
+	mp4DataTypePNG      = 14
+	mp4DataTypeInt      = 21
+	mp4DataTypeBMP      = 27
+)
+
+// parseMP4Atoms parses a sequence of atoms from data
+func parseMP4Atoms(data []byte) ([]*mp4Atom, error) {
+	var atoms []*mp4Atom
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, errors.New("truncated atom header")
+		}
+		size := uint64(binary.BigEndian.Uint32(data[0:4]))
+		typ := string(data[4:8])
+		headerSize := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil, errors.New("truncated atom header")
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			headerSize = 16
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			return nil, fmt.Errorf("invalid size of atom %q", typ)
+		}
+		atom, err := newMP4Atom(typ, data[headerSize:size])
+		if err != nil {
+			return nil, err
+		}
+		atoms = append(atoms, atom)
+		data = data[size:]
+	}
+	return atoms, nil
+}
+
+// newMP4Atom creates an atom from its type and body, parsing children of container atoms
+func newMP4Atom(typ string, body []byte) (*mp4Atom, error) {
+	if !mp4Containers[typ] {
+		return &mp4Atom{typ: typ, data: body}, nil
+	}
+	atom := &mp4Atom{typ: typ}
+	if typ == "meta" && len(body) >= 12 && string(body[8:12]) == "hdlr" {
+		// "meta" is a full box with version and flags (QuickTime style "meta" is not)
+		atom.prefix = body[:4]
+		body = body[4:]
+	}
+	children, err := parseMP4Atoms(body)
+	if err != nil {
+		return nil, err
+	}
+	atom.children = children
+	return atom, nil
+}
+
+// bytes serializes the atom including its header
+func (a *mp4Atom) bytes() []byte {
+	var body []byte
+	if a.children == nil && !mp4Containers[a.typ] {
+		body = a.data
+	} else {
+		body = append(body, a.prefix...)
+		for _, c := range a.children {
+			body = append(body, c.bytes()...)
+		}
+	}
+	buf := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(8+len(body)))
+	copy(buf[4:8], a.typ)
+	return append(buf, body...)
+}
+
+// child returns the first child atom of the type
+func (a *mp4Atom) child(typ string) *mp4Atom {
+	for _, c := range a.children {
+		if c.typ == typ {
+			return c
+		}
+	}
+	return nil
+}
+
+// find returns the descendant atom at the path
+func (a *mp4Atom) find(path ...string) *mp4Atom {
+	cur := a
+	for _, typ := range path {
+		if cur = cur.child(typ); cur == nil {
+			return nil
+		}
+	}
+	return cur
+}
+
+// ensureChild returns the first child atom of the type, appending a new one if missing
+func (a *mp4Atom) ensureChild(typ string) *mp4Atom {
+	if c := a.child(typ); c != nil {
+		return c
+	}
+	c := &mp4Atom{typ: typ}
+	a.children = append(a.children, c)
+	return c
+}
+
+// mp4TopLevelAtom represents the position of a top-level atom in the file
+type mp4TopLevelAtom struct {
+	typ    string
+	offset int64
+	size   int64
+}
+
+// scanMP4TopLevelAtoms lists the top-level atoms of the file without reading their bodies
+func scanMP4TopLevelAtoms(f io.ReadSeeker) ([]mp4TopLevelAtom, error) {
+	fileSize, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	var atoms []mp4TopLevelAtom
+	header := make([]byte, 16)
+	for offset := int64(0); offset < fileSize; {
+		if err := readAt(f, header[:8], offset); err != nil {
+			return nil, fmt.Errorf("failed to read atom header: %w", err)
+		}
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		typ := string(header[4:8])
+		switch size {
+		case 0:
+			size = fileSize - offset
+		case 1:
+			if err := readAt(f, header[8:16], offset+8); err != nil {
+				return nil, fmt.Errorf("failed to read atom header: %w", err)
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+		if size < 8 || offset+size > fileSize {
+			return nil, fmt.Errorf("invalid size of atom %q", typ)
+		}
+		atoms = append(atoms, mp4TopLevelAtom{typ: typ, offset: offset, size: size})
+		offset += size
+	}
+	return atoms, nil
+}
+
+// readAt reads len(b) bytes of r at offset
+func readAt(r io.ReadSeeker, b []byte, offset int64) error {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.ReadFull(r, b)
+	return err
+}
+
+// readMoov reads and parses the moov atom of the file
+func readMoov(f io.ReadSeeker) (*mp4Atom, []mp4TopLevelAtom, error) {
+	topLevel, err := scanMP4TopLevelAtoms(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, a := range topLevel {
+		if a.typ != "moov" {
+			continue
+		}
+		buf := make([]byte, a.size)
+		if err := readAt(f, buf, a.offset); err != nil {
+			return nil, nil, fmt.Errorf("failed to read moov atom: %w", err)
+		}
+		atoms, err := parseMP4Atoms(buf)
+		if err != nil {
+			return nil, nil, err
+		}
+		return atoms[0], topLevel, nil
+	}
+	return nil, nil, errors.New("moov atom not found")
+}
+
+// readMoov reads the moov atom of the MP4 file. The atom is read once and reused by later calls.
+func (t *mp4Tagger) readMoov() (*mp4Atom, error) {
+	if t.moov != nil {
+		return t.moov, nil
+	}
+	f, err := t.open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	moov, _, err := readMoov(f)
+	if err != nil {
+		return nil, err
+	}
+	t.moov = moov
+	return moov, nil
+}
+
+// mp4Item represents the value of an iTunes metadata item
+type mp4Item struct {
+	dataType uint32
+	value    []byte
+}
+
+// ilstItems returns the metadata items keyed by atom type (or "----:<mean>:<name>" for freeform items)
+func ilstItems(moov *mp4Atom) map[string]mp4Item {
+	items := map[string]mp4Item{}
+	ilst := moov.find("udta", "meta", "ilst")
+	if ilst == nil {
+		return items
+	}
+	for _, item := range ilst.children {
+		if err := item.parseChildren(); err != nil {
+			continue
+		}
+		name := item.typ
+		if name == "----" {
+			name = mp4FreeformName(item)
+		}
+		if data := item.child("data"); data != nil && len(data.data) >= 8 {
+			items[name] = mp4Item{
+				dataType: binary.BigEndian.Uint32(data.data[0:4]) & 0xFFFFFF,
+				value:    data.data[8:],
+			}
+		}
+	}
+	return items
+}
+
+// parseChildren parses the body of an ilst item into its children ("data", "mean", "name")
+func (a *mp4Atom) parseChildren() error {
+	if a.children != nil {
+		return nil
+	}
+	children, err := parseMP4Atoms(a.data)
+	if err != nil {
+		return err
+	}
+	a.children = children
+	return nil
+}
+
+// mp4FreeformName returns "----:<mean>:<name>" for a freeform item
+func mp4FreeformName(item *mp4Atom) string {
+	var mean, name string
+	if a := item.child("mean"); a != nil && len(a.data) >= 4 {
+		mean = string(a.data[4:])
+	}
+	if a := item.child("name"); a != nil && len(a.data) >= 4 {
+		name = string(a.data[4:])
+	}
+	return mp4FreeformPrefix + mean + ":" + name
+}
+
+// newMP4Item creates an ilst item atom
+func newMP4Item(name string, dataType uint32, value []byte) *mp4Atom {
+	data := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint32(data[0:4], dataType)
+	data = append(data, value...)
+
+	item := &mp4Atom{typ: name}
+	if freeform, ok := strings.CutPrefix(name, mp4FreeformPrefix); ok {
+		mean, n, _ := strings.Cut(freeform, ":")
+		item.typ = "----"
+		item.children = append(item.children,
+			&mp4Atom{typ: "mean", data: append(make([]byte, 4), mean...)},
+			&mp4Atom{typ: "name", data: append(make([]byte, 4), n...)})
+	}
+	item.children = append(item.children, &mp4Atom{typ: "data", data: data})
+	return item
+}
+
+// encodeMP4Item converts a string value into an ilst item value for the item name
+func encodeMP4Item(name, value string) (uint32, []byte) {
+	switch name {
+	case "trkn", "disk":
+		current, total := parseNumberPair(value)
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint16(v[2:4], uint16(current))
+		binary.BigEndian.PutUint16(v[4:6], uint16(total))
+		if name == "disk" {
+			v = v[:6]
+		}
+		return mp4DataTypeImplicit, v
+	case "tmpo":
+		// tmpo holds an integer, so fractional BPM is rounded
+		bpm, _ := strconv.ParseFloat(value, 64)
+		v := make([]byte, 2)
+		binary.BigEndian.PutUint16(v, uint16(math.Round(bpm)))
+		return mp4DataTypeInt, v
+	case "\xa9mvi":
+		// The movement count is held in another item, mp4ItemMovementCount
+		current, _ := parseNumberPair(value)
+		v := make([]byte, 2)
+		binary.BigEndian.PutUint16(v, uint16(current))
+		return mp4DataTypeInt, v
+	case "cpil", "pcst":
+		if value == "1" {
+			return mp4DataTypeInt, []byte{1}
+		}
+		return mp4DataTypeInt, []byte{0}
+	}
+	return mp4DataTypeUTF8, []byte(value)
+}
+
+// decodeMP4Item converts an ilst item value into a string value for the item name
+func decodeMP4Item(name string, item mp4Item) string {
+	switch name {
+	case "trkn", "disk":
+		if len(item.value) < 6 {
+			return ""
+		}
+		n := &NumberInSet{
+			Current: int(binary.BigEndian.Uint16(item.value[2:4])),
+			Total:   int(binary.BigEndian.Uint16(item.value[4:6])),
+		}
+		return n.String()
+	case "tmpo", "\xa9mvi":
+		if len(item.value) < 2 {
+			return ""
+		}
+		return strconv.Itoa(int(binary.BigEndian.Uint16(item.value[0:2])))
+	case "cpil", "pcst":
+		if len(item.value) < 1 || item.value[0] == 0 {
+			return ""
+		}
+		return "1"
+	}
+	return string(item.value)
+}
+
+// readMetadata extracts metadata from the iTunes metadata items and the Nero chapter list
+func (t *mp4Tagger) readMetadata() (*Metadata, error) {
+	moov, err := t.readMoov()
+	if err != nil {
+		return nil, err
+	}
+	items := ilstItems(moov)
+
+	var metadata = &Metadata{}
+	for _, mapping := range textFrameMappings {
+		if item, ok := items[mapping.mp4Item]; ok {
+			if v := decodeMP4Item(mapping.mp4Item, item); v != "" {
+				mapping.setValue(metadata, v)
+			}
+		}
+	}
+
+	if item, ok := items[mp4ItemMovementCount]; ok && metadata.MovementNumber != nil && len(item.value) >= 2 {
+		metadata.MovementNumber.Total = int(binary.BigEndian.Uint16(item.value[0:2]))
+	}
+	if item, ok := items[mp4ItemDate]; ok {
+		var ts Timestamp
+		if err := ts.UnmarshalYAML(item.value); err == nil {
+			metadata.Date = &ts
+		}
+	}
+	metadata.Comment = string(items[mp4ItemComment].value)
+	metadata.Lyrics = string(items[mp4ItemLyrics].value)
+
+	if cover, ok := items[mp4ItemCover]; ok && len(cover.value) > 0 {
+		// Always prefer CHAPE_SOURCE if available, regardless of file existence
+		if chapeSource := cmp.Or(string(items[mp4ItemChapeSource].value),
+			string(items[mp4ItemLegacyChapeSource].value)); chapeSource != "" {
+			metadata.Artwork.Src = chapeSource
+		} else {
+			metadata.Artwork.Src = mp4CoverDataURI(cover)
+		}
+	}
+
+	if chpl := moov.find("udta", "chpl"); chpl != nil {
+		chapters, err := parseChpl(chpl.data)
+		if err != nil {
+			return nil, err
+		}
+		metadata.Chapters = chapters
+	}
+
+	return metadata, nil
+}
+
+// mp4CoverDataURI returns the cover item as data URI
+func mp4CoverDataURI(cover mp4Item) string {
+	var mimeType string
+	switch cover.dataType {
+	case mp4DataTypeJPEG:
+		mimeType = "image/jpeg"
+	case mp4DataTypePNG:
+		mimeType = "image/png"
+	case mp4DataTypeGIF:
+		mimeType = "image/gif"
+	case mp4DataTypeBMP:
+		mimeType = "image/bmp"
+	default:
+		mimeType = http.DetectContentType(cover.value)
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(cover.value))
+}
+
+// mp4CoverDataType returns the well-known data type for the image MIME type
+func mp4CoverDataType(mimeType string) uint32 {
+	switch mimeType {
+	case "image/jpeg":
+		return mp4DataTypeJPEG
+	case "image/png":
+		return mp4DataTypePNG
+	case "image/gif":
+		return mp4DataTypeGIF
+	case "image/bmp":
+		return mp4DataTypeBMP
+	default:
+		return mp4DataTypeImplicit
+	}
+}
+
+// chplTimescale is the unit of Nero chapter start times (100 nanoseconds)
+const chplTimescale = 100 * time.Nanosecond
+
+// parseChpl parses the body of a Nero chapter list (chpl) atom
+func parseChpl(data []byte) ([]*Chapter, error) {
+	if len(data) < 5 {
+		return nil, errors.New("truncated chpl atom")
+	}
+	version := data[0]
+	data = data[4:]
+	if version > 0 {
+		if len(data) < 4 {
+			return nil, errors.New("truncated chpl atom")
+		}
+		data = data[4:] // reserved
+	}
+	count := int(data[0])
+	data = data[1:]
+
+	var chapters []*Chapter
+	for range count {
+		if len(data) < 9 {
+			return nil, errors.New("truncated chpl entry")
+		}
+		start := time.Duration(binary.BigEndian.Uint64(data[0:8])) * chplTimescale
+		titleLen := int(data[8])
+		data = data[9:]
+		if len(data) < titleLen {
+			return nil, errors.New("truncated chpl entry")
+		}
+		chapters = append(chapters, &Chapter{
+			Title: string(data[:titleLen]),
+			// Nero chapters are stored in 100ns units; keep millisecond precision as YAML does
+			Start: start.Truncate(time.Millisecond),
+		})
+		data = data[titleLen:]
+	}
+	return chapters, nil
+}
+
+// chplBytes returns the body of a Nero chapter list (chpl) atom
+func chplBytes(chapters []*Chapter) ([]byte, error) {
+	if len(chapters) > 255 {
+		return nil, fmt.Errorf("too many chapters for chpl: %d", len(chapters))
+	}
+	var buf bytes.Buffer
+	buf.Write([]byte{1, 0, 0, 0}) // version 1, flags
+	buf.Write([]byte{0, 0, 0, 0}) // reserved
+	buf.WriteByte(byte(len(chapters)))
+	for _, chapter := range chapters {
+		binary.Write(&buf, binary.BigEndian, uint64(chapter.Start/chplTimescale))
+		title := chapter.Title
+		if len(title) > 255 {
+			// Cut at a character boundary to keep the title valid UTF-8
+			n := 255
+			for n > 0 && !utf8.RuneStart(title[n]) {
+				n--
+			}
+			title = title[:n]
+		}
+		buf.WriteByte(byte(len(title)))
+		buf.WriteString(title)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeMetadata writes metadata to the MP4 file.
+// Only the metadata items that chape manages are replaced; other items are kept as is.
+func (t *mp4Tagger) writeMetadata(ctx context.Context, metadata *Metadata) error {
+	file, err := os.Open(t.path)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	moov, topLevel, err := readMoov(file)
+	if err != nil {
+		return err
+	}
+
+	udta := moov.ensureChild("udta")
+	ilst := ensureIlst(moov)
+
+	// Delete managed items and add them again
+	managed := map[string]bool{
+		mp4ItemDate:          true,
+		mp4ItemComment:       true,
+		mp4ItemLyrics:        true,
+		mp4ItemMovementCount: true,
+	}
+	for _, mapping := range textFrameMappings {
+		managed[mapping.mp4Item] = true
+	}
+	deleteMP4Items(ilst, managed)
+	addItem := func(name string, dataType uint32, value []byte) {
+		ilst.children = append(ilst.children, newMP4Item(name, dataType, value))
+	}
+
+	for _, mapping := range textFrameMappings {
+		if v := joinMultiValues(mapping.getValue(metadata)); v != "" {
+			dataType, value := encodeMP4Item(mapping.mp4Item, v)
+			addItem(mapping.mp4Item, dataType, value)
+		}
+	}
+	// Like MVIN, the count is written only with the movement number
+	if n := metadata.MovementNumber; n != nil && n.Current > 0 && n.Total > 0 {
+		v := make([]byte, 2)
+		binary.BigEndian.PutUint16(v, uint16(n.Total))
+		addItem(mp4ItemMovementCount, mp4DataTypeInt, v)
+	}
+	if metadata.Date != nil && !metadata.Date.Time.IsZero() {
+		addItem(mp4ItemDate, mp4DataTypeUTF8, []byte(metadata.Date.String()))
+	}
+	if metadata.Comment != "" {
+		addItem(mp4ItemComment, mp4DataTypeUTF8, []byte(metadata.Comment))
+	}
+	if metadata.Lyrics != "" {
+		addItem(mp4ItemLyrics, mp4DataTypeUTF8, []byte(metadata.Lyrics))
+	}
+
+	if metadata.Artwork.Src != "" {
+		pictureData, mimeType, err := parseArtwork(ctx, metadata.Artwork.Src, t.downloadRetries)
+		if err != nil {
+			return fmt.Errorf("failed to parse artwork: %w", err)
+		}
+		if err := checkArtworkSize(pictureData, t.maxArtworkSize); err != nil {
+			return err
+		}
+		if len(pictureData) > 0 {
+			deleteMP4Items(ilst, map[string]bool{mp4ItemCover: true})
+			addItem(mp4ItemCover, mp4CoverDataType(mimeType), pictureData)
+
+			// Store artwork source in a freeform item
+			// Skip data URIs as they don't need source tracking
+			if !strings.HasPrefix(metadata.Artwork.Src, "data:") {
+				deleteMP4Items(ilst, map[string]bool{mp4ItemChapeSource: true, mp4ItemLegacyChapeSource: true})
+				addItem(mp4ItemChapeSource, mp4DataTypeUTF8, []byte(metadata.Artwork.Src))
+			}
+		}
+	}
+
+	// Set chapters
+	udta.children = slices.DeleteFunc(udta.children, func(a *mp4Atom) bool { return a.typ == "chpl" })
+	if len(metadata.Chapters) > 0 {
+		chpl, err := chplBytes(metadata.Chapters)
+		if err != nil {
+			return err
+		}
+		udta.children = append(udta.children, &mp4Atom{typ: "chpl", data: chpl})
+	}
+
+	if err := saveMoov(file, moov, topLevel); err != nil {
+		return err
+	}
+	t.moov = nil
+	return nil
+}
+
+// writeArtwork replaces the covr item and the CHAPE_SOURCE item, keeping the other
+// items and atoms as they are
+func (t *mp4Tagger) writeArtwork(ctx context.Context, artwork string) error {
+	pictureData, mimeType, err := loadArtwork(ctx, artwork, t.downloadRetries, t.maxArtworkSize)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(t.path)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	moov, topLevel, err := readMoov(file)
+	if err != nil {
+		return err
+	}
+	ilst := ensureIlst(moov)
+	deleteMP4Items(ilst, map[string]bool{mp4ItemCover: true, mp4ItemChapeSource: true, mp4ItemLegacyChapeSource: true})
+	ilst.children = append(ilst.children, newMP4Item(mp4ItemCover, mp4CoverDataType(mimeType), pictureData))
+	if source := artworkSource(artwork); source != "" {
+		ilst.children = append(ilst.children, newMP4Item(mp4ItemChapeSource, mp4DataTypeUTF8, []byte(source)))
+	}
+
+	if err := saveMoov(file, moov, topLevel); err != nil {
+		return err
+	}
+	t.moov = nil
+	return nil
+}
+
+// ensureIlst returns the ilst atom of moov, creating it and its parents if missing
+func ensureIlst(moov *mp4Atom) *mp4Atom {
+	udta := moov.ensureChild("udta")
+	meta := udta.child("meta")
+	if meta == nil {
+		meta = &mp4Atom{typ: "meta", prefix: make([]byte, 4)}
+		// hdlr: version/flags, pre_defined, handler type "mdir", reserved ("appl" + 8 bytes), empty name
+		hdlr := append(make([]byte, 8), "mdirappl"...)
+		hdlr = append(hdlr, make([]byte, 9)...)
+		meta.children = append(meta.children, &mp4Atom{typ: "hdlr", data: hdlr})
+		udta.children = append(udta.children, meta)
+	}
+	return meta.ensureChild("ilst")
+}
+
+// deleteMP4Items deletes the items of ilst whose names are in del
+func deleteMP4Items(ilst *mp4Atom, del map[string]bool) {
+	ilst.children = slices.DeleteFunc(ilst.children, func(item *mp4Atom) bool {
+		name := item.typ
+		if name == "----" {
+			if err := item.parseChildren(); err != nil {
+				return false
+			}
+			name = mp4FreeformName(item)
+		}
+		return del[name]
+	})
+}
+
+// saveMoov writes the atoms of file with its moov atom replaced by moov to a temporary
+// file and replaces file with it. topLevel is the top-level atoms of file.
+func saveMoov(file *os.File, moov *mp4Atom, topLevel []mp4TopLevelAtom) error {
+	// Media data located after moov moves by the size difference of moov,
+	// so chunk offsets need to be shifted
+	var moovOffset, moovSize int64
+	for _, a := range topLevel {
+		if a.typ == "moov" {
+			moovOffset, moovSize = a.offset, a.size
+			break
+		}
+	}
+	delta := int64(len(moov.bytes())) - moovSize
+	if delta != 0 {
+		for _, a := range topLevel {
+			if a.typ == "mdat" && a.offset > moovOffset {
+				if err := shiftChunkOffsets(moov, delta); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+
+	// Write to a temporary file next to the original and replace it
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	path := file.Name()
+	tmpPath := path + "-chape"
+	tmpFile, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, stat.Mode())
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmpPath)
+	defer tmpFile.Close()
+
+	if _, err := io.Copy(tmpFile, io.NewSectionReader(file, 0, moovOffset)); err != nil {
+		return fmt.Errorf("failed to copy atoms: %w", err)
+	}
+	if _, err := tmpFile.Write(moov.bytes()); err != nil {
+		return fmt.Errorf("failed to write moov atom: %w", err)
+	}
+	rest := moovOffset + moovSize
+	if _, err := io.Copy(tmpFile, io.NewSectionReader(file, rest, stat.Size()-rest)); err != nil {
+		return fmt.Errorf("failed to copy atoms: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	file.Close()
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+	return nil
+}
+
+// shiftChunkOffsets adds delta to all chunk offsets (stco/co64) of all tracks
+func shiftChunkOffsets(moov *mp4Atom, delta int64) error {
+	for _, trak := range moov.children {
+		if trak.typ != "trak" {
+			continue
+		}
+		stbl := trak.find("mdia", "minf", "stbl")
+		if stbl == nil {
+			continue
+		}
+		for _, a := range stbl.children {
+			switch a.typ {
+			case "stco":
+				if len(a.data) < 8 {
+					return errors.New("truncated stco atom")
+				}
+				count := int(binary.BigEndian.Uint32(a.data[4:8]))
+				if len(a.data) < 8+count*4 {
+					return errors.New("truncated stco atom")
+				}
+				for i := range count {
+					p := a.data[8+i*4:]
+					offset := int64(binary.BigEndian.Uint32(p)) + delta
+					if offset < 0 || offset > 0xFFFFFFFF {
+						return errors.New("chunk offset overflows stco")
+					}
+					binary.BigEndian.PutUint32(p, uint32(offset))
+				}
+			case "co64":
+				if len(a.data) < 8 {
+					return errors.New("truncated co64 atom")
+				}
+				count := int(binary.BigEndian.Uint32(a.data[4:8]))
+				if len(a.data) < 8+count*8 {
+					return errors.New("truncated co64 atom")
+				}
+				for i := range count {
+					p := a.data[8+i*8:]
+					binary.BigEndian.PutUint64(p, uint64(int64(binary.BigEndian.Uint64(p))+delta))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// embeddedArtwork extracts embedded artwork from MP4 as data URI
+func (t *mp4Tagger) embeddedArtwork() (string, error) {
+	moov, err := t.readMoov()
+	if err != nil {
+		return "", err
+	}
+	if cover, ok := ilstItems(moov)[mp4ItemCover]; ok && len(cover.value) > 0 {
+		return mp4CoverDataURI(cover), nil
+	}
+	return "", nil
+}
+
+// duration calculates the duration of the MP4 file from the mvhd atom
+func (t *mp4Tagger) duration() (time.Duration, error) {
+	moov, err := t.readMoov()
+	if err != nil {
+		return 0, err
+	}
+	mvhd := moov.child("mvhd")
+	if mvhd == nil || len(mvhd.data) < 20 {
+		return 0, errors.New("mvhd atom not found")
+	}
+	var timescale, duration uint64
+	if mvhd.data[0] == 1 {
+		// version 1: 64-bit creation/modification time and duration
+		if len(mvhd.data) < 32 {
+			return 0, errors.New("truncated mvhd atom")
+		}
+		timescale = uint64(binary.BigEndian.Uint32(mvhd.data[20:24]))
+		duration = binary.BigEndian.Uint64(mvhd.data[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(mvhd.data[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(mvhd.data[16:20]))
+	}
+	if timescale == 0 {
+		return 0, errors.New("invalid timescale in mvhd")
+	}
+	return durationOf(duration, timescale), nil
+}
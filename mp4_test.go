@@ -0,0 +1,22 @@
+package chape
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChplBytesTitle(t *testing.T) {
+	// 86 characters of 3 bytes are 258 bytes, beyond the 255 bytes of a chpl title
+	title := strings.Repeat("章", 86)
+	b, err := chplBytes([]*Chapter{{Title: title}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// version and flags, reserved, count, start (8 bytes), title length and the title
+	size := int(b[17])
+	got := string(b[18 : 18+size])
+	if size != 255 || got != strings.Repeat("章", 85) || !utf8.ValidString(got) {
+		t.Errorf("title is cut to %d bytes: %q", size, got)
+	}
+}
@@ -0,0 +1,55 @@
+package chape
+
+import (
+	"github.com/bogem/id3v2/v2"
+)
+
+// musicBrainzUFIDOwner is the owner of the UFID frame holding the MusicBrainz recording ID
+const musicBrainzUFIDOwner = "http://musicbrainz.org"
+
+// Descriptions of the TXXX frames holding MusicBrainz IDs, as MusicBrainz Picard writes them
+// cf. https://picard-docs.musicbrainz.org/en/appendices/tag_mapping.html
+const (
+	musicBrainzArtistIDDescription  = "MusicBrainz Artist Id"
+	musicBrainzReleaseIDDescription = "MusicBrainz Album Id"
+)
+
+// isMusicBrainzDescription reports whether the TXXX frame with the description holds
+// a MusicBrainz ID managed by Metadata fields rather than Custom
+func isMusicBrainzDescription(description string) bool {
+	return description == musicBrainzArtistIDDescription || description == musicBrainzReleaseIDDescription
+}
+
+// readMusicBrainzIDs reads the MusicBrainz IDs from the UFID and TXXX frames
+func readMusicBrainzIDs(id3tag *id3v2.Tag, metadata *Metadata) {
+	for _, frame := range id3tag.GetFrames("UFID") {
+		if ufid, ok := frame.(id3v2.UFIDFrame); ok && ufid.OwnerIdentifier == musicBrainzUFIDOwner {
+			metadata.MusicBrainzRecordingID = string(ufid.Identifier)
+		}
+	}
+	metadata.MusicBrainzArtistID = getUserDefinedTextFrame(id3tag, musicBrainzArtistIDDescription)
+	metadata.MusicBrainzReleaseID = getUserDefinedTextFrame(id3tag, musicBrainzReleaseIDDescription)
+}
+
+// applyMusicBrainzIDs writes the MusicBrainz IDs to the UFID and TXXX frames.
+// UFID frames of other owners are kept.
+func applyMusicBrainzIDs(id3tag *id3v2.Tag, metadata *Metadata) {
+	var others []id3v2.UFIDFrame
+	for _, frame := range id3tag.GetFrames("UFID") {
+		if ufid, ok := frame.(id3v2.UFIDFrame); ok && ufid.OwnerIdentifier != musicBrainzUFIDOwner {
+			others = append(others, ufid)
+		}
+	}
+	id3tag.DeleteFrames("UFID")
+	for _, ufid := range others {
+		id3tag.AddUFIDFrame(ufid)
+	}
+	if metadata.MusicBrainzRecordingID != "" {
+		id3tag.AddUFIDFrame(id3v2.UFIDFrame{
+			OwnerIdentifier: musicBrainzUFIDOwner,
+			Identifier:      []byte(metadata.MusicBrainzRecordingID),
+		})
+	}
+	setUserDefinedTextFrame(id3tag, musicBrainzArtistIDDescription, metadata.MusicBrainzArtistID)
+	setUserDefinedTextFrame(id3tag, musicBrainzReleaseIDDescription, metadata.MusicBrainzReleaseID)
+}
@@ -0,0 +1,83 @@
+package chape
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+func TestApplyMusicBrainzIDs(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+
+	// Seed the tag as MusicBrainz Picard does, along with a UFID of another owner
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.SetTitle("Song")
+	tag.AddUFIDFrame(id3v2.UFIDFrame{OwnerIdentifier: musicBrainzUFIDOwner, Identifier: []byte("rec-1")})
+	tag.AddUFIDFrame(id3v2.UFIDFrame{OwnerIdentifier: "http://example.com", Identifier: []byte("other")})
+	tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+		Encoding: id3v2.EncodingUTF8, Description: musicBrainzArtistIDDescription, Value: "artist-1",
+	})
+	if err := tag.Save(); err != nil {
+		t.Fatal(err)
+	}
+	tag.Close()
+
+	metadata, err := New(mp3Path).Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if metadata.MusicBrainzRecordingID != "rec-1" || metadata.MusicBrainzArtistID != "artist-1" {
+		t.Errorf("unexpected MusicBrainz IDs: %q, %q", metadata.MusicBrainzRecordingID, metadata.MusicBrainzArtistID)
+	}
+	if len(metadata.Custom) != 0 {
+		t.Errorf("MusicBrainz IDs leaked into custom: %v", metadata.Custom)
+	}
+
+	yamlContent := `title: Song
+musicBrainzRecordingId: rec-2
+musicBrainzArtistId: artist-1
+musicBrainzReleaseId: release-1
+`
+	if err := New(mp3Path).Apply(strings.NewReader(yamlContent), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	tag, err = id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	owners := map[string]string{}
+	for _, frame := range tag.GetFrames("UFID") {
+		ufid := frame.(id3v2.UFIDFrame)
+		if _, ok := owners[ufid.OwnerIdentifier]; ok {
+			t.Errorf("duplicated UFID frame of %s", ufid.OwnerIdentifier)
+		}
+		owners[ufid.OwnerIdentifier] = string(ufid.Identifier)
+	}
+	release := getUserDefinedTextFrame(tag, musicBrainzReleaseIDDescription)
+	tag.Close()
+	if owners[musicBrainzUFIDOwner] != "rec-2" || owners["http://example.com"] != "other" {
+		t.Errorf("unexpected UFID frames: %v", owners)
+	}
+	if release != "release-1" {
+		t.Errorf("release ID = %q", release)
+	}
+
+	// Removing the recording ID removes only the MusicBrainz UFID frame
+	if err := New(mp3Path).Apply(strings.NewReader("title: Song\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	tag, err = id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+	if frames := tag.GetFrames("UFID"); len(frames) != 1 || frames[0].(id3v2.UFIDFrame).OwnerIdentifier != "http://example.com" {
+		t.Errorf("unexpected UFID frames: %v", frames)
+	}
+}
@@ -0,0 +1,67 @@
+package chape
+
+import (
+	"math/big"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+// defaultRatingEmail is the POPM email identifier used unless configured, as MediaMonkey writes
+const defaultRatingEmail = "no@email"
+
+// readRating returns the rating of the POPM frame whose email is ratingEmail. If there's
+// no such frame, the first non-zero rating of other frames is returned.
+func readRating(id3tag *id3v2.Tag, ratingEmail string) int {
+	var rating int
+	for _, frame := range id3tag.GetFrames("POPM") {
+		pf, ok := frame.(id3v2.PopularimeterFrame)
+		if !ok {
+			continue
+		}
+		if pf.Email == ratingEmail {
+			return int(pf.Rating)
+		}
+		if rating == 0 {
+			rating = int(pf.Rating)
+		}
+	}
+	return rating
+}
+
+// applyRating writes the rating to the POPM frame whose email is ratingEmail, keeping its
+// play counter. A zero rating removes the frame and clears the ratings of other frames,
+// which readRating would fall back to, while their play counters are kept.
+func applyRating(id3tag *id3v2.Tag, rating int, ratingEmail string) {
+	var frames []id3v2.PopularimeterFrame
+	counter := new(big.Int)
+	for _, frame := range id3tag.GetFrames("POPM") {
+		pf, ok := frame.(id3v2.PopularimeterFrame)
+		if !ok {
+			continue
+		}
+		if pf.Email == ratingEmail {
+			if pf.Counter != nil {
+				counter = pf.Counter
+			}
+			continue
+		}
+		if rating == 0 {
+			pf.Rating = 0
+		}
+		if pf.Counter == nil {
+			pf.Counter = new(big.Int)
+		}
+		frames = append(frames, pf)
+	}
+	id3tag.DeleteFrames("POPM")
+	for _, pf := range frames {
+		id3tag.AddFrame("POPM", pf)
+	}
+	if rating > 0 {
+		id3tag.AddFrame("POPM", id3v2.PopularimeterFrame{
+			Email:   ratingEmail,
+			Rating:  uint8(rating),
+			Counter: counter,
+		})
+	}
+}
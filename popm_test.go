@@ -0,0 +1,80 @@
+package chape
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+func TestApplyRating(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+
+	// Seed the tag with a rating of another player
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.SetTitle("Song")
+	tag.AddFrame("POPM", id3v2.PopularimeterFrame{Email: "other@example.com", Rating: 64, Counter: big.NewInt(7)})
+	if err := tag.Save(); err != nil {
+		t.Fatal(err)
+	}
+	tag.Close()
+
+	readPOPM := func() map[string]id3v2.PopularimeterFrame {
+		t.Helper()
+		tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tag.Close()
+		frames := map[string]id3v2.PopularimeterFrame{}
+		for _, frame := range tag.GetFrames("POPM") {
+			pf := frame.(id3v2.PopularimeterFrame)
+			frames[pf.Email] = pf
+		}
+		return frames
+	}
+
+	// Falls back to the rating of another email
+	metadata, err := New(mp3Path).Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if metadata.Rating != 64 {
+		t.Errorf("Rating = %d, want 64", metadata.Rating)
+	}
+
+	c := New(mp3Path)
+	c.RatingEmail = "me@example.com"
+	if err := c.Apply(strings.NewReader("title: Song\nrating: 255\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	frames := readPOPM()
+	if len(frames) != 2 || frames["me@example.com"].Rating != 255 || frames["other@example.com"].Rating != 64 {
+		t.Errorf("unexpected POPM frames: %v", frames)
+	}
+	// The frame of the configured email is preferred
+	if metadata, err = c.Metadata(); err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if metadata.Rating != 255 {
+		t.Errorf("Rating = %d, want 255", metadata.Rating)
+	}
+
+	// Zero removes the frame and clears the other ratings, keeping the play counter
+	if err := c.Apply(strings.NewReader("title: Song\n"), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	frames = readPOPM()
+	if pf, ok := frames["other@example.com"]; len(frames) != 1 || !ok || pf.Rating != 0 || pf.Counter.Int64() != 7 {
+		t.Errorf("unexpected POPM frames: %v", frames)
+	}
+
+	if err := c.Apply(strings.NewReader("title: Song\nrating: 256\n"), true); err == nil {
+		t.Error("expected an error for rating out of range")
+	}
+}
@@ -0,0 +1,65 @@
+package chape
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+// prunableFrameIDs is the standard ID3v2.3 and ID3v2.4 text frames that Prune deletes when
+// empty. Frames chape doesn't know, e.g. of other taggers, are kept as they are.
+var prunableFrameIDs = func() map[string]bool {
+	ids := map[string]bool{}
+	for _, common := range []map[string]string{id3v2.V23CommonIDs, id3v2.V24CommonIDs} {
+		for _, id := range common {
+			if strings.HasPrefix(id, "T") && id != "TXXX" {
+				ids[id] = true
+			}
+		}
+	}
+	return ids
+}()
+
+// emptyTextFrameIDs returns the sorted IDs of the prunable text frames of the tag whose
+// text is empty or whitespace only
+func emptyTextFrameIDs(id3tag *id3v2.Tag) []string {
+	var ids []string
+	for id, frames := range id3tag.AllFrames() {
+		if !prunableFrameIDs[id] {
+			continue
+		}
+		for _, frame := range frames {
+			if tf, ok := frame.(id3v2.TextFrame); ok && strings.TrimSpace(strings.ReplaceAll(tf.Text, multiValueNUL, "")) == "" {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// pruneEmptyTextFrames deletes the empty text frames of the tag and returns their IDs
+func pruneEmptyTextFrames(id3tag *id3v2.Tag) []string {
+	ids := emptyTextFrameIDs(id3tag)
+	for _, id := range ids {
+		id3tag.DeleteFrames(id)
+	}
+	return ids
+}
+
+// emptyFrameIDs returns the IDs of the empty text frames that writing with prune deletes
+func (t *mp3Tagger) emptyFrameIDs() ([]string, error) {
+	file, err := t.open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+	id3tag, _, _, err := readID3Tag(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tag: %w", err)
+	}
+	return emptyTextFrameIDs(id3tag), nil
+}
@@ -0,0 +1,224 @@
+package chape
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// Patterns of the string forms of the custom YAML types
+const (
+	numberInSetPattern = `^\d+(/\d+)?$`
+	timestampPattern   = `^\d{4}(-\d{2}(-\d{2}(T\d{2}(:\d{2}(:\d{2})?)?(Z|[+-]\d{2}:?\d{2})?)?)?)?$`
+	chapterTimePattern = `^\d+:\d{2}(:\d{2})?(\.\d{1,3})?$`
+	chapterPattern     = `^(\d+:\d{2}(:\d{2})?(\.\d{1,3})?)(-\d+:\d{2}(:\d{2})?(\.\d{1,3})?)?(\s.*)?$`
+	syncedLyricPattern = `^\d+:\d{2}(:\d{2})?(\.\d{1,3})?(\s.*)?$`
+	languagePattern    = `^[a-z]{3}$`
+)
+
+// jsonSchema is a JSON Schema (draft-07) document or subschema
+type jsonSchema struct {
+	Schema               string            `json:"$schema,omitempty"`
+	Title                string            `json:"title,omitempty"`
+	Description          string            `json:"description,omitempty"`
+	Type                 string            `json:"type,omitempty"`
+	Pattern              string            `json:"pattern,omitempty"`
+	Format               string            `json:"format,omitempty"`
+	Enum                 []string          `json:"enum,omitempty"`
+	Minimum              *float64          `json:"minimum,omitempty"`
+	Maximum              *float64          `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64          `json:"exclusiveMinimum,omitempty"`
+	OneOf                []*jsonSchema     `json:"oneOf,omitempty"`
+	Items                *jsonSchema       `json:"items,omitempty"`
+	Properties           *schemaProperties `json:"properties,omitempty"`
+	Required             []string          `json:"required,omitempty"`
+	AdditionalProperties any               `json:"additionalProperties,omitempty"`
+}
+
+// schemaProperties is the properties of an object schema, marshaled in the field order
+type schemaProperties struct {
+	names   []string
+	schemas map[string]*jsonSchema
+}
+
+// MarshalJSON marshals the properties to a JSON object keeping their order
+func (p *schemaProperties) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, name := range p.names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := marshalJSONNoEscape(p.schemas[name])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// schemaOverrides refines the schemas of the properties that their types can't tell,
+// keyed by the YAML key
+var schemaOverrides = map[string]func(*jsonSchema){
+	"rating": func(s *jsonSchema) {
+		s.Minimum, s.Maximum = ptr(0.0), ptr(255.0)
+	},
+	"frameLanguage": func(s *jsonSchema) { s.Pattern = languagePattern },
+	"feedUrl":       func(s *jsonSchema) { s.Format = "uri" },
+	"url":           func(s *jsonSchema) { s.Format = "uri" },
+}
+
+// ptr returns a pointer to v
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// WriteSchema writes the JSON Schema of the YAML metadata format to output. It's generated
+// from Metadata, so that it covers all the fields.
+func WriteSchema(output io.Writer) error {
+	schema := structSchema(reflect.TypeFor[Metadata]())
+	schema.Schema = "http://json-schema.org/draft-07/schema#"
+	schema.Title = "Chape Metadata Schema"
+	schema.Description = "JSON Schema for chape metadata YAML format used for audio files including music and podcasts"
+	// Fields of Metadata are all optional
+	schema.Required = nil
+
+	enc := json.NewEncoder(output)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(schema)
+}
+
+// structSchema returns the object schema of the struct type from its yaml tags.
+// The fields without omitempty are required.
+func structSchema(t reflect.Type) *jsonSchema {
+	props := &schemaProperties{schemas: map[string]*jsonSchema{}}
+	var required []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		s := typeSchema(f.Type)
+		s.Title = fieldTitle(f.Name)
+		if override, ok := schemaOverrides[name]; ok {
+			override(s)
+		}
+		props.names = append(props.names, name)
+		props.schemas[name] = s
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	return &jsonSchema{
+		Type:                 "object",
+		Properties:           props,
+		Required:             required,
+		AdditionalProperties: false,
+	}
+}
+
+// typeSchema returns the schema of the type, in the YAML form of the custom types
+func typeSchema(t reflect.Type) *jsonSchema {
+	switch t {
+	case reflect.TypeFor[Values]():
+		return &jsonSchema{OneOf: []*jsonSchema{
+			{Type: "string"},
+			{Type: "array", Items: &jsonSchema{Type: "string"}},
+		}}
+	case reflect.TypeFor[*NumberInSet]():
+		return &jsonSchema{
+			Type:        "string",
+			Pattern:     numberInSetPattern,
+			Description: `Number like "3" or "3/10" (current/total)`,
+		}
+	case reflect.TypeFor[*Timestamp]():
+		return &jsonSchema{
+			Type:    "string",
+			Pattern: timestampPattern,
+			Description: "ID3v2 timestamp (subset of ISO 8601) of the precision of yyyy, yyyy-MM, yyyy-MM-dd, " +
+				"yyyy-MM-ddTHH, yyyy-MM-ddTHH:mm or yyyy-MM-ddTHH:mm:ss in UTC. " +
+				`A timezone offset after the time, e.g. "+09:00", is converted to UTC.`,
+		}
+	case reflect.TypeFor[BPM]():
+		return &jsonSchema{Type: "number", ExclusiveMinimum: ptr(0.0)}
+	case reflect.TypeFor[*Chapter]():
+		mapping := structSchema(reflect.TypeFor[chapterMapping]())
+		mapping.Description = "Chapter with its own image, URL or description"
+		for _, name := range []string{"start", "end"} {
+			mapping.Properties.schemas[name].Pattern = chapterTimePattern
+		}
+		return &jsonSchema{OneOf: []*jsonSchema{{
+			Type:        "string",
+			Pattern:     chapterPattern,
+			Description: `Chapter in WebVTT format: "M:SS Title", "H:MM:SS Title" or "M:SS.mmm Title", optionally with an explicit end as "M:SS-M:SS Title"`,
+		}, mapping}}
+	case reflect.TypeFor[Artwork]():
+		mapping := structSchema(reflect.TypeFor[Artwork]())
+		mapping.Description = "Artwork with the picture type and description of the embedded picture (MP3 and FLAC)"
+		mapping.Properties.schemas["type"].Enum = pictureTypeNames
+		return &jsonSchema{OneOf: []*jsonSchema{{Type: "string"}, mapping}}
+	case reflect.TypeFor[*SyncedLyric]():
+		return &jsonSchema{
+			Type:        "string",
+			Pattern:     syncedLyricPattern,
+			Description: `Line shown from the time: "M:SS Text", "H:MM:SS Text" or "M:SS.mmm Text"`,
+		}
+	case reflect.TypeFor[*Comment]():
+		s := structSchema(reflect.TypeFor[Comment]())
+		s.Properties.schemas["language"].Pattern = languagePattern
+		return s
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Uint, reflect.Uint64, reflect.Uint32:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Float64, reflect.Float32:
+		return &jsonSchema{Type: "number"}
+	case reflect.Slice:
+		return &jsonSchema{Type: "array", Items: typeSchema(t.Elem())}
+	case reflect.Map:
+		return &jsonSchema{Type: "object", AdditionalProperties: typeSchema(t.Elem())}
+	case reflect.Pointer:
+		return typeSchema(t.Elem())
+	case reflect.Struct:
+		return structSchema(t)
+	}
+	return &jsonSchema{}
+}
+
+// fieldTitle returns the title of the field from its name, e.g. "Album Artist" for
+// AlbumArtist and "Feed URL" for FeedURL
+func fieldTitle(name string) string {
+	runes := []rune(name)
+	var sb strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) &&
+			(unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			sb.WriteByte(' ')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
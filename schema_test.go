@@ -0,0 +1,66 @@
+package chape
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+func TestWriteSchema(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteSchema(&buf); err != nil {
+		t.Fatalf("WriteSchema failed: %v", err)
+	}
+	var generated struct {
+		Properties map[string]struct {
+			Type    string `json:"type"`
+			Pattern string `json:"pattern"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &generated); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if p := generated.Properties["track"]; p.Type != "string" || p.Pattern != numberInSetPattern {
+		t.Errorf("unexpected schema of track: %+v", p)
+	}
+	if p := generated.Properties["bpm"]; p.Type != "number" {
+		t.Errorf("unexpected schema of bpm: %+v", p)
+	}
+
+	// The patterns accept what the custom types marshal to
+	for pattern, values := range map[string][]string{
+		timestampPattern:   {"2024", "2024-08", "2024-08-15", "2024-08-15T14", "2024-08-15T14:30", "2024-08-15T14:30:05", "2024-08-15T14:30+09:00"},
+		chapterPattern:     {"0:00 Intro", "1:02:03.500 Main", "0:00-1:30 Opening", "2:00"},
+		numberInSetPattern: {"3", "3/10"},
+	} {
+		re := regexp.MustCompile(pattern)
+		for _, v := range values {
+			if !re.MatchString(v) {
+				t.Errorf("%q doesn't match %s", v, pattern)
+			}
+		}
+	}
+
+	// schema.yaml has the same properties as the generated schema
+	b, err := os.ReadFile("schema.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var handwritten struct {
+		Properties map[string]any `yaml:"properties"`
+	}
+	if err := yaml.Unmarshal(b, &handwritten); err != nil {
+		t.Fatal(err)
+	}
+	got := slices.Sorted(maps.Keys(handwritten.Properties))
+	want := slices.Sorted(maps.Keys(generated.Properties))
+	if !slices.Equal(got, want) {
+		t.Errorf("properties of schema.yaml = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,59 @@
+package chape
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ApplyStream reads the audio from audio instead of the audio file, applies the metadata read
+// from input as Apply does and writes the tagged audio to output, so that the audio can be
+// piped through chape. The audio is buffered to a temporary file next to output, which is
+// moved into place once tagged. The format of the audio is determined by the extension of
+// output. There's no confirmation as audio may be stdin; with DryRun, the diff is shown and
+// output isn't written.
+func (c *Chape) ApplyStream(ctx context.Context, audio io.Reader, output string, input io.Reader, format ...Format) error {
+	if output == "" {
+		return errors.New("no output file specified")
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(output), "."+filepath.Base(output)+"-chape-*"+filepath.Ext(output))
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+
+	// CreateTemp creates the file only readable by the owner
+	err = tmpFile.Chmod(0644)
+	if err == nil {
+		_, err = io.Copy(tmpFile, audio)
+	}
+	if cerr := tmpFile.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to buffer audio: %w", err)
+	}
+
+	sc := *c
+	sc.audio = tmpPath
+	sc.reader = nil
+	sc.Backup = false
+	newMetadata, err := sc.readInput(input, format...)
+	if err != nil {
+		return err
+	}
+	if err := sc.write(ctx, newMetadata, true, false); err != nil {
+		return err
+	}
+	if c.DryRun {
+		return nil
+	}
+	if err := os.Rename(tmpPath, output); err != nil {
+		return fmt.Errorf("failed to write %s: %w", output, err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package chape
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Categories of metadata that Strip can keep
+const (
+	StripKeepChapters = "chapters"
+	StripKeepArtwork  = "artwork"
+)
+
+// Strip removes the entire ID3v2 tag of the MP3 file, including frames chape doesn't manage.
+// The audio frames are kept untouched. keep is the categories of metadata to preserve,
+// StripKeepChapters and StripKeepArtwork; the artwork is kept as the embedded picture.
+// Unless yes is true, it shows the diff and asks for confirmation before writing as Write does.
+func (c *Chape) Strip(yes bool, keep ...string) error {
+	if ext := strings.ToLower(filepath.Ext(c.audio)); ext != ".mp3" {
+		return fmt.Errorf("strip is only supported for MP3 files: %s", c.audio)
+	}
+	var keepChapters, keepArtwork bool
+	for _, k := range keep {
+		switch k {
+		case StripKeepChapters:
+			keepChapters = true
+		case StripKeepArtwork:
+			keepArtwork = true
+		default:
+			return fmt.Errorf("unknown category to keep %q: must be %s or %s", k, StripKeepChapters, StripKeepArtwork)
+		}
+	}
+
+	currentMetadata, t, err := c.readMetadata()
+	if err != nil {
+		return fmt.Errorf("failed to read current metadata: %w", err)
+	}
+	newMetadata := &Metadata{}
+	if keepChapters {
+		newMetadata.Chapters = currentMetadata.Chapters
+	}
+	if keepArtwork {
+		newMetadata.Artwork = currentMetadata.Artwork
+		if newMetadata.Artwork.Src, err = t.embeddedArtwork(); err != nil {
+			return fmt.Errorf("failed to get embedded artwork: %w", err)
+		}
+	}
+	sc := *c
+	sc.strip = true
+	return sc.write(context.Background(), newMetadata, yes, false)
+}
@@ -0,0 +1,80 @@
+package chape
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+const testPNGDataURI = "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mP8/5+hHgAHggJ/PchI7wAAAABJRU5ErkJggg=="
+
+func TestStrip(t *testing.T) {
+	mp3Path := createDummyMP3(t, time.Second)
+	b, err := os.ReadFile(mp3Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The audio follows the empty ID3v2 header
+	audio := b[10:]
+	input := "title: Episode\nartist: Host\nartwork: " + testPNGDataURI + "\nchapters:\n- 0:00 Opening\n"
+	if err := New(mp3Path).Apply(strings.NewReader(input), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.AddFrame("PRIV", id3v2.UnknownFrame{Body: []byte("com.example\x00private data")})
+	if err := tag.Save(); err != nil {
+		t.Fatal(err)
+	}
+	tag.Close()
+
+	t.Run("keep chapters and artwork", func(t *testing.T) {
+		if err := New(mp3Path).Strip(true, StripKeepChapters, StripKeepArtwork); err != nil {
+			t.Fatalf("Strip failed: %v", err)
+		}
+		metadata, err := New(mp3Path).Metadata()
+		if err != nil {
+			t.Fatalf("Metadata failed: %v", err)
+		}
+		if metadata.Title != "" || len(metadata.Artist) != 0 {
+			t.Errorf("text frames should be removed: %+v", metadata)
+		}
+		if metadata.Artwork.Src != testPNGDataURI {
+			t.Errorf("artwork should be kept: %q", metadata.Artwork.Src)
+		}
+		if len(metadata.Chapters) != 1 || metadata.Chapters[0].Title != "Opening" {
+			t.Errorf("chapters should be kept: %v", metadata.Chapters)
+		}
+		tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tag.Close()
+		if len(tag.GetFrames("PRIV")) != 0 {
+			t.Error("unknown frames should be removed")
+		}
+	})
+
+	t.Run("all", func(t *testing.T) {
+		if err := New(mp3Path).Strip(true); err != nil {
+			t.Fatalf("Strip failed: %v", err)
+		}
+		got, err := os.ReadFile(mp3Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, audio) {
+			t.Errorf("only the audio should be left: got %d bytes, want %d", len(got), len(audio))
+		}
+	})
+
+	if err := New(mp3Path).Strip(true, "lyrics"); err == nil {
+		t.Error("expected an error for an unknown category")
+	}
+}
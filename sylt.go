@@ -0,0 +1,108 @@
+package chape
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+const (
+	syltTimestampMilliseconds = 2 // absolute time in milliseconds
+	syltContentLyrics         = 1
+)
+
+// syltFrame represents a SYLT (synchronised lyrics/text) frame, which id3v2 doesn't support.
+// Only time stamps in milliseconds are supported, not in MPEG frames.
+// cf. https://id3.org/id3v2.4.0-frames
+type syltFrame struct {
+	encoding    id3v2.Encoding
+	language    string
+	contentType byte
+	descriptor  string
+	lines       []*SyncedLyric
+}
+
+// parseSYLTFrame parses the body of a SYLT frame
+func parseSYLTFrame(body []byte) (*syltFrame, error) {
+	if len(body) < 6 {
+		return nil, errors.New("invalid SYLT frame")
+	}
+	if body[4] != syltTimestampMilliseconds {
+		return nil, fmt.Errorf("unsupported SYLT time stamp format: %d", body[4])
+	}
+	enc := body[0]
+	f := &syltFrame{
+		language:    string(body[1:4]),
+		contentType: body[5],
+	}
+	var rest []byte
+	f.descriptor, rest = cutID3Text(enc, body[6:])
+	for len(rest) > 0 {
+		var text string
+		text, rest = cutID3Text(enc, rest)
+		if len(rest) < 4 {
+			return nil, errors.New("invalid SYLT frame: truncated time stamp")
+		}
+		f.lines = append(f.lines, &SyncedLyric{
+			Time: time.Duration(binary.BigEndian.Uint32(rest)) * time.Millisecond,
+			Text: text,
+		})
+		rest = rest[4:]
+	}
+	return f, nil
+}
+
+// bytes returns the body of the SYLT frame
+func (f *syltFrame) bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(f.encoding.Key)
+	lang := []byte("XXX")
+	copy(lang, f.language)
+	buf.Write(lang)
+	buf.WriteByte(syltTimestampMilliseconds)
+	buf.WriteByte(f.contentType)
+	buf.Write(encodeID3Text(f.encoding.Key, f.descriptor))
+	buf.Write(id3Terminator(f.encoding.Key))
+	for _, l := range f.lines {
+		buf.Write(encodeID3Text(f.encoding.Key, l.Text))
+		buf.Write(id3Terminator(f.encoding.Key))
+		binary.Write(&buf, binary.BigEndian, uint32(l.Time.Milliseconds()))
+	}
+	return buf.Bytes()
+}
+
+// Size implements id3v2.Framer
+func (f *syltFrame) Size() int {
+	return len(f.bytes())
+}
+
+// UniqueIdentifier implements id3v2.Framer
+func (f *syltFrame) UniqueIdentifier() string {
+	return f.language + f.descriptor
+}
+
+// WriteTo implements id3v2.Framer
+func (f *syltFrame) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(f.bytes())
+	return int64(n), err
+}
+
+// readSyncedLyrics returns the lines of the first SYLT frame of the tag that can be parsed
+func readSyncedLyrics(id3tag *id3v2.Tag) []*SyncedLyric {
+	for _, frame := range id3tag.GetFrames("SYLT") {
+		switch fr := frame.(type) {
+		case *syltFrame:
+			return fr.lines
+		case id3v2.UnknownFrame:
+			if f, err := parseSYLTFrame(fr.Body); err == nil {
+				return f.lines
+			}
+		}
+	}
+	return nil
+}
@@ -1,16 +1,53 @@
 package chape
 
 import (
+	"math"
 	"reflect"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/bogem/id3v2/v2"
 )
 
+const (
+	// multiValueNUL separates multiple values in ID3v2.4 text frames
+	multiValueNUL = "\x00"
+	// multiValueSeparator joins multiple values in the formats holding only one,
+	// i.e. ID3v2.3, MP4 and FFmpeg metadata
+	multiValueSeparator = "; "
+)
+
+// originalYearFrameID is the ID3v2.3 frame of the original release year, which is
+// TDOR in ID3v2.4
+const originalYearFrameID = "TORY"
+
+// joinMultiValues joins the values separated by NUL with multiValueSeparator
+func joinMultiValues(v string) string {
+	return strings.ReplaceAll(v, multiValueNUL, multiValueSeparator)
+}
+
+// id3FrameType is the type of an ID3v2 frame mapped by tagMapping
+type id3FrameType int
+
+const (
+	id3TextFrame id3FrameType = iota // text frame with the encoding
+	id3URLFrame                      // URL frame in ISO-8859-1 without the encoding, e.g. WFED
+	id3FlagFrame                     // frame whose presence is the flag, e.g. PCST
+)
+
 // tagMapping represents the mapping between ID3v2 tags and Metadata fields
 type tagMapping struct {
 	tagID     string // ID3v2 tag ID (e.g., "TIT2")
+	vorbisKey string // Vorbis comment field name (e.g., "TITLE")
+	mp4Item   string // iTunes metadata item name (e.g., "\xa9nam")
+	ffmetaKey string // FFmpeg metadata key (e.g., "title")
 	fieldName string // Metadata struct field name (e.g., "Title")
+	// multiValued means the field can have multiple values, joined with NUL by getValue
+	// and split by setValue as TCON of ID3v2.4 holds them
+	multiValued bool
+	// frameType is the type of the ID3v2 frame, which is a text frame by default
+	frameType id3FrameType
 	// Optional custom converter functions (if nil, use reflection)
 	toString   func(*Metadata) string  // Custom function to convert field to string
 	fromString func(*Metadata, string) // Custom function to set field from string
@@ -18,18 +55,78 @@ type tagMapping struct {
 
 // textFrameMappings defines all text frame mappings
 var textFrameMappings = []tagMapping{
-	{tagID: "TIT2", fieldName: "Title"},
-	{tagID: "TIT3", fieldName: "Subtitle"},
-	{tagID: "TPE1", fieldName: "Artist"},
-	{tagID: "TALB", fieldName: "Album"},
-	{tagID: "TPE2", fieldName: "AlbumArtist"},
-	{tagID: "TIT1", fieldName: "Grouping"},
-	{tagID: "TCON", fieldName: "Genre"},
-	{tagID: "TCOM", fieldName: "Composer"},
-	{tagID: "TPUB", fieldName: "Publisher"},
-	{tagID: "TCOP", fieldName: "Copyright"},
+	{tagID: "TIT2", vorbisKey: "TITLE", mp4Item: "\xa9nam", ffmetaKey: "title", fieldName: "Title"},
+	{tagID: "TIT3", vorbisKey: "SUBTITLE", mp4Item: "----:com.apple.iTunes:SUBTITLE", ffmetaKey: "TIT3", fieldName: "Subtitle"},
+	{tagID: "TPE1", vorbisKey: "ARTIST", mp4Item: "\xa9ART", ffmetaKey: "artist", fieldName: "Artist", multiValued: true},
+	{tagID: "TALB", vorbisKey: "ALBUM", mp4Item: "\xa9alb", ffmetaKey: "album", fieldName: "Album"},
+	{tagID: "TPE2", vorbisKey: "ALBUMARTIST", mp4Item: "aART", ffmetaKey: "album_artist", fieldName: "AlbumArtist"},
+	{tagID: "TIT1", vorbisKey: "GROUPING", mp4Item: "\xa9grp", ffmetaKey: "grouping", fieldName: "Grouping"},
+	{tagID: "TSOT", vorbisKey: "TITLESORT", mp4Item: "sonm", ffmetaKey: "title-sort", fieldName: "TitleSort"},
+	{tagID: "TSOP", vorbisKey: "ARTISTSORT", mp4Item: "soar", ffmetaKey: "artist-sort", fieldName: "ArtistSort"},
+	{tagID: "TSOA", vorbisKey: "ALBUMSORT", mp4Item: "soal", ffmetaKey: "album-sort", fieldName: "AlbumSort"},
+	{tagID: "TSO2", vorbisKey: "ALBUMARTISTSORT", mp4Item: "soaa", ffmetaKey: "album_artist-sort", fieldName: "AlbumArtistSort"},
+	{
+		tagID:     "TDOR",
+		vorbisKey: "ORIGINALDATE",
+		mp4Item:   "----:com.apple.iTunes:ORIGINALDATE",
+		ffmetaKey: "TDOR",
+		fieldName: "OriginalDate",
+		toString: func(m *Metadata) string {
+			if m.OriginalDate == nil {
+				return ""
+			}
+			return m.OriginalDate.String()
+		},
+		fromString: func(m *Metadata, v string) {
+			var ts Timestamp
+			if err := ts.UnmarshalYAML([]byte(v)); err == nil && !ts.Time.IsZero() {
+				m.OriginalDate = &ts
+			}
+		},
+	},
+	{tagID: "TOAL", vorbisKey: "ORIGINALALBUM", mp4Item: "----:com.apple.iTunes:ORIGINALALBUM", ffmetaKey: "TOAL", fieldName: "OriginalAlbum"},
+	{tagID: "TOPE", vorbisKey: "ORIGINALARTIST", mp4Item: "----:com.apple.iTunes:ORIGINALARTIST", ffmetaKey: "TOPE", fieldName: "OriginalArtist", multiValued: true},
+	{tagID: "TOLY", vorbisKey: "ORIGINALLYRICIST", mp4Item: "----:com.apple.iTunes:ORIGINALLYRICIST", ffmetaKey: "TOLY", fieldName: "OriginalLyricist", multiValued: true},
+	{
+		tagID:       "TCON",
+		vorbisKey:   "GENRE",
+		mp4Item:     "\xa9gen",
+		ffmetaKey:   "genre",
+		fieldName:   "Genre",
+		multiValued: true,
+		fromString: func(m *Metadata, v string) {
+			m.Genre = normalizeGenre(v)
+		},
+	},
+	{tagID: "GRP1", vorbisKey: "WORK", mp4Item: "\xa9wrk", ffmetaKey: "work", fieldName: "Work"},
+	{tagID: "MVNM", vorbisKey: "MOVEMENTNAME", mp4Item: "\xa9mvn", ffmetaKey: "movementname", fieldName: "Movement"},
+	{
+		tagID:     "MVIN",
+		vorbisKey: "MOVEMENT",
+		mp4Item:   "\xa9mvi",
+		ffmetaKey: "movement",
+		fieldName: "MovementNumber",
+		toString: func(m *Metadata) string {
+			return m.MovementNumber.String()
+		},
+		fromString: func(m *Metadata, v string) {
+			current, total := parseNumberPair(v)
+			if current > 0 {
+				m.MovementNumber = &NumberInSet{Current: current, Total: total}
+			}
+		},
+	},
+	{tagID: "TCOM", vorbisKey: "COMPOSER", mp4Item: "\xa9wrt", ffmetaKey: "composer", fieldName: "Composer", multiValued: true},
+	{tagID: "TEXT", vorbisKey: "LYRICIST", mp4Item: "----:com.apple.iTunes:LYRICIST", ffmetaKey: "TEXT", fieldName: "Lyricist", multiValued: true},
+	{tagID: "TPUB", vorbisKey: "PUBLISHER", mp4Item: "----:com.apple.iTunes:LABEL", ffmetaKey: "publisher", fieldName: "Publisher"},
+	{tagID: "TCOP", vorbisKey: "COPYRIGHT", mp4Item: "cprt", ffmetaKey: "copyright", fieldName: "Copyright"},
+	{tagID: "TSRC", vorbisKey: "ISRC", mp4Item: "----:com.apple.iTunes:ISRC", ffmetaKey: "TSRC", fieldName: "ISRC"},
+	{tagID: "TMED", vorbisKey: "MEDIA", mp4Item: "----:com.apple.iTunes:MEDIA", ffmetaKey: "TMED", fieldName: "MediaType"},
 	{
 		tagID:     "TLAN",
+		vorbisKey: "LANGUAGE",
+		mp4Item:   "----:com.apple.iTunes:LANGUAGE",
+		ffmetaKey: "language",
 		fieldName: "Language",
 		toString: func(m *Metadata) string {
 			return normalizeLanguageCode(m.Language)
@@ -37,21 +134,45 @@ var textFrameMappings = []tagMapping{
 	},
 	{
 		tagID:     "TBPM",
+		vorbisKey: "BPM",
+		mp4Item:   "tmpo",
+		ffmetaKey: "TBPM",
 		fieldName: "BPM",
 		toString: func(m *Metadata) string {
 			if m.BPM == 0 {
 				return ""
 			}
-			return strconv.Itoa(m.BPM)
+			return formatBPM(float64(m.BPM))
 		},
 		fromString: func(m *Metadata, v string) {
-			if bpm, err := strconv.Atoi(v); err == nil {
-				m.BPM = bpm
+			if bpm, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && bpm > 0 {
+				m.BPM = BPM(bpm)
 			}
 		},
 	},
+	{tagID: "TKEY", vorbisKey: "INITIALKEY", mp4Item: "----:com.apple.iTunes:initialkey", ffmetaKey: "TKEY", fieldName: "InitialKey"},
+	{tagID: "TMOO", vorbisKey: "MOOD", mp4Item: "----:com.apple.iTunes:MOOD", ffmetaKey: "TMOO", fieldName: "Mood"},
+	{
+		tagID:     "TCMP",
+		vorbisKey: "COMPILATION",
+		mp4Item:   "cpil",
+		ffmetaKey: "compilation",
+		fieldName: "Compilation",
+		toString: func(m *Metadata) string {
+			if !m.Compilation {
+				return ""
+			}
+			return "1"
+		},
+		fromString: func(m *Metadata, v string) {
+			m.Compilation = strings.TrimSpace(v) == "1"
+		},
+	},
 	{
 		tagID:     "TRCK",
+		vorbisKey: "TRACKNUMBER",
+		mp4Item:   "trkn",
+		ffmetaKey: "track",
 		fieldName: "Track",
 		toString: func(m *Metadata) string {
 			return m.Track.String()
@@ -65,6 +186,9 @@ var textFrameMappings = []tagMapping{
 	},
 	{
 		tagID:     "TPOS",
+		vorbisKey: "DISCNUMBER",
+		mp4Item:   "disk",
+		ffmetaKey: "disc",
 		fieldName: "Disc",
 		toString: func(m *Metadata) string {
 			return m.Disc.String()
@@ -76,6 +200,52 @@ var textFrameMappings = []tagMapping{
 			}
 		},
 	},
+	{tagID: "TDES", vorbisKey: "PODCASTDESC", mp4Item: "desc", ffmetaKey: "description", fieldName: "Description"},
+	{tagID: "TGID", vorbisKey: "PODCASTID", mp4Item: "egid", ffmetaKey: "episode_uid", fieldName: "PodcastID"},
+	{tagID: "WFED", vorbisKey: "PODCASTURL", mp4Item: "purl", ffmetaKey: "podcast_url", fieldName: "FeedURL", frameType: id3URLFrame},
+	{tagID: "TCAT", vorbisKey: "PODCASTCATEGORY", mp4Item: "catg", ffmetaKey: "category", fieldName: "Category"},
+	{
+		tagID:     "TKWD",
+		vorbisKey: "PODCASTKEYWORDS",
+		mp4Item:   "keyw",
+		ffmetaKey: "keywords",
+		fieldName: "Keywords",
+		// Keywords are comma separated as iTunes does
+		toString: func(m *Metadata) string {
+			return strings.Join(m.Keywords, ",")
+		},
+		fromString: func(m *Metadata, v string) {
+			m.Keywords = nil
+			for _, k := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == 0 }) {
+				if k = strings.TrimSpace(k); k != "" {
+					m.Keywords = append(m.Keywords, k)
+				}
+			}
+		},
+	},
+	{tagID: "TENC", vorbisKey: "ENCODEDBY", mp4Item: "----:com.apple.iTunes:ENCODEDBY", ffmetaKey: "encoded_by", fieldName: "EncodedBy"},
+	{tagID: "TSSE", vorbisKey: "ENCODERSETTINGS", mp4Item: "\xa9too", ffmetaKey: "encoder", fieldName: "EncoderSettings"},
+	{tagID: "WOAR", vorbisKey: "WEBSITE", mp4Item: "----:com.apple.iTunes:WEBSITE", ffmetaKey: "WOAR", fieldName: "ArtistURL", frameType: id3URLFrame},
+	{tagID: "WCOP", vorbisKey: "LICENSE", mp4Item: "----:com.apple.iTunes:LICENSE", ffmetaKey: "WCOP", fieldName: "CopyrightURL", frameType: id3URLFrame},
+	{tagID: "WPUB", vorbisKey: "PUBLISHERURL", mp4Item: "----:com.apple.iTunes:PUBLISHERURL", ffmetaKey: "WPUB", fieldName: "PublisherURL", frameType: id3URLFrame},
+	{tagID: "WOAF", vorbisKey: "AUDIOFILEURL", mp4Item: "----:com.apple.iTunes:AUDIOFILEURL", ffmetaKey: "WOAF", fieldName: "AudioFileURL", frameType: id3URLFrame},
+	{
+		tagID:     "PCST",
+		vorbisKey: "PODCAST",
+		mp4Item:   "pcst",
+		ffmetaKey: "podcast",
+		fieldName: "Podcast",
+		frameType: id3FlagFrame,
+		toString: func(m *Metadata) string {
+			if !m.Podcast {
+				return ""
+			}
+			return "1"
+		},
+		fromString: func(m *Metadata, v string) {
+			m.Podcast = strings.TrimSpace(v) == "1"
+		},
+	},
 }
 
 // getValue gets the string value from Metadata for a mapping
@@ -99,37 +269,81 @@ func (tm *tagMapping) setValue(metadata *Metadata, value string) {
 	setFieldString(metadata, tm.fieldName, value)
 }
 
-// getFieldString gets string field value from Metadata using reflection
+// getFieldString gets string field value from Metadata using reflection.
+// Values are joined with NUL.
 func getFieldString(metadata *Metadata, fieldName string) string {
 	r := reflect.ValueOf(metadata).Elem()
 	f := r.FieldByName(fieldName)
-	if f.IsValid() && f.Kind() == reflect.String {
+	if !f.IsValid() {
+		return ""
+	}
+	if v, ok := f.Interface().(Values); ok {
+		return strings.Join(v, multiValueNUL)
+	}
+	if f.Kind() == reflect.String {
 		return f.String()
 	}
 	return ""
 }
 
-// setFieldString sets string field value to Metadata using reflection
+// setFieldString sets string field value to Metadata using reflection.
+// Values are split by NUL.
 func setFieldString(metadata *Metadata, fieldName string, value string) {
 	r := reflect.ValueOf(metadata).Elem()
 	f := r.FieldByName(fieldName)
-	if f.IsValid() && f.CanSet() && f.Kind() == reflect.String {
+	if !f.IsValid() || !f.CanSet() {
+		return
+	}
+	if _, ok := f.Interface().(Values); ok {
+		values := slices.DeleteFunc(strings.Split(value, multiValueNUL), func(s string) bool { return s == "" })
+		f.Set(reflect.ValueOf(Values(values)))
+		return
+	}
+	if f.Kind() == reflect.String {
 		f.SetString(value)
 	}
 }
 
+// formatBPM formats BPM without trailing zeros, e.g. "128" or "128.5"
+func formatBPM(bpm float64) string {
+	return strconv.FormatFloat(bpm, 'f', -1, 64)
+}
+
 // applyTextFrames applies text frames to ID3 tag
 func applyTextFrames(id3tag *id3v2.Tag, metadata *Metadata) {
+	// TORY of ID3v2.3 is replaced with TDOR or rewritten from it
+	id3tag.DeleteFrames(originalYearFrameID)
 	for _, mapping := range textFrameMappings {
 		// Delete existing frame
 		id3tag.DeleteFrames(mapping.tagID)
 
-		// Get value from metadata
+		// Get value from metadata. ID3v2.3 has no multiple values, only integer BPM and
+		// only the year of the original release in TORY.
+		tagID := mapping.tagID
 		value := mapping.getValue(metadata)
+		if id3tag.Version() == 3 {
+			value = joinMultiValues(value)
+			if mapping.tagID == "TBPM" && value != "" {
+				value = formatBPM(math.Round(float64(metadata.BPM)))
+			}
+			if mapping.tagID == "TDOR" && value != "" {
+				tagID = originalYearFrameID
+				value = metadata.OriginalDate.Time.Format("2006")
+			}
+		}
 
 		// Add frame if value is not empty
-		if value != "" {
-			id3tag.AddTextFrame(mapping.tagID, id3v2.EncodingUTF8, value)
+		if value == "" {
+			continue
+		}
+		switch mapping.frameType {
+		case id3URLFrame:
+			id3tag.AddFrame(mapping.tagID, id3v2.UnknownFrame{Body: encodeID3Text(0, value)})
+		case id3FlagFrame:
+			// iTunes writes PCST with four zero bytes
+			id3tag.AddFrame(mapping.tagID, id3v2.UnknownFrame{Body: make([]byte, 4)})
+		default:
+			id3tag.AddTextFrame(tagID, frameEncoding(id3tag.Version(), value), value)
 		}
 	}
 }
@@ -138,9 +352,37 @@ func applyTextFrames(id3tag *id3v2.Tag, metadata *Metadata) {
 func readTextFrames(id3tag *id3v2.Tag, metadata *Metadata) {
 	for _, mapping := range textFrameMappings {
 		if framer := id3tag.GetLastFrame(mapping.tagID); framer != nil {
-			if tf, ok := framer.(id3v2.TextFrame); ok && tf.Text != "" {
-				mapping.setValue(metadata, tf.Text)
+			if mapping.frameType == id3FlagFrame {
+				mapping.setValue(metadata, "1")
+				continue
 			}
+			if text := textFrameText(framer); text != "" {
+				mapping.setValue(metadata, text)
+			}
+		}
+	}
+	if metadata.OriginalDate == nil {
+		if year := id3tag.GetTextFrame(originalYearFrameID).Text; year != "" {
+			metadata.OriginalDate = parseID3v23Date(year, "", "")
 		}
 	}
 }
+
+// textFrameText returns the text of a text or URL frame. The iTunes frames that id3v2
+// doesn't know, e.g. MVNM and WFED, are parsed as unknown frames holding the encoding and
+// the text. URL frames have no encoding, though some taggers write WFED with one.
+func textFrameText(framer id3v2.Framer) string {
+	switch f := framer.(type) {
+	case id3v2.TextFrame:
+		return f.Text
+	case id3v2.UnknownFrame:
+		if len(f.Body) == 0 {
+			return ""
+		}
+		if f.Body[0] > 3 {
+			return strings.TrimRight(decodeID3Text(0, f.Body), "\x00")
+		}
+		return strings.TrimRight(decodeID3Text(f.Body[0], f.Body[1:]), "\x00")
+	}
+	return ""
+}
@@ -0,0 +1,204 @@
+package chape
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/goccy/go-yaml"
+)
+
+// FormatTOML is the TOML format, which holds the same fields as YAML
+const FormatTOML Format = "toml"
+
+// writeTOML writes metadata as TOML. The zero dates are omitted, as omitzero of the
+// encoder doesn't take them as zero.
+func writeTOML(output io.Writer, metadata *Metadata) error {
+	m := *metadata
+	m.clearZeroDates()
+	enc := toml.NewEncoder(output)
+	enc.Indent = ""
+	if err := enc.Encode(&m); err != nil {
+		return fmt.Errorf("failed to marshal to TOML: %w", err)
+	}
+	return nil
+}
+
+// decodeTOML decodes metadata from TOML
+func decodeTOML(input io.Reader) (*Metadata, error) {
+	metadata := &Metadata{}
+	if _, err := toml.NewDecoder(input).Decode(metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode TOML: %w", err)
+	}
+	metadata.clearZeroDates()
+	return metadata, nil
+}
+
+// quoteTOML quotes s as a TOML basic string
+func quoteTOML(s string) []byte {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&sb, `\u%04X`, r)
+				continue
+			}
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return []byte(sb.String())
+}
+
+// inlineTableTOML formats the non-empty values as a TOML inline table in the order of keys
+func inlineTableTOML(keys []string, values map[string]string) []byte {
+	var pairs []string
+	for _, k := range keys {
+		if v := values[k]; v != "" {
+			pairs = append(pairs, k+" = "+string(quoteTOML(v)))
+		}
+	}
+	return []byte("{" + strings.Join(pairs, ", ") + "}")
+}
+
+// unmarshalTOMLAsYAML unmarshals the value decoded from TOML with the UnmarshalYAML method
+// of u, so that TOML accepts the same forms as YAML. Strings are passed quoted to be taken
+// as is.
+func unmarshalTOMLAsYAML(v any, u interface{ UnmarshalYAML([]byte) error }) error {
+	if s, ok := v.(string); ok {
+		return u.UnmarshalYAML([]byte(strconv.Quote(s)))
+	}
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return u.UnmarshalYAML(b)
+}
+
+// MarshalTOML marshals values to TOML as a string or an array
+func (v Values) MarshalTOML() ([]byte, error) {
+	if len(v) <= 1 {
+		return quoteTOML(v.String()), nil
+	}
+	quoted := make([]string, len(v))
+	for i, s := range v {
+		quoted[i] = string(quoteTOML(s))
+	}
+	return []byte("[" + strings.Join(quoted, ", ") + "]"), nil
+}
+
+// UnmarshalTOML unmarshals values from TOML as either a string or an array
+func (v *Values) UnmarshalTOML(data any) error {
+	return unmarshalTOMLAsYAML(data, v)
+}
+
+// MarshalTOML marshals number in set to TOML as a string like "1/10"
+func (n *NumberInSet) MarshalTOML() ([]byte, error) {
+	return quoteTOML(n.String()), nil
+}
+
+// UnmarshalTOML unmarshals number in set from TOML, either a string like "1/10" or an integer
+func (n *NumberInSet) UnmarshalTOML(data any) error {
+	return unmarshalTOMLAsYAML(data, n)
+}
+
+// MarshalTOML marshals BPM to TOML without a trailing ".0" for integer values
+func (b BPM) MarshalTOML() ([]byte, error) {
+	return []byte(formatBPM(float64(b))), nil
+}
+
+// MarshalTOML marshals timestamp to TOML as a string of the precision. It has a value
+// receiver, as the encoder takes the MarshalText of the embedded time.Time otherwise.
+func (t Timestamp) MarshalTOML() ([]byte, error) {
+	return quoteTOML(t.String()), nil
+}
+
+// UnmarshalTOML unmarshals timestamp from TOML, either a string or a TOML date-time.
+// A local date or local date-time is taken as UTC as the string form is.
+func (t *Timestamp) UnmarshalTOML(data any) error {
+	if tm, ok := data.(time.Time); ok {
+		switch tm.Location().String() {
+		case "date-local":
+			data = tm.Format("2006-01-02")
+		case "datetime-local":
+			data = tm.Format("2006-01-02T15:04:05")
+		default:
+			data = tm.Format(time.RFC3339)
+		}
+	}
+	return unmarshalTOMLAsYAML(data, t)
+}
+
+// MarshalTOML marshals the chapter to TOML, as the compact "0:00 Title" string unless
+// the chapter has an image, URL or description
+func (c *Chapter) MarshalTOML() ([]byte, error) {
+	if !c.mappingForm() {
+		return quoteTOML(c.String()), nil
+	}
+	values := map[string]string{
+		"start": formatChapterTimePrecision(c.Start, c.precision),
+		"title": c.Title,
+		"image": c.Image,
+		"url":   c.URL,
+
+		"description": c.Description,
+	}
+	if c.End > 0 {
+		values["end"] = formatChapterTimePrecision(c.End, c.precision)
+	}
+	return inlineTableTOML([]string{"start", "end", "title", "image", "url", "description"}, values), nil
+}
+
+// UnmarshalTOML unmarshals the chapter from TOML, either the compact "0:00 Title" string
+// or an inline table with start, end, title, image, url and description keys
+func (c *Chapter) UnmarshalTOML(data any) error {
+	return unmarshalTOMLAsYAML(data, c)
+}
+
+// MarshalTOML marshals the artwork to TOML as a string of the source, or as an inline
+// table with the picture type and description
+func (a Artwork) MarshalTOML() ([]byte, error) {
+	if !a.explicit() {
+		return quoteTOML(a.Src), nil
+	}
+	return inlineTableTOML([]string{"src", "type", "description"}, map[string]string{
+		"src":         a.Src,
+		"type":        a.Type,
+		"description": a.Description,
+	}), nil
+}
+
+// UnmarshalTOML unmarshals the artwork from TOML, either a string of the source or
+// an inline table with src, type and description keys
+func (a *Artwork) UnmarshalTOML(data any) error {
+	return unmarshalTOMLAsYAML(data, a)
+}
+
+// MarshalTOML marshals the line to TOML in the same form as chapters
+func (l *SyncedLyric) MarshalTOML() ([]byte, error) {
+	return quoteTOML(l.String()), nil
+}
+
+// UnmarshalTOML unmarshals the line from "0:12.340 Text"
+func (l *SyncedLyric) UnmarshalTOML(data any) error {
+	return unmarshalTOMLAsYAML(data, l)
+}
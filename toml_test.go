@@ -0,0 +1,102 @@
+package chape
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOMLRoundTrip(t *testing.T) {
+	yamlContent, err := os.ReadFile("testdata/complete.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	yamlContent = append(yamlContent, `syncedLyrics:
+- 0:00.500 Hello "world"
+artwork:
+  src: ./testdata/assets/logo.png
+  type: back
+comments:
+- description: iTunNORM
+  text: " 00000001"
+custom:
+  EPISODE_GUID: abc-123
+`...)
+	src := createDummyMP3(t, time.Second)
+	if err := New(src).Apply(bytes.NewReader(yamlContent), true); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	var want, tomlOut bytes.Buffer
+	if err := New(src).Dump(&want); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	if err := New(src).Dump(&tomlOut, FormatTOML); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	for _, line := range []string{
+		`track = "5/12"`,
+		`date = "2024-03-15"`,
+		`chapters = ["0:00 Welcome", "1:30 Chapter 1: Getting Started",`,
+		`syncedLyrics = ["0:00.500 Hello \"world\""]`,
+		`artwork = {src = "./testdata/assets/logo.png", type = "back"}`,
+	} {
+		if !strings.Contains(tomlOut.String(), line) {
+			t.Errorf("TOML doesn't contain %q:\n%s", line, tomlOut.String())
+		}
+	}
+
+	dst := createDummyMP3(t, time.Second)
+	if err := New(dst).Apply(bytes.NewReader(tomlOut.Bytes()), true, FormatTOML); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	var got bytes.Buffer
+	if err := New(dst).Dump(&got); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("round trip mismatch:\n%s\nwant:\n%s", got.String(), want.String())
+	}
+}
+
+func TestDecodeTOML(t *testing.T) {
+	metadata, err := decodeTOML(strings.NewReader(`title = "Episode"
+artist = ["Alice", "Bob"]
+date = 2024-03-15
+track = 3
+bpm = 120
+chapters = [
+  "0:00 Intro",
+  {start = "1:00", end = "2:00", title = "Main", url = "https://example.com"},
+]
+`))
+	if err != nil {
+		t.Fatalf("decodeTOML failed: %v", err)
+	}
+	if want := (Values{"Alice", "Bob"}); !slices.Equal(metadata.Artist, want) {
+		t.Errorf("artist = %v, want %v", metadata.Artist, want)
+	}
+	if got := metadata.Date.String(); got != "2024-03-15" {
+		t.Errorf("date = %q, want 2024-03-15", got)
+	}
+	if metadata.Track == nil || *metadata.Track != (NumberInSet{Current: 3}) {
+		t.Errorf("track = %v, want 3", metadata.Track)
+	}
+	if metadata.BPM != 120 {
+		t.Errorf("bpm = %v, want 120", metadata.BPM)
+	}
+	want := []*Chapter{
+		{Title: "Intro"},
+		{Title: "Main", Start: time.Minute, End: 2 * time.Minute, URL: "https://example.com"},
+	}
+	if !reflect.DeepEqual(metadata.Chapters, want) {
+		t.Errorf("chapters = %v, want %v", metadata.Chapters, want)
+	}
+
+	if _, err := decodeTOML(strings.NewReader(`artwork = {src = "a.png", type = "unknown"}`)); err == nil {
+		t.Error("expected an error for an unknown picture type")
+	}
+}
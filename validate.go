@@ -0,0 +1,145 @@
+package chape
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Validate checks the metadata of the audio file without modifying it and
+// returns the problems found. An empty result means the metadata is valid.
+func (c *Chape) Validate() ([]string, error) {
+	t, err := c.tagger()
+	if err != nil {
+		return nil, err
+	}
+	// Read chapters without sorting them by start time, so that the ones out of order are reported
+	metadata, err := t.readMetadata()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	audioDuration, err := t.duration()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audio duration: %w", err)
+	}
+	return validateMetadata(metadata, audioDuration), nil
+}
+
+// validateMetadata returns the problems of the metadata, one message per problem
+func validateMetadata(metadata *Metadata, audioDuration time.Duration) []string {
+	var problems []string
+	if metadata.Title == "" {
+		problems = append(problems, "title is empty")
+	}
+	if n := metadata.Track; n != nil && n.Total > 0 && n.Current > n.Total {
+		problems = append(problems, fmt.Sprintf("track number %d exceeds total %d", n.Current, n.Total))
+	}
+	if n := metadata.Disc; n != nil && n.Total > 0 && n.Current > n.Total {
+		problems = append(problems, fmt.Sprintf("disc number %d exceeds total %d", n.Current, n.Total))
+	}
+
+	for i, chapter := range metadata.Chapters {
+		if i > 0 {
+			prev := metadata.Chapters[i-1]
+			switch {
+			case chapter.Start < prev.Start:
+				problems = append(problems, fmt.Sprintf("chapter %q is out of order: it starts before %q", chapter, prev))
+			case chapter.Start == prev.Start:
+				problems = append(problems, fmt.Sprintf("chapter %q has zero length: %q starts at the same time", prev, chapter))
+			}
+		}
+		if chapter.End > 0 && chapter.End <= chapter.Start {
+			problems = append(problems, fmt.Sprintf("chapter %q ends before it starts", chapter))
+		}
+		if startsBeyond(chapter, audioDuration) {
+			problems = append(problems, fmt.Sprintf("chapter %q starts beyond the audio duration %s", chapter,
+				formatChapterTime(audioDuration)))
+		}
+	}
+	return problems
+}
+
+// isValidInitialKey reports whether s is a musical key in the syntax of TKEY: a note A-G,
+// optionally followed by "b" (flat) or "#" (sharp) and "m" (minor), or "o" for off key
+func isValidInitialKey(s string) bool {
+	if s == "o" {
+		return true
+	}
+	if s == "" || s[0] < 'A' || s[0] > 'G' {
+		return false
+	}
+	s = s[1:]
+	if strings.HasPrefix(s, "b") || strings.HasPrefix(s, "#") {
+		s = s[1:]
+	}
+	return s == "" || s == "m"
+}
+
+// isValidISRC reports whether s looks like an ISRC, 12 alphanumerics optionally separated
+// by hyphens. The country and registrant codes aren't checked.
+func isValidISRC(s string) bool {
+	s = strings.ReplaceAll(s, "-", "")
+	if len(s) != 12 {
+		return false
+	}
+	for _, r := range s {
+		if !('0' <= r && r <= '9' || 'A' <= r && r <= 'Z' || 'a' <= r && r <= 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+// lastFrameTolerance is how far a chapter may start beyond the computed audio duration. The
+// duration is counted in whole frames, so the last chapter may start within the last frame,
+// e.g. 1152 samples of MPEG audio at 8kHz (144ms).
+const lastFrameTolerance = 150 * time.Millisecond
+
+// startsBeyond reports whether the chapter starts beyond audioDuration
+func startsBeyond(chapter *Chapter, audioDuration time.Duration) bool {
+	return chapter.Start > audioDuration+lastFrameTolerance
+}
+
+// checkChapterStarts returns an error naming the chapters starting beyond audioDuration,
+// which players can't seek to
+func checkChapterStarts(chapters []*Chapter, audioDuration time.Duration) error {
+	var beyond []string
+	for _, chapter := range chapters {
+		if startsBeyond(chapter, audioDuration) {
+			beyond = append(beyond, fmt.Sprintf("%q", chapter))
+		}
+	}
+	if len(beyond) > 0 {
+		return fmt.Errorf("chapters start beyond the audio duration %s: %s",
+			formatChapterTime(audioDuration), strings.Join(beyond, ", "))
+	}
+	return nil
+}
+
+// compareChapterStart compares chapters by start time
+func compareChapterStart(a, b *Chapter) int {
+	return cmp.Compare(a.Start, b.Start)
+}
+
+// checkChapterOrder returns an error naming the chapters that start before the previous one
+// whose end is inferred from the next start, which would make the CHAP frame end before it
+// starts. Chapters out of order are fine if the previous one has an explicit end, as the
+// chapters of a table of contents. Chapters starting at the same time as the previous one
+// are rejected unless allowDuplicateStarts is true.
+func checkChapterOrder(chapters []*Chapter, allowDuplicateStarts bool) error {
+	var problems []string
+	for i := 1; i < len(chapters); i++ {
+		prev, chapter := chapters[i-1], chapters[i]
+		switch {
+		case chapter.Start < prev.Start && prev.End == 0:
+			problems = append(problems, fmt.Sprintf("%q starts before %q", chapter, prev))
+		case chapter.Start == prev.Start && !allowDuplicateStarts:
+			problems = append(problems, fmt.Sprintf("%q starts at the same time as %q", chapter, prev))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid chapter order: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package chape
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestValidateMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata *Metadata
+		expected []string
+	}{
+		{
+			name: "valid",
+			metadata: &Metadata{
+				Title: "Episode 1",
+				Track: &NumberInSet{Current: 1, Total: 10},
+				Chapters: []*Chapter{
+					{Title: "Intro", Start: 0},
+					{Title: "Main", Start: time.Minute},
+				},
+			},
+		},
+		{
+			name:     "empty title",
+			metadata: &Metadata{},
+			expected: []string{"title is empty"},
+		},
+		{
+			name: "track exceeds total",
+			metadata: &Metadata{
+				Title: "Episode 1",
+				Track: &NumberInSet{Current: 11, Total: 10},
+				Disc:  &NumberInSet{Current: 3}, // no total is fine
+			},
+			expected: []string{"track number 11 exceeds total 10"},
+		},
+		{
+			name: "chapter problems",
+			metadata: &Metadata{
+				Title: "Episode 1",
+				Chapters: []*Chapter{
+					{Title: "Intro", Start: 0},
+					{Title: "Main", Start: 2 * time.Minute},
+					{Title: "Aside", Start: time.Minute},
+					{Title: "Again", Start: time.Minute},
+					{Title: "Bonus", Start: 11 * time.Minute},
+					{Title: "Outro", Start: 12 * time.Minute, End: 12 * time.Minute},
+				},
+			},
+			expected: []string{
+				`chapter "1:00 Aside" is out of order: it starts before "2:00 Main"`,
+				`chapter "1:00 Aside" has zero length: "1:00 Again" starts at the same time`,
+				`chapter "11:00 Bonus" starts beyond the audio duration 10:00`,
+				`chapter "12:00-12:00 Outro" ends before it starts`,
+				`chapter "12:00-12:00 Outro" starts beyond the audio duration 10:00`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := validateMetadata(tt.metadata, 10*time.Minute)
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("validateMetadata() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIsValidISRC(t *testing.T) {
+	tests := []struct {
+		isrc string
+		want bool
+	}{
+		{"USRC17607839", true},
+		{"US-RC1-76-07839", true},
+		{"usrc17607839", true},
+		{"USRC1760783", false},
+		{"USRC176078391", false},
+		{"USRC 7607839", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isValidISRC(tt.isrc); got != tt.want {
+			t.Errorf("isValidISRC(%q) = %t, want %t", tt.isrc, got, tt.want)
+		}
+	}
+}
+
+func TestIsValidInitialKey(t *testing.T) {
+	for _, key := range []string{"A", "Abm", "C#", "F#m", "Gm", "o"} {
+		if !isValidInitialKey(key) {
+			t.Errorf("isValidInitialKey(%q) = false, want true", key)
+		}
+	}
+	for _, key := range []string{"", "H", "am", "Abmm", "C##", "8A", "Off"} {
+		if isValidInitialKey(key) {
+			t.Errorf("isValidInitialKey(%q) = true, want false", key)
+		}
+	}
+}
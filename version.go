@@ -3,3 +3,8 @@ package chape
 const Version = "0.0.3"
 
 var Revision = "HEAD"
+
+// encoderStamp returns the encoder settings recorded by StampEncoder, e.g. "chape v0.0.3"
+func encoderStamp() string {
+	return "chape v" + Version
+}